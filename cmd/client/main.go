@@ -23,4 +23,5 @@ func main() {
 		BuildCommit:  buildCommit,
 	}
 	client.InitForms().Run(c)
+	c.Close()
 }
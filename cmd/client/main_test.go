@@ -16,11 +16,17 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"sync"
 	"testing"
 )
 
+func TestMain(m *testing.M) {
+	tests.InitTokenKey()
+	os.Exit(m.Run())
+}
+
 func TestFuncClient(t *testing.T) {
 	config := environment.ClientConfig{}
 	t.Run("Checking init config", func(t *testing.T) {
@@ -3,7 +3,10 @@ package main
 
 import (
 	"fmt"
+	"gophkeeper/internal/environment"
 	"gophkeeper/internal/handlers"
+	"log"
+	"os"
 )
 
 var buildVersion = "N/A"
@@ -12,9 +15,32 @@ var buildCommit = "N/A"
 
 // main запуск сервера
 func main() {
-	fmt.Printf("Build version: %s\n", buildVersion)
-	fmt.Printf("Build date: %s\n", buildDate)
-	fmt.Printf("Build commit: %s\n", buildCommit)
+	if !environment.PrintConfigRequested(os.Args[1:]) {
+		fmt.Printf("Build version: %s\n", buildVersion)
+		fmt.Printf("Build date: %s\n", buildDate)
+		fmt.Printf("Build commit: %s\n", buildCommit)
+	}
 
-	handlers.NewServer().Run()
+	if len(os.Args) > 1 && os.Args[1] == "unlock" {
+		if err := handlers.UnlockCommand(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "admin" {
+		if err := handlers.AdminCommand(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "verify-audit" {
+		if err := handlers.VerifyAuditCommand(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	handlers.NewServer(os.Args[1:]).Run()
 }
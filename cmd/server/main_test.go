@@ -4,19 +4,33 @@ import (
 	"context"
 	"gophkeeper/internal/constants"
 	"gophkeeper/internal/cryptography"
+	"gophkeeper/internal/environment"
 	"gophkeeper/internal/handlers"
 	"gophkeeper/internal/postgresql"
 	"gophkeeper/internal/postgresql/model"
+	"gophkeeper/internal/staging"
 	"gophkeeper/internal/tests"
 	"gophkeeper/internal/token"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/google/uuid"
 )
 
+func TestMain(m *testing.M) {
+	tests.InitTokenKey()
+	os.Exit(m.Run())
+}
+
 func TestFuncClient(t *testing.T) {
 
 	srv := &handlers.Server{}
 	t.Run("Checking init config", func(t *testing.T) {
-		srv.InitConfig()
+		srv.InitConfig(nil)
 		if srv.ServerConfig.Address == "" {
 			t.Errorf("Error init config")
 		}
@@ -36,7 +50,7 @@ func TestFuncClient(t *testing.T) {
 		}
 	})
 
-	srv.InListUserData = map[string]model.Appender{}
+	inListUserData := map[string]model.Appender{}
 
 	t.Run("Checking init server", func(t *testing.T) {
 		if srv.ServerConfig.Address == "" {
@@ -71,41 +85,117 @@ func TestFuncClient(t *testing.T) {
 					}
 					t.Run("Checking create user DB user", func(t *testing.T) {
 						user := tests.CreateUser("")
-						err = srv.DBConnector.Update(&user)
+						err = srv.DBConnector.Update(context.Background(), &user)
 						if err != nil {
 							t.Errorf("Error create user DB user")
 						}
 
-						err = srv.DBConnector.CheckAccount(&user)
+						err = srv.DBConnector.CheckAccount(context.Background(), &user)
 						if err != nil {
 							t.Errorf("Error create user DB user")
 						}
 					})
 					t.Run("Checking re-creation user DB user", func(t *testing.T) {
 						user := tests.CreateUser("")
-						err = srv.DBConnector.NewAccount(&user)
+						err = srv.DBConnector.NewAccount(context.Background(), &user)
 						if err == nil {
 							t.Errorf("Error re-creation user DB user")
 						}
 					})
+					t.Run("Checking change password DB user", func(t *testing.T) {
+						user := tests.CreateUser("")
+						user.NewPassword = "new password"
+						err = srv.DBConnector.ChangePassword(context.Background(), &user)
+						if err != nil {
+							t.Errorf("Error change password DB user")
+						}
+
+						user.Password, user.NewPassword = user.NewPassword, user.Password
+						err = srv.DBConnector.ChangePassword(context.Background(), &user)
+						if err != nil {
+							t.Errorf("Error change password DB user")
+						}
+					})
+					t.Run("Checking export DB user", func(t *testing.T) {
+						ctx := context.Background()
+						ctxWV := context.WithValue(ctx, model.KeyContext("user"), strToken)
+						ue, err := srv.DBConnector.ExportAccount(ctxWV)
+						if err != nil || ue.User != "test" {
+							t.Errorf("Error export DB user")
+						}
+					})
+					t.Run("Checking audit DB user", func(t *testing.T) {
+						ctx := context.Background()
+						a := model.AuditRecord{User: "test", Event: constants.AuditLogin, Success: true, Date: time.Now()}
+						err := srv.DBConnector.InsertAudit(context.WithValue(ctx, model.KeyContext("data"), a))
+						if err != nil {
+							t.Errorf("Error insert audit DB user")
+						}
+
+						f := model.AuditFilter{User: "test", To: time.Now(), Limit: 1}
+						arrAudit, err := srv.DBConnector.SelectAudit(context.WithValue(ctx, model.KeyContext("data"), f))
+						if err != nil || len(arrAudit) != 1 || arrAudit[0].Event != constants.AuditLogin {
+							t.Errorf("Error select audit DB user")
+						}
+					})
 					t.Run("Checking delete DB user", func(t *testing.T) {
 						user := tests.CreateUser("")
 						user.HashPassword = cryptography.HashSHA256(user.Password, srv.Key)
-						err = srv.DBConnector.DelAccount(&user)
+						err = srv.DBConnector.DelAccount(context.Background(), &user)
 						if err != nil {
 							t.Errorf("Error delete ping DB")
 						}
 
-						err = srv.DBConnector.CheckAccount(&user)
+						err = srv.DBConnector.CheckAccount(context.Background(), &user)
 						if err == nil {
 							t.Errorf("Error delete user DB user")
 						}
 					})
 
+					t.Run("Checking sessions of account", func(t *testing.T) {
+						body := `{"login":"sessions","password":"password","new_password":"new password"}`
+						request := func(method, path, tokenString string) *httptest.ResponseRecorder {
+							req := httptest.NewRequest(method, path, strings.NewReader(body))
+							req.Header.Set(constants.HeaderAuthorization, tokenString)
+							w := httptest.NewRecorder()
+							srv.Router.ServeHTTP(w, req)
+							return w
+						}
+						newToken := func(path string) string {
+							w := request("POST", path, "")
+							if w.Code != http.StatusOK || w.Header().Get(constants.HeaderAuthorization) == "" {
+								t.Fatalf("Error %s: %d", path, w.Code)
+							}
+							return w.Header().Get(constants.HeaderAuthorization)
+						}
+
+						current := newToken("/api/user/register")
+						other := newToken("/api/user/login")
+						if w := request("POST", "/api/user/password", current); w.Code != http.StatusOK {
+							t.Fatalf("Error change password: %d", w.Code)
+						}
+						if w := request("GET", "/api/resource/text", other); w.Code != http.StatusUnauthorized {
+							t.Errorf("Other session is active after password change: %d", w.Code)
+						}
+						if w := request("GET", "/api/resource/text", current); w.Code == http.StatusUnauthorized {
+							t.Errorf("Current session is revoked after password change")
+						}
+
+						body = `{"login":"sessions","password":"new password"}`
+						if w := request("POST", "/api/user/delete", current); w.Code != http.StatusOK {
+							t.Fatalf("Error delete account: %d", w.Code)
+						}
+						newToken("/api/user/register")
+						if w := request("GET", "/api/resource/text", current); w.Code != http.StatusUnauthorized {
+							t.Errorf("Session of deleted account is active: %d", w.Code)
+						}
+						request("POST", "/api/user/delete", newToken("/api/user/login"))
+					})
+
 					t.Run("Checking Pairs login/password DB", func(t *testing.T) {
 						plp := tests.CreatePairLoginPassword(strToken, "", ck)
 						t.Run("Checking update Pairs login/password DB", func(t *testing.T) {
-							err = srv.DBConnector.Update(&plp)
+							err = srv.DBConnector.Update(context.Background(), &plp)
 							if err != nil {
 								t.Errorf("Error Pairs login/password DB")
 							}
@@ -119,7 +209,7 @@ func TestFuncClient(t *testing.T) {
 							}
 						})
 						t.Run("Checking delete Pairs login/password DB", func(t *testing.T) {
-							err := srv.DBConnector.Delete(&plp)
+							err := srv.DBConnector.Delete(context.Background(), &plp)
 							if err != nil {
 								t.Errorf("Error delete Pairs login/password DB")
 							}
@@ -129,7 +219,7 @@ func TestFuncClient(t *testing.T) {
 					t.Run("Checking Text data DB", func(t *testing.T) {
 						td := tests.CreateTextData(strToken, "", ck)
 						t.Run("Checking update Text data DB", func(t *testing.T) {
-							err = srv.DBConnector.Update(&td)
+							err = srv.DBConnector.Update(context.Background(), &td)
 							if err != nil {
 								t.Errorf("Error update Text data DB")
 							}
@@ -143,7 +233,7 @@ func TestFuncClient(t *testing.T) {
 							}
 						})
 						t.Run("Checking delete Text data DB", func(t *testing.T) {
-							err := srv.DBConnector.Delete(&td)
+							err := srv.DBConnector.Delete(context.Background(), &td)
 							if err != nil {
 								t.Errorf("Error delete Text data DB")
 							}
@@ -153,7 +243,7 @@ func TestFuncClient(t *testing.T) {
 					t.Run("Checking Binary data DB", func(t *testing.T) {
 						bd := tests.CreateBinaryData(strToken, "")
 						t.Run("Checking update Binary data DB", func(t *testing.T) {
-							err = srv.DBConnector.Update(&bd)
+							err = srv.DBConnector.Update(context.Background(), &bd)
 							if err != nil {
 								t.Errorf("Error handlers ping DB")
 							}
@@ -167,7 +257,7 @@ func TestFuncClient(t *testing.T) {
 							}
 						})
 						t.Run("Checking delete Binary data DB", func(t *testing.T) {
-							err := srv.DBConnector.Delete(&bd)
+							err := srv.DBConnector.Delete(context.Background(), &bd)
 							if err != nil {
 								t.Errorf("Error delete text data DB")
 							}
@@ -177,7 +267,7 @@ func TestFuncClient(t *testing.T) {
 					t.Run("Checking Bank data DB", func(t *testing.T) {
 						bd := tests.CreateBankCard(strToken, "", ck)
 						t.Run("Checking update Bank data DB", func(t *testing.T) {
-							err = srv.DBConnector.Update(&bd)
+							err = srv.DBConnector.Update(context.Background(), &bd)
 							if err != nil {
 								t.Errorf("Error update Bank data DB")
 							}
@@ -191,7 +281,7 @@ func TestFuncClient(t *testing.T) {
 							}
 						})
 						t.Run("Checking delete Bank data DB", func(t *testing.T) {
-							err := srv.DBConnector.Delete(&bd)
+							err := srv.DBConnector.Delete(context.Background(), &bd)
 							if err != nil {
 								t.Errorf("Error delete Bank data DB")
 							}
@@ -241,7 +331,7 @@ func TestFuncClient(t *testing.T) {
 		})
 
 		t.Run("Checking delete Pairs login/password DB", func(t *testing.T) {
-			err := srv.DBConnector.Delete(&plp)
+			err := srv.DBConnector.Delete(context.Background(), &plp)
 			if err != nil {
 				t.Errorf("Error delete Pairs login/password DB")
 			}
@@ -269,7 +359,7 @@ func TestFuncClient(t *testing.T) {
 		})
 
 		t.Run("Checking method 'SetFromInListUserData' Pair login/password", func(t *testing.T) {
-			plpInListUserData, ok := srv.InListUserData[constants.TypePairLoginPassword.String()]
+			plpInListUserData, ok := inListUserData[constants.TypePairLoginPassword.String()]
 			if !ok {
 				plpInListUserData = model.Appender{}
 			}
@@ -308,7 +398,7 @@ func TestFuncClient(t *testing.T) {
 		})
 
 		t.Run("Checking delete Text data DB", func(t *testing.T) {
-			err := srv.DBConnector.Delete(&td)
+			err := srv.DBConnector.Delete(context.Background(), &td)
 			if err != nil {
 				t.Errorf("Error delete Text data DB")
 			}
@@ -336,7 +426,7 @@ func TestFuncClient(t *testing.T) {
 		})
 
 		t.Run("Checking method 'SetFromInListUserData' Text data", func(t *testing.T) {
-			plpInListUserData, ok := srv.InListUserData[constants.TypeTextData.String()]
+			plpInListUserData, ok := inListUserData[constants.TypeTextData.String()]
 			if !ok {
 				plpInListUserData = model.Appender{}
 			}
@@ -375,7 +465,7 @@ func TestFuncClient(t *testing.T) {
 		})
 
 		t.Run("Checking delete Binary data DB", func(t *testing.T) {
-			err := srv.DBConnector.Delete(&bd)
+			err := srv.DBConnector.Delete(context.Background(), &bd)
 			if err != nil {
 				t.Errorf("Error delete Binary data DB")
 			}
@@ -403,7 +493,7 @@ func TestFuncClient(t *testing.T) {
 		})
 
 		t.Run("Checking method 'SetFromInListUserData' Binary data", func(t *testing.T) {
-			plpInListUserData, ok := srv.InListUserData[constants.TypeBinaryData.String()]
+			plpInListUserData, ok := inListUserData[constants.TypeBinaryData.String()]
 			if !ok {
 				plpInListUserData = model.Appender{}
 			}
@@ -442,7 +532,7 @@ func TestFuncClient(t *testing.T) {
 		})
 
 		t.Run("Checking delete Bank card DB", func(t *testing.T) {
-			err := srv.DBConnector.Delete(&bc)
+			err := srv.DBConnector.Delete(context.Background(), &bc)
 			if err != nil {
 				t.Errorf("Error delete Bank card DB")
 			}
@@ -470,7 +560,7 @@ func TestFuncClient(t *testing.T) {
 		})
 
 		t.Run("Checking method 'SetFromInListUserData' Bank card", func(t *testing.T) {
-			plpInListUserData, ok := srv.InListUserData[constants.TypeBankCardData.String()]
+			plpInListUserData, ok := inListUserData[constants.TypeBankCardData.String()]
 			if !ok {
 				plpInListUserData = model.Appender{}
 			}
@@ -509,7 +599,7 @@ func TestFuncClient(t *testing.T) {
 		})
 
 		t.Run("Checking method 'SetFromInListUserData' User", func(t *testing.T) {
-			plpInListUserData, ok := srv.InListUserData[constants.TypeUserData.String()]
+			plpInListUserData, ok := inListUserData[constants.TypeUserData.String()]
 			if !ok {
 				plpInListUserData = model.Appender{}
 			}
@@ -522,3 +612,130 @@ func TestFuncClient(t *testing.T) {
 	})
 
 }
+
+// benchConnector соединение с БД для бенчмарков сохранения. Без параметра сеанса DATABASE_URI бенчмарк пропускается
+func benchConnector(b *testing.B) *postgresql.DBConnector {
+	dsn := os.Getenv("DATABASE_URI")
+	if dsn == "" {
+		b.Skip("DATABASE_URI is not set")
+	}
+	dbc, err := postgresql.NewDBConnector(&environment.DBConfig{DatabaseDsn: dsn})
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err = postgresql.CreateModeLDB(dbc.Pool); err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(dbc.Pool.Close)
+	return dbc
+}
+
+// BenchmarkImportRecords сохранение 10 000 записей пользователя, как при импорте:
+// по одной записи (проверка существования и добавление) и пакетами хранилища сервера в одной транзакции
+func BenchmarkImportRecords(b *testing.B) {
+	const records = 10000
+	dbc := benchConnector(b)
+	ctx := context.Background()
+
+	strToken, err := token.NewClaims("bench_import").GenerateJWT()
+	if err != nil {
+		b.Fatal(err)
+	}
+	newRecords := func() []model.Updater {
+		arr := make([]model.Updater, records)
+		for i := range arr {
+			arr[i] = &model.TextData{User: strToken, Uid: uuid.NewString(), Text: "bench text"}
+		}
+		return arr
+	}
+	// записи сохраняются только для существующего пользователя
+	_, _ = dbc.Pool.Exec(ctx, constants.QueryInsertUserTemplate, "bench_import", "bench")
+	b.Cleanup(func() {
+		_, _ = dbc.Pool.Exec(ctx, constants.QueryDelUserTextData, "bench_import")
+		_, _ = dbc.Pool.Exec(ctx, constants.QueryDeleteUserTemplate, "bench_import", "bench")
+	})
+
+	b.Run("PerRecord", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			arr := newRecords()
+			b.StartTimer()
+			for _, u := range arr {
+				if err := dbc.Update(ctx, u); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	b.Run("Batch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			arr := newRecords()
+			b.StartTimer()
+			for len(arr) > 0 {
+				n := len(arr)
+				if n > staging.MaxBatch {
+					n = staging.MaxBatch
+				}
+				ctxVW := context.WithValue(ctx, model.KeyContext("data"), arr[:n])
+				if err := dbc.SaveBatch(ctxVW); err != nil {
+					b.Fatal(err)
+				}
+				arr = arr[n:]
+			}
+		}
+	})
+}
+
+// BenchmarkUploadPortions запись в БД файла размером 1 Гб порциями по constants.Step байт:
+// по одной порции (INSERT) и пачками по constants.CopyPortions порций (COPY)
+func BenchmarkUploadPortions(b *testing.B) {
+	const fileSize = 1 << 30
+	dbc := benchConnector(b)
+	ctx := context.Background()
+
+	body := strings.Repeat("a", constants.Step)
+	uid := uuid.NewString()
+	b.Cleanup(func() {
+		_, _ = dbc.Pool.Exec(ctx, constants.QueryDelPortionsBinaryData, uid)
+	})
+	clean := func(b *testing.B) {
+		b.StopTimer()
+		if _, err := dbc.Pool.Exec(ctx, constants.QueryDelPortionsBinaryData, uid); err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+	}
+
+	b.Run("Insert", func(b *testing.B) {
+		b.SetBytes(fileSize)
+		for i := 0; i < b.N; i++ {
+			for pos := int64(0); pos < fileSize; pos += constants.Step {
+				if _, err := dbc.Pool.Exec(ctx, constants.QueryInsertPortionsBinaryData, uid, pos, body); err != nil {
+					b.Fatal(err)
+				}
+			}
+			clean(b)
+		}
+	})
+
+	b.Run("Copy", func(b *testing.B) {
+		b.SetBytes(fileSize)
+		for i := 0; i < b.N; i++ {
+			arr := make([]model.PortionBinaryData, 0, constants.CopyPortions)
+			for pos := int64(0); pos < fileSize; pos += constants.Step {
+				arr = append(arr, model.PortionBinaryData{Uid: uid, Portion: pos, Body: body})
+				if len(arr) < constants.CopyPortions && pos+constants.Step < fileSize {
+					continue
+				}
+				ctxVW := context.WithValue(ctx, model.KeyContext("data"), arr)
+				if err := dbc.CopyPortionBinaryData(ctxVW); err != nil {
+					b.Fatal(err)
+				}
+				arr = arr[:0]
+			}
+			clean(b)
+		}
+	})
+}
@@ -0,0 +1,172 @@
+// Package auditchain: цепочка хешей журнала аудита и подписанные контрольные точки.
+// Каждая запись журнала хранит хеш предыдущей записи, поэтому изменение или удаление
+// любой записи в БД ломает цепочку. Контрольные точки подписываются ключем сервера ed25519
+package auditchain
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gophkeeper/internal/postgresql/model"
+)
+
+// pemType тип блока PEM для хранения ключа подписи контрольных точек
+const pemType = "GOPHKEEPER AUDIT KEY"
+
+// pemPublicType тип блока PEM для хранения открытого ключа проверки контрольных точек
+const pemPublicType = "GOPHKEEPER AUDIT PUBLIC KEY"
+
+// ErrBrokenLink ошибка целостности цепочки журнала аудита
+var ErrBrokenLink = errors.New("audit chain broken")
+
+// Canonical приводит время записи к виду, в котором оно хранится в БД (точность микросекунды, UTC).
+// Используется перед вычислением хеша, что бы хеш совпадал после чтения записи из БД
+func Canonical(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+// Hash вычисляет хеш записи журнала аудита вместе с хешем предыдущей записи
+func Hash(prevHash string, a model.AuditRecord) string {
+	data, _ := json.Marshal([]interface{}{
+		prevHash, a.User, a.Event, a.Type, a.Uid, a.IP, a.Session, a.Success,
+		Canonical(a.Date).Format(time.RFC3339Nano),
+	})
+
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// checkpointData данные контрольной точки, которые подписываются
+func checkpointData(c model.AuditCheckpoint) []byte {
+	return []byte(fmt.Sprintf("%d|%s|%s", c.AuditID, c.Hash, Canonical(c.Date).Format(time.RFC3339Nano)))
+}
+
+// Sign подписывает контрольную точку ключем сервера
+func Sign(key ed25519.PrivateKey, c model.AuditCheckpoint) string {
+	return hex.EncodeToString(ed25519.Sign(key, checkpointData(c)))
+}
+
+// VerifyCheckpoint проверяет подпись контрольной точки открытым ключем сервера
+func VerifyCheckpoint(pub ed25519.PublicKey, c model.AuditCheckpoint) bool {
+	sig, err := hex.DecodeString(c.Signature)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(pub, checkpointData(c), sig)
+}
+
+// LoadKey читает ключ подписи контрольных точек из файла.
+// Если файла нет, то создает новый ключ и сохраняет его. Открытый ключ для проверки журнала
+// сохраняется в файл PublicKeyFile(path), если его еще нет
+func LoadKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		data = pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: key.Seed()})
+		if err = os.WriteFile(path, data, 0600); err != nil {
+			return nil, err
+		}
+		return key, writePublicKey(path, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != pemType || len(block.Bytes) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid audit key file %s", path)
+	}
+	key := ed25519.NewKeyFromSeed(block.Bytes)
+	return key, writePublicKey(path, key)
+}
+
+// PublicKeyFile имя файла открытого ключа для ключа подписи path
+func PublicKeyFile(path string) string {
+	return path + ".pub"
+}
+
+// writePublicKey сохраняет открытый ключ key в файл PublicKeyFile(path), если файла еще нет
+func writePublicKey(path string, key ed25519.PrivateKey) error {
+	pubFile := PublicKeyFile(path)
+	if _, err := os.Stat(pubFile); !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: pemPublicType, Bytes: key.Public().(ed25519.PublicKey)})
+	return os.WriteFile(pubFile, data, 0644)
+}
+
+// LoadPublicKey читает открытый ключ проверки контрольных точек из файла. Файл ключа подписи не принимается:
+// для проверки журнала закрытый ключ не нужен
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block != nil && block.Type == pemType {
+		return nil, fmt.Errorf("%s is a signing key, use the public key file %s", path, PublicKeyFile(path))
+	}
+	if block == nil || block.Type != pemPublicType || len(block.Bytes) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid audit public key file %s", path)
+	}
+	return ed25519.PublicKey(block.Bytes), nil
+}
+
+// Verifier последовательно проверяет записи журнала аудита в порядке добавления.
+// Записи без хеша в начале журнала (добавленные до включения цепочки) пропускаются
+type Verifier struct {
+	prevHash string
+	started  bool
+	Checked  int
+	Legacy   int
+	Hashes   map[int64]string
+}
+
+// NewVerifier создание проверки цепочки
+func NewVerifier() *Verifier {
+	return &Verifier{Hashes: map[int64]string{}}
+}
+
+// Next проверяет очередную запись журнала. Возвращает ErrBrokenLink с описанием первого разрыва
+func (v *Verifier) Next(a model.AuditRecord) error {
+	if a.Hash == "" && !v.started {
+		v.Legacy++
+		return nil
+	}
+	v.started = true
+
+	if a.PrevHash != v.prevHash {
+		return fmt.Errorf("%w at entry %d: previous hash mismatch", ErrBrokenLink, a.ID)
+	}
+	if Hash(a.PrevHash, a) != a.Hash {
+		return fmt.Errorf("%w at entry %d: entry hash mismatch", ErrBrokenLink, a.ID)
+	}
+
+	v.prevHash = a.Hash
+	v.Hashes[a.ID] = a.Hash
+	v.Checked++
+	return nil
+}
+
+// Checkpoint проверяет подпись контрольной точки и совпадение хеша с записью журнала
+func (v *Verifier) Checkpoint(pub ed25519.PublicKey, c model.AuditCheckpoint) error {
+	if !VerifyCheckpoint(pub, c) {
+		return fmt.Errorf("%w at checkpoint %d: invalid signature", ErrBrokenLink, c.ID)
+	}
+	if h, ok := v.Hashes[c.AuditID]; !ok || h != c.Hash {
+		return fmt.Errorf("%w at checkpoint %d: entry %d does not match", ErrBrokenLink, c.ID, c.AuditID)
+	}
+	return nil
+}
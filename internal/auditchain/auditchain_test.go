@@ -0,0 +1,103 @@
+package auditchain
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gophkeeper/internal/postgresql/model"
+)
+
+func TestAuditChain(t *testing.T) {
+	var arrAudit []model.AuditRecord
+	prevHash := ""
+	for i := 1; i <= 5; i++ {
+		a := model.AuditRecord{
+			ID:       int64(i),
+			User:     "test",
+			Event:    "login",
+			IP:       "127.0.0.1",
+			Success:  true,
+			Date:     Canonical(time.Now()),
+			PrevHash: prevHash,
+		}
+		a.Hash = Hash(prevHash, a)
+		prevHash = a.Hash
+		arrAudit = append(arrAudit, a)
+	}
+
+	t.Run("Checking valid chain", func(t *testing.T) {
+		v := NewVerifier()
+		for _, a := range arrAudit {
+			if err := v.Next(a); err != nil {
+				t.Errorf("Error checking valid chain: %v", err)
+			}
+		}
+		if v.Checked != len(arrAudit) {
+			t.Errorf("Error checking valid chain")
+		}
+	})
+
+	t.Run("Checking edited entry", func(t *testing.T) {
+		v := NewVerifier()
+		edited := append([]model.AuditRecord{}, arrAudit...)
+		edited[2].Success = false
+
+		var err error
+		for _, a := range edited {
+			if err = v.Next(a); err != nil {
+				break
+			}
+		}
+		if !errors.Is(err, ErrBrokenLink) || v.Checked != 2 {
+			t.Errorf("Error checking edited entry: %v", err)
+		}
+	})
+
+	t.Run("Checking deleted entry", func(t *testing.T) {
+		v := NewVerifier()
+		deleted := append(append([]model.AuditRecord{}, arrAudit[:1]...), arrAudit[2:]...)
+
+		var err error
+		for _, a := range deleted {
+			if err = v.Next(a); err != nil {
+				break
+			}
+		}
+		if !errors.Is(err, ErrBrokenLink) {
+			t.Errorf("Error checking deleted entry")
+		}
+	})
+
+	t.Run("Checking checkpoint", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "audit.key")
+		key, err := LoadKey(file)
+		if err != nil {
+			t.Fatalf("Error checking checkpoint: %v", err)
+		}
+		pub, err := LoadPublicKey(PublicKeyFile(file))
+		if err != nil || !pub.Equal(key.Public()) {
+			t.Fatalf("Error checking public key: %v", err)
+		}
+		if _, err = LoadPublicKey(file); err == nil {
+			t.Errorf("Signing key is accepted as public key")
+		}
+
+		v := NewVerifier()
+		for _, a := range arrAudit {
+			_ = v.Next(a)
+		}
+
+		c := model.AuditCheckpoint{ID: 1, AuditID: 5, Hash: arrAudit[4].Hash, Date: time.Now()}
+		c.Signature = Sign(key, c)
+		if err = v.Checkpoint(pub, c); err != nil {
+			t.Errorf("Error checking checkpoint: %v", err)
+		}
+
+		c.Hash = arrAudit[3].Hash
+		if err = v.Checkpoint(pub, c); !errors.Is(err, ErrBrokenLink) {
+			t.Errorf("Error checking forged checkpoint")
+		}
+	})
+}
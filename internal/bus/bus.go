@@ -0,0 +1,141 @@
+// Package bus: шина событий между экземплярами сервера, работающими с одной БД.
+// Экземпляр, у которого изменились данные пользователя, отозвана сессия или устройство, удален пользователь,
+// публикует событие, а все экземпляры (включая его самого) получают его через подписку.
+// Local работает внутри процесса (один экземпляр сервера и тесты), Postgres через LISTEN/NOTIFY
+package bus
+
+import (
+	"context"
+	"sync"
+
+	"gophkeeper/internal/constants"
+)
+
+// Виды событий шины
+const (
+	// KindChanged изменения данных пользователя User сохранены в БД
+	KindChanged = "changed"
+	// KindSessionRevoked отозвана сессия Uid
+	KindSessionRevoked = "session_revoked"
+	// KindDeviceRevoked отозвано устройство Uid
+	KindDeviceRevoked = "device_revoked"
+	// KindUserDeleted удален пользователь User со всеми данными
+	KindUserDeleted = "user_deleted"
+	// KindResync события могли быть пропущены (переподключение к БД): подписчики перечитывают состояние из БД
+	KindResync = "resync"
+)
+
+// subscriberBuffer размер очереди событий подписчика
+const subscriberBuffer = 256
+
+// Event событие шины. Instance УИД экземпляра сервера, опубликовавшего событие
+type Event struct {
+	Kind     string `json:"kind"`
+	User     string `json:"user,omitempty"`
+	Uid      string `json:"uid,omitempty"`
+	Instance string `json:"instance"`
+}
+
+// Bus шина событий. Subscribe возвращает канал событий и функцию отписки, которая закрывает канал
+type Bus interface {
+	Publish(ctx context.Context, ev Event) error
+	Subscribe() (<-chan Event, func())
+	Close() error
+}
+
+// hub рассылка событий подписчикам процесса. Подписчик, который не успевает читать события,
+// пропускает их: вместо пропущенных событий он получает KindResync
+type hub struct {
+	sync.Mutex
+	subs   map[chan Event]bool
+	closed bool
+}
+
+// Subscribe подписка на события
+func (h *hub) Subscribe() (<-chan Event, func()) {
+	h.Lock()
+	defer h.Unlock()
+
+	ch := make(chan Event, subscriberBuffer)
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if h.subs == nil {
+		h.subs = map[chan Event]bool{}
+	}
+	h.subs[ch] = true
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.Lock()
+			defer h.Unlock()
+			if h.subs[ch] {
+				delete(h.subs, ch)
+				close(ch)
+			}
+		})
+	}
+}
+
+// deliver рассылает событие всем подписчикам, не дожидаясь медленных
+func (h *hub) deliver(ev Event) {
+	h.Lock()
+	defer h.Unlock()
+
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+			constants.Logger.Log.Warn().Str("kind", ev.Kind).Msg("bus subscriber is slow, event dropped")
+			h.resync(ch)
+		}
+	}
+}
+
+// resync заменяет самое старое событие в очереди подписчика на KindResync
+func (h *hub) resync(ch chan Event) {
+	select {
+	case <-ch:
+	default:
+	}
+	select {
+	case ch <- Event{Kind: KindResync}:
+	default:
+	}
+}
+
+// close закрывает каналы всех подписчиков
+func (h *hub) close() {
+	h.Lock()
+	defer h.Unlock()
+
+	h.closed = true
+	for ch := range h.subs {
+		close(ch)
+	}
+	h.subs = nil
+}
+
+// Local шина событий внутри процесса
+type Local struct {
+	hub
+}
+
+// NewLocal создание шины событий внутри процесса
+func NewLocal() *Local {
+	return &Local{}
+}
+
+// Publish рассылает событие подписчикам процесса
+func (l *Local) Publish(_ context.Context, ev Event) error {
+	l.deliver(ev)
+	return nil
+}
+
+// Close закрывает подписки
+func (l *Local) Close() error {
+	l.close()
+	return nil
+}
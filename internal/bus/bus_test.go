@@ -0,0 +1,90 @@
+package bus
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// receive событие подписчика или пустое событие, если его нет за секунду
+func receive(ch <-chan Event) (Event, bool) {
+	select {
+	case ev, ok := <-ch:
+		return ev, ok
+	case <-time.After(time.Second):
+		return Event{}, false
+	}
+}
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Checking fan-out", func(t *testing.T) {
+		l := NewLocal()
+		defer l.Close()
+
+		ch1, unsubscribe1 := l.Subscribe()
+		defer unsubscribe1()
+		ch2, unsubscribe2 := l.Subscribe()
+		defer unsubscribe2()
+
+		ev := Event{Kind: KindChanged, User: "user", Instance: "a"}
+		if err := l.Publish(ctx, ev); err != nil {
+			t.Fatal(err)
+		}
+		for _, ch := range []<-chan Event{ch1, ch2} {
+			if got, ok := receive(ch); !ok || got != ev {
+				t.Errorf("Expected %+v, got %+v", ev, got)
+			}
+		}
+	})
+
+	t.Run("Checking unsubscribe", func(t *testing.T) {
+		l := NewLocal()
+		defer l.Close()
+
+		ch, unsubscribe := l.Subscribe()
+		unsubscribe()
+		unsubscribe()
+		_ = l.Publish(ctx, Event{Kind: KindChanged, User: "user"})
+		if _, ok := <-ch; ok {
+			t.Error("Event is delivered after unsubscribe")
+		}
+	})
+
+	t.Run("Checking slow subscriber", func(t *testing.T) {
+		l := NewLocal()
+		defer l.Close()
+
+		ch, unsubscribe := l.Subscribe()
+		defer unsubscribe()
+		for i := 0; i < subscriberBuffer+10; i++ {
+			_ = l.Publish(ctx, Event{Kind: KindChanged, User: "user"})
+		}
+
+		resync := false
+		for i := 0; i < subscriberBuffer; i++ {
+			ev, ok := receive(ch)
+			if !ok {
+				t.Fatal("Expected full queue")
+			}
+			resync = resync || ev.Kind == KindResync
+		}
+		if !resync {
+			t.Error("Expected resync event instead of dropped events")
+		}
+	})
+
+	t.Run("Checking close", func(t *testing.T) {
+		l := NewLocal()
+		ch, _ := l.Subscribe()
+		_ = l.Close()
+		if _, ok := <-ch; ok {
+			t.Error("Channel is not closed")
+		}
+		ch, _ = l.Subscribe()
+		if _, ok := <-ch; ok {
+			t.Error("Subscription after close is open")
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package bus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"gophkeeper/internal/constants"
+)
+
+// reconnectDelay пауза перед повторным подключением слушателя к БД
+const reconnectDelay = time.Second
+
+// Postgres шина событий через LISTEN/NOTIFY PostgreSQL. События публикуются в канал Channel
+// и доставляются подписчикам всех экземпляров, которые слушают этот канал, в том числе опубликовавшему.
+// Слушатель держит отдельное соединение пула. После переподключения подписчики получают KindResync,
+// потому что события за время разрыва потеряны
+type Postgres struct {
+	hub
+	Pool    *pgxpool.Pool
+	Channel string
+}
+
+// NewPostgres создание шины событий в канале channel. Слушатель запускается методом Run
+func NewPostgres(pool *pgxpool.Pool, channel string) *Postgres {
+	return &Postgres{Pool: pool, Channel: channel}
+}
+
+// Publish публикует событие в канал. Событие доставляется после фиксации транзакции публикации
+func (p *Postgres) Publish(ctx context.Context, ev Event) error {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = p.Pool.Exec(ctx, `SELECT pg_notify($1, $2)`, p.Channel, string(payload))
+	return err
+}
+
+// Run горутина слушателя канала. При потере соединения переподключается, пока не закончится ctx
+func (p *Postgres) Run(ctx context.Context) {
+	reconnect := false
+	for {
+		err := p.listen(ctx, reconnect)
+		if ctx.Err() != nil {
+			return
+		}
+		constants.Logger.ErrorLog(err)
+		reconnect = true
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// listen подписывается на канал и доставляет уведомления подписчикам до ошибки соединения
+func (p *Postgres) listen(ctx context.Context, reconnect bool) error {
+	conn, err := p.Pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err = conn.Exec(ctx, "LISTEN "+pgx.Identifier{p.Channel}.Sanitize()); err != nil {
+		return err
+	}
+	defer func() {
+		// соединение возвращается в пул, подписка на канал ему больше не нужна
+		uctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if _, err := conn.Exec(uctx, "UNLISTEN *"); err != nil {
+			_ = conn.Conn().Close(uctx)
+		}
+	}()
+	if reconnect {
+		p.deliver(Event{Kind: KindResync})
+	}
+
+	for {
+		n, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var ev Event
+		if err = json.Unmarshal([]byte(n.Payload), &ev); err != nil || ev.Kind == "" {
+			constants.Logger.ErrorLog(errors.New("bus: invalid notification payload: " + n.Payload))
+			continue
+		}
+		p.deliver(ev)
+	}
+}
+
+// Close закрывает подписки. Слушатель останавливается по контексту Run
+func (p *Postgres) Close() error {
+	p.close()
+	return nil
+}
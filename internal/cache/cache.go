@@ -0,0 +1,250 @@
+// Package cache: кеш записей пользователей, прочитанных из БД, по типам.
+// Записи пользователя читаются из БД при первом обращении, после сохранения изменений в БД кеш обновляется
+// (см. Apply), а при изменениях, о которых известно только то, что они были, записи пользователя
+// сбрасываются (см. Invalidate). Размер кеша ограничен количеством пользователей и записей,
+// при превышении вытесняются давно прочитанные пользователи.
+// Закешированные наборы записей не изменяются: Apply заменяет набор новым, поэтому Get отдает набор без копирования
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+
+	"gophkeeper/internal/postgresql/model"
+)
+
+// Значения по умолчанию наибольшего количества пользователей и записей в кеше
+const (
+	DefaultUsers   = 10000
+	DefaultRecords = 1000000
+)
+
+// Ticket отметка промаха кеша. Прочитанные из БД записи кладутся в кеш (см. Fill), только если записи
+// пользователя не менялись после промаха: иначе в кеш мог бы попасть набор, прочитанный до сохранения изменений
+type Ticket struct {
+	user string
+	gen  uint64
+}
+
+// Stats статистика кеша: попадания, промахи, вытеснения пользователей, пользователи и записи в кеше
+type Stats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Users     int
+	Records   int
+}
+
+// entry записи пользователя user по типам. gen номер версии записей пользователя, records количество записей
+type entry struct {
+	user    string
+	types   map[string]model.Appender
+	gen     uint64
+	records int
+}
+
+// Cache кеш записей пользователей. Порядок lru от недавно прочитанных пользователей к давно прочитанным
+type Cache struct {
+	mu       sync.Mutex
+	users    map[string]*list.Element
+	lru      *list.List
+	gen      uint64
+	records  int
+	maxUsers int
+	maxRecs  int
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+// New создание кеша не более чем на users пользователей и records записей.
+// Нулевые или отрицательные значения заменяются значениями по умолчанию
+func New(users, records int) *Cache {
+	if users <= 0 {
+		users = DefaultUsers
+	}
+	if records <= 0 {
+		records = DefaultRecords
+	}
+	return &Cache{users: map[string]*list.Element{}, lru: list.New(), maxUsers: users, maxRecs: records}
+}
+
+// Get записи пользователя user типа t. При промахе возвращает отметку, с которой прочитанные из БД записи
+// передаются в Fill. Возвращенный набор записей нельзя изменять
+func (c *Cache) Get(user, t string) (model.Appender, Ticket, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el := c.entry(user)
+	e := el.Value.(*entry)
+	c.lru.MoveToFront(el)
+	if app, ok := e.types[t]; ok {
+		c.hits.Add(1)
+		return app, Ticket{}, true
+	}
+	c.misses.Add(1)
+	return nil, Ticket{user: user, gen: e.gen}, false
+}
+
+// Fill кладет в кеш записи app пользователя типа t, прочитанные из БД после промаха с отметкой tk.
+// Если записи пользователя менялись после промаха или пользователь вытеснен, то записи не кладутся.
+// После Fill набор app нельзя изменять
+func (c *Cache) Fill(tk Ticket, t string, app model.Appender) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.users[tk.user]
+	if !ok || len(app) > c.maxRecs {
+		return
+	}
+	e := el.Value.(*entry)
+	if e.gen != tk.gen {
+		return
+	}
+	c.set(e, t, app)
+	c.evict(el)
+}
+
+// Apply обновляет закешированные записи пользователя user типа t после сохранения изменений в БД.
+// changes записи по УИДу, nil - запись удалена. Если записи типа не закешированы, то только отменяет
+// помещение в кеш записей, которые читаются из БД в это время
+func (c *Cache) Apply(user, t string, changes map[string]model.Updater) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.users[user]
+	if !ok {
+		return
+	}
+	e := el.Value.(*entry)
+	c.bump(e)
+	old, ok := e.types[t]
+	if !ok {
+		return
+	}
+
+	app := make(model.Appender, len(old)+len(changes))
+	for uid, v := range old {
+		app[uid] = v
+	}
+	for uid, v := range changes {
+		if v == nil {
+			delete(app, uid)
+			continue
+		}
+		app[uid] = v
+	}
+	if len(app) > c.maxRecs {
+		c.set(e, t, nil)
+		return
+	}
+	c.set(e, t, app)
+	c.evict(el)
+}
+
+// Invalidate сбрасывает записи пользователя user: следующее чтение пойдет в БД
+func (c *Cache) Invalidate(user string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.users[user]; ok {
+		e := el.Value.(*entry)
+		c.bump(e)
+		for t := range e.types {
+			c.set(e, t, nil)
+		}
+	}
+}
+
+// Remove удаляет пользователя user из кеша (пользователь удален)
+func (c *Cache) Remove(user string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.users[user]; ok {
+		c.remove(el)
+	}
+}
+
+// Clear сбрасывает записи всех пользователей
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for el := c.lru.Front(); el != nil; el = c.lru.Front() {
+		c.remove(el)
+	}
+}
+
+// Stats статистика кеша
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	users, records := len(c.users), c.records
+	c.mu.Unlock()
+
+	return Stats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Users:     users,
+		Records:   records,
+	}
+}
+
+// entry элемент пользователя user. Если пользователя нет, то создает его пустым
+func (c *Cache) entry(user string) *list.Element {
+	if el, ok := c.users[user]; ok {
+		return el
+	}
+	c.gen++
+	el := c.lru.PushFront(&entry{user: user, types: map[string]model.Appender{}, gen: c.gen})
+	c.users[user] = el
+	c.evict(el)
+	return el
+}
+
+// bump новая версия записей пользователя: отметки промахов до нее становятся недействительными
+func (c *Cache) bump(e *entry) {
+	c.gen++
+	e.gen = c.gen
+}
+
+// set заменяет записи пользователя типа t, nil удаляет их из кеша
+func (c *Cache) set(e *entry, t string, app model.Appender) {
+	n := len(e.types[t])
+	e.records -= n
+	c.records -= n
+	if app == nil {
+		delete(e.types, t)
+		return
+	}
+	e.types[t] = app
+	e.records += len(app)
+	c.records += len(app)
+}
+
+// evict вытесняет давно прочитанных пользователей, пока кеш не уложится в ограничения.
+// Пользователь keep не вытесняется
+func (c *Cache) evict(keep *list.Element) {
+	for len(c.users) > c.maxUsers || c.records > c.maxRecs {
+		el := c.lru.Back()
+		if el == keep {
+			el = el.Prev()
+		}
+		if el == nil {
+			return
+		}
+		c.remove(el)
+		c.evictions.Add(1)
+	}
+}
+
+// remove удаляет элемент пользователя
+func (c *Cache) remove(el *list.Element) {
+	e := el.Value.(*entry)
+	c.records -= e.records
+	delete(c.users, e.user)
+	c.lru.Remove(el)
+}
@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+
+	"gophkeeper/internal/postgresql/model"
+)
+
+// records набор из n текстовых записей
+func records(n int) model.Appender {
+	app := model.Appender{}
+	for i := 0; i < n; i++ {
+		uid := strconv.Itoa(i)
+		app[uid] = &model.TextData{Uid: uid}
+	}
+	return app
+}
+
+func TestCache(t *testing.T) {
+	t.Run("Checking miss and hit", func(t *testing.T) {
+		c := New(10, 100)
+		_, tk, ok := c.Get("user", "text")
+		if ok {
+			t.Fatal("Empty cache hit")
+		}
+		c.Fill(tk, "text", records(2))
+		app, _, ok := c.Get("user", "text")
+		if !ok || len(app) != 2 {
+			t.Errorf("Expected 2 cached records, got %v", app)
+		}
+		if _, _, ok = c.Get("user", "card"); ok {
+			t.Error("Other type is cached")
+		}
+		st := c.Stats()
+		if st.Hits != 1 || st.Misses != 2 || st.Records != 2 {
+			t.Errorf("Error counting stats: %+v", st)
+		}
+	})
+
+	t.Run("Checking apply", func(t *testing.T) {
+		c := New(10, 100)
+		_, tk, _ := c.Get("user", "text")
+		c.Fill(tk, "text", records(2))
+		before, _, _ := c.Get("user", "text")
+
+		c.Apply("user", "text", map[string]model.Updater{"0": nil, "5": &model.TextData{Uid: "5", Text: "new"}})
+		app, _, ok := c.Get("user", "text")
+		if !ok || len(app) != 2 || app["0"] != nil || app["5"].(*model.TextData).Text != "new" {
+			t.Errorf("Error applying changes: %v", app)
+		}
+		if len(before) != 2 || before["0"] == nil {
+			t.Error("Returned records are changed")
+		}
+	})
+
+	t.Run("Checking stale fill", func(t *testing.T) {
+		c := New(10, 100)
+		_, tk, _ := c.Get("user", "text")
+		c.Apply("user", "text", map[string]model.Updater{"1": &model.TextData{Uid: "1"}})
+		c.Fill(tk, "text", records(1))
+		if _, _, ok := c.Get("user", "text"); ok {
+			t.Error("Records read before change are cached")
+		}
+
+		_, tk, _ = c.Get("other", "text")
+		c.Remove("other")
+		_, _, _ = c.Get("other", "card")
+		c.Fill(tk, "text", records(1))
+		if _, _, ok := c.Get("other", "text"); ok {
+			t.Error("Records read before remove are cached")
+		}
+	})
+
+	t.Run("Checking invalidate and clear", func(t *testing.T) {
+		c := New(10, 100)
+		for _, user := range []string{"user", "other"} {
+			_, tk, _ := c.Get(user, "text")
+			c.Fill(tk, "text", records(3))
+		}
+		c.Invalidate("user")
+		if _, _, ok := c.Get("user", "text"); ok {
+			t.Error("Records are not invalidated")
+		}
+		if st := c.Stats(); st.Records != 3 {
+			t.Errorf("Expected 3 records, got %d", st.Records)
+		}
+		c.Clear()
+		if st := c.Stats(); st.Users != 0 || st.Records != 0 {
+			t.Errorf("Cache is not cleared: %+v", st)
+		}
+	})
+
+	t.Run("Checking eviction", func(t *testing.T) {
+		c := New(2, 10)
+		for _, user := range []string{"a", "b"} {
+			_, tk, _ := c.Get(user, "text")
+			c.Fill(tk, "text", records(4))
+		}
+		_, _, _ = c.Get("a", "text")
+
+		_, tk, _ := c.Get("c", "text")
+		c.Fill(tk, "text", records(4))
+		if _, _, ok := c.Get("b", "text"); ok {
+			t.Error("Least recently used user is not evicted")
+		}
+		if _, _, ok := c.Get("c", "text"); !ok {
+			t.Error("New user is evicted")
+		}
+
+		_, tk, _ = c.Get("big", "text")
+		c.Fill(tk, "text", records(11))
+		if _, _, ok := c.Get("big", "text"); ok {
+			t.Error("Records over the limit are cached")
+		}
+		if st := c.Stats(); st.Users > 2 || st.Records > 10 || st.Evictions == 0 {
+			t.Errorf("Error checking limits: %+v", st)
+		}
+	})
+}
+
+// BenchmarkGet чтение закешированных записей параллельно
+func BenchmarkGet(b *testing.B) {
+	c := New(0, 0)
+	for i := 0; i < 100; i++ {
+		user := "user" + strconv.Itoa(i)
+		_, tk, _ := c.Get(user, "text")
+		c.Fill(tk, "text", records(100))
+	}
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			i++
+			if _, _, ok := c.Get("user"+strconv.Itoa(i%100), "text"); !ok {
+				b.Fatal("cache miss")
+			}
+		}
+	})
+}
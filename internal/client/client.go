@@ -2,9 +2,20 @@
 package client
 
 import (
+	"context"
+	"fmt"
+	"gophkeeper/internal/compression"
 	"gophkeeper/internal/environment"
 	"gophkeeper/internal/postgresql"
 	"gophkeeper/internal/postgresql/model"
+	"gophkeeper/internal/tlsutil"
+	"gophkeeper/internal/tracing"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 // ListUserData Список данных пользователя. Заполняется горутиной, котрая запускается
@@ -32,6 +43,17 @@ type Client struct {
 	AuthorizedUser
 	DataList ListUserData
 	BuildInfo
+
+	// quota использование квот пользователя. Пишет горутина refreshQuota, читает горутина окна программы,
+	// поэтому обращение только через setQuota и quotaUsage
+	quotaMu sync.Mutex
+	quota   model.QuotaUsage
+
+	HTTPClient *http.Client
+	Dialer     *websocket.Dialer
+
+	traceShutdown tracing.ShutdownFunc
+	encoding      compression.Remote
 }
 
 // NewClient Создание и заполнение клиента.
@@ -44,6 +66,119 @@ func NewClient() *Client {
 		DataList:       ListUserData{},
 		BuildInfo:      BuildInfo{},
 	}
+	if err := c.InitTransport(); err != nil {
+		log.Fatal(err)
+	}
+	if err := c.InitTracing(); err != nil {
+		log.Fatal(err)
+	}
 
 	return &c
 }
+
+// InitTracing инициализация трассировки клиента по конфигурации: экспортер, адрес коллектора и файл
+func (c *Client) InitTracing() error {
+	shutdown, err := tracing.Init(tracing.Config{
+		Exporter: c.Config.Trace.Exporter,
+		Endpoint: c.Config.Trace.Endpoint,
+		File:     c.Config.Trace.File,
+		Service:  "gophkeeper-client",
+	})
+	if err != nil {
+		return err
+	}
+	c.traceShutdown = shutdown
+	return nil
+}
+
+// Close отправляет оставшиеся данные трассировки. Вызывается при выходе из клиента
+func (c *Client) Close() {
+	if c.traceShutdown == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = c.traceShutdown(ctx)
+}
+
+// InitTransport инициализация HTTP клиента и websocket dialer с проверкой сертификата сервера.
+// Запросы HTTP клиента трассируются
+func (c *Client) InitTransport() error {
+	if c.Config.AllowPlaintext {
+		c.HTTPClient = &http.Client{Transport: tracing.Transport(nil)}
+		c.Dialer = websocket.DefaultDialer
+		return nil
+	}
+
+	cfg, err := tlsutil.ClientConfig(c.Config.Address, tlsutil.ClientOptions{
+		Pin:        c.Config.TLSPin,
+		CAFile:     c.Config.TLSCA,
+		KnownHosts: c.Config.KnownHosts,
+		CertFile:   c.Config.DeviceCert,
+		KeyFile:    c.Config.DeviceKey,
+	})
+	if err != nil {
+		return err
+	}
+
+	c.HTTPClient = &http.Client{Transport: tracing.Transport(&http.Transport{TLSClientConfig: cfg})}
+	c.Dialer = &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: websocket.DefaultDialer.HandshakeTimeout,
+		TLSClientConfig:  cfg,
+	}
+	return nil
+}
+
+// apiURL адрес метода API сервера. Без TLS запросы отправляются только если это явно разрешено
+func (c *Client) apiURL(path string) string {
+	if c.Config.AllowPlaintext {
+		return fmt.Sprintf("http://%s%s", c.Config.Address, path)
+	}
+	return fmt.Sprintf("https://%s%s", c.Config.Address, path)
+}
+
+// wsURL адрес websocket сервера
+func (c *Client) wsURL(path string) string {
+	if c.Config.AllowPlaintext {
+		return fmt.Sprintf("ws://%s%s", c.Config.Address, path)
+	}
+	return fmt.Sprintf("wss://%s%s", c.Config.Address, path)
+}
+
+// httpClient HTTP клиент для запросов к серверу
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return &http.Client{Transport: tracing.Transport(nil)}
+	}
+	return c.HTTPClient
+}
+
+// do отправляет запрос на сервер (см. doRequest)
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	return doRequest(c.httpClient(), &c.encoding, req)
+}
+
+// doRequest отправляет запрос клиентом client с просьбой сжать ответ (zstd или gzip) и распаковывает ответ.
+// Способ сжатия тел запросов, которые принимает сервер, запоминается в remote
+func doRequest(client *http.Client, remote *compression.Remote, req *http.Request) (*http.Response, error) {
+	req.Header.Set("Accept-Encoding", compression.AcceptEncoding)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	remote.Update(resp.Header.Get("Accept-Encoding"))
+	if err = compression.DecodeResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// dialer websocket dialer для подключения к серверу
+func (c *Client) dialer() *websocket.Dialer {
+	if c.Dialer == nil {
+		return websocket.DefaultDialer
+	}
+	return c.Dialer
+}
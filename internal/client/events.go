@@ -7,13 +7,17 @@ import (
 	"errors"
 	"fmt"
 	"gophkeeper/internal/postgresql/model"
+	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 
 	"gophkeeper/internal/compression"
 	"gophkeeper/internal/constants"
 	"gophkeeper/internal/constants/errs"
 	"gophkeeper/internal/encryption"
+	"gophkeeper/internal/tlsutil"
+	"gophkeeper/internal/tracing"
 )
 
 // additionalBinaryParameters структура для переноса данных по файлу в websocket загрузки и скачки
@@ -46,13 +50,14 @@ func (c *Client) downloadBinaryData(bd model.BinaryData) error {
 // inputLoginUser событие формы, позволяет залогинится пользователю. Проверяется по имени и хешу пароля
 func (c *Client) inputLoginUser(user model.User) error {
 
-	addressPost := fmt.Sprintf("http://%s/api/user/login", c.Config.Address) //a.cfg.Address)
+	addressPost := c.apiURL("/api/user/login")
 	arrJSON, err := json.MarshalIndent(user, "", " ")
 	if err != nil {
 		return err
 	}
 
-	compressJSON, err := compression.Compress(arrJSON)
+	encoding := c.encoding.Encoding()
+	compressJSON, err := compression.Encode(encoding, arrJSON)
 	if err != nil {
 		constants.Logger.ErrorLog(err)
 		return err
@@ -64,42 +69,50 @@ func (c *Client) inputLoginUser(user model.User) error {
 		return errors.New("-- ошибка отправки данных на сервер (1)")
 	}
 
-	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Content-Encoding", encoding)
 	req.Header.Set("Content-Type", "application/json")
+	c.setDeviceHeaders(req)
 	defer req.Body.Close()
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		constants.Logger.ErrorLog(err)
 		return errors.New("-- ошибка отправки данных на сервер (2)")
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return errs.ErrInvalidLoginPassword
+	if err = errs.FromResponse(resp); err != nil {
+		return err
 	}
 
 	c.AuthorizedUser.User = user
 	c.AuthorizedUser.Token = resp.Header.Get(constants.HeaderAuthorization)
 
+	enrolled, err := c.enrollDevice(user.Password)
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+	}
+	if enrolled {
+		return c.inputLoginUser(user)
+	}
+
 	return nil
 }
 
 // inputPairLoginPassword событие формы, которое работает данными типа "пары логин/пароль"
 func (c *Client) inputPairLoginPassword(plp model.PairLoginPassword) error {
-	addressPost := fmt.Sprintf("http://%s/api/resource/pairs", c.Config.Address) //a.cfg.Address)
+	addressPost := c.apiURL("/api/resource/pairs")
 	plpJSON, err := json.MarshalIndent(plp, "", " ")
 	if err != nil {
 		return err
 	}
-	_, err = ExecuteAPI(plpJSON, addressPost, c.Token)
+	_, err = c.executeAPI(plpJSON, addressPost)
 	return err
 }
 
 // inputTextData событие формы, которое работают с данными типа "произвольные текстовые данные"
 func (c *Client) inputTextData(td model.TextData) error {
-	addressPost := fmt.Sprintf("http://%s/api/resource/text", c.Config.Address) //a.cfg.Address)
+	addressPost := c.apiURL("/api/resource/text")
 
 	td.Text = encryption.EncryptString(td.Text, c.Config.CryptoKey)
 	tdJSON, err := json.MarshalIndent(td, "", " ")
@@ -107,20 +120,23 @@ func (c *Client) inputTextData(td model.TextData) error {
 		return err
 	}
 
-	_, err = ExecuteAPI(tdJSON, addressPost, c.Token)
+	_, err = c.executeAPI(tdJSON, addressPost)
 	return err
 }
 
 // inputBinaryData событие формы, которое работают с данными типа "произвольные бинарные данные"
 func (c *Client) inputBinaryData(bd model.BinaryData) error {
-	addressPost := fmt.Sprintf("http://%s/api/resource/binary", c.Config.Address) //a.cfg.Address)
+	addressPost := c.apiURL("/api/resource/binary")
 
 	bdJSON, err := json.MarshalIndent(bd, "", " ")
 	if err != nil {
 		return err
 	}
 
-	_, err = ExecuteAPI(bdJSON, addressPost, c.Token)
+	// при превышении квоты сервер не принимает файл, порции не передаются
+	if _, err = c.executeAPI(bdJSON, addressPost); err != nil {
+		return err
+	}
 
 	if bd.Event != constants.EventDel.String() {
 		ctx := context.Background()
@@ -136,7 +152,7 @@ func (c *Client) inputBinaryData(bd model.BinaryData) error {
 
 // inputBankCard событие формы, которое работают с данными типа "данные банковских карт"
 func (c *Client) inputBankCard(bc model.BankCard) error {
-	addressPost := fmt.Sprintf("http://%s/api/resource/card", c.Config.Address)
+	addressPost := c.apiURL("/api/resource/card")
 
 	bc.Number = encryption.EncryptString(bc.Number, c.Config.CryptoKey)
 	bc.Cvc = encryption.EncryptString(bc.Cvc, c.Config.CryptoKey)
@@ -146,21 +162,22 @@ func (c *Client) inputBankCard(bc model.BankCard) error {
 		return err
 	}
 
-	_, err = ExecuteAPI(bcJSON, addressPost, c.Token)
+	_, err = c.executeAPI(bcJSON, addressPost)
 	return err
 }
 
 // inputBankCard событие формы, которое работает с регистрацией нового пользователя
 func (c *Client) registerNewUser(user model.User) error {
 
-	addressPost := fmt.Sprintf("http://%s/api/user/register", c.Config.Address) //a.cfg.Address)
+	addressPost := c.apiURL("/api/user/register")
 
 	arrJSON, err := json.MarshalIndent(user, "", " ")
 	if err != nil {
 		return err
 	}
 
-	compressJSON, err := compression.Compress(arrJSON)
+	encoding := c.encoding.Encoding()
+	compressJSON, err := compression.Encode(encoding, arrJSON)
 	if err != nil {
 		constants.Logger.ErrorLog(err)
 		return err
@@ -173,31 +190,50 @@ func (c *Client) registerNewUser(user model.User) error {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Content-Encoding", encoding)
+	c.setDeviceHeaders(req)
 	defer req.Body.Close()
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		constants.Logger.ErrorLog(err)
 		return errors.New("-- ошибка отправки данных на сервер (2)")
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return errs.ErrInvalidLoginPassword
+	if err = errs.FromResponse(resp); err != nil {
+		return err
 	}
 
 	c.AuthorizedUser.User = user
 	c.AuthorizedUser.Token = resp.Header.Get(constants.HeaderAuthorization)
 
-	return err
+	enrolled, err := c.enrollDevice(user.Password)
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+	}
+	if enrolled {
+		return c.inputLoginUser(user)
+	}
+
+	return nil
 }
 
 // ExecuteAPI общая фукция, которая сжимает в gzip, заполняет токены и отправляет на сервер данные,
 // с которыми нужно произсести действия
 func ExecuteAPI(bJSON []byte, addressPost, token string) (*http.Response, error) {
-	compressJSON, err := compression.Compress(bJSON)
+	return executeAPI(&http.Client{Transport: tracing.Transport(nil)}, &compression.Remote{}, bJSON, addressPost, token)
+}
+
+// executeAPI отправка данных на сервер через HTTP клиент текущего пользователя. Данные сжимаются способом,
+// который принимает сервер
+func (c *Client) executeAPI(bJSON []byte, addressPost string) (*http.Response, error) {
+	return executeAPI(c.httpClient(), &c.encoding, bJSON, addressPost, c.Token)
+}
+
+func executeAPI(client *http.Client, remote *compression.Remote, bJSON []byte, addressPost, token string) (*http.Response, error) {
+	encoding := remote.Encoding()
+	compressJSON, err := compression.Encode(encoding, bJSON)
 	if err != nil {
 		constants.Logger.ErrorLog(err)
 		return nil, err
@@ -212,20 +248,332 @@ func ExecuteAPI(bJSON []byte, addressPost, token string) (*http.Response, error)
 
 	req.Header.Set("Authorization", token)
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Content-Encoding", encoding)
 	defer req.Body.Close()
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := doRequest(client, remote, req)
 	if err != nil {
 		constants.Logger.ErrorLog(err)
 		return nil, errors.New("-- ошибка отправки данных на сервер")
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, errs.ErrInvalidLoginPassword
+	if err = errs.FromResponse(resp); err != nil {
+		return nil, err
 	}
 
 	return resp, nil
 }
+
+// changeUserPassword событие формы, которое меняет пароль текущего пользователя.
+// Сервер повторно проверяет текущий пароль перед сменой
+func (c *Client) changeUserPassword(user model.User) error {
+	addressPost := c.apiURL("/api/user/password")
+
+	user.Name = c.User.Name
+	arrJSON, err := json.MarshalIndent(user, "", " ")
+	if err != nil {
+		return err
+	}
+
+	if _, err = c.executeAPI(arrJSON, addressPost); err != nil {
+		return err
+	}
+
+	c.AuthorizedUser.User.Password = user.NewPassword
+	return nil
+}
+
+// deleteUserAccount событие формы, которое удаляет экаунт текущего пользователя со всеми данными.
+// После удаления пользователь разлогинивается
+func (c *Client) deleteUserAccount(user model.User) error {
+	addressPost := c.apiURL("/api/user/delete")
+
+	user.Name = c.User.Name
+	arrJSON, err := json.MarshalIndent(user, "", " ")
+	if err != nil {
+		return err
+	}
+
+	if _, err = c.executeAPI(arrJSON, addressPost); err != nil {
+		return err
+	}
+
+	c.AuthorizedUser = AuthorizedUser{}
+	c.DataList = ListUserData{}
+	return nil
+}
+
+// exportUserData событие формы, которое выгружает все данные пользователя с сервера в файл JSON.
+// Данные остаются зашифрованными ключем клиента
+func (c *Client) exportUserData(patch string) error {
+	addressGet := c.apiURL("/api/user/export")
+
+	req, err := http.NewRequest("GET", addressGet, nil)
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+		return errors.New("-- ошибка отправки данных на сервер (1)")
+	}
+	req.Header.Set("Authorization", c.Token)
+
+	resp, err := c.do(req)
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+		return errors.New("-- ошибка отправки данных на сервер (2)")
+	}
+	defer resp.Body.Close()
+
+	if err = errs.FromResponse(resp); err != nil {
+		return err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(patch, body, 0600)
+}
+
+// setDeviceHeaders заполняет хедеры с именем устройства и версией сборки клиента.
+// Сервер сохраняет их в сессии пользователя
+func (c *Client) setDeviceHeaders(req *http.Request) {
+	device, err := os.Hostname()
+	if err != nil {
+		device = "unknown"
+	}
+	req.Header.Set(constants.HeaderDeviceName, device)
+	req.Header.Set(constants.HeaderClientBuild, fmt.Sprintf("%s (%s, %s)", c.BuildVersion, c.BuildDate, c.BuildCommit))
+}
+
+// selectQuota получает с сервера квоты текущего пользователя и их использование
+func (c *Client) selectQuota() (model.QuotaUsage, error) {
+	qu := model.QuotaUsage{}
+
+	req, err := http.NewRequest("GET", c.apiURL("/api/user/quota"), nil)
+	if err != nil {
+		return qu, err
+	}
+	req.Header.Set("Authorization", c.Token)
+
+	resp, err := c.do(req)
+	if err != nil {
+		return qu, err
+	}
+	defer resp.Body.Close()
+
+	if err = errs.FromResponse(resp); err != nil {
+		return qu, err
+	}
+	err = json.NewDecoder(resp.Body).Decode(&qu)
+	return qu, err
+}
+
+// selectSessions получает с сервера список активных сессий текущего пользователя
+func (c *Client) selectSessions() ([]model.Session, error) {
+	addressGet := c.apiURL("/api/user/sessions")
+
+	req, err := http.NewRequest("GET", addressGet, nil)
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+		return nil, errors.New("-- ошибка отправки данных на сервер (1)")
+	}
+	req.Header.Set("Authorization", c.Token)
+
+	resp, err := c.do(req)
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+		return nil, errors.New("-- ошибка отправки данных на сервер (2)")
+	}
+	defer resp.Body.Close()
+
+	if err = errs.FromResponse(resp); err != nil {
+		return nil, err
+	}
+
+	var arrSession []model.Session
+	if err = json.NewDecoder(resp.Body).Decode(&arrSession); err != nil {
+		return nil, err
+	}
+
+	return arrSession, nil
+}
+
+// revokeSession событие формы, которое отзывает сессию текущего пользователя по УИДу.
+// Если отзывается текущая сессия, то пользователь разлогинивается
+func (c *Client) revokeSession(s model.Session) error {
+	addressPost := c.apiURL("/api/user/sessions/revoke")
+
+	arrJSON, err := json.MarshalIndent(s, "", " ")
+	if err != nil {
+		return err
+	}
+
+	if _, err = c.executeAPI(arrJSON, addressPost); err != nil {
+		return err
+	}
+
+	if s.Current {
+		c.AuthorizedUser = AuthorizedUser{}
+		c.DataList = ListUserData{}
+	}
+	return nil
+}
+
+// selectAudit получает с сервера журнал аудита текущего пользователя.
+// Если format = "jsonl", то журнал возвращается в формате JSON lines
+func (c *Client) selectAudit(format string) ([]byte, error) {
+	addressGet := c.apiURL("/api/user/audit?format=" + format)
+
+	req, err := http.NewRequest("GET", addressGet, nil)
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+		return nil, errors.New("-- ошибка отправки данных на сервер (1)")
+	}
+	req.Header.Set("Authorization", c.Token)
+
+	resp, err := c.do(req)
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+		return nil, errors.New("-- ошибка отправки данных на сервер (2)")
+	}
+	defer resp.Body.Close()
+
+	if err = errs.FromResponse(resp); err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// exportAudit событие формы, которое сохраняет журнал аудита пользователя в файл в формате JSON lines
+func (c *Client) exportAudit(patch string) error {
+	body, err := c.selectAudit("jsonl")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(patch, body, 0600)
+}
+
+// enrollDevice выпуск сертификата устройства после входа, если сертификата еще нет.
+// Ключ устройства создается на клиенте, на сервер отправляется только запрос на сертификат.
+// Если сервер не проверяет устройства, то сертификат не выпускается. Возвращает true, если сертификат выпущен
+func (c *Client) enrollDevice(password string) (bool, error) {
+	if c.Config.AllowPlaintext || c.Config.DeviceCert == "" || c.Config.DeviceKey == "" {
+		return false, nil
+	}
+	if _, err := os.Stat(c.Config.DeviceCert); err == nil {
+		return false, nil
+	}
+
+	keyPEM, csrPEM, err := tlsutil.NewDeviceKey(c.User.Name)
+	if err != nil {
+		return false, err
+	}
+	device, err := os.Hostname()
+	if err != nil {
+		device = "unknown"
+	}
+
+	arrJSON, err := json.MarshalIndent(model.DeviceEnrollment{
+		Password: password,
+		Name:     device,
+		CSR:      string(csrPEM),
+	}, "", " ")
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequest("POST", c.apiURL("/api/user/devices/enroll"), bytes.NewReader(arrJSON))
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+		return false, errors.New("-- ошибка отправки данных на сервер (1)")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", c.Token)
+
+	resp, err := c.do(req)
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+		return false, errors.New("-- ошибка отправки данных на сервер (2)")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err = errs.FromResponse(resp); err != nil {
+		return false, err
+	}
+
+	dc := model.DeviceCertificate{}
+	if err = json.NewDecoder(resp.Body).Decode(&dc); err != nil {
+		return false, err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(c.Config.DeviceKey), 0700); err != nil {
+		return false, err
+	}
+	if err = os.WriteFile(c.Config.DeviceKey, keyPEM, 0600); err != nil {
+		return false, err
+	}
+	if err = os.MkdirAll(filepath.Dir(c.Config.DeviceCert), 0700); err != nil {
+		return false, err
+	}
+	if err = os.WriteFile(c.Config.DeviceCert, []byte(dc.Certificate), 0644); err != nil {
+		return false, err
+	}
+
+	return true, c.InitTransport()
+}
+
+// selectDevices получает с сервера список действующих устройств текущего пользователя
+func (c *Client) selectDevices() ([]model.Device, error) {
+	req, err := http.NewRequest("GET", c.apiURL("/api/user/devices"), nil)
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+		return nil, errors.New("-- ошибка отправки данных на сервер (1)")
+	}
+	req.Header.Set("Authorization", c.Token)
+
+	resp, err := c.do(req)
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+		return nil, errors.New("-- ошибка отправки данных на сервер (2)")
+	}
+	defer resp.Body.Close()
+
+	if err = errs.FromResponse(resp); err != nil {
+		return nil, err
+	}
+
+	var arrDevice []model.Device
+	if err = json.NewDecoder(resp.Body).Decode(&arrDevice); err != nil {
+		return nil, err
+	}
+
+	return arrDevice, nil
+}
+
+// revokeDevice событие формы, которое отзывает устройство текущего пользователя и его сертификат.
+// Если отзывается текущее устройство, то сертификат удаляется и пользователь разлогинивается
+func (c *Client) revokeDevice(d model.Device) error {
+	arrJSON, err := json.MarshalIndent(d, "", " ")
+	if err != nil {
+		return err
+	}
+
+	if _, err = c.executeAPI(arrJSON, c.apiURL("/api/user/devices/revoke")); err != nil {
+		return err
+	}
+
+	if d.Current {
+		c.AuthorizedUser = AuthorizedUser{}
+		c.DataList = ListUserData{}
+		_ = os.Remove(c.Config.DeviceCert)
+		_ = os.Remove(c.Config.DeviceKey)
+		return c.InitTransport()
+	}
+	return nil
+}
@@ -1,11 +1,13 @@
 package client
 
 import (
+	"encoding/json"
 	"fmt"
 	"gophkeeper/internal/postgresql/model"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/theplant/luhn"
@@ -154,6 +156,8 @@ func (f *Forms) openPairLoginPasswordForms(c *Client, plp model.PairLoginPasswor
 
 		err := c.inputPairLoginPassword(plp)
 		if err != nil {
+			f.Form.AddTextView("", err.Error(), 100, 1, true, false)
+
 			constants.Logger.ErrorLog(err)
 			return
 		}
@@ -167,6 +171,8 @@ func (f *Forms) openPairLoginPasswordForms(c *Client, plp model.PairLoginPasswor
 
 		err := c.inputPairLoginPassword(plp)
 		if err != nil {
+			f.Form.AddTextView("", err.Error(), 100, 1, true, false)
+
 			constants.Logger.ErrorLog(err)
 			return
 		}
@@ -197,6 +203,8 @@ func (f *Forms) openTextDataForms(c *Client, td model.TextData) {
 
 		err := c.inputTextData(td)
 		if err != nil {
+			f.Form.AddTextView("", err.Error(), 100, 1, true, false)
+
 			constants.Logger.ErrorLog(err)
 			return
 		}
@@ -207,6 +215,8 @@ func (f *Forms) openTextDataForms(c *Client, td model.TextData) {
 
 		err := c.inputTextData(td)
 		if err != nil {
+			f.Form.AddTextView("", err.Error(), 100, 1, true, false)
+
 			constants.Logger.ErrorLog(err)
 			return
 		}
@@ -255,6 +265,8 @@ func (f *Forms) openBinaryDataForms(c *Client, bd model.BinaryData) {
 
 		err = c.inputBinaryData(bd)
 		if err != nil {
+			f.Form.AddTextView("", err.Error(), 100, 1, true, false)
+
 			constants.Logger.ErrorLog(err)
 			return
 		}
@@ -268,6 +280,8 @@ func (f *Forms) openBinaryDataForms(c *Client, bd model.BinaryData) {
 
 		err := c.downloadBinaryData(bd)
 		if err != nil {
+			f.Form.AddTextView("", err.Error(), 100, 1, true, false)
+
 			constants.Logger.ErrorLog(err)
 			return
 		}
@@ -278,6 +292,8 @@ func (f *Forms) openBinaryDataForms(c *Client, bd model.BinaryData) {
 
 		err := c.inputBinaryData(bd)
 		if err != nil {
+			f.Form.AddTextView("", err.Error(), 100, 1, true, false)
+
 			constants.Logger.ErrorLog(err)
 			return
 		}
@@ -316,6 +332,8 @@ func (f *Forms) openBankCardForms(c *Client, bc model.BankCard) {
 		bc.Event = constants.EventAddEdit.String()
 		err = c.inputBankCard(bc)
 		if err != nil {
+			f.Form.AddTextView("", err.Error(), 100, 1, true, false)
+
 			constants.Logger.ErrorLog(err)
 			return
 		}
@@ -325,6 +343,8 @@ func (f *Forms) openBankCardForms(c *Client, bc model.BankCard) {
 		bc.Event = constants.EventDel.String()
 		err := c.inputBankCard(bc)
 		if err != nil {
+			f.Form.AddTextView("", err.Error(), 100, 1, true, false)
+
 			constants.Logger.ErrorLog(err)
 			return
 		}
@@ -354,6 +374,8 @@ func (f *Forms) openEncryptionKeyForms(c *Client, k encryption.KeyRSA) {
 		}
 		err := c.createEncryptionKey(k)
 		if err != nil {
+			f.Form.AddTextView("", err.Error(), 100, 1, true, false)
+
 			constants.Logger.ErrorLog(err)
 			return
 		}
@@ -373,3 +395,207 @@ func (f *Forms) openInfoForm(c *Client) {
 		f.Pages.SwitchToPage(constants.NameMainPage)
 	})
 }
+
+// openChangePasswordForms отображает окно смены пароля текущего пользователя
+func (f *Forms) openChangePasswordForms(c *Client) {
+
+	user := model.User{}
+	repeatPassword := ""
+	f.Form.AddPasswordField("current password", "", 20, ' ', func(password string) {
+		user.Password = password
+	})
+	f.Form.AddPasswordField("new password", "", 20, ' ', func(password string) {
+		user.NewPassword = password
+	})
+	f.Form.AddPasswordField("repeat new password", "", 20, ' ', func(password string) {
+		repeatPassword = password
+	})
+
+	f.Form.AddButton("Change password", func() {
+		if user.NewPassword == "" || user.NewPassword != repeatPassword {
+			f.Form.AddTextView("", "new passwords do not match", 100, 1, true, false)
+			return
+		}
+
+		err := c.changeUserPassword(user)
+		if err != nil {
+			f.Form.AddTextView("", err.Error(), 100, 1, true, false)
+
+			constants.Logger.ErrorLog(err)
+			return
+		}
+		f.Pages.SwitchToPage(constants.NameMainPage)
+	})
+
+	f.Form.AddButton("Cancel", func() {
+		f.Pages.SwitchToPage(constants.NameMainPage)
+	})
+}
+
+// openAccountForms отображает окно выгрузки всех данных и удаления экаунта текущего пользователя.
+// Перед удалением рекомендуется выгрузить данные в файл
+func (f *Forms) openAccountForms(c *Client) {
+
+	user := model.User{}
+	patch := ""
+	f.Form.AddInputField("Export patch:", "", 100, nil, func(p string) {
+		patch = p
+	})
+	f.Form.AddPasswordField("password", "", 20, ' ', func(password string) {
+		user.Password = password
+	})
+
+	f.Form.AddButton("Export data", func() {
+		if patch == "" {
+			f.Form.AddTextView("", "не указан путь к файлу", 100, 1, true, false)
+			return
+		}
+
+		err := c.exportUserData(patch)
+		if err != nil {
+			f.Form.AddTextView("", err.Error(), 100, 1, true, false)
+
+			constants.Logger.ErrorLog(err)
+			return
+		}
+		f.Pages.SwitchToPage(constants.NameMainPage)
+	})
+
+	f.Form.AddButton("Delete account", func() {
+		err := c.deleteUserAccount(user)
+		if err != nil {
+			f.Form.AddTextView("", err.Error(), 100, 1, true, false)
+
+			constants.Logger.ErrorLog(err)
+			return
+		}
+		f.Pages.SwitchToPage(constants.NameMainPage)
+	})
+
+	f.Form.AddButton("Cancel", func() {
+		f.Pages.SwitchToPage(constants.NameMainPage)
+	})
+}
+
+// openSessionsForms отображает список активных сессий текущего пользователя.
+// Выбор сессии в списке отзывает ее. Websocket соединение отозванной сессии сервер закрывает сразу
+func (f *Forms) openSessionsForms(c *Client) {
+
+	f.List.Clear()
+	f.List.SetSelectedFunc(nil)
+	arrSession, err := c.selectSessions()
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+		f.List.AddItem(err.Error(), "", '!', nil)
+		return
+	}
+
+	for _, v := range arrSession {
+		s := v
+		mainText := fmt.Sprintf("%s (%s) %s", s.Device, s.IP, s.Build)
+		if s.Current {
+			mainText += " [current]"
+		}
+		secondaryText := fmt.Sprintf("created: %s, last seen: %s",
+			s.Created.Format(time.RFC822), s.LastSeen.Format(time.RFC822))
+
+		f.List.AddItem(mainText, secondaryText, '*', func() {
+			if err := c.revokeSession(s); err != nil {
+				constants.Logger.ErrorLog(err)
+				return
+			}
+			if s.Current {
+				f.Pages.SwitchToPage(constants.NameMainPage)
+				return
+			}
+			f.openSessionsForms(c)
+		})
+	}
+}
+
+// openDevicesForms отображает список устройств текущего пользователя, которым выпущены сертификаты.
+// Выбор устройства в списке отзывает его
+func (f *Forms) openDevicesForms(c *Client) {
+
+	f.List.Clear()
+	f.List.SetSelectedFunc(nil)
+	arrDevice, err := c.selectDevices()
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+		f.List.AddItem(err.Error(), "", '!', nil)
+		return
+	}
+
+	for _, v := range arrDevice {
+		d := v
+		mainText := fmt.Sprintf("%s (%s)", d.Name, d.Serial)
+		if d.Current {
+			mainText += " [current]"
+		}
+		secondaryText := fmt.Sprintf("created: %s, expires: %s",
+			d.Created.Format(time.RFC822), d.NotAfter.Format(time.RFC822))
+
+		f.List.AddItem(mainText, secondaryText, '*', func() {
+			if err := c.revokeDevice(d); err != nil {
+				constants.Logger.ErrorLog(err)
+				return
+			}
+			if d.Current {
+				f.Pages.SwitchToPage(constants.NameMainPage)
+				return
+			}
+			f.openDevicesForms(c)
+		})
+	}
+}
+
+// openAuditForms отображает журнал аудита текущего пользователя и позволяет выгрузить его в файл JSON lines
+func (f *Forms) openAuditForms(c *Client) {
+
+	body, err := c.selectAudit("")
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+		f.Form.AddTextView("", err.Error(), 100, 1, true, false)
+	}
+
+	var arrAudit []model.AuditRecord
+	if err == nil {
+		if err = json.Unmarshal(body, &arrAudit); err != nil {
+			constants.Logger.ErrorLog(err)
+		}
+	}
+
+	var arrText []string
+	for _, v := range arrAudit {
+		status := "ok"
+		if !v.Success {
+			status = "FAILED"
+		}
+		arrText = append(arrText, fmt.Sprintf("%s  %-8s %-6s %s %s %s", v.Date.Format(time.RFC822), v.Event,
+			status, v.Type, v.Uid, v.IP))
+	}
+	f.Form.AddTextArea("Audit:", strings.Join(arrText, "\n"), 150, 15, 0, nil)
+
+	patch := ""
+	f.Form.AddInputField("Export patch:", "", 100, nil, func(p string) {
+		patch = p
+	})
+
+	f.Form.AddButton("Export JSON lines", func() {
+		if patch == "" {
+			f.Form.AddTextView("", "не указан путь к файлу", 100, 1, true, false)
+			return
+		}
+
+		if err := c.exportAudit(patch); err != nil {
+			f.Form.AddTextView("", err.Error(), 100, 1, true, false)
+
+			constants.Logger.ErrorLog(err)
+			return
+		}
+		f.Pages.SwitchToPage(constants.NameMainPage)
+	})
+	f.Form.AddButton("Cancel", func() {
+		f.Pages.SwitchToPage(constants.NameMainPage)
+	})
+}
@@ -10,7 +10,6 @@ import (
 	"time"
 
 	"github.com/gdamore/tcell/v2"
-	"github.com/gorilla/websocket"
 	"github.com/rivo/tview"
 )
 
@@ -35,10 +34,15 @@ func InitForms() *Forms {
 		"(5)   Add arbitrary text data",
 		"(6)   Add arbitrary binary data",
 		"(7)   Add bank card details",
+		"(8)   Change password",
+		"(9)   Account: export/delete",
 		"(0)   To quit",
 		"",
 		"(Ctrl+K)  Create crypto-key",
-		"(Ctrl+I)  Build info"}
+		"(Ctrl+I)  Build info",
+		"(Ctrl+S)  Sessions",
+		"(Ctrl+D)  Devices",
+		"(Ctrl+A)  Audit log"}
 
 	textDefault := strings.Join(arrayEvent, "\n")
 
@@ -62,8 +66,7 @@ func InitForms() *Forms {
 // На форме отображается и обновляется количество сохраненных записей в базе данных
 func (f *Forms) Run(c *Client) {
 
-	socketUrl := fmt.Sprintf("ws://%s/socket", c.Config.Address)
-	conn, _, err := websocket.DefaultDialer.Dial(socketUrl, nil)
+	conn, encoding, err := c.dialSocket()
 	if err != nil {
 		constants.Logger.ErrorLog(err)
 		fmt.Println("Ошибка соединения с сервером. Повторите попытку позже")
@@ -72,8 +75,8 @@ func (f *Forms) Run(c *Client) {
 
 	ctx := context.Background()
 
-	go c.wsDataWrite(ctx, conn)
-	go c.wsDataRead(ctx, conn)
+	go c.wsData(ctx, conn, encoding)
+	go c.refreshQuota(ctx)
 	go f.refreshForm(ctx, c)
 
 	f.Application.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
@@ -93,6 +96,22 @@ func (f *Forms) Run(c *Client) {
 			f.Pages.SwitchToPage("KeyRSA")
 			return nil
 		}
+		if event.Key() == tcell.KeyCtrlS && c.Name != "" {
+			f.openSessionsForms(c)
+			f.Pages.SwitchToPage("Sessions")
+			return nil
+		}
+		if event.Key() == tcell.KeyCtrlD && c.Name != "" {
+			f.openDevicesForms(c)
+			f.Pages.SwitchToPage("Devices")
+			return nil
+		}
+		if event.Key() == tcell.KeyCtrlA && c.Name != "" {
+			f.Form.Clear(true)
+			f.openAuditForms(c)
+			f.Pages.SwitchToPage("Audit")
+			return nil
+		}
 		if event.Key() == tcell.KeyCtrlI {
 			f.Form.Clear(true)
 			f.openInfoForm(c)
@@ -105,7 +124,9 @@ func (f *Forms) Run(c *Client) {
 				event.Rune() == constants.Key4 ||
 				event.Rune() == constants.Key5 ||
 				event.Rune() == constants.Key6 ||
-				event.Rune() == constants.Key7) {
+				event.Rune() == constants.Key7 ||
+				event.Rune() == constants.Key8 ||
+				event.Rune() == constants.Key9) {
 
 			f.Pages.SwitchToPage(constants.NameMainPage)
 			return nil
@@ -151,6 +172,16 @@ func (f *Forms) Run(c *Client) {
 			f.openBankCardForms(c, model.BankCard{})
 			f.Pages.SwitchToPage("BankCard")
 			return nil
+		case constants.Key8: //8
+			f.Form.Clear(true)
+			f.openChangePasswordForms(c)
+			f.Pages.SwitchToPage("ChangePassword")
+			return nil
+		case constants.Key9: //9
+			f.Form.Clear(true)
+			f.openAccountForms(c)
+			f.Pages.SwitchToPage("Account")
+			return nil
 		}
 		return event
 	})
@@ -172,6 +203,11 @@ func (f *Forms) Run(c *Client) {
 	f.Pages.AddPage("KeyRSA", f.Form, true, false)
 	f.Pages.AddPage("Comment", f.Form, true, false)
 	f.Pages.AddPage("Info", f.Form, true, false)
+	f.Pages.AddPage("ChangePassword", f.Form, true, false)
+	f.Pages.AddPage("Account", f.Form, true, false)
+	f.Pages.AddPage("Sessions", f.List, true, false)
+	f.Pages.AddPage("Devices", f.List, true, false)
+	f.Pages.AddPage("Audit", f.Form, true, false)
 
 	if err := f.Application.SetRoot(f.Pages, true).EnableMouse(true).Sync().Run(); err != nil {
 		panic(err)
@@ -188,11 +224,86 @@ func (f *Forms) setMainText(c *Client) string {
 	for _, v := range c.DataList {
 		i += len(v)
 	}
-	return fmt.Sprintf("USER: %s\n\n%s\n\nRecords counts (%d)", name, f.TextDefault, i)
+	return fmt.Sprintf("USER: %s\n\n%s\n\nRecords counts (%d)%s", name, f.TextDefault, i, quotaText(c))
+}
+
+// quotaText текст использования квот пользователя для основного окна программы
+func quotaText(c *Client) string {
+	q := c.quotaUsage()
+	if c.Name == "" || q.Records == nil {
+		return ""
+	}
+	records := make([]string, 0, len(q.Records))
+	for _, t := range []string{"pairs", "text", "binary", "card"} {
+		records = append(records, fmt.Sprintf("%s %d/%s", t, q.Records[t], quotaLimit(int64(q.Limits.Records), false)))
+	}
+	return fmt.Sprintf("\nStorage: %s/%s, max file %s\nRecords: %s", formatBytes(q.Bytes),
+		quotaLimit(q.Limits.Bytes, true), quotaLimit(q.Limits.FileSize, true), strings.Join(records, ", "))
+}
+
+// quotaLimit текст значения квоты. bytes выводит значение в единицах объема
+func quotaLimit(limit int64, bytes bool) string {
+	if limit == 0 {
+		return "unlimited"
+	}
+	if bytes {
+		return formatBytes(limit)
+	}
+	return fmt.Sprintf("%d", limit)
+}
+
+// formatBytes объем в байтах в читаемом виде
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// refreshQuota горутина, которая периодически получает с сервера использование квот текущего пользователя
+func (c *Client) refreshQuota(ctx context.Context) {
+	ticker := time.NewTicker(constants.QuotaRefreshInterval)
+	for {
+		select {
+		case <-ticker.C:
+			if c.Name == "" {
+				c.setQuota(model.QuotaUsage{})
+				continue
+			}
+			qu, err := c.selectQuota()
+			if err != nil {
+				constants.Logger.ErrorLog(err)
+				continue
+			}
+			c.setQuota(qu)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// setQuota сохраняет использование квот, полученное с сервера
+func (c *Client) setQuota(qu model.QuotaUsage) {
+	c.quotaMu.Lock()
+	defer c.quotaMu.Unlock()
+	c.quota = qu
+}
+
+// quotaUsage копия использования квот для вывода. Карту Records после получения с сервера никто не изменяет
+func (c *Client) quotaUsage() model.QuotaUsage {
+	c.quotaMu.Lock()
+	defer c.quotaMu.Unlock()
+	return c.quota
 }
 
 // refreshForm горутина которая обновляет текст основного окна программы.
-// отображает пользователя и количество записей, хранящихся в БД
+// отображает пользователя, количество записей, хранящихся в БД, и использование квот
 func (f *Forms) refreshForm(ctx context.Context, c *Client) {
 	ticker := time.NewTicker(time.Second / 2)
 	for {
@@ -0,0 +1,31 @@
+package client
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"gophkeeper/internal/postgresql/model"
+)
+
+func TestQuotaText(t *testing.T) {
+	c := &Client{}
+	c.Name = "user"
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			c.setQuota(model.QuotaUsage{Bytes: int64(i), Records: map[string]int{"text": i}})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		_ = quotaText(c)
+	}
+	wg.Wait()
+
+	if text := quotaText(c); !strings.Contains(text, "text 99/unlimited") {
+		t.Errorf("Unexpected quota text %q", text)
+	}
+}
@@ -17,15 +17,23 @@ import (
 	"gophkeeper/internal/constants"
 	"gophkeeper/internal/encryption"
 	"gophkeeper/internal/postgresql"
+	"gophkeeper/internal/tracing"
 )
 
 // wsBinaryData содает web socket для переброски файлов с клиента на сервер
 // Режет файлы на кусочки равные константе Step.
-// Шифрует, упаковывает в gzip и отправляет на сервер с разметкой с какого байта начинается.
+// Шифрует, сжимает способом, выбранным при открытии websocket, и отправляет на сервер с разметкой с какого байта начинается.
+// Передача файла трассируется одним span на все время жизни websocket
 func (c *Client) wsBinaryData(ctx context.Context) {
-	socketUrl := fmt.Sprintf("ws://%s/socket_file", c.Config.Address)
-	conn, _, err := websocket.DefaultDialer.Dial(socketUrl, nil)
+	h := http.Header{}
+	h.Set(constants.HeaderAuthorization, c.Token)
+	_, span := tracing.StartSession(ctx, "ws /socket_file", h)
+	defer span.End()
+
+	socketUrl := c.wsURL("/socket_file")
+	conn, encoding, err := c.dial(socketUrl, h)
 	if err != nil {
+		tracing.SetError(span, err)
 		constants.Logger.ErrorLog(err)
 		return
 	}
@@ -47,7 +55,7 @@ func (c *Client) wsBinaryData(ctx context.Context) {
 
 		bd.Uid = abp.uid
 		msg, err := json.MarshalIndent(bd, "", " ")
-		msg, err = compression.Compress(msg)
+		msg, err = compression.Encode(encoding, msg)
 		if err != nil {
 			constants.Logger.ErrorLog(err)
 		}
@@ -78,21 +86,78 @@ func (c *Client) wsDataWrite(ctx context.Context, conn *websocket.Conn) {
 	}
 }
 
-// wsDataRead, web socket передает информацию пользователя с сервера на клиент
-func (c *Client) wsDataRead(ctx context.Context, conn *websocket.Conn) {
+// wsData горутина обслуживает websocket обмена данными с сервером.
+// Если сервер закрыл соединение из-за отзыва сессии, то пользователь разлогинивается.
+// После разрыва соединение с сервером устанавливается заново
+func (c *Client) wsData(ctx context.Context, conn *websocket.Conn, encoding string) {
+	for {
+		ctxConn, cancelFunc := context.WithCancel(ctx)
+		go c.wsDataWrite(ctxConn, conn)
+		err := c.wsDataRead(ctxConn, conn, encoding)
+		cancelFunc()
+		_ = conn.Close()
+
+		if websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+			c.AuthorizedUser = AuthorizedUser{}
+			c.DataList = ListUserData{}
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+
+			conn, encoding, err = c.dialSocket()
+			if err == nil {
+				break
+			}
+			constants.Logger.ErrorLog(err)
+		}
+	}
+}
+
+// dialSocket создает websocket обмена данными с сервером. Трассируется только открытие соединения:
+// соединение живет все время работы клиента
+func (c *Client) dialSocket() (*websocket.Conn, string, error) {
+	h := http.Header{}
+	_, span := tracing.StartSession(context.Background(), "ws /socket", h)
+	defer span.End()
+
+	socketUrl := c.wsURL("/socket")
+	conn, encoding, err := c.dial(socketUrl, h)
+	tracing.SetError(span, err)
+	return conn, encoding, err
+}
+
+// dial открывает websocket и договаривается с сервером о способе сжатия сообщений.
+// Возвращает соединение и выбранный сервером способ сжатия
+func (c *Client) dial(socketUrl string, h http.Header) (*websocket.Conn, string, error) {
+	h.Set(compression.HeaderMessageEncoding, compression.MessageEncodings)
+	conn, resp, err := c.dialer().Dial(socketUrl, h)
+	if err != nil {
+		return nil, "", err
+	}
+	return conn, compression.MessageEncoding(resp.Header.Get(compression.HeaderMessageEncoding)), nil
+}
+
+// wsDataRead, web socket передает информацию пользователя с сервера на клиент.
+// Возвращает ошибку чтения, после которой соединение считается закрытым
+func (c *Client) wsDataRead(ctx context.Context, conn *websocket.Conn, encoding string) error {
 	for {
 		select {
 		case <-ctx.Done():
-			return
+			return ctx.Err()
 		default:
 
 			_, messageContent, err := conn.ReadMessage()
 			if err != nil {
 				constants.Logger.ErrorLog(err)
-				continue
+				return err
 			}
 
-			messageContent, err = compression.Decompress(messageContent)
+			messageContent, err = compression.Decode(encoding, messageContent, 0)
 			if err != nil {
 				constants.Logger.ErrorLog(err)
 			}
@@ -169,8 +234,9 @@ func (c *Client) readFile(pathSource string, chanOut chan model.PortionBinaryDat
 }
 
 // wsDownloadBinaryData, web socket передает файл с сервера на клиент и сохраняет на диске
-// Получает файл порциями, распаковывает из gzip, расшифровывает. И складывает в один файл
-// орентируясь на метки с какого бачта начинается порция
+// Получает файл порциями, распаковывает, расшифровывает. И складывает в один файл
+// орентируясь на метки с какого бачта начинается порция.
+// Получение файла трассируется одним span на все время жизни websocket
 func (c *Client) wsDownloadBinaryData(ctx context.Context) {
 
 	if c.User.Name == "" {
@@ -179,11 +245,16 @@ func (c *Client) wsDownloadBinaryData(ctx context.Context) {
 
 	abp := ctx.Value(model.KeyContext("additionalBinaryParameters")).(additionalBinaryParameters)
 
-	socketUrl := fmt.Sprintf("ws://%s/socket_download_file", c.Config.Address)
+	socketUrl := c.wsURL("/socket_download_file")
 	h := http.Header{}
 	h.Add("UID", abp.uid)
-	conn, _, err := websocket.DefaultDialer.Dial(socketUrl, h)
+	h.Add(constants.HeaderAuthorization, c.Token)
+	_, span := tracing.StartSession(ctx, "ws /socket_download_file", h)
+	defer span.End()
+
+	conn, encoding, err := c.dial(socketUrl, h)
 	if err != nil {
+		tracing.SetError(span, err)
 		constants.Logger.ErrorLog(err)
 		return
 	}
@@ -197,7 +268,7 @@ func (c *Client) wsDownloadBinaryData(ctx context.Context) {
 			constants.Logger.ErrorLog(err)
 			return
 		}
-		messageContent, err = compression.Decompress(messageContent)
+		messageContent, err = compression.Decode(encoding, messageContent, 0)
 		if err != nil {
 			constants.Logger.ErrorLog(err)
 		}
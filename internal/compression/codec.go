@@ -0,0 +1,204 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+
+	"gophkeeper/internal/constants/errs"
+)
+
+// Способы сжатия (значения Content-Encoding). Identity - без сжатия
+const (
+	Gzip     = "gzip"
+	Zstd     = "zstd"
+	Identity = "identity"
+)
+
+// maxWindow наибольшее окно zstd, которое принимает распаковщик (окно упаковщика по умолчанию),
+// что бы сжатые данные не заставляли сервер выделять под окно много памяти
+const maxWindow = 8 << 20
+
+// Пулы упаковщиков и распаковщиков: их создание дороже сжатия небольших сообщений
+var (
+	gzipWriters = sync.Pool{New: func() interface{} { return gzip.NewWriter(nil) }}
+	zstdWriters = sync.Pool{New: func() interface{} {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return enc
+	}}
+	zstdReaders = sync.Pool{New: func() interface{} {
+		dec, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(maxWindow))
+		return dec
+	}}
+)
+
+// Normalize способ сжатия из значения Content-Encoding: без регистра и пробелов, пустое значение - Identity
+func Normalize(encoding string) string {
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+	if encoding == "" {
+		return Identity
+	}
+	return encoding
+}
+
+// Supported признак, что способ сжатия encoding поддерживается
+func Supported(encoding string) bool {
+	switch Normalize(encoding) {
+	case Gzip, Zstd, Identity:
+		return true
+	}
+	return false
+}
+
+// NewWriter потоковый упаковщик encoding поверх w. Close дописывает сжатые данные в w, но не закрывает w.
+// Если способ сжатия не поддерживается, то возвращает ошибку errs.ErrUnsupportedEncoding
+func NewWriter(encoding string, w io.Writer) (io.WriteCloser, error) {
+	switch Normalize(encoding) {
+	case Gzip:
+		gw := gzipWriters.Get().(*gzip.Writer)
+		gw.Reset(w)
+		return &pooledWriter{WriteCloser: gw, put: func() { gzipWriters.Put(gw) }}, nil
+	case Zstd:
+		zw := zstdWriters.Get().(*zstd.Encoder)
+		zw.Reset(w)
+		return &pooledWriter{WriteCloser: zw, put: func() { zstdWriters.Put(zw) }}, nil
+	case Identity:
+		return nopWriteCloser{w}, nil
+	}
+	return nil, fmt.Errorf("%w: %s", errs.ErrUnsupportedEncoding, encoding)
+}
+
+// NewReader потоковый распаковщик encoding поверх r. Close не закрывает r.
+// Если способ сжатия не поддерживается, то возвращает ошибку errs.ErrUnsupportedEncoding
+func NewReader(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch Normalize(encoding) {
+	case Gzip:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed init decompress reader: %v", err)
+		}
+		return gr, nil
+	case Zstd:
+		zr := zstdReaders.Get().(*zstd.Decoder)
+		if err := zr.Reset(r); err != nil {
+			zstdReaders.Put(zr)
+			return nil, fmt.Errorf("failed init decompress reader: %v", err)
+		}
+		return &pooledReader{Decoder: zr}, nil
+	case Identity:
+		return io.NopCloser(r), nil
+	}
+	return nil, fmt.Errorf("%w: %s", errs.ErrUnsupportedEncoding, encoding)
+}
+
+// Encode сжимает данные целиком способом encoding
+func Encode(encoding string, data []byte) ([]byte, error) {
+	if Normalize(encoding) == Identity {
+		return data, nil
+	}
+
+	var valByte bytes.Buffer
+	writer, err := NewWriter(encoding, &valByte)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = writer.Write(data); err != nil {
+		_ = writer.Close()
+		return nil, fmt.Errorf("failed write data to compress temporary buffer: %v", err)
+	}
+	if err = writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed compress data: %v", err)
+	}
+	return valByte.Bytes(), nil
+}
+
+// Decode распаковывает данные, сжатые способом encoding, но не больше limit байт (0 - без ограничения).
+// Если распакованные данные больше limit, то возвращает ошибку errs.ErrTooLarge
+func Decode(encoding string, data []byte, limit int64) ([]byte, error) {
+	if Normalize(encoding) == Identity {
+		if limit > 0 && int64(len(data)) > limit {
+			return nil, errs.ErrTooLarge
+		}
+		return data, nil
+	}
+
+	reader, err := NewReader(encoding, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return readLimit(reader, limit)
+}
+
+// readLimit читает r до конца, но не больше limit байт (0 - без ограничения)
+func readLimit(r io.Reader, limit int64) ([]byte, error) {
+	if limit > 0 {
+		r = io.LimitReader(r, limit+1)
+	}
+	var valByte bytes.Buffer
+	n, err := valByte.ReadFrom(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed decompress data: %v", err)
+	}
+	if limit > 0 && n > limit {
+		return nil, errs.ErrTooLarge
+	}
+	return valByte.Bytes(), nil
+}
+
+// pooledWriter упаковщик, который после Close возвращается в пул
+type pooledWriter struct {
+	io.WriteCloser
+	put func()
+}
+
+// Flush выталкивает сжатые данные, накопленные упаковщиком, не завершая поток
+func (pw *pooledWriter) Flush() error {
+	if f, ok := pw.WriteCloser.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Close завершает поток и возвращает упаковщик в пул. Повторный Close ничего не делает
+func (pw *pooledWriter) Close() error {
+	if pw.put == nil {
+		return nil
+	}
+	err := pw.WriteCloser.Close()
+	pw.put()
+	pw.put = nil
+	return err
+}
+
+// pooledReader распаковщик zstd, который после Close возвращается в пул
+type pooledReader struct {
+	*zstd.Decoder
+}
+
+// Close возвращает распаковщик в пул. Повторный Close ничего не делает
+func (pr *pooledReader) Close() error {
+	if pr.Decoder == nil {
+		return nil
+	}
+	// распаковщик не должен держать источник до следующего использования
+	_ = pr.Decoder.Reset(nil)
+	zstdReaders.Put(pr.Decoder)
+	pr.Decoder = nil
+	return nil
+}
+
+// nopWriteCloser запись без сжатия
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close ничего не делает: источник закрывает вызывающий
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,143 @@
+package compression
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"gophkeeper/internal/constants/errs"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	data := []byte(strings.Repeat("gophkeeper ", 1000))
+
+	for _, encoding := range []string{Gzip, Zstd, Identity, "", " GZIP "} {
+		t.Run("Checking "+encoding, func(t *testing.T) {
+			packed, err := Encode(encoding, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if Normalize(encoding) != Identity && len(packed) >= len(data) {
+				t.Errorf("Data is not compressed: %d >= %d", len(packed), len(data))
+			}
+
+			got, err := Decode(encoding, packed, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Error("Decoded data differs")
+			}
+
+			if _, err = Decode(encoding, packed, int64(len(data)-1)); !errors.Is(err, errs.ErrTooLarge) {
+				t.Errorf("Expected ErrTooLarge, got %v", err)
+			}
+		})
+	}
+
+	t.Run("Checking unsupported encoding", func(t *testing.T) {
+		if _, err := Encode("br", data); !errors.Is(err, errs.ErrUnsupportedEncoding) {
+			t.Errorf("Expected ErrUnsupportedEncoding, got %v", err)
+		}
+		if _, err := Decode("br", data, 0); !errors.Is(err, errs.ErrUnsupportedEncoding) {
+			t.Errorf("Expected ErrUnsupportedEncoding, got %v", err)
+		}
+	})
+
+	t.Run("Checking corrupted data", func(t *testing.T) {
+		for _, encoding := range []string{Gzip, Zstd} {
+			if _, err := Decode(encoding, data, 0); err == nil {
+				t.Errorf("%s: expected error", encoding)
+			}
+		}
+	})
+
+	t.Run("Checking legacy gzip", func(t *testing.T) {
+		packed, err := Compress(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Decode(Gzip, packed, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Error("Decoded data differs")
+		}
+	})
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		offers []string
+		want   string
+	}{
+		{accept: "", offers: []string{Zstd, Gzip}, want: ""},
+		{accept: "", offers: []string{Zstd, Gzip, Identity}, want: Identity},
+		{accept: "gzip", offers: []string{Zstd, Gzip}, want: Gzip},
+		{accept: "gzip, zstd", offers: []string{Zstd, Gzip}, want: Zstd},
+		{accept: "zstd;q=0.5, gzip", offers: []string{Zstd, Gzip}, want: Gzip},
+		{accept: "*", offers: []string{Zstd, Gzip}, want: Zstd},
+		{accept: "zstd;q=0, *", offers: []string{Zstd, Gzip}, want: Gzip},
+		{accept: "identity;q=0", offers: []string{Identity}, want: ""},
+		{accept: "br, deflate", offers: []string{Zstd, Gzip}, want: ""},
+		{accept: "zstd, gzip, identity", offers: []string{Identity, Zstd, Gzip}, want: Identity},
+		{accept: " ZSTD ; Q=1 ", offers: []string{Gzip, Zstd}, want: Zstd},
+	}
+	for _, tt := range tests {
+		if got := Negotiate(tt.accept, tt.offers...); got != tt.want {
+			t.Errorf("Negotiate(%q, %v) = %q, want %q", tt.accept, tt.offers, got, tt.want)
+		}
+	}
+}
+
+func TestRemote(t *testing.T) {
+	var rm Remote
+	if got := rm.Encoding(); got != Gzip {
+		t.Fatalf("Expected %q, got %q", Gzip, got)
+	}
+
+	rm.Update("")
+	rm.Update("br")
+	if got := rm.Encoding(); got != Gzip {
+		t.Fatalf("Expected %q, got %q", Gzip, got)
+	}
+
+	rm.Update(AcceptEncoding)
+	if got := rm.Encoding(); got != Zstd {
+		t.Fatalf("Expected %q, got %q", Zstd, got)
+	}
+}
+
+func TestDecodeResponse(t *testing.T) {
+	data := []byte(strings.Repeat("gophkeeper ", 1000))
+	packed, err := Encode(Zstd, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := &http.Response{
+		Header:        http.Header{"Content-Encoding": {Zstd}, "Content-Length": {"1"}},
+		Body:          io.NopCloser(bytes.NewReader(packed)),
+		ContentLength: int64(len(packed)),
+	}
+	if err = DecodeResponse(resp); err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	got, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("Decoded body differs")
+	}
+	if resp.Header.Get("Content-Encoding") != "" || resp.ContentLength != -1 {
+		t.Errorf("Headers are not reset: %v %d", resp.Header, resp.ContentLength)
+	}
+}
@@ -1,40 +1,22 @@
-// Package compression: упаковка/распаковка gzip
+// Package compression: сжатие данных gzip и zstd и выбор способа сжатия по Accept-Encoding.
+// Данные сжимаются целиком (Encode/Decode) или потоком (NewWriter/NewReader).
+// Compress/Decompress сжимают gzip: так сжимаются сообщения клиентов, которые не выбирают способ сжатия
 package compression
 
-import (
-	"bytes"
-	"compress/gzip"
-	"fmt"
-)
-
 // Compress сжимает данные (тип []byte) в gzip.
 // Возвращает сжатый []byte и ошибку.
 func Compress(data []byte) ([]byte, error) {
-
-	var valByte bytes.Buffer
-	writer := gzip.NewWriter(&valByte)
-	if _, err := writer.Write(data); err != nil {
-		return nil, fmt.Errorf("failed write data to compress temporary buffer: %v", err)
-	}
-	if err := writer.Close(); err != nil {
-		return nil, fmt.Errorf("failed compress data: %v", err)
-	}
-	return valByte.Bytes(), nil
+	return Encode(Gzip, data)
 }
 
 // Decompress разархивирует данные из архива gzip.
 // Возвращает разархивированный массив байт ([]byte) и ошибку.
 func Decompress(data []byte) ([]byte, error) {
-	reader, err := gzip.NewReader(bytes.NewReader(data))
-	if err != nil {
-		return nil, fmt.Errorf("failed init decompress reader: %v", err)
-	}
-	defer reader.Close()
-
-	var valByte bytes.Buffer
-	if _, err := valByte.ReadFrom(reader); err != nil {
-		return nil, fmt.Errorf("failed decompress data: %v", err)
-	}
+	return Decode(Gzip, data, 0)
+}
 
-	return valByte.Bytes(), nil
+// DecompressLimit разархивирует данные из архива gzip, но не больше limit байт.
+// Если распакованные данные больше limit, то возвращает ошибку errs.ErrTooLarge
+func DecompressLimit(data []byte, limit int64) ([]byte, error) {
+	return Decode(Gzip, data, limit)
 }
@@ -0,0 +1,145 @@
+package compression
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// AcceptEncoding способы сжатия, которые принимает сервер и клиенты (значение Accept-Encoding)
+const AcceptEncoding = "zstd, gzip"
+
+// MessageEncodings способы сжатия сообщений websocket, которые поддерживают клиенты. Identity указывается явно:
+// сообщения с зашифрованными порциями файлов сервер передает без сжатия
+const MessageEncodings = "zstd, gzip, identity"
+
+// HeaderMessageEncoding ключ хедера открытия websocket. Клиент передает в нем способы сжатия сообщений,
+// которые он поддерживает (как в Accept-Encoding), сервер отвечает выбранным способом. Если клиент хедер
+// не передал, то сообщения сжимаются gzip, если сервер не ответил хедером, то клиент сжимает сообщения gzip
+const HeaderMessageEncoding = "X-Message-Encoding"
+
+// Negotiate выбирает способ сжатия из offers (в порядке предпочтения вызывающего) по значению Accept-Encoding.
+// Из способов с наибольшим весом q выбирается первый в offers. Identity допустим, если явно не запрещен
+// (identity;q=0 или *;q=0). Если ни один способ не допустим, то возвращает пустую строку
+func Negotiate(accept string, offers ...string) string {
+	weights := map[string]float64{}
+	for _, part := range strings.Split(accept, ",") {
+		name, q := parseCoding(part)
+		if name != "" {
+			weights[name] = q
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		q, ok := weights[offer]
+		if !ok {
+			q, ok = weights["*"]
+		}
+		if !ok {
+			q = 0
+			if offer == Identity {
+				q = 0.001
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// parseCoding способ сжатия и вес из элемента Accept-Encoding (например, "gzip;q=0.5")
+func parseCoding(part string) (string, float64) {
+	params := strings.Split(part, ";")
+	name := Normalize(params[0])
+	if strings.TrimSpace(params[0]) == "" {
+		return "", 0
+	}
+
+	q := 1.0
+	for _, p := range params[1:] {
+		k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+		if !ok || !strings.EqualFold(strings.TrimSpace(k), "q") {
+			continue
+		}
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && f >= 0 && f <= 1 {
+			q = f
+		}
+	}
+	return name, q
+}
+
+// Remote способ сжатия тел запросов к серверу. Пока сервер не сообщил, какие способы он принимает
+// (хедер Accept-Encoding ответа), запросы сжимаются gzip, который понимают все версии сервера
+type Remote struct {
+	sync.Mutex
+	encoding string
+}
+
+// Encoding способ сжатия тел запросов
+func (rm *Remote) Encoding() string {
+	rm.Lock()
+	defer rm.Unlock()
+
+	if rm.encoding == "" {
+		return Gzip
+	}
+	return rm.encoding
+}
+
+// Update запоминает способ сжатия по хедеру Accept-Encoding ответа сервера. Пустой хедер ничего не меняет
+func (rm *Remote) Update(accept string) {
+	if accept == "" {
+		return
+	}
+	encoding := Negotiate(accept, Zstd, Gzip)
+	if encoding == "" {
+		return
+	}
+
+	rm.Lock()
+	defer rm.Unlock()
+	rm.encoding = encoding
+}
+
+// MessageEncoding способ сжатия сообщений websocket по хедеру HeaderMessageEncoding ответа сервера
+func MessageEncoding(value string) string {
+	if value == "" || !Supported(value) {
+		return Gzip
+	}
+	return Normalize(value)
+}
+
+// DecodeResponse заменяет сжатое тело ответа распакованным (по Content-Encoding), что бы тело, в том числе
+// тело ошибки, читалось без учета сжатия. Закрытие нового тела закрывает и исходное
+func DecodeResponse(resp *http.Response) error {
+	encoding := Normalize(resp.Header.Get("Content-Encoding"))
+	if encoding == Identity {
+		return nil
+	}
+
+	reader, err := NewReader(encoding, resp.Body)
+	if err != nil {
+		return err
+	}
+	resp.Body = &decodedBody{ReadCloser: reader, raw: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	return nil
+}
+
+// decodedBody распакованное тело ответа
+type decodedBody struct {
+	io.ReadCloser
+	raw io.ReadCloser
+}
+
+// Close закрывает распаковщик и исходное тело
+func (db *decodedBody) Close() error {
+	_ = db.ReadCloser.Close()
+	return db.raw.Close()
+}
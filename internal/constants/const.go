@@ -40,16 +40,137 @@ const (
 	EventDel
 )
 
+const (
+	//EventLock событие аудита блокировки ключа после превышения неудачных попыток
+	EventLock = "lock"
+
+	//EventUnlock событие аудита снятия блокировки администратором
+	EventUnlock = "unlock"
+)
+
+const (
+	//AuditLogin событие аудита вход пользователя в систему
+	AuditLogin = "login"
+
+	//AuditRegister событие аудита регистрация пользователя
+	AuditRegister = "register"
+
+	//AuditPassword событие аудита смена пароля
+	AuditPassword = "password"
+
+	//AuditExport событие аудита выгрузка всех данных пользователя
+	AuditExport = "export"
+
+	//AuditDownload событие аудита скачивание файла
+	AuditDownload = "download"
+
+	//AuditRevoke событие аудита отзыв сессии (токена)
+	AuditRevoke = "revoke"
+
+	//AuditEnroll событие аудита выпуск сертификата устройства
+	AuditEnroll = "enroll"
+
+	//AuditRevokeDevice событие аудита отзыв устройства и его сертификата
+	AuditRevokeDevice = "revoke_device"
+
+	//AuditAdminDisable событие аудита блокировка экаунта администратором
+	AuditAdminDisable = "admin_disable"
+
+	//AuditAdminEnable событие аудита разблокировка экаунта администратором
+	AuditAdminEnable = "admin_enable"
+
+	//AuditAdminLogout событие аудита принудительный выход из всех сессий по команде администратора
+	AuditAdminLogout = "admin_logout"
+
+	//AuditAdminDelete событие аудита удаление экаунта администратором
+	AuditAdminDelete = "admin_delete"
+
+	//AuditAdminRole событие аудита смена роли пользователя администратором
+	AuditAdminRole = "admin_role"
+
+	//AuditLimitDefault количество записей журнала аудита, возвращаемых по умолчанию
+	AuditLimitDefault = 1000
+
+	//AuditBatch количество записей очереди журнала аудита, которые сохраняются в БД одной транзакцией
+	AuditBatch = 500
+
+	//AuditQueueLimit максимальное количество записей в очереди журнала аудита. Самые старые записи
+	//вытесняются в лог ошибок
+	AuditQueueLimit = 100000
+
+	//BatchLimit максимальное количество операций в одном пакетном запросе
+	BatchLimit = 1000
+)
+
+const (
+	//RoleUser роль обычного пользователя
+	RoleUser = "user"
+
+	//RoleAdmin роль администратора. Дает доступ к административным маршрутам, роль проверяется по БД
+	RoleAdmin = "admin"
+)
+
+const (
+	//FlushMaxAttempts количество неудачных попыток сохранить запись хранилища сервера в БД,
+	//после которого запись переносится в список неисправных записей
+	FlushMaxAttempts = 5
+
+	//DeadItemsLimit максимальное количество неисправных записей. Самые старые записи вытесняются
+	DeadItemsLimit = 1000
+)
+
+// Ограничения размеров данных. Совпадают с размерами колонок таблиц БД
+const (
+	//MaxBodySize максимальный размер тела запроса, в том числе после распаковки gzip
+	MaxBodySize = 8 << 20
+
+	//MaxNameLength максимальная длина имени пользователя и полей пары логин/пароль (зашифрованных)
+	MaxNameLength = 150
+
+	//MaxPasswordLength максимальная длина пароля пользователя
+	MaxPasswordLength = 256
+
+	//MaxTextLength максимальная длина зашифрованного текста
+	MaxTextLength = 1 << 20
+
+	//MaxFileNameLength максимальная длина имени файла
+	MaxFileNameLength = 150
+
+	//MaxExpansionLength максимальная длина расширения файла
+	MaxExpansionLength = 50
+
+	//MaxPatchLength максимальная длина пути к файлу
+	MaxPatchLength = 1000
+
+	//MaxCardFieldLength максимальная длина зашифрованного номера и CVC банковской карты
+	MaxCardFieldLength = 256
+)
+
 const (
 	// AdressServer адрес сервера по умолчанию
 	AdressServer = "localhost:8080"
 
+	// AdressGRPC адрес gRPC API сервера по умолчанию
+	AdressGRPC = "localhost:3200"
+
 	// HeaderAuthorization ключ хедера с авторизированным пользователем
 	HeaderAuthorization = "Authorization"
 
+	// HeaderDeviceName ключ хедера с именем устройства клиента
+	HeaderDeviceName = "Device-Name"
+
+	// HeaderClientBuild ключ хедера с версией сборки клиента
+	HeaderClientBuild = "Client-Build"
+
 	// Step размер отрезков в байтах, на который "режим" файл
 	Step = 512000
 
+	// CopyPortions количество порций файла, которые сервер накапливает для записи в БД одной командой COPY
+	CopyPortions = 32
+
+	// ExportPortions количество порций файла, которые выгрузка данных пользователя читает из БД одним запросом
+	ExportPortions = 16
+
 	// DefaultColorClient цвет шрифта клиенского приложения
 	DefaultColorClient = tcell.ColorGreen
 
@@ -87,11 +208,94 @@ const (
 							WHERE 
 								"User" = $1 and "Password" = $2`
 
-	//QueryUpdatUserTemplate запрос на изменение пользователя по имени
-	QueryUpdatUserTemplate = `UPDATE gophkeeper."Users" ("User", "Password")
-							SET "User"=$1, "Password"=$2
+	//QueryUpdatUserTemplate запрос на изменение пароля пользователя по имени
+	QueryUpdatUserTemplate = `UPDATE 
+								gophkeeper."Users"
+							SET 
+								"Password" = $2
+							WHERE 
+								"User" = $1;`
+
+	//QueryLockUser блокировка данных пользователя по имени до конца транзакции. Сохранение записей пользователя,
+	//пакетные изменения и удаление пользователя выполняются по очереди, даже если их выполняют разные экземпляры сервера
+	QueryLockUser = `SELECT pg_advisory_xact_lock(hashtextextended($1, 0));`
+
+	//QueryUpsertUserTemplate запрос на добавление пользователя или изменение его пароля по имени
+	QueryUpsertUserTemplate = `INSERT INTO 
+								gophkeeper."Users" ("User", "Password") 
+							VALUES
+								($1, $2)
+							ON CONFLICT ("User") DO UPDATE SET "Password" = EXCLUDED."Password";`
+
+	//QueryDelUserPortionsBinaryData удаление порций всех файлов пользователя
+	QueryDelUserPortionsBinaryData = `DELETE 
+							FROM 
+								gophkeeper."PortionsFiles"
+							WHERE 
+								"UID" IN (SELECT "UID" FROM gophkeeper."Files" WHERE "User" = $1);`
+
+	//QueryDelUserBinaryData удаление всех произвольных бинарных данных пользователя
+	QueryDelUserBinaryData = `DELETE FROM gophkeeper."Files" WHERE "User" = $1;`
+
+	//QueryDelUserTextData удаление всех произвольных текстовых данных пользователя
+	QueryDelUserTextData = `DELETE FROM gophkeeper."Text" WHERE "User" = $1;`
+
+	//QueryDelUserBankCard удаление всех данных банковских карт пользователя
+	QueryDelUserBankCard = `DELETE FROM gophkeeper."BankCards" WHERE "User" = $1;`
+
+	//QueryDelUserPairs удаление всех пар логин/пароль пользователя
+	QueryDelUserPairs = `DELETE FROM gophkeeper."PairsLoginPassword" WHERE "User" = $1;`
+
+	//QueryDelUserByName удаление пользователя по имени (администратором, без проверки пароля)
+	QueryDelUserByName = `DELETE FROM gophkeeper."Users" WHERE "User" = $1;`
+
+	//QuerySelectUserStatus запрос на выборку роли пользователя и признака блокировки экаунта
+	QuerySelectUserStatus = `SELECT 
+								COALESCE("Role", 'user'), COALESCE("Disabled", false)
+							FROM 
+								gophkeeper."Users"
+							WHERE 
+								"User" = $1;`
+
+	//QueryUpdateUserDisabled запрос на блокировку/разблокировку экаунта пользователя
+	QueryUpdateUserDisabled = `UPDATE 
+								gophkeeper."Users"
+							SET 
+								"Disabled" = $2
+							WHERE 
+								"User" = $1;`
+
+	//QueryUpdateUserRole запрос на смену роли пользователя
+	QueryUpdateUserRole = `UPDATE 
+								gophkeeper."Users"
+							SET 
+								"Role" = $2
 							WHERE 
 								"User" = $1;`
+
+	//QuerySelectUsersStats запрос на выборку пользователей с количеством записей по типам,
+	//объемом хранимых данных в байтах и количеством активных сессий
+	QuerySelectUsersStats = `SELECT 
+								u."User", COALESCE(u."Role", 'user'), COALESCE(u."Disabled", false),
+								(SELECT count(*) FROM gophkeeper."PairsLoginPassword" p WHERE p."User" = u."User"),
+								(SELECT count(*) FROM gophkeeper."Text" t WHERE t."User" = u."User"),
+								(SELECT count(*) FROM gophkeeper."Files" f WHERE f."User" = u."User"),
+								(SELECT count(*) FROM gophkeeper."BankCards" c WHERE c."User" = u."User"),
+								(SELECT COALESCE(sum(pg_column_size(p.*)), 0) FROM gophkeeper."PairsLoginPassword" p 
+									WHERE p."User" = u."User") +
+								(SELECT COALESCE(sum(pg_column_size(t.*)), 0) FROM gophkeeper."Text" t 
+									WHERE t."User" = u."User") +
+								(SELECT COALESCE(sum(pg_column_size(f.*)), 0) FROM gophkeeper."Files" f 
+									WHERE f."User" = u."User") +
+								(SELECT COALESCE(sum(pg_column_size(c.*)), 0) FROM gophkeeper."BankCards" c 
+									WHERE c."User" = u."User") +
+								(SELECT COALESCE(sum(length(pf."Body")), 0) FROM gophkeeper."PortionsFiles" pf 
+									WHERE pf."UID" IN (SELECT f."UID" FROM gophkeeper."Files" f WHERE f."User" = u."User")),
+								(SELECT count(*) FROM gophkeeper."Sessions" s 
+									WHERE s."User" = u."User" AND NOT s."Revoked" AND s."Created" > $1)
+							FROM 
+								gophkeeper."Users" u
+							ORDER BY u."User";`
 ) //User
 
 const (
@@ -105,6 +309,15 @@ const (
 							SET "User"=$1, "UID"=$2, "TypePairs"=$3, "Name"=$4, "Password"=$5
 							WHERE "User" = $1 and "UID" = $2;`
 
+	//QueryUpsertPairsTemplate запрос на добавление или изменение пары логин/пароль по пользователю и УИДу.
+	//Записи удаленного пользователя не добавляются (здесь и в остальных запросах добавления/изменения записей)
+	QueryUpsertPairsTemplate = `INSERT INTO gophkeeper."PairsLoginPassword"(
+								"User", "UID", "TypePairs", "Name", "Password")
+							SELECT $1::text, $2::text, $3::text, $4::text, $5::text
+							WHERE EXISTS (SELECT 1 FROM gophkeeper."Users" WHERE "User" = $1::text)
+							ON CONFLICT ("User", "UID") DO UPDATE 
+								SET "TypePairs" = EXCLUDED."TypePairs", "Name" = EXCLUDED."Name", "Password" = EXCLUDED."Password";`
+
 	//QuerySelectPairsTemplate запрос на выборку пары логин/пароль по пользователю
 	QuerySelectPairsTemplate = `SELECT "User", "UID", "TypePairs", "Name", "Password" 
 							FROM 
@@ -138,6 +351,13 @@ const (
 								SET "User"=$1, "UID"=$2, "Text"=$3 
 								WHERE "User" = $1 and "UID" = $2;`
 
+	//QueryUpsertTextData запрос на добавление или изменение произвольных текстовых данных по пользователю и УИДу
+	QueryUpsertTextData = `INSERT INTO gophkeeper."Text"(
+								"User", "UID", "Text")
+							SELECT $1::text, $2::text, $3::text
+							WHERE EXISTS (SELECT 1 FROM gophkeeper."Users" WHERE "User" = $1::text)
+							ON CONFLICT ("User", "UID") DO UPDATE SET "Text" = EXCLUDED."Text";`
+
 	//QuerySelectTextData запрос на выборку произвольных текстовых данных по пользователю
 	QuerySelectTextData = `SELECT "User", "UID", "Text" 
 						FROM 
@@ -171,6 +391,13 @@ const (
 								SET "User"=$1, "UID"=$2, "Number"=$3, "Cvc"=$4 
 								WHERE "User" = $1 and "UID" = $2;`
 
+	//QueryUpsertBankCard запрос на добавление или изменение данных банковских карт по пользователю и УИДу
+	QueryUpsertBankCard = `INSERT INTO gophkeeper."BankCards"(
+								"User", "UID", "Number", "Cvc")
+							SELECT $1::text, $2::text, $3::text, $4::text
+							WHERE EXISTS (SELECT 1 FROM gophkeeper."Users" WHERE "User" = $1::text)
+							ON CONFLICT ("User", "UID") DO UPDATE SET "Number" = EXCLUDED."Number", "Cvc" = EXCLUDED."Cvc";`
+
 	//QuerySelectBankCard запрос на выборку данных банковских карт по пользователю
 	QuerySelectBankCard = `SELECT "User", "UID", "Number", "Cvc" 
 						FROM 
@@ -204,6 +431,15 @@ const (
 								SET "User" = $1, "UID" = $2, "Name" = $3, "Expansion" = $4, "Size" = $5, "Patch" = $6 
 								WHERE "User" = $1 and "UID" = $2;`
 
+	//QueryUpsertBinaryData запрос на добавление или изменение произвольных бинарных данных по пользователю и УИДу
+	QueryUpsertBinaryData = `INSERT INTO gophkeeper."Files"(
+								"User", "UID", "Name", "Expansion", "Size", "Patch")
+							SELECT $1::text, $2::text, $3::text, $4::text, $5::text, $6::text
+							WHERE EXISTS (SELECT 1 FROM gophkeeper."Users" WHERE "User" = $1::text)
+							ON CONFLICT ("User", "UID") DO UPDATE 
+								SET "Name" = EXCLUDED."Name", "Expansion" = EXCLUDED."Expansion", "Size" = EXCLUDED."Size", 
+									"Patch" = EXCLUDED."Patch";`
+
 	//QuerySelectBinaryData запрос на выборку произвольных бинарных данных по пользователю
 	QuerySelectBinaryData = `SELECT "User", "UID", "Name", "Expansion", "Size", "Patch" 
 						FROM 
@@ -235,10 +471,48 @@ const (
 						WHERE
 							"UID" = $1;`
 
-	//QueryInsertPortionsBinaryData запрос на добавление файлов для таблицы бинарных данных
+	//QuerySelectPortionsPage запрос на выборку порций файла по УИДу после смещения $2, не больше $3 порций
+	QuerySelectPortionsPage = `SELECT
+							"UID", "Portion", "Body"
+						FROM
+							gophkeeper."PortionsFiles"
+						WHERE
+							"UID" = $1 AND "Portion" > $2
+						ORDER BY "Portion"
+						LIMIT $3;`
+
+	//QueryInsertPortionsBinaryData запрос на добавление файлов для таблицы бинарных данных.
+	//Повторно отправленная порция заменяет сохраненную.
+	//Сервер пишет порции командой COPY, запрос используется для сравнения в бенчмарках
 	QueryInsertPortionsBinaryData = `INSERT INTO 
 							gophkeeper."PortionsFiles"("UID", "Portion", "Body")
-						VALUES ($1, $2, $3);`
+						VALUES ($1, $2, $3)
+						ON CONFLICT ("UID", "Portion") DO UPDATE SET "Body" = EXCLUDED."Body";`
+
+	//QueryCreatePortionsCopy временная таблица порций файлов для записи командой COPY до конца транзакции
+	QueryCreatePortionsCopy = `CREATE TEMP TABLE "PortionsCopy" 
+							(LIKE gophkeeper."PortionsFiles" INCLUDING DEFAULTS) 
+						ON COMMIT DROP;`
+
+	//QueryUpsertPortionsCopy перенос порций из временной таблицы. Повторно отправленная порция заменяет
+	//сохраненную, из повторов одной пачки остается последняя
+	QueryUpsertPortionsCopy = `INSERT INTO 
+							gophkeeper."PortionsFiles"("UID", "Portion", "Body")
+						SELECT DISTINCT ON ("UID", "Portion") 
+							"UID", "Portion", "Body" 
+						FROM 
+							"PortionsCopy" 
+						ORDER BY "UID", "Portion", ctid DESC
+						ON CONFLICT ("UID", "Portion") DO UPDATE SET "Body" = EXCLUDED."Body";`
+
+	//QuerySelectFilesStored запрос на выборку объема порций файлов пользователя, сохраненных в БД, по УИДам файлов
+	QuerySelectFilesStored = `SELECT 
+							pf."UID", COALESCE(sum(length(pf."Body")), 0)
+						FROM
+							gophkeeper."PortionsFiles" pf
+						WHERE
+							pf."UID" IN (SELECT f."UID" FROM gophkeeper."Files" f WHERE f."User" = $1)
+						GROUP BY pf."UID";`
 
 	//QueryDelPortionsBinaryData запрос на уделению файлов для таблицы бинарных данных по УИДу
 	QueryDelPortionsBinaryData = `DELETE FROM gophkeeper."PortionsFiles"	
@@ -246,6 +520,180 @@ const (
 							"UID" = $1;`
 ) //PortionsBinaryData
 
+const (
+	//QueryInsertLockout запрос на добавление записи аудита блокировки/разблокировки
+	QueryInsertLockout = `INSERT INTO 
+							gophkeeper."Lockouts"("Key", "Event", "Failures", "Until", "Date")
+						VALUES ($1, $2, $3, $4, $5);`
+) //Lockouts
+
+const (
+	//QueryInsertSession запрос на добавление сессии пользователя
+	QueryInsertSession = `INSERT INTO 
+							gophkeeper."Sessions"("UID", "User", "Device", "Build", "IP", "Created", "LastSeen", "Revoked",
+								"DeviceID")
+						VALUES ($1, $2, $3, $4, $5, $6, $6, false, $7);`
+
+	//QuerySelectSessions запрос на выборку активных сессий пользователя, созданных после указанной даты
+	QuerySelectSessions = `SELECT 
+							"UID", "User", "Device", "Build", "IP", "Created", "LastSeen", COALESCE("DeviceID", '')
+						FROM 
+							gophkeeper."Sessions"
+						WHERE 
+							"User" = $1 AND NOT "Revoked" AND "Created" > $2
+						ORDER BY "Created";`
+
+	//QuerySelectActiveSession запрос на выборку сессии по УИДу, если она не отозвана и создана после указанной даты
+	QuerySelectActiveSession = `SELECT 
+							"UID", "User", "Created"
+						FROM 
+							gophkeeper."Sessions"
+						WHERE 
+							"UID" = $1 AND NOT "Revoked" AND "Created" > $2;`
+
+	//QuerySelectRevokedSessions запрос на выборку отозванных сессий, созданных после указанной даты
+	QuerySelectRevokedSessions = `SELECT 
+							"UID"
+						FROM 
+							gophkeeper."Sessions"
+						WHERE 
+							"Revoked" AND "Created" > $1;`
+
+	//QueryRevokeSession запрос на отзыв сессии пользователя по УИДу
+	QueryRevokeSession = `UPDATE 
+							gophkeeper."Sessions"
+						SET 
+							"Revoked" = true
+						WHERE 
+							"UID" = $1 AND "User" = $2 AND NOT "Revoked";`
+
+	//QueryRevokeUserSessions запрос на отзыв всех сессий пользователя, кроме сессии $2.
+	//Возвращает УИДы отозванных сессий
+	QueryRevokeUserSessions = `UPDATE 
+							gophkeeper."Sessions"
+						SET 
+							"Revoked" = true
+						WHERE 
+							"User" = $1 AND "UID" <> $2 AND NOT "Revoked"
+						RETURNING "UID";`
+
+	//QueryDelUserSessions удаление всех сессий пользователя (при удалении экаунта)
+	QueryDelUserSessions = `DELETE FROM gophkeeper."Sessions" WHERE "User" = $1;`
+
+	//QueryUpdateSessionLastSeen запрос на обновление времени последней активности сессии
+	QueryUpdateSessionLastSeen = `UPDATE 
+							gophkeeper."Sessions"
+						SET 
+							"LastSeen" = $2
+						WHERE 
+							"UID" = $1;`
+) //Sessions
+
+const (
+	//QueryInsertDevice запрос на добавление устройства пользователя с выпущенным сертификатом
+	QueryInsertDevice = `INSERT INTO 
+							gophkeeper."Devices"("UID", "User", "Name", "Serial", "Created", "NotAfter", "Revoked")
+						VALUES ($1, $2, $3, $4, $5, $6, false);`
+
+	//QuerySelectDevices запрос на выборку действующих устройств пользователя
+	QuerySelectDevices = `SELECT 
+							"UID", "User", "Name", "Serial", "Created", "NotAfter"
+						FROM 
+							gophkeeper."Devices"
+						WHERE 
+							"User" = $1 AND NOT "Revoked" AND "NotAfter" > $2
+						ORDER BY "Created";`
+
+	//QuerySelectRevokedDevices запрос на выборку отозванных устройств, сертификаты которых еще не истекли
+	QuerySelectRevokedDevices = `SELECT 
+							"UID"
+						FROM 
+							gophkeeper."Devices"
+						WHERE 
+							"Revoked" AND "NotAfter" > $1;`
+
+	//QueryRevokeDevice запрос на отзыв устройства пользователя по УИДу
+	QueryRevokeDevice = `UPDATE 
+							gophkeeper."Devices"
+						SET 
+							"Revoked" = true
+						WHERE 
+							"UID" = $1 AND "User" = $2 AND NOT "Revoked";`
+
+	//QueryRevokeUserDevices запрос на отзыв всех устройств пользователя. Возвращает УИДы отозванных устройств.
+	//Строки устройств не удаляются: сертификат отозванного устройства не должен подойти экаунту с тем же именем
+	QueryRevokeUserDevices = `UPDATE 
+							gophkeeper."Devices"
+						SET 
+							"Revoked" = true
+						WHERE 
+							"User" = $1 AND NOT "Revoked"
+						RETURNING "UID";`
+) //Devices
+
+const (
+	//QueryInsertAudit запрос на добавление записи в журнал аудита
+	QueryInsertAudit = `INSERT INTO 
+							gophkeeper."Audit"("User", "Event", "Type", "UID", "IP", "Session", "Success", "Date",
+								"PrevHash", "Hash")
+						VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);`
+
+	//QueryLockAudit блокировка добавления в журнал аудита до конца транзакции.
+	//Нужна, что бы записи цепочки хешей добавлялись строго последовательно
+	QueryLockAudit = `SELECT pg_advisory_xact_lock(7001);`
+
+	//QuerySelectLastAudit запрос на выборку последней записи цепочки журнала аудита
+	QuerySelectLastAudit = `SELECT 
+							"ID", COALESCE("Hash", '')
+						FROM 
+							gophkeeper."Audit"
+						ORDER BY "ID" DESC
+						LIMIT 1;`
+
+	//QuerySelectAuditChain запрос на выборку всего журнала аудита в порядке добавления
+	QuerySelectAuditChain = `SELECT 
+							"ID", "User", "Event", "Type", "UID", "IP", "Session", "Success", "Date",
+							COALESCE("PrevHash", ''), COALESCE("Hash", '')
+						FROM 
+							gophkeeper."Audit"
+						ORDER BY "ID";`
+
+	//QueryInsertAuditCheckpoint запрос на добавление подписанной контрольной точки журнала аудита
+	QueryInsertAuditCheckpoint = `INSERT INTO 
+							gophkeeper."AuditCheckpoints"("AuditID", "Hash", "Signature", "Date")
+						VALUES ($1, $2, $3, $4);`
+
+	//QuerySelectAuditCheckpoints запрос на выборку всех контрольных точек журнала аудита
+	QuerySelectAuditCheckpoints = `SELECT 
+							"ID", "AuditID", "Hash", "Signature", "Date"
+						FROM 
+							gophkeeper."AuditCheckpoints"
+						ORDER BY "ID";`
+
+	//QuerySelectLastAuditCheckpoint запрос на выборку записи журнала последней контрольной точки
+	QuerySelectLastAuditCheckpoint = `SELECT 
+							COALESCE(MAX("AuditID"), 0)
+						FROM 
+							gophkeeper."AuditCheckpoints";`
+
+	//QuerySelectAudit запрос на выборку журнала аудита пользователя за период, последние записи первыми
+	QuerySelectAudit = `SELECT 
+							"ID", "User", "Event", "Type", "UID", "IP", "Session", "Success", "Date",
+							COALESCE("PrevHash", ''), COALESCE("Hash", '')
+						FROM 
+							gophkeeper."Audit"
+						WHERE 
+							"User" = $1 AND "Date" >= $2 AND "Date" <= $3
+						ORDER BY "ID" DESC
+						LIMIT $4;`
+) //Audit
+
+const (
+	//QueryLockMigrations блокировка применения миграций схемы БД до конца транзакции.
+	//Нужна, что бы экземпляры сервера, запущенные одновременно, не применяли одну миграцию дважды
+	QueryLockMigrations = `SELECT pg_advisory_xact_lock(7002);`
+) //Migrations
+
 const (
 	KeyCtrlC = 3
 	Key0     = 48
@@ -256,6 +704,8 @@ const (
 	Key5     = 53
 	Key6     = 54
 	Key7     = 55
+	Key8     = 56
+	Key9     = 57
 )
 
 // HashKey ключ по умолчанию для хешированию паролей
@@ -264,6 +714,15 @@ var HashKey = []byte("taekwondo")
 // TimeLiveToken время жизни токена. После завершения времени надо перелогиниться.
 var TimeLiveToken time.Duration = 5
 
+// TimeLiveDeviceCert время жизни сертификата устройства
+var TimeLiveDeviceCert = 365 * 24 * time.Hour
+
+// QuotaRefreshInterval период обновления использования квот пользователя в клиенте
+var QuotaRefreshInterval = 5 * time.Second
+
+// AuditRetryInterval период повторного сохранения записей журнала аудита после ошибки БД
+var AuditRetryInterval = 5 * time.Second
+
 // Logger логер системы
 var Logger logger.Logger
 
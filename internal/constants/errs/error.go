@@ -3,7 +3,9 @@ package errs
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 )
 
 // InvalidFormat Ошибка в тексте SQL запроса
@@ -18,12 +20,102 @@ var ErrErrorServer = errors.New("error server")
 // ErrInvalidLoginPassword пара пользователь и пароль не найдены.
 var ErrInvalidLoginPassword = errors.New("invalid login password")
 
+// ErrNotFound объект не найден.
+var ErrNotFound = errors.New("not found")
+
+// ErrUnauthorized токен не передан, не валиден или его сессия отозвана.
+var ErrUnauthorized = errors.New("not authorized")
+
+// ErrForbidden доступ запрещен.
+var ErrForbidden = errors.New("forbidden")
+
+// ErrAccountDisabled экаунт пользователя заблокирован администратором.
+var ErrAccountDisabled = errors.New("account disabled")
+
+// ErrDeviceRequired не предъявлен сертификат устройства или он не подходит к токену.
+var ErrDeviceRequired = errors.New("device certificate required")
+
+// ErrTooManyRequests превышено количество неудачных попыток.
+var ErrTooManyRequests = errors.New("too many attempts")
+
+// ErrValidation данные записи не прошли проверку. Ошибки полей передаются в ValidationError.
+var ErrValidation = errors.New("validation failed")
+
+// ErrTooLarge тело запроса превышает допустимый размер.
+var ErrTooLarge = errors.New("request body too large")
+
+// ErrQuotaExceeded запись превышает квоту пользователя. Подробности передаются в QuotaError.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// ErrUnavailable сервер временно не может принять запрос (например, заполнено хранилище сервера).
+var ErrUnavailable = errors.New("service unavailable")
+
+// ErrUnsupportedEncoding тело запроса сжато неизвестным серверу способом (Content-Encoding).
+var ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// FieldError ошибка поля записи
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError ошибки полей записи. Разворачивается в ErrValidation
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Error текст ошибки с перечнем полей
+func (e *ValidationError) Error() string {
+	arr := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		arr[i] = f.Field + ": " + f.Message
+	}
+	return ErrValidation.Error() + ": " + strings.Join(arr, "; ")
+}
+
+// Unwrap ошибка пакета ErrValidation
+func (e *ValidationError) Unwrap() error {
+	return ErrValidation
+}
+
+// Add добавляет ошибку поля
+func (e *ValidationError) Add(field, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: message})
+}
+
+// Err возвращает ошибку, если есть ошибки полей, иначе nil
+func (e *ValidationError) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// QuotaError превышение квоты пользователя. Quota квота (bytes, records, file_size), Limit значение квоты,
+// Used использовано без текущей записи, Requested требуется для текущей записи. Разворачивается в ErrQuotaExceeded
+type QuotaError struct {
+	Quota     string `json:"quota"`
+	Limit     int64  `json:"limit"`
+	Used      int64  `json:"used"`
+	Requested int64  `json:"requested"`
+}
+
+// Error текст ошибки с квотой и использованием
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s: %s used %d of %d, requested %d", ErrQuotaExceeded.Error(), e.Quota, e.Used, e.Limit, e.Requested)
+}
+
+// Unwrap ошибка пакета ErrQuotaExceeded
+func (e *QuotaError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
 // HTTPErrors Приведение ошибки к HTTP статусам
 func HTTPErrors(err error) int {
 
 	HTTPAnswer := http.StatusOK
 
-	if errors.Is(err, InvalidFormat) {
+	if errors.Is(err, InvalidFormat) || errors.Is(err, ErrValidation) {
 		HTTPAnswer = http.StatusBadRequest
 	} else if errors.Is(err, ErrLoginBusy) {
 		HTTPAnswer = http.StatusConflict
@@ -31,6 +123,26 @@ func HTTPErrors(err error) int {
 		HTTPAnswer = http.StatusInternalServerError
 	} else if errors.Is(err, ErrInvalidLoginPassword) {
 		HTTPAnswer = http.StatusUnauthorized
+	} else if errors.Is(err, ErrNotFound) {
+		HTTPAnswer = http.StatusNotFound
+	} else if errors.Is(err, ErrUnauthorized) {
+		HTTPAnswer = http.StatusUnauthorized
+	} else if errors.Is(err, ErrForbidden) || errors.Is(err, ErrDeviceRequired) || errors.Is(err, ErrAccountDisabled) ||
+		errors.Is(err, ErrQuotaExceeded) {
+		HTTPAnswer = http.StatusForbidden
+	} else if errors.Is(err, ErrTooManyRequests) {
+		HTTPAnswer = http.StatusTooManyRequests
+	} else if errors.Is(err, ErrTooLarge) {
+		HTTPAnswer = http.StatusRequestEntityTooLarge
+	} else if errors.Is(err, ErrUnavailable) {
+		HTTPAnswer = http.StatusServiceUnavailable
+	} else if errors.Is(err, ErrUnsupportedEncoding) {
+		HTTPAnswer = http.StatusUnsupportedMediaType
 	}
 	return HTTPAnswer
 }
+
+// Invalid ошибка формата запроса. Текст исходной ошибки сохраняется в описании
+func Invalid(err error) error {
+	return fmt.Errorf("%w: %s", InvalidFormat, err.Error())
+}
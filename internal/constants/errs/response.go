@@ -0,0 +1,191 @@
+package errs
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// HeaderRequestID ключ хедера с идентификатором запроса
+const HeaderRequestID = "X-Request-ID"
+
+// HeaderTraceID ключ хедера с идентификатором трассировки запроса
+const HeaderTraceID = "X-Trace-ID"
+
+// Стабильные коды ошибок API. Клиенты должны опираться на код, а не на текст ошибки
+const (
+	CodeInvalidFormat        = "invalid_format"
+	CodeLoginBusy            = "login_busy"
+	CodeServerError          = "server_error"
+	CodeInvalidLoginPassword = "invalid_login_password"
+	CodeNotFound             = "not_found"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeDeviceRequired       = "device_certificate_required"
+	CodeAccountDisabled      = "account_disabled"
+	CodeTooManyRequests      = "too_many_requests"
+	CodeValidation           = "validation_failed"
+	CodeTooLarge             = "payload_too_large"
+	CodeQuotaExceeded        = "quota_exceeded"
+	CodeUnavailable          = "unavailable"
+	CodeUnsupportedEncoding  = "unsupported_encoding"
+)
+
+// codeErrors соответствие кода ошибки ошибке пакета
+var codeErrors = map[string]error{
+	CodeInvalidFormat:        InvalidFormat,
+	CodeLoginBusy:            ErrLoginBusy,
+	CodeServerError:          ErrErrorServer,
+	CodeInvalidLoginPassword: ErrInvalidLoginPassword,
+	CodeNotFound:             ErrNotFound,
+	CodeUnauthorized:         ErrUnauthorized,
+	CodeForbidden:            ErrForbidden,
+	CodeDeviceRequired:       ErrDeviceRequired,
+	CodeAccountDisabled:      ErrAccountDisabled,
+	CodeTooManyRequests:      ErrTooManyRequests,
+	CodeValidation:           ErrValidation,
+	CodeTooLarge:             ErrTooLarge,
+	CodeQuotaExceeded:        ErrQuotaExceeded,
+	CodeUnavailable:          ErrUnavailable,
+	CodeUnsupportedEncoding:  ErrUnsupportedEncoding,
+}
+
+// ErrorResponse тело ответа сервера с ошибкой.
+// Code стабильный код ошибки, Message описание, Details подробности (например, ошибки полей),
+// RequestID идентификатор запроса для поиска в логах сервера, TraceID идентификатор трассировки
+// для поиска в системе трассировки (если трассировка включена)
+type ErrorResponse struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+	TraceID   string      `json:"trace_id,omitempty"`
+}
+
+// Code стабильный код ошибки. Неизвестные ошибки считаются ошибками сервера
+func Code(err error) string {
+	for _, code := range []string{CodeInvalidFormat, CodeLoginBusy, CodeInvalidLoginPassword, CodeNotFound,
+		CodeUnauthorized, CodeForbidden, CodeDeviceRequired, CodeAccountDisabled, CodeTooManyRequests, CodeValidation,
+		CodeTooLarge, CodeQuotaExceeded, CodeUnavailable, CodeUnsupportedEncoding} {
+		if errors.Is(err, codeErrors[code]) {
+			return code
+		}
+	}
+	return CodeServerError
+}
+
+// WriteError отправляет ошибку в формате JSON с HTTP статусом по ошибке.
+// Идентификаторы запроса и трассировки берутся из хедеров ответа, которые заполняют middleware
+func WriteError(w http.ResponseWriter, err error) {
+	WriteErrorDetails(w, err, nil)
+}
+
+// WriteErrorDetails отправляет ошибку с подробностями в формате JSON.
+// Для ошибки проверки данных без подробностей в подробностях передаются ошибки полей,
+// для превышения квоты - квота и использование
+func WriteErrorDetails(w http.ResponseWriter, err error, details interface{}) {
+	var ve *ValidationError
+	var qe *QuotaError
+	if details == nil && errors.As(err, &ve) {
+		details = ve.Fields
+	} else if details == nil && errors.As(err, &qe) {
+		details = qe
+	}
+
+	status := HTTPErrors(err)
+	if status == http.StatusOK {
+		status = http.StatusInternalServerError
+	}
+
+	requestID := w.Header().Get(HeaderRequestID)
+	if requestID == "" {
+		requestID = uuid.New().String()
+		w.Header().Set(HeaderRequestID, requestID)
+	}
+
+	msg, _ := json.Marshal(ErrorResponse{
+		Code:      Code(err),
+		Message:   err.Error(),
+		Details:   details,
+		RequestID: requestID,
+		TraceID:   w.Header().Get(HeaderTraceID),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_, _ = w.Write(msg)
+}
+
+// APIError ошибка, полученная от сервера. Разворачивается в ошибку пакета по коду,
+// поэтому проверяется через errors.Is, например errors.Is(err, errs.ErrNotFound)
+type APIError struct {
+	ErrorResponse
+	Status int
+}
+
+// Error текст ошибки для пользователя
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return http.StatusText(e.Status)
+	}
+	return e.Message
+}
+
+// Unwrap ошибка пакета по коду ошибки
+func (e *APIError) Unwrap() error {
+	return codeErrors[e.Code]
+}
+
+// FromResponse ошибка по ответу сервера. Для ответа со статусом 200 возвращает nil.
+// Если тело ответа не в формате ошибки API, то код определяется по HTTP статусу
+func FromResponse(resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	e := &APIError{Status: resp.StatusCode}
+	if err := json.Unmarshal(body, &e.ErrorResponse); err != nil || e.Code == "" {
+		e.ErrorResponse = ErrorResponse{
+			Code:    statusCode(resp.StatusCode),
+			Message: strings.TrimSpace(string(body)),
+		}
+	}
+	if e.RequestID == "" {
+		e.RequestID = resp.Header.Get(HeaderRequestID)
+	}
+	if e.TraceID == "" {
+		e.TraceID = resp.Header.Get(HeaderTraceID)
+	}
+	return e
+}
+
+// statusCode код ошибки по HTTP статусу
+func statusCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidFormat
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeLoginBusy
+	case http.StatusTooManyRequests:
+		return CodeTooManyRequests
+	case http.StatusRequestEntityTooLarge:
+		return CodeTooLarge
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	case http.StatusUnsupportedMediaType:
+		return CodeUnsupportedEncoding
+	}
+	return CodeServerError
+}
@@ -0,0 +1,73 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		target error
+	}{
+		{name: "Not found", err: ErrNotFound, status: http.StatusNotFound, code: CodeNotFound, target: ErrNotFound},
+		{name: "Invalid", err: Invalid(errors.New("unexpected EOF")), status: http.StatusBadRequest, code: CodeInvalidFormat, target: InvalidFormat},
+		{name: "Wrapped", err: fmt.Errorf("%w: page /x", ErrNotFound), status: http.StatusNotFound, code: CodeNotFound, target: ErrNotFound},
+		{name: "Device", err: ErrDeviceRequired, status: http.StatusForbidden, code: CodeDeviceRequired, target: ErrDeviceRequired},
+		{name: "Disabled", err: ErrAccountDisabled, status: http.StatusForbidden, code: CodeAccountDisabled, target: ErrAccountDisabled},
+		{name: "Quota", err: &QuotaError{Quota: "bytes", Limit: 10, Used: 8, Requested: 4}, status: http.StatusForbidden,
+			code: CodeQuotaExceeded, target: ErrQuotaExceeded},
+		{name: "Unavailable", err: fmt.Errorf("%w: staging buffer full", ErrUnavailable), status: http.StatusServiceUnavailable,
+			code: CodeUnavailable, target: ErrUnavailable},
+		{name: "Encoding", err: ErrUnsupportedEncoding, status: http.StatusUnsupportedMediaType,
+			code: CodeUnsupportedEncoding, target: ErrUnsupportedEncoding},
+		{name: "Unknown", err: errors.New("db down"), status: http.StatusInternalServerError, code: CodeServerError, target: ErrErrorServer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			w.Header().Set(HeaderRequestID, "req-1")
+			WriteError(w, tt.err)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status %d, want %d", resp.StatusCode, tt.status)
+			}
+
+			err := FromResponse(resp)
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("error %T, want *APIError", err)
+			}
+			if apiErr.Code != tt.code || apiErr.RequestID != "req-1" || apiErr.Message != tt.err.Error() {
+				t.Errorf("got %+v", apiErr.ErrorResponse)
+			}
+			if !errors.Is(err, tt.target) {
+				t.Errorf("errors.Is(%v, %v) = false", err, tt.target)
+			}
+		})
+	}
+}
+
+func TestFromResponsePlain(t *testing.T) {
+	w := httptest.NewRecorder()
+	http.Error(w, "Too many attempts", http.StatusTooManyRequests)
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	err := FromResponse(resp)
+	if !errors.Is(err, ErrTooManyRequests) || !strings.Contains(err.Error(), "Too many attempts") {
+		t.Errorf("got %v", err)
+	}
+	if FromResponse(&http.Response{StatusCode: http.StatusOK}) != nil {
+		t.Error("nil error expected for status 200")
+	}
+}
@@ -44,6 +44,11 @@ func DecryptString(cryptoText string, keyString string) string {
 	return string(decrypted)
 }
 
+// EncryptedLen максимальная длина строки, которую возвращает EncryptString для строки длиной n байт
+func EncryptedLen(n int) int {
+	return base64.URLEncoding.EncodedLen(aes.BlockSize + n)
+}
+
 // EncryptString шифрует строку. Использует текстовый ключ. Если возникает ошибка, то возвращает изночальную строку
 func EncryptString(plainText string, keyString string) string {
 
@@ -5,23 +5,58 @@ import (
 	"flag"
 	"log"
 	"os"
+	"path/filepath"
 
 	"github.com/caarlos0/env/v6"
 
 	"gophkeeper/internal/constants"
 )
 
-// ClientConfig структура хранения свойств конфигурации клиента
+// ClientConfig структура хранения свойств конфигурации клиента.
+// Сертификат сервера проверяется по закрепленному отпечатку TLSPin, по корневым сертификатам TLSCA
+// или по файлу KnownHosts (доверие при первом подключении).
+// AllowPlaintext разрешает подключение к серверу без TLS.
+// DeviceCert и DeviceKey сертификат и ключ устройства, которые выпускаются сервером после входа.
+// Trace трассировка запросов клиента, экспортер stdout не подходит для клиента: вывод смешивается с интерфейсом
 type ClientConfig struct {
 	Address   string
 	Key       string
 	CryptoKey string
+
+	TLSCA          string
+	TLSPin         string
+	KnownHosts     string
+	AllowPlaintext bool
+	DeviceCert     string
+	DeviceKey      string
+
+	Trace TraceConfig
 }
 
 type clientConfigENV struct {
 	Address   string `env:"ADDRESS" envDefault:"localhost:8080"`
 	Key       string `env:"KEY"`
 	CryptoKey string `env:"CRYPTO_KEY"`
+
+	TLSCA          string `env:"TLS_CA"`
+	TLSPin         string `env:"TLS_PIN"`
+	KnownHosts     string `env:"KNOWN_HOSTS"`
+	AllowPlaintext bool   `env:"ALLOW_PLAINTEXT"`
+	DeviceCert     string `env:"DEVICE_CERT"`
+	DeviceKey      string `env:"DEVICE_KEY"`
+
+	TraceExporter string `env:"TRACE_EXPORTER"`
+	TraceEndpoint string `env:"TRACE_ENDPOINT"`
+	TraceFile     string `env:"TRACE_FILE"`
+}
+
+// defaultClientFile путь к файлу клиента по умолчанию в каталоге ~/.gophkeeper
+func defaultClientFile(name string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return name
+	}
+	return filepath.Join(home, ".gophkeeper", name)
 }
 
 // InitConfigAgent Инициализация и заполнения свойств структуры конфигурации клиента
@@ -59,6 +94,17 @@ func (c *ClientConfig) InitConfigAgentENV() {
 
 	c.Address = addressServ
 	c.Key = keyHash
+	c.TLSCA = cfgENV.TLSCA
+	c.TLSPin = cfgENV.TLSPin
+	c.KnownHosts = cfgENV.KnownHosts
+	c.AllowPlaintext = cfgENV.AllowPlaintext
+	c.DeviceCert = cfgENV.DeviceCert
+	c.DeviceKey = cfgENV.DeviceKey
+	c.Trace = TraceConfig{
+		Exporter: cfgENV.TraceExporter,
+		Endpoint: cfgENV.TraceEndpoint,
+		File:     cfgENV.TraceFile,
+	}
 	fileInfo, err := os.Stat(patchCryptoKey)
 	if fileInfo != nil && err == nil {
 		res, err := os.ReadFile(patchCryptoKey)
@@ -76,9 +122,46 @@ func (c *ClientConfig) InitConfigAgentFlag() {
 	addressPtr := flag.String("a", "", "имя сервера")
 	keyFlag := flag.String("k", "", "ключ хеширования")
 	cryptoKeyFlag := flag.String("c", "", "файл с криптоключем")
+	tlsCAFlag := flag.String("tls-ca", "", "файл корневых сертификатов для проверки сервера")
+	tlsPinFlag := flag.String("tls-pin", "", "отпечаток SHA-256 сертификата сервера")
+	knownHostsFlag := flag.String("known-hosts", defaultClientFile("known_hosts"), "файл отпечатков сертификатов серверов")
+	allowPlaintextFlag := flag.Bool("insecure-plaintext", false, "подключение к серверу без TLS")
+	deviceCertFlag := flag.String("device-cert", defaultClientFile("device.crt"), "файл сертификата устройства")
+	deviceKeyFlag := flag.String("device-key", defaultClientFile("device.key"), "файл ключа устройства")
+	traceExporterFlag := flag.String("trace-exporter", "none", "экспортер трассировки: none, file, otlp")
+	traceEndpointFlag := flag.String("trace-endpoint", "", "адрес коллектора OTLP HTTP, например http://localhost:4318")
+	traceFileFlag := flag.String("trace-file", defaultClientFile("trace.json"), "файл трассировки для экспортера file")
 
 	flag.Parse()
 
+	if c.TLSCA == "" {
+		c.TLSCA = *tlsCAFlag
+	}
+	if c.TLSPin == "" {
+		c.TLSPin = *tlsPinFlag
+	}
+	if c.KnownHosts == "" {
+		c.KnownHosts = *knownHostsFlag
+	}
+	if !c.AllowPlaintext {
+		c.AllowPlaintext = *allowPlaintextFlag
+	}
+	if c.DeviceCert == "" {
+		c.DeviceCert = *deviceCertFlag
+	}
+	if c.DeviceKey == "" {
+		c.DeviceKey = *deviceKeyFlag
+	}
+	if c.Trace.Exporter == "" {
+		c.Trace.Exporter = *traceExporterFlag
+	}
+	if c.Trace.Endpoint == "" {
+		c.Trace.Endpoint = *traceEndpointFlag
+	}
+	if c.Trace.File == "" {
+		c.Trace.File = *traceFileFlag
+	}
+
 	if c.Address == "" {
 		c.Address = *addressPtr
 	}
@@ -1,73 +1,450 @@
 package environment
 
 import (
+	"bytes"
+	"errors"
 	"flag"
-	"log"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
 	"os"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/caarlos0/env/v6"
+	"gopkg.in/yaml.v3"
 
 	"gophkeeper/internal/constants"
 )
 
-// serverConfigENV структура для хранения параметров сеанса
-type serverConfigENV struct {
-	Address     string `env:"ADDRESS" envDefault:"localhost:8080"`
-	DatabaseDsn string `env:"DATABASE_URI"`
-	Key         string `env:"KEY"`
-}
+// redacted значение секрета в выводе конфигурации
+const redacted = "REDACTED"
 
-// DBConfig структура хранения свойств базы данных
+// DBConfig структура хранения свойств базы данных.
+// MaxConns и MinConns размер пула соединений, MaxConnLifetime и MaxConnIdleTime время жизни и простоя соединения.
+// Нулевые значения означают значения pgxpool по умолчанию.
+// QueryTimeout ограничение времени одного обращения к БД, 0 - без ограничения
 type DBConfig struct {
-	DatabaseDsn string
-	Key         string
+	DatabaseDsn     string        `yaml:"dsn" env:"DATABASE_URI"`
+	Key             string        `yaml:"key" env:"KEY"`
+	MaxConns        int32         `yaml:"max_conns" env:"DB_MAX_CONNS"`
+	MinConns        int32         `yaml:"min_conns" env:"DB_MIN_CONNS"`
+	MaxConnLifetime time.Duration `yaml:"max_conn_lifetime" env:"DB_MAX_CONN_LIFETIME"`
+	MaxConnIdleTime time.Duration `yaml:"max_conn_idle_time" env:"DB_MAX_CONN_IDLE_TIME"`
+	QueryTimeout    time.Duration `yaml:"query_timeout" env:"DB_QUERY_TIMEOUT"`
+}
+
+// RateLimitConfig структура хранения свойств ограничения неудачных попыток входа и регистрации.
+// После Attempts неудачных попыток за Window ключ (пользователь или IP) блокируется на Lockout.
+// Каждая следующая блокировка в два раза длиннее, но не более MaxLockout
+type RateLimitConfig struct {
+	Attempts   int           `yaml:"attempts" env:"RATE_LIMIT_ATTEMPTS"`
+	Window     time.Duration `yaml:"window" env:"RATE_LIMIT_WINDOW"`
+	Lockout    time.Duration `yaml:"lockout" env:"RATE_LIMIT_LOCKOUT"`
+	MaxLockout time.Duration `yaml:"max_lockout" env:"RATE_LIMIT_MAX_LOCKOUT"`
+}
+
+// AuditConfig структура хранения свойств журнала аудита.
+// KeyFile файл ключа подписи контрольных точек (создается при первом запуске),
+// CheckpointInterval период создания контрольных точек
+type AuditConfig struct {
+	KeyFile            string        `yaml:"key_file" env:"AUDIT_KEY"`
+	CheckpointInterval time.Duration `yaml:"checkpoint_interval" env:"AUDIT_CHECKPOINT_INTERVAL"`
+}
+
+// TLSConfig структура хранения свойств TLS сервера.
+// Если файлов сертификата и ключа нет, то при запуске создается самоподписанный сертификат.
+// Disabled отключает TLS (только для разработки и тестов).
+// ClientCerts включает проверку сертификатов устройств, которые выпускает удостоверяющий центр сервера
+// CACertFile/CAKeyFile (создается при первом запуске)
+type TLSConfig struct {
+	CertFile    string `yaml:"cert_file" env:"TLS_CERT"`
+	KeyFile     string `yaml:"key_file" env:"TLS_KEY"`
+	Disabled    bool   `yaml:"disabled" env:"TLS_DISABLED"`
+	CACertFile  string `yaml:"ca_cert_file" env:"TLS_CA_CERT"`
+	CAKeyFile   string `yaml:"ca_key_file" env:"TLS_CA_KEY"`
+	ClientCerts bool   `yaml:"client_certs" env:"MTLS_REQUIRED"`
+}
+
+// LogConfig структура хранения свойств лога сервера.
+// Level уровень (debug, info, warn, error), Format формат (json или console), File файл лога (пустой - stderr)
+type LogConfig struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL"`
+	Format string `yaml:"format" env:"LOG_FORMAT"`
+	File   string `yaml:"file" env:"LOG_FILE"`
+}
+
+// TraceConfig структура хранения свойств трассировки.
+// Exporter экспортер (none, stdout, file, otlp), Endpoint адрес коллектора OTLP HTTP,
+// File файл трассировки для экспортера file
+type TraceConfig struct {
+	Exporter string `yaml:"exporter" env:"TRACE_EXPORTER"`
+	Endpoint string `yaml:"endpoint" env:"TRACE_ENDPOINT"`
+	File     string `yaml:"file" env:"TRACE_FILE"`
 }
 
-// ServerConfig структура хранения свойств конфигурации сервера
+// QuotaConfig структура хранения квот пользователя. Bytes общий объем файлов пользователя в байтах,
+// Records количество записей каждого типа, FileSize размер одного файла в байтах. 0 означает без ограничения
+type QuotaConfig struct {
+	Bytes    int64 `yaml:"bytes" env:"QUOTA_BYTES"`
+	Records  int   `yaml:"records" env:"QUOTA_RECORDS"`
+	FileSize int64 `yaml:"file_size" env:"QUOTA_FILE_SIZE"`
+}
+
+// FlushConfig структура хранения свойств сохранения хранилища сервера в БД.
+// Interval период сохранения, Shards количество шардов хранилища (шарды сохраняются параллельно),
+// Capacity емкость хранилища в записях: при заполнении запись данных отвечает 503
+type FlushConfig struct {
+	Interval time.Duration `yaml:"interval" env:"FLUSH_INTERVAL"`
+	Shards   int           `yaml:"shards" env:"STAGING_SHARDS"`
+	Capacity int           `yaml:"capacity" env:"STAGING_CAPACITY"`
+}
+
+// ClusterConfig структура хранения свойств согласования экземпляров сервера, работающих с одной БД.
+// Bus шина событий между экземплярами: local (один экземпляр) или postgres (LISTEN/NOTIFY),
+// Channel канал PostgreSQL для событий
+type ClusterConfig struct {
+	Bus     string `yaml:"bus" env:"CLUSTER_BUS"`
+	Channel string `yaml:"channel" env:"CLUSTER_CHANNEL"`
+}
+
+// CacheConfig структура хранения свойств кеша записей пользователей, прочитанных из БД.
+// Users наибольшее количество пользователей, Records наибольшее количество записей в кеше
+type CacheConfig struct {
+	Users   int `yaml:"users" env:"CACHE_USERS"`
+	Records int `yaml:"records" env:"CACHE_RECORDS"`
+}
+
+// ServerConfig структура хранения свойств конфигурации сервера.
+// GRPCAddress адрес gRPC API, пустой адрес отключает gRPC.
+// Значения берутся по возрастанию приоритета: значения по умолчанию, файл конфигурации (флаг -config или
+// параметр сеанса CONFIG_FILE), ключи запуска, параметры сеанса.
+// ShutdownTimeout время на остановку сервера: завершение запросов и сохранение хранилища сервера в БД.
+// TokenKey секрет подписи токенов, без него сервер не запускается. Задается только в файле конфигурации
+// или параметром сеанса, что бы секрет не попадал в список процессов.
+// File файл конфигурации, PrintConfig вывод итоговой конфигурации и выход (флаг -print-config)
 type ServerConfig struct {
-	Address string
-	DBConfig
+	Address         string          `yaml:"address" env:"ADDRESS"`
+	TokenKey        string          `yaml:"token_key" env:"TOKEN_KEY"`
+	GRPCAddress     string          `yaml:"grpc_address" env:"GRPC_ADDRESS"`
+	ShutdownTimeout time.Duration   `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	RateLimit       RateLimitConfig `yaml:"rate_limit"`
+	Audit           AuditConfig     `yaml:"audit"`
+	TLS             TLSConfig       `yaml:"tls"`
+	Log             LogConfig       `yaml:"log"`
+	Trace           TraceConfig     `yaml:"trace"`
+	Quota           QuotaConfig     `yaml:"quota"`
+	Flush           FlushConfig     `yaml:"flush"`
+	Cluster         ClusterConfig   `yaml:"cluster"`
+	Cache           CacheConfig     `yaml:"cache"`
+	DBConfig        `yaml:"database"`
+
+	File        string `yaml:"-" env:"CONFIG_FILE"`
+	PrintConfig bool   `yaml:"-"`
+
+	args []string
 }
 
-// NewConfigServer создание и заполнение структуры свойств сервера
-func NewConfigServer() (*ServerConfig, error) {
+// DefaultServerConfig конфигурация сервера по умолчанию
+func DefaultServerConfig() ServerConfig {
+	return ServerConfig{
+		Address:         constants.AdressServer,
+		GRPCAddress:     constants.AdressGRPC,
+		ShutdownTimeout: 30 * time.Second,
+		DBConfig: DBConfig{
+			QueryTimeout: 10 * time.Second,
+		},
+		RateLimit: RateLimitConfig{
+			Attempts:   5,
+			Window:     15 * time.Minute,
+			Lockout:    time.Minute,
+			MaxLockout: 24 * time.Hour,
+		},
+		Audit: AuditConfig{
+			KeyFile:            "audit.key",
+			CheckpointInterval: time.Hour,
+		},
+		TLS: TLSConfig{
+			CertFile:   "server.crt",
+			KeyFile:    "server.key",
+			CACertFile: "ca.crt",
+			CAKeyFile:  "ca.key",
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Trace: TraceConfig{
+			Exporter: "none",
+			File:     "trace.json",
+		},
+		Flush: FlushConfig{
+			Interval: time.Second / 2,
+			Shards:   16,
+			Capacity: 100000,
+		},
+		Cluster: ClusterConfig{
+			Bus:     "local",
+			Channel: "gophkeeper_events",
+		},
+		Cache: CacheConfig{
+			Users:   10000,
+			Records: 1000000,
+		},
+	}
+}
+
+// NewConfigServer создание и заполнение структуры свойств сервера по ключам запуска args
+// (ключи программы без ее имени, разбираются в main). С ключом -h программа завершается
+func NewConfigServer(args []string) (*ServerConfig, error) {
+	sc, err := LoadServerConfig(args)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	return sc, err
+}
+
+// LoadServerConfig создание и заполнение структуры свойств сервера по ключам запуска args, файлу конфигурации
+// и параметрам сеанса. Итоговая конфигурация проверяется, все ошибки возвращаются одной ошибкой
+func LoadServerConfig(args []string) (*ServerConfig, error) {
+	sc := DefaultServerConfig()
+	sc.args = args
 
-	addressPtr := flag.String("a", constants.AdressServer, "адрес сервера")
-	keyDatabaseDsn := flag.String("d", "", "строка соединения с базой")
-	keyFlag := flag.String("k", "", "ключ хеша")
-	flag.Parse()
+	fs := serverFlags(&sc)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if v, ok := os.LookupEnv("CONFIG_FILE"); ok {
+		sc.File = v
+	}
 
-	var cfgENV serverConfigENV
-	err := env.Parse(&cfgENV)
+	if sc.File != "" {
+		if err := sc.loadFile(sc.File); err != nil {
+			return nil, err
+		}
+		// ключи запуска важнее файла конфигурации: разбираем их еще раз поверх файла
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := env.Parse(&sc); err != nil {
+		return nil, err
+	}
+	if sc.Key == "" {
+		sc.Key = string(constants.HashKey[:])
+	}
+
+	if err := sc.Validate(); err != nil {
+		return nil, err
+	}
+	return &sc, nil
+}
+
+// Reload повторная загрузка конфигурации с теми же ключами запуска. Файл конфигурации и параметры сеанса
+// читаются заново
+func (sc *ServerConfig) Reload() (*ServerConfig, error) {
+	return LoadServerConfig(sc.args)
+}
+
+// serverFlags ключи запуска сервера. Значения ключей записываются сразу в sc
+func serverFlags(sc *ServerConfig) *flag.FlagSet {
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+
+	fs.StringVar(&sc.File, "config", "", "файл конфигурации YAML")
+	fs.BoolVar(&sc.PrintConfig, "print-config", false, "вывести итоговую конфигурацию и выйти")
+	fs.StringVar(&sc.Address, "a", sc.Address, "адрес сервера")
+	fs.StringVar(&sc.GRPCAddress, "g", sc.GRPCAddress, "адрес gRPC API")
+	fs.DurationVar(&sc.ShutdownTimeout, "shutdown-timeout", sc.ShutdownTimeout, "время на остановку сервера")
+	fs.StringVar(&sc.DatabaseDsn, "d", sc.DatabaseDsn, "строка соединения с базой")
+	fs.StringVar(&sc.Key, "k", sc.Key, "ключ хеша")
+	fs.Var(int32Value{&sc.MaxConns}, "db-max-conns", "максимальное количество соединений с БД, 0 - по умолчанию")
+	fs.Var(int32Value{&sc.MinConns}, "db-min-conns", "минимальное количество соединений с БД")
+	fs.DurationVar(&sc.MaxConnLifetime, "db-max-conn-lifetime", sc.MaxConnLifetime, "время жизни соединения с БД")
+	fs.DurationVar(&sc.MaxConnIdleTime, "db-max-conn-idle-time", sc.MaxConnIdleTime, "время простоя соединения с БД")
+	fs.DurationVar(&sc.QueryTimeout, "db-query-timeout", sc.QueryTimeout, "ограничение времени обращения к БД, 0 - без ограничения")
+	fs.IntVar(&sc.RateLimit.Attempts, "rl-attempts", sc.RateLimit.Attempts, "количество неудачных попыток входа до блокировки")
+	fs.DurationVar(&sc.RateLimit.Window, "rl-window", sc.RateLimit.Window, "окно подсчета неудачных попыток входа")
+	fs.DurationVar(&sc.RateLimit.Lockout, "rl-lockout", sc.RateLimit.Lockout, "время первой блокировки")
+	fs.DurationVar(&sc.RateLimit.MaxLockout, "rl-max-lockout", sc.RateLimit.MaxLockout, "максимальное время блокировки")
+	fs.StringVar(&sc.Audit.KeyFile, "audit-key", sc.Audit.KeyFile, "файл ключа подписи контрольных точек журнала аудита")
+	fs.DurationVar(&sc.Audit.CheckpointInterval, "audit-checkpoint", sc.Audit.CheckpointInterval, "период контрольных точек журнала аудита")
+	fs.StringVar(&sc.TLS.CertFile, "tls-cert", sc.TLS.CertFile, "файл сертификата TLS")
+	fs.StringVar(&sc.TLS.KeyFile, "tls-key", sc.TLS.KeyFile, "файл ключа TLS")
+	fs.BoolVar(&sc.TLS.Disabled, "no-tls", sc.TLS.Disabled, "запуск без TLS")
+	fs.StringVar(&sc.TLS.CACertFile, "tls-ca-cert", sc.TLS.CACertFile, "сертификат удостоверяющего центра устройств")
+	fs.StringVar(&sc.TLS.CAKeyFile, "tls-ca-key", sc.TLS.CAKeyFile, "ключ удостоверяющего центра устройств")
+	fs.BoolVar(&sc.TLS.ClientCerts, "mtls", sc.TLS.ClientCerts, "проверка сертификатов устройств")
+	fs.StringVar(&sc.Log.Level, "log-level", sc.Log.Level, "уровень лога: debug, info, warn, error")
+	fs.StringVar(&sc.Log.Format, "log-format", sc.Log.Format, "формат лога: json или console")
+	fs.StringVar(&sc.Log.File, "log-file", sc.Log.File, "файл лога, по умолчанию stderr")
+	fs.StringVar(&sc.Trace.Exporter, "trace-exporter", sc.Trace.Exporter, "экспортер трассировки: none, stdout, file, otlp")
+	fs.StringVar(&sc.Trace.Endpoint, "trace-endpoint", sc.Trace.Endpoint, "адрес коллектора OTLP HTTP, например http://localhost:4318")
+	fs.StringVar(&sc.Trace.File, "trace-file", sc.Trace.File, "файл трассировки для экспортера file")
+	fs.Int64Var(&sc.Quota.Bytes, "quota-bytes", sc.Quota.Bytes, "общий объем файлов пользователя в байтах, 0 - без ограничения")
+	fs.IntVar(&sc.Quota.Records, "quota-records", sc.Quota.Records, "количество записей пользователя каждого типа, 0 - без ограничения")
+	fs.Int64Var(&sc.Quota.FileSize, "quota-file-size", sc.Quota.FileSize, "размер одного файла в байтах, 0 - без ограничения")
+	fs.DurationVar(&sc.Flush.Interval, "flush-interval", sc.Flush.Interval, "период сохранения хранилища сервера в БД")
+	fs.IntVar(&sc.Flush.Shards, "staging-shards", sc.Flush.Shards, "количество шардов хранилища сервера")
+	fs.IntVar(&sc.Flush.Capacity, "staging-capacity", sc.Flush.Capacity, "емкость хранилища сервера в записях")
+	fs.StringVar(&sc.Cluster.Bus, "cluster-bus", sc.Cluster.Bus, "шина событий между экземплярами сервера: local или postgres")
+	fs.StringVar(&sc.Cluster.Channel, "cluster-channel", sc.Cluster.Channel, "канал PostgreSQL для событий между экземплярами")
+	fs.IntVar(&sc.Cache.Users, "cache-users", sc.Cache.Users, "наибольшее количество пользователей в кеше записей")
+	fs.IntVar(&sc.Cache.Records, "cache-records", sc.Cache.Records, "наибольшее количество записей в кеше записей")
+
+	return fs
+}
+
+// int32Value значение ключа запуска типа int32
+type int32Value struct {
+	p *int32
+}
+
+// String текущее значение
+func (v int32Value) String() string {
+	if v.p == nil {
+		return "0"
+	}
+	return fmt.Sprint(*v.p)
+}
+
+// Set разбор значения ключа
+func (v int32Value) Set(s string) error {
+	var n int32
+	if _, err := fmt.Sscan(s, &n); err != nil {
+		return err
+	}
+	*v.p = n
+	return nil
+}
+
+// loadFile загрузка файла конфигурации YAML поверх текущих значений.
+// Неизвестные ключи считаются ошибкой, что бы опечатка не превращалась в значение по умолчанию
+func (sc *ServerConfig) loadFile(file string) error {
+	data, err := os.ReadFile(file)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	addressServer := cfgENV.Address
-	if _, ok := os.LookupEnv("ADDRESS"); !ok {
-		addressServer = *addressPtr
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err = dec.Decode(sc); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", file, err)
 	}
+	return nil
+}
 
-	databaseDsn := cfgENV.DatabaseDsn
-	if _, ok := os.LookupEnv("DATABASE_URI"); !ok {
-		databaseDsn = *keyDatabaseDsn
+// Validate проверка конфигурации. Возвращает все найденные ошибки одной ошибкой
+func (sc *ServerConfig) Validate() error {
+	var arrErr []string
+	check := func(ok bool, format string, a ...interface{}) {
+		if !ok {
+			arrErr = append(arrErr, fmt.Sprintf(format, a...))
+		}
 	}
 
-	keyHash := cfgENV.Key
-	if _, ok := os.LookupEnv("KEY"); !ok {
-		keyHash = *keyFlag
+	_, _, err := net.SplitHostPort(sc.Address)
+	check(err == nil, "address %q: must be host:port", sc.Address)
+	if sc.GRPCAddress != "" {
+		_, _, err = net.SplitHostPort(sc.GRPCAddress)
+		check(err == nil, "grpc_address %q: must be host:port or empty", sc.GRPCAddress)
 	}
-	if keyHash == "" {
-		keyHash = string(constants.HashKey[:])
+
+	check(sc.MaxConns >= 0 && sc.MinConns >= 0, "database: max_conns and min_conns must not be negative")
+	check(sc.MaxConns == 0 || sc.MinConns <= sc.MaxConns, "database.min_conns %d: must not exceed max_conns %d",
+		sc.MinConns, sc.MaxConns)
+	check(sc.MaxConnLifetime >= 0 && sc.MaxConnIdleTime >= 0 && sc.QueryTimeout >= 0,
+		"database: connection lifetimes and query_timeout must not be negative")
+	check(len(sc.TokenKey) >= MinTokenKeySize, "token_key: must be set, at least %d bytes", MinTokenKeySize)
+	check(sc.ShutdownTimeout > 0, "shutdown_timeout %s: must be positive", sc.ShutdownTimeout)
+
+	check(sc.RateLimit.Attempts >= 0, "rate_limit.attempts %d: must not be negative", sc.RateLimit.Attempts)
+	if sc.RateLimit.Attempts > 0 {
+		check(sc.RateLimit.Window > 0, "rate_limit.window %s: must be positive", sc.RateLimit.Window)
+		check(sc.RateLimit.Lockout > 0, "rate_limit.lockout %s: must be positive", sc.RateLimit.Lockout)
+		check(sc.RateLimit.MaxLockout == 0 || sc.RateLimit.MaxLockout >= sc.RateLimit.Lockout,
+			"rate_limit.max_lockout %s: must not be less than lockout %s", sc.RateLimit.MaxLockout, sc.RateLimit.Lockout)
 	}
 
-	sc := ServerConfig{
-		Address: addressServer,
-		DBConfig: DBConfig{
-			DatabaseDsn: databaseDsn,
-			Key:         keyHash,
-		},
+	check(sc.Audit.KeyFile != "", "audit.key_file: must not be empty")
+	check(sc.Audit.CheckpointInterval > 0, "audit.checkpoint_interval %s: must be positive", sc.Audit.CheckpointInterval)
+
+	check(sc.TLS.Disabled || (sc.TLS.CertFile != "" && sc.TLS.KeyFile != ""),
+		"tls: cert_file and key_file are required unless TLS is disabled")
+	check(!sc.TLS.ClientCerts || !sc.TLS.Disabled, "tls.client_certs: device certificates require TLS")
+	check(!sc.TLS.ClientCerts || (sc.TLS.CACertFile != "" && sc.TLS.CAKeyFile != ""),
+		"tls: ca_cert_file and ca_key_file are required for client_certs")
+
+	check(oneOf(sc.Log.Level, "debug", "info", "warn", "error"), "log.level %q: must be debug, info, warn or error", sc.Log.Level)
+	check(oneOf(sc.Log.Format, "json", "console"), "log.format %q: must be json or console", sc.Log.Format)
+
+	check(oneOf(sc.Trace.Exporter, "none", "stdout", "file", "otlp"), "trace.exporter %q: must be none, stdout, file or otlp",
+		sc.Trace.Exporter)
+	check(sc.Trace.Exporter != "otlp" || sc.Trace.Endpoint != "", "trace.endpoint: required for otlp exporter")
+	check(sc.Trace.Exporter != "file" || sc.Trace.File != "", "trace.file: required for file exporter")
+
+	check(sc.Quota.Bytes >= 0 && sc.Quota.Records >= 0 && sc.Quota.FileSize >= 0, "quota: limits must not be negative")
+	check(sc.Flush.Interval > 0, "flush.interval %s: must be positive", sc.Flush.Interval)
+	check(sc.Flush.Shards > 0, "flush.shards %d: must be positive", sc.Flush.Shards)
+	check(sc.Flush.Capacity >= sc.Flush.Shards, "flush.capacity %d: must not be less than shards %d",
+		sc.Flush.Capacity, sc.Flush.Shards)
+	check(oneOf(sc.Cluster.Bus, "local", "postgres"), "cluster.bus %q: must be local or postgres", sc.Cluster.Bus)
+	check(channelName.MatchString(sc.Cluster.Channel), "cluster.channel %q: must be a lowercase identifier up to 63 characters",
+		sc.Cluster.Channel)
+	check(sc.Cache.Users > 0, "cache.users %d: must be positive", sc.Cache.Users)
+	check(sc.Cache.Records > 0, "cache.records %d: must be positive", sc.Cache.Records)
+
+	if len(arrErr) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(arrErr, "; "))
+	}
+	return nil
+}
+
+// MinTokenKeySize наименьший размер секрета подписи токенов (размер ключа HMAC-SHA256)
+const MinTokenKeySize = 32
+
+// channelName допустимое имя канала LISTEN/NOTIFY
+var channelName = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,62}$`)
+
+// oneOf признак, что значение v (без учета регистра) есть в списке
+func oneOf(v string, values ...string) bool {
+	for _, s := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// YAML итоговая конфигурация в формате файла конфигурации. Ключ хеша, секрет подписи токенов
+// и пароль в строке соединения скрываются
+func (sc *ServerConfig) YAML() ([]byte, error) {
+	out := *sc
+	if out.Key != "" {
+		out.Key = redacted
+	}
+	if out.TokenKey != "" {
+		out.TokenKey = redacted
+	}
+	if u, err := url.Parse(out.DatabaseDsn); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+			out.DatabaseDsn = u.String()
+		}
 	}
+	return yaml.Marshal(&out)
+}
 
-	return &sc, err
+// PrintConfigRequested признак, что в ключах запуска args есть -print-config.
+// Используется, что бы не смешивать вывод конфигурации с другим выводом программы
+func PrintConfigRequested(args []string) bool {
+	for _, v := range args {
+		switch strings.TrimLeft(v, "-") {
+		case "print-config", "print-config=true":
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,494 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: keeper.proto
+
+package grpcapi
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Keeper_Register_FullMethodName     = "/gophkeeper.Keeper/Register"
+	Keeper_Login_FullMethodName        = "/gophkeeper.Keeper/Login"
+	Keeper_ListRecords_FullMethodName  = "/gophkeeper.Keeper/ListRecords"
+	Keeper_GetRecord_FullMethodName    = "/gophkeeper.Keeper/GetRecord"
+	Keeper_PutRecord_FullMethodName    = "/gophkeeper.Keeper/PutRecord"
+	Keeper_DeleteRecord_FullMethodName = "/gophkeeper.Keeper/DeleteRecord"
+	Keeper_Changes_FullMethodName      = "/gophkeeper.Keeper/Changes"
+	Keeper_UploadFile_FullMethodName   = "/gophkeeper.Keeper/UploadFile"
+	Keeper_DownloadFile_FullMethodName = "/gophkeeper.Keeper/DownloadFile"
+)
+
+// KeeperClient is the client API for Keeper service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type KeeperClient interface {
+	Register(ctx context.Context, in *Credentials, opts ...grpc.CallOption) (*AuthReply, error)
+	Login(ctx context.Context, in *Credentials, opts ...grpc.CallOption) (*AuthReply, error)
+	ListRecords(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListReply, error)
+	GetRecord(ctx context.Context, in *RecordRef, opts ...grpc.CallOption) (*Record, error)
+	PutRecord(ctx context.Context, in *Record, opts ...grpc.CallOption) (*PutReply, error)
+	DeleteRecord(ctx context.Context, in *RecordRef, opts ...grpc.CallOption) (*DeleteReply, error)
+	Changes(ctx context.Context, in *ChangesRequest, opts ...grpc.CallOption) (Keeper_ChangesClient, error)
+	UploadFile(ctx context.Context, opts ...grpc.CallOption) (Keeper_UploadFileClient, error)
+	DownloadFile(ctx context.Context, in *RecordRef, opts ...grpc.CallOption) (Keeper_DownloadFileClient, error)
+}
+
+type keeperClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewKeeperClient(cc grpc.ClientConnInterface) KeeperClient {
+	return &keeperClient{cc}
+}
+
+func (c *keeperClient) Register(ctx context.Context, in *Credentials, opts ...grpc.CallOption) (*AuthReply, error) {
+	out := new(AuthReply)
+	err := c.cc.Invoke(ctx, Keeper_Register_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *keeperClient) Login(ctx context.Context, in *Credentials, opts ...grpc.CallOption) (*AuthReply, error) {
+	out := new(AuthReply)
+	err := c.cc.Invoke(ctx, Keeper_Login_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *keeperClient) ListRecords(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListReply, error) {
+	out := new(ListReply)
+	err := c.cc.Invoke(ctx, Keeper_ListRecords_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *keeperClient) GetRecord(ctx context.Context, in *RecordRef, opts ...grpc.CallOption) (*Record, error) {
+	out := new(Record)
+	err := c.cc.Invoke(ctx, Keeper_GetRecord_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *keeperClient) PutRecord(ctx context.Context, in *Record, opts ...grpc.CallOption) (*PutReply, error) {
+	out := new(PutReply)
+	err := c.cc.Invoke(ctx, Keeper_PutRecord_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *keeperClient) DeleteRecord(ctx context.Context, in *RecordRef, opts ...grpc.CallOption) (*DeleteReply, error) {
+	out := new(DeleteReply)
+	err := c.cc.Invoke(ctx, Keeper_DeleteRecord_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *keeperClient) Changes(ctx context.Context, in *ChangesRequest, opts ...grpc.CallOption) (Keeper_ChangesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Keeper_ServiceDesc.Streams[0], Keeper_Changes_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &keeperChangesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Keeper_ChangesClient interface {
+	Recv() (*Snapshot, error)
+	grpc.ClientStream
+}
+
+type keeperChangesClient struct {
+	grpc.ClientStream
+}
+
+func (x *keeperChangesClient) Recv() (*Snapshot, error) {
+	m := new(Snapshot)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *keeperClient) UploadFile(ctx context.Context, opts ...grpc.CallOption) (Keeper_UploadFileClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Keeper_ServiceDesc.Streams[1], Keeper_UploadFile_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &keeperUploadFileClient{stream}
+	return x, nil
+}
+
+type Keeper_UploadFileClient interface {
+	Send(*FileChunk) error
+	CloseAndRecv() (*UploadReply, error)
+	grpc.ClientStream
+}
+
+type keeperUploadFileClient struct {
+	grpc.ClientStream
+}
+
+func (x *keeperUploadFileClient) Send(m *FileChunk) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *keeperUploadFileClient) CloseAndRecv() (*UploadReply, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(UploadReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *keeperClient) DownloadFile(ctx context.Context, in *RecordRef, opts ...grpc.CallOption) (Keeper_DownloadFileClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Keeper_ServiceDesc.Streams[2], Keeper_DownloadFile_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &keeperDownloadFileClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Keeper_DownloadFileClient interface {
+	Recv() (*FileChunk, error)
+	grpc.ClientStream
+}
+
+type keeperDownloadFileClient struct {
+	grpc.ClientStream
+}
+
+func (x *keeperDownloadFileClient) Recv() (*FileChunk, error) {
+	m := new(FileChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// KeeperServer is the server API for Keeper service.
+// All implementations must embed UnimplementedKeeperServer
+// for forward compatibility
+type KeeperServer interface {
+	Register(context.Context, *Credentials) (*AuthReply, error)
+	Login(context.Context, *Credentials) (*AuthReply, error)
+	ListRecords(context.Context, *ListRequest) (*ListReply, error)
+	GetRecord(context.Context, *RecordRef) (*Record, error)
+	PutRecord(context.Context, *Record) (*PutReply, error)
+	DeleteRecord(context.Context, *RecordRef) (*DeleteReply, error)
+	Changes(*ChangesRequest, Keeper_ChangesServer) error
+	UploadFile(Keeper_UploadFileServer) error
+	DownloadFile(*RecordRef, Keeper_DownloadFileServer) error
+	mustEmbedUnimplementedKeeperServer()
+}
+
+// UnimplementedKeeperServer must be embedded to have forward compatible implementations.
+type UnimplementedKeeperServer struct {
+}
+
+func (UnimplementedKeeperServer) Register(context.Context, *Credentials) (*AuthReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Register not implemented")
+}
+func (UnimplementedKeeperServer) Login(context.Context, *Credentials) (*AuthReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Login not implemented")
+}
+func (UnimplementedKeeperServer) ListRecords(context.Context, *ListRequest) (*ListReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRecords not implemented")
+}
+func (UnimplementedKeeperServer) GetRecord(context.Context, *RecordRef) (*Record, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRecord not implemented")
+}
+func (UnimplementedKeeperServer) PutRecord(context.Context, *Record) (*PutReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PutRecord not implemented")
+}
+func (UnimplementedKeeperServer) DeleteRecord(context.Context, *RecordRef) (*DeleteReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteRecord not implemented")
+}
+func (UnimplementedKeeperServer) Changes(*ChangesRequest, Keeper_ChangesServer) error {
+	return status.Errorf(codes.Unimplemented, "method Changes not implemented")
+}
+func (UnimplementedKeeperServer) UploadFile(Keeper_UploadFileServer) error {
+	return status.Errorf(codes.Unimplemented, "method UploadFile not implemented")
+}
+func (UnimplementedKeeperServer) DownloadFile(*RecordRef, Keeper_DownloadFileServer) error {
+	return status.Errorf(codes.Unimplemented, "method DownloadFile not implemented")
+}
+func (UnimplementedKeeperServer) mustEmbedUnimplementedKeeperServer() {}
+
+// UnsafeKeeperServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to KeeperServer will
+// result in compilation errors.
+type UnsafeKeeperServer interface {
+	mustEmbedUnimplementedKeeperServer()
+}
+
+func RegisterKeeperServer(s grpc.ServiceRegistrar, srv KeeperServer) {
+	s.RegisterService(&Keeper_ServiceDesc, srv)
+}
+
+func _Keeper_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Credentials)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KeeperServer).Register(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Keeper_Register_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KeeperServer).Register(ctx, req.(*Credentials))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Keeper_Login_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Credentials)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KeeperServer).Login(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Keeper_Login_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KeeperServer).Login(ctx, req.(*Credentials))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Keeper_ListRecords_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KeeperServer).ListRecords(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Keeper_ListRecords_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KeeperServer).ListRecords(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Keeper_GetRecord_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RecordRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KeeperServer).GetRecord(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Keeper_GetRecord_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KeeperServer).GetRecord(ctx, req.(*RecordRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Keeper_PutRecord_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Record)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KeeperServer).PutRecord(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Keeper_PutRecord_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KeeperServer).PutRecord(ctx, req.(*Record))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Keeper_DeleteRecord_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RecordRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KeeperServer).DeleteRecord(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Keeper_DeleteRecord_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KeeperServer).DeleteRecord(ctx, req.(*RecordRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Keeper_Changes_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ChangesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(KeeperServer).Changes(m, &keeperChangesServer{stream})
+}
+
+type Keeper_ChangesServer interface {
+	Send(*Snapshot) error
+	grpc.ServerStream
+}
+
+type keeperChangesServer struct {
+	grpc.ServerStream
+}
+
+func (x *keeperChangesServer) Send(m *Snapshot) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Keeper_UploadFile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(KeeperServer).UploadFile(&keeperUploadFileServer{stream})
+}
+
+type Keeper_UploadFileServer interface {
+	SendAndClose(*UploadReply) error
+	Recv() (*FileChunk, error)
+	grpc.ServerStream
+}
+
+type keeperUploadFileServer struct {
+	grpc.ServerStream
+}
+
+func (x *keeperUploadFileServer) SendAndClose(m *UploadReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *keeperUploadFileServer) Recv() (*FileChunk, error) {
+	m := new(FileChunk)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Keeper_DownloadFile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(RecordRef)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(KeeperServer).DownloadFile(m, &keeperDownloadFileServer{stream})
+}
+
+type Keeper_DownloadFileServer interface {
+	Send(*FileChunk) error
+	grpc.ServerStream
+}
+
+type keeperDownloadFileServer struct {
+	grpc.ServerStream
+}
+
+func (x *keeperDownloadFileServer) Send(m *FileChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Keeper_ServiceDesc is the grpc.ServiceDesc for Keeper service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Keeper_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gophkeeper.Keeper",
+	HandlerType: (*KeeperServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Register",
+			Handler:    _Keeper_Register_Handler,
+		},
+		{
+			MethodName: "Login",
+			Handler:    _Keeper_Login_Handler,
+		},
+		{
+			MethodName: "ListRecords",
+			Handler:    _Keeper_ListRecords_Handler,
+		},
+		{
+			MethodName: "GetRecord",
+			Handler:    _Keeper_GetRecord_Handler,
+		},
+		{
+			MethodName: "PutRecord",
+			Handler:    _Keeper_PutRecord_Handler,
+		},
+		{
+			MethodName: "DeleteRecord",
+			Handler:    _Keeper_DeleteRecord_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Changes",
+			Handler:       _Keeper_Changes_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "UploadFile",
+			Handler:       _Keeper_UploadFile_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "DownloadFile",
+			Handler:       _Keeper_DownloadFile_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "keeper.proto",
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"gophkeeper/internal/bus"
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/constants/errs"
+	"gophkeeper/internal/postgresql/model"
+	"gophkeeper/internal/token"
+)
+
+// userFromRequest получение пользователя из токена запроса.
+// Имя пользователя берется из токена, а не из тела запроса, что бы нельзя было изменить чужой экаунт
+func userFromRequest(r *http.Request) (model.User, error) {
+	user := model.User{}
+
+	body, err := readBody(r)
+	if err != nil {
+		return user, err
+	}
+	if err = json.Unmarshal(body, &user); err != nil {
+		return user, errs.Invalid(err)
+	}
+
+	claims, ok := token.ExtractClaims(r.Header.Get(constants.HeaderAuthorization))
+	if !ok {
+		return user, errs.ErrInvalidLoginPassword
+	}
+	user.Name = claims["user"].(string)
+
+	return user, user.Validate()
+}
+
+// apiUserPasswordPOST хендлер смены пароля пользователя.
+// Перед сменой пароля пользователь повторно аутентифицируется по текущему паролю.
+// После смены пароля отзываются все сессии пользователя, кроме текущей
+func (srv *Server) apiUserPasswordPOST(w http.ResponseWriter, r *http.Request) {
+
+	user, err := userFromRequest(r)
+	if err != nil {
+		constants.Logger.Ctx(r.Context()).ErrorLog(err)
+		errs.WriteError(w, err)
+		return
+	}
+
+	if err = srv.DBConnector.ChangePassword(r.Context(), &user); err != nil {
+		srv.audit(r, model.AuditRecord{Event: constants.AuditPassword, Success: false})
+		errs.WriteError(w, err)
+		return
+	}
+	srv.audit(r, model.AuditRecord{Event: constants.AuditPassword, Success: true})
+
+	ctx := context.WithValue(r.Context(), model.KeyContext("user"), user.Name)
+	current := token.SessionFromToken(r.Header.Get(constants.HeaderAuthorization))
+	if _, err = srv.revokeUserSessions(ctx, current); err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// apiUserDeletePOST хендлер удаления экаунта пользователя со всеми его данными.
+// Перед удалением пользователь повторно аутентифицируется по текущему паролю.
+// Сессии и устройства пользователя отзываются до удаления, как при удалении администратором
+func (srv *Server) apiUserDeletePOST(w http.ResponseWriter, r *http.Request) {
+
+	user, err := userFromRequest(r)
+	if err != nil {
+		constants.Logger.Ctx(r.Context()).ErrorLog(err)
+		errs.WriteError(w, err)
+		return
+	}
+
+	// пароль проверяется до отзыва сессий, что бы неверный пароль не завершал сессии пользователя
+	if err = srv.DBConnector.CheckAccount(r.Context(), &user); err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+	ctx := context.WithValue(r.Context(), model.KeyContext("user"), user.Name)
+	if err = srv.revokeUserAccess(ctx); err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+
+	unlock := srv.Staging.LockUser(user.Name)
+	defer unlock()
+
+	if err = srv.DBConnector.DelAccount(r.Context(), &user); err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+	srv.delUserFromStaging(user.Name)
+	srv.publish(r.Context(), bus.Event{Kind: bus.KindUserDeleted, User: user.Name})
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// apiUserExportGET хендлер выгрузки всех данных пользователя в JSON. Ответ сжимается по Accept-Encoding (см. midware.Compress).
+// Порции файлов читаются из БД частями и пишутся в ответ по мере чтения
+func (srv *Server) apiUserExportGET(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.WithValue(r.Context(), model.KeyContext("user"), r.Header.Get(constants.HeaderAuthorization))
+	ue, err := srv.DBConnector.ExportAccount(ctx)
+	if err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = ue.WriteJSON(w, func(yield func(model.PortionBinaryData) error) error {
+		for _, v := range ue.Binary {
+			if err := srv.DBConnector.ExportPortions(r.Context(), v.Uid, yield); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// ответ уже начат, клиент получит неполный JSON
+		constants.Logger.Ctx(r.Context()).ErrorLog(err)
+	}
+	srv.audit(r, model.AuditRecord{Event: constants.AuditExport, Success: err == nil})
+}
+
+// delUserFromStaging удаляет из хранилища сервера и из неисправных записей все данные пользователя,
+// что бы после удаления экаунта они не попали в БД, и убирает пользователя из кеша записей.
+// Вызывается под блокировкой сохранения шарда пользователя (см. staging.Buffer.LockUser)
+func (srv *Server) delUserFromStaging(name string) {
+	srv.Staging.RemoveUser(name)
+	srv.delUserDeadItems(name)
+	srv.Cache.Remove(name)
+}
+
+// userName имя пользователя по токену, сохраненному в объекте хранилища сервера
+func userName(u model.Updater) string {
+	return tokenUser(userToken(u))
+}
+
+// userToken возвращает токен пользователя, сохраненный в объекте хранилища сервера
+func userToken(u model.Updater) string {
+	switch v := u.(type) {
+	case *model.PairLoginPassword:
+		return v.User
+	case *model.TextData:
+		return v.User
+	case *model.BinaryData:
+		return v.User
+	case *model.BankCard:
+		return v.User
+	}
+	return ""
+}
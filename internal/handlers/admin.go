@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/constants/errs"
+	"gophkeeper/internal/limiter"
+	"gophkeeper/internal/postgresql/model"
+	"gophkeeper/internal/tlsutil"
+)
+
+// unlockRequest структура запроса на снятие блокировки по имени пользователя и/или IP адресу
+type unlockRequest struct {
+	Login string `json:"login,omitempty"`
+	IP    string `json:"ip,omitempty"`
+}
+
+// apiAdminUnlockPOST хендлер снятия блокировки, установленной при переборе паролей.
+// Доступен только администратору
+func (srv *Server) apiAdminUnlockPOST(w http.ResponseWriter, r *http.Request) {
+
+	body, err := readBody(r)
+	if err != nil {
+		constants.Logger.Ctx(r.Context()).ErrorLog(err)
+		errs.WriteError(w, err)
+		return
+	}
+
+	ur := unlockRequest{}
+	if err = json.Unmarshal(body, &ur); err != nil {
+		errs.WriteError(w, errs.Invalid(err))
+		return
+	}
+
+	var keys []string
+	if ur.Login != "" {
+		keys = append(keys, limiter.KeyLogin(ur.Login))
+	}
+	if ur.IP != "" {
+		keys = append(keys, limiter.KeyIP(ur.IP))
+	}
+
+	released := false
+	for _, k := range keys {
+		if !srv.Limiter.Release(k) {
+			continue
+		}
+		released = true
+		srv.saveLockout(k, constants.EventUnlock, 0, time.Now())
+	}
+
+	if !released {
+		errs.WriteError(w, fmt.Errorf("%w: lockout", errs.ErrNotFound))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// saveLockout сохраняет запись аудита блокировки/разблокировки в БД
+func (srv *Server) saveLockout(key, event string, failures int, until time.Time) {
+	if srv.DBConnector == nil {
+		return
+	}
+
+	l := model.Lockout{
+		Key:      key,
+		Event:    event,
+		Failures: failures,
+		Until:    until,
+		Date:     time.Now(),
+	}
+	ctxVW := context.WithValue(context.Background(), model.KeyContext("data"), l)
+	if err := srv.DBConnector.InsertLockout(ctxVW); err != nil {
+		constants.Logger.ErrorLog(err)
+	}
+}
+
+// UnlockCommand административная команда снятия блокировки на запущенном сервере.
+// Пример: server unlock -a localhost:8080 -u admin -l user -ip 127.0.0.1
+// Команда входит на сервер экаунтом администратора (см. adminLogin)
+func UnlockCommand(args []string) error {
+	fs := flag.NewFlagSet("unlock", flag.ContinueOnError)
+	addressPtr := fs.String("a", constants.AdressServer, "адрес сервера")
+	adminPtr := fs.String("u", "", "имя администратора")
+	loginPtr := fs.String("l", "", "имя пользователя")
+	ipPtr := fs.String("ip", "", "IP адрес")
+	certPtr := fs.String("tls-cert", "server.crt", "сертификат TLS сервера")
+	noTLSPtr := fs.Bool("no-tls", false, "подключение без TLS")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	address := *addressPtr
+	if v, ok := os.LookupEnv("ADDRESS"); ok {
+		address = v
+	}
+
+	if *loginPtr == "" && *ipPtr == "" {
+		return errors.New("не указаны имя пользователя или IP адрес")
+	}
+
+	arrJSON, err := json.Marshal(unlockRequest{Login: *loginPtr, IP: *ipPtr})
+	if err != nil {
+		return err
+	}
+
+	client, scheme, err := adminHTTPClient(address, *certPtr, *noTLSPtr)
+	if err != nil {
+		return err
+	}
+	tokenString, err := adminLogin(client, fmt.Sprintf("%s://%s", scheme, address), *adminPtr)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s://%s/api/admin/unlock", scheme, address), bytes.NewReader(arrJSON))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(constants.HeaderAuthorization, tokenString)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ошибка снятия блокировки: %s", resp.Status)
+	}
+
+	fmt.Println("unlocked")
+	return nil
+}
+
+// adminLogin вход администратора для административных команд. Имя администратора берется из флага -u
+// или параметра сеанса ADMIN_LOGIN, пароль из параметра сеанса ADMIN_PASSWORD или со стандартного ввода.
+// Права администратора сервер проверяет по роли пользователя в БД. Возвращает токен сессии администратора
+func adminLogin(client *http.Client, baseURL, login string) (string, error) {
+	if v, ok := os.LookupEnv("ADMIN_LOGIN"); ok && login == "" {
+		login = v
+	}
+	if login == "" {
+		return "", errors.New("не указано имя администратора")
+	}
+
+	password, ok := os.LookupEnv("ADMIN_PASSWORD")
+	if !ok {
+		var err error
+		if password, err = readPassword(os.Stdin, os.Stderr); err != nil {
+			return "", err
+		}
+	}
+
+	arrJSON, err := json.Marshal(model.User{Name: login, Password: password})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, baseURL+"/api/user/login", bytes.NewReader(arrJSON))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(constants.HeaderDeviceName, "admin command")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err = errs.FromResponse(resp); err != nil {
+		return "", err
+	}
+	return resp.Header.Get(constants.HeaderAuthorization), nil
+}
+
+// readPassword читает пароль администратора: с терминала без отображения, иначе первую строку ввода
+func readPassword(in *os.File, prompt io.Writer) (string, error) {
+	if !term.IsTerminal(int(in.Fd())) {
+		line, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprint(prompt, "Пароль администратора: ")
+	b, err := term.ReadPassword(int(in.Fd()))
+	fmt.Fprintln(prompt)
+	return string(b), err
+}
+
+// adminHTTPClient HTTP клиент административных команд.
+// Команды запускаются рядом с сервером, поэтому сертификату сервера доверяем напрямую
+func adminHTTPClient(address, certFile string, plaintext bool) (*http.Client, string, error) {
+	if plaintext {
+		return &http.Client{}, "http", nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, "", err
+	}
+	cfg, err := tlsutil.ClientConfig(host, tlsutil.ClientOptions{CAFile: certFile})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}, "https", nil
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/postgresql/model"
+	"gophkeeper/internal/staging"
+	"gophkeeper/internal/token"
+)
+
+func TestAdmin(t *testing.T) {
+	s := &Server{}
+	s.InitRouters()
+
+	userToken, err := token.NewClaims("user").GenerateJWT()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, path, tokenString, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set(constants.HeaderAuthorization, tokenString)
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, r)
+		return w
+	}
+
+	// роль администратора проверяется по БД, поэтому хендлеры без БД вызываются напрямую
+	call := func(handler http.HandlerFunc, method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	t.Run("Checking admin routes for token without session", func(t *testing.T) {
+		for _, v := range []struct{ method, path string }{
+			{"GET", "/api/admin/users"},
+			{"DELETE", "/api/admin/users/user"},
+			{"POST", "/api/admin/users/user/disable"},
+			{"POST", "/api/admin/users/user/enable"},
+			{"POST", "/api/admin/users/user/logout"},
+			{"POST", "/api/admin/users/user/role"},
+			{"GET", "/api/admin/dead"},
+			{"POST", "/api/admin/dead/retry"},
+		} {
+			if w := do(v.method, v.path, userToken, ""); w.Code != http.StatusUnauthorized {
+				t.Errorf("%s %s: expected %d, got %d", v.method, v.path, http.StatusUnauthorized, w.Code)
+			}
+		}
+	})
+
+	t.Run("Checking admin routes for session token", func(t *testing.T) {
+		// без БД роль пользователя проверить нельзя
+		if w := do("GET", "/api/admin/users", sessionToken(t, s, "user"), ""); w.Code != http.StatusForbidden {
+			t.Errorf("Expected %d, got %d", http.StatusForbidden, w.Code)
+		}
+	})
+
+	t.Run("Checking token signed with another key", func(t *testing.T) {
+		forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"authorized": true,
+			"admin":      true,
+			"user":       "admin",
+			"exp":        time.Now().Add(time.Hour).Unix(),
+		})
+		tokenString, err := forged.SignedString([]byte("taekwondo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w := do("GET", "/api/admin/users", tokenString, ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected %d, got %d", http.StatusUnauthorized, w.Code)
+		}
+	})
+
+	t.Run("Checking role validation", func(t *testing.T) {
+		w := call(s.apiAdminUserRolePOST, "POST", "/api/admin/users/user/role", `{"role":"root"}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+
+	t.Run("Checking dead items", func(t *testing.T) {
+		tc := token.NewClaims("user")
+		recordToken, _ := tc.GenerateJWT()
+		typeText := constants.TypeTextData.String()
+		v := &model.TextData{User: recordToken, Uid: "1"}
+		key := staging.Key{User: "user", Type: typeText, Uid: "1"}
+		if err := s.Staging.Put(staging.Item{Key: key, Record: v}); err != nil {
+			t.Fatal(err)
+		}
+
+		failSave := func(ctx context.Context, items []staging.Item) []error {
+			return []error{errors.New("db is down")}
+		}
+		for i := 0; i < constants.FlushMaxAttempts; i++ {
+			s.Staging.Flush(context.Background(), failSave, s.flushFailed)
+		}
+		if _, ok := s.Staging.Get("user", key); ok {
+			t.Fatal("Expected record removed from staging")
+		}
+
+		w := call(s.apiAdminDeadGET, "GET", "/api/admin/dead", "")
+		arrDead := []model.DeadItem{}
+		if err := json.Unmarshal(w.Body.Bytes(), &arrDead); err != nil {
+			t.Fatal(err)
+		}
+		if len(arrDead) != 1 || arrDead[0].User != "user" || arrDead[0].Attempts != constants.FlushMaxAttempts {
+			t.Fatalf("Unexpected dead items %+v", arrDead)
+		}
+		if strings.Contains(w.Body.String(), recordToken) {
+			t.Error("Record data in dead items list")
+		}
+
+		w = call(s.apiAdminDeadRetryPOST, "POST", "/api/admin/dead/retry", "")
+		reply := map[string]int{}
+		if err := json.Unmarshal(w.Body.Bytes(), &reply); err != nil || reply["requeued"] != 1 {
+			t.Fatalf("Unexpected retry response %d %s", w.Code, w.Body.String())
+		}
+		if item, _ := s.Staging.Get("user", key); item.Record != v {
+			t.Error("Expected record returned to staging")
+		}
+		if s.dead.Len() != 0 {
+			t.Error("Expected empty dead items")
+		}
+	})
+}
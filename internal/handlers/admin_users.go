@@ -0,0 +1,357 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"gophkeeper/internal/bus"
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/constants/errs"
+	"gophkeeper/internal/postgresql/model"
+)
+
+// admin обертка над authorizedSession для административных маршрутов. Принимаются только токены
+// активных сессий, выданные при входе. Роль пользователя токена проверяется по БД при каждом запросе:
+// доступ есть только у незаблокированного пользователя с ролью admin
+func (srv *Server) admin(endpoint func(http.ResponseWriter, *http.Request)) http.Handler {
+	return srv.authorizedSession(func(w http.ResponseWriter, r *http.Request) {
+		if err := srv.checkAdmin(r); err != nil {
+			errs.WriteError(w, err)
+			return
+		}
+		endpoint(w, r)
+	})
+}
+
+// checkAdmin проверяет по БД, что пользователь токена запроса - администратор.
+// Без БД роль проверить нельзя, поэтому доступ запрещается
+func (srv *Server) checkAdmin(r *http.Request) error {
+	name := tokenUser(r.Header.Get(constants.HeaderAuthorization))
+	if srv.DBConnector == nil || name == "" {
+		return errs.ErrForbidden
+	}
+
+	ctx := context.WithValue(r.Context(), model.KeyContext("user"), name)
+	status, err := srv.DBConnector.SelectUserStatus(ctx)
+	if errors.Is(err, errs.ErrNotFound) {
+		return errs.ErrForbidden
+	}
+	if err != nil {
+		return err
+	}
+	if status.Role != constants.RoleAdmin || status.Disabled {
+		return errs.ErrForbidden
+	}
+	return nil
+}
+
+// adminUserContext контекст запроса с именем пользователя из адреса запроса по ключу "user"
+func adminUserContext(r *http.Request) (context.Context, string) {
+	login := mux.Vars(r)["login"]
+	return context.WithValue(r.Context(), model.KeyContext("user"), login), login
+}
+
+// apiAdminUsersGET хендлер списка пользователей с количеством записей, объемом данных и активными сессиями.
+// Доступен только администратору
+func (srv *Server) apiAdminUsersGET(w http.ResponseWriter, r *http.Request) {
+	arrStats, err := srv.DBConnector.SelectUsersStats(r.Context())
+	if err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+	writeJSON(w, arrStats)
+}
+
+// apiAdminUserDisablePOST хендлер блокировки экаунта пользователя. Все сессии пользователя отзываются.
+// Доступен только администратору
+func (srv *Server) apiAdminUserDisablePOST(w http.ResponseWriter, r *http.Request) {
+	srv.adminSetDisabled(w, r, true)
+}
+
+// apiAdminUserEnablePOST хендлер разблокировки экаунта пользователя. Доступен только администратору
+func (srv *Server) apiAdminUserEnablePOST(w http.ResponseWriter, r *http.Request) {
+	srv.adminSetDisabled(w, r, false)
+}
+
+// adminSetDisabled блокирует или разблокирует экаунт пользователя из адреса запроса
+func (srv *Server) adminSetDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	ctx, login := adminUserContext(r)
+	if err := srv.DBConnector.UpdateUserDisabled(ctx, disabled); err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+
+	event := constants.AuditAdminEnable
+	if disabled {
+		event = constants.AuditAdminDisable
+		if _, err := srv.revokeUserSessions(ctx, ""); err != nil {
+			errs.WriteError(w, err)
+			return
+		}
+	}
+	srv.audit(r, model.AuditRecord{User: login, Event: event, Success: true})
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// apiAdminUserLogoutPOST хендлер принудительного выхода пользователя: отзыв всех его сессий.
+// Возвращает количество отозванных сессий. Доступен только администратору
+func (srv *Server) apiAdminUserLogoutPOST(w http.ResponseWriter, r *http.Request) {
+	ctx, login := adminUserContext(r)
+	n, err := srv.revokeUserSessions(ctx, "")
+	if err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+	srv.audit(r, model.AuditRecord{User: login, Event: constants.AuditAdminLogout, Success: true})
+
+	writeJSON(w, map[string]int{"revoked": n})
+}
+
+// apiAdminUserRolePOST хендлер смены роли пользователя (user или admin). Роль проверяется по БД, поэтому
+// действует сразу, сессии пользователя дополнительно отзываются. Доступен только администратору
+func (srv *Server) apiAdminUserRolePOST(w http.ResponseWriter, r *http.Request) {
+	body, err := readBody(r)
+	if err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+	rr := model.RoleRequest{}
+	if err = json.Unmarshal(body, &rr); err != nil {
+		errs.WriteError(w, errs.Invalid(err))
+		return
+	}
+	if rr.Role != constants.RoleUser && rr.Role != constants.RoleAdmin {
+		ve := &errs.ValidationError{}
+		ve.Add("role", "must be "+constants.RoleUser+" or "+constants.RoleAdmin)
+		errs.WriteError(w, ve)
+		return
+	}
+
+	ctx, login := adminUserContext(r)
+	if err = srv.DBConnector.UpdateUserRole(ctx, rr.Role); err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+	if _, err = srv.revokeUserSessions(ctx, ""); err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+	srv.audit(r, model.AuditRecord{User: login, Event: constants.AuditAdminRole, Type: rr.Role, Success: true})
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// apiAdminUserDELETE хендлер удаления экаунта пользователя со всеми его данными без пароля пользователя.
+// Сессии и устройства пользователя отзываются, его записи удаляются из хранилища сервера. Доступен только администратору
+func (srv *Server) apiAdminUserDELETE(w http.ResponseWriter, r *http.Request) {
+	ctx, login := adminUserContext(r)
+	if err := srv.revokeUserAccess(ctx); err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+
+	unlock := srv.Staging.LockUser(login)
+	err := srv.DBConnector.AdminDelAccount(ctx)
+	if err == nil {
+		srv.delUserFromStaging(login)
+	}
+	unlock()
+	if err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+	srv.publish(ctx, bus.Event{Kind: bus.KindUserDeleted, User: login})
+	srv.audit(r, model.AuditRecord{User: login, Event: constants.AuditAdminDelete, Success: true})
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// revokeUserSessions отзывает все сессии пользователя из контекста (ключ "user"), кроме сессии except,
+// в БД и на сервере, закрывая их websocket соединения. Возвращает количество отозванных сессий
+func (srv *Server) revokeUserSessions(ctx context.Context, except string) (int, error) {
+	arrUID, err := srv.DBConnector.RevokeUserSessions(ctx, except)
+	if err != nil {
+		return 0, errs.ErrErrorServer
+	}
+	for _, uid := range arrUID {
+		srv.revokeSession(ctx, uid)
+	}
+	return len(arrUID), nil
+}
+
+// revokeUserAccess отзывает все сессии и устройства пользователя из контекста (ключ "user") перед удалением экаунта,
+// что бы его токены и сертификаты устройств не подошли экаунту, созданному с тем же именем
+func (srv *Server) revokeUserAccess(ctx context.Context) error {
+	if _, err := srv.revokeUserSessions(ctx, ""); err != nil {
+		return err
+	}
+	arrUID, err := srv.DBConnector.RevokeUserDevices(ctx)
+	if err != nil {
+		return errs.ErrErrorServer
+	}
+	for _, uid := range arrUID {
+		srv.revokeDevice(ctx, uid)
+	}
+	return nil
+}
+
+// AdminCommand административные команды управления пользователями на запущенном сервере.
+// Пример: server admin users -a localhost:8080 -u admin
+// Команды: users, disable, enable, logout, delete, role, dead. Команда входит на сервер экаунтом
+// администратора (см. adminLogin)
+func AdminCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("не указана команда: users, disable, enable, logout, delete, role, dead")
+	}
+	cmd := args[0]
+
+	fs := flag.NewFlagSet("admin "+cmd, flag.ContinueOnError)
+	addressPtr := fs.String("a", constants.AdressServer, "адрес сервера")
+	adminPtr := fs.String("u", "", "имя администратора")
+	loginPtr := fs.String("l", "", "имя пользователя")
+	rolePtr := fs.String("r", "", "роль пользователя: user или admin")
+	yesPtr := fs.Bool("yes", false, "подтверждение удаления экаунта")
+	retryPtr := fs.Bool("retry", false, "вернуть неисправные записи в хранилище сервера")
+	certPtr := fs.String("tls-cert", "server.crt", "сертификат TLS сервера")
+	noTLSPtr := fs.Bool("no-tls", false, "подключение без TLS")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	address := *addressPtr
+	if v, ok := os.LookupEnv("ADDRESS"); ok {
+		address = v
+	}
+	userPath := "/api/admin/users/" + url.PathEscape(*loginPtr)
+
+	var method, path string
+	var body interface{}
+	switch cmd {
+	case "users":
+		method, path = http.MethodGet, "/api/admin/users"
+	case "disable", "enable", "logout":
+		method, path = http.MethodPost, userPath+"/"+cmd
+	case "delete":
+		if !*yesPtr {
+			return errors.New("удаление экаунта со всеми данными требует флага -yes")
+		}
+		method, path = http.MethodDelete, userPath
+	case "role":
+		method, path, body = http.MethodPost, userPath+"/role", model.RoleRequest{Role: *rolePtr}
+	case "dead":
+		method, path = http.MethodGet, "/api/admin/dead"
+		if *retryPtr {
+			method, path = http.MethodPost, "/api/admin/dead/retry"
+		}
+	default:
+		return fmt.Errorf("неизвестная команда %s", cmd)
+	}
+	if *loginPtr == "" && strings.HasPrefix(path, "/api/admin/users/") {
+		return errors.New("не указано имя пользователя")
+	}
+
+	client, scheme, err := adminHTTPClient(address, *certPtr, *noTLSPtr)
+	if err != nil {
+		return err
+	}
+	baseURL := fmt.Sprintf("%s://%s", scheme, address)
+	tokenString, err := adminLogin(client, baseURL, *adminPtr)
+	if err != nil {
+		return err
+	}
+	resp, err := adminRequest(client, tokenString, method, baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err = errs.FromResponse(resp); err != nil {
+		return err
+	}
+
+	switch {
+	case cmd == "users":
+		var arrStats []model.UserStats
+		if err = json.NewDecoder(resp.Body).Decode(&arrStats); err != nil {
+			return err
+		}
+		printUsersStats(os.Stdout, arrStats)
+	case cmd == "dead" && !*retryPtr:
+		var arrDead []model.DeadItem
+		if err = json.NewDecoder(resp.Body).Decode(&arrDead); err != nil {
+			return err
+		}
+		printDeadItems(os.Stdout, arrDead)
+	default:
+		// ответ с количеством (revoked, requeued) выводится как есть
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if len(b) > 0 {
+			fmt.Println(strings.TrimSpace(string(b)))
+			return nil
+		}
+		fmt.Println("ok")
+	}
+	return nil
+}
+
+// adminRequest выполняет запрос административной команды с токеном сессии администратора tokenString
+func adminRequest(client *http.Client, tokenString, method, address string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		arrJSON, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(arrJSON)
+	}
+
+	req, err := http.NewRequest(method, address, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set(constants.HeaderAuthorization, tokenString)
+
+	return client.Do(req)
+}
+
+// printUsersStats выводит таблицу пользователей
+func printUsersStats(out io.Writer, arrStats []model.UserStats) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LOGIN\tROLE\tDISABLED\tPAIRS\tTEXT\tBINARY\tCARD\tSTORAGE\tSESSIONS")
+	for _, s := range arrStats {
+		fmt.Fprintf(tw, "%s\t%s\t%t\t%d\t%d\t%d\t%d\t%d\t%d\n", s.Login, s.Role, s.Disabled,
+			s.Records["pairs"], s.Records["text"], s.Records["binary"], s.Records["card"], s.Storage, s.Sessions)
+	}
+	_ = tw.Flush()
+}
+
+// printDeadItems выводит таблицу неисправных записей хранилища сервера
+func printDeadItems(out io.Writer, arrDead []model.DeadItem) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tUID\tUSER\tEVENT\tATTEMPTS\tDATE\tERROR")
+	for _, d := range arrDead {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", d.Type, d.Uid, d.User, d.Event, d.Attempts,
+			d.Date.Format(time.RFC3339), d.Error)
+	}
+	_ = tw.Flush()
+}
@@ -2,12 +2,14 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"gophkeeper/internal/constants/errs"
 	"gophkeeper/internal/postgresql/model"
 	"io"
 	"net/http"
-	"strings"
 
 	"gophkeeper/internal/compression"
 	"gophkeeper/internal/constants"
@@ -16,7 +18,7 @@ import (
 
 // handlerNotFound, хендлер адрес не найден
 func (srv *Server) handlerNotFound(rw http.ResponseWriter, r *http.Request) {
-	http.Error(rw, "Page "+r.URL.Path+" not found", http.StatusNotFound)
+	errs.WriteError(rw, fmt.Errorf("%w: page %s", errs.ErrNotFound, r.URL.Path))
 }
 
 // handlerNotFound, хендлер начальной страницы сервера
@@ -30,269 +32,174 @@ func (srv *Server) handleFunc(rw http.ResponseWriter, rq *http.Request) {
 	rw.WriteHeader(http.StatusOK)
 }
 
-// apiUserRegisterPOST хендлер создания пользователя
-func (srv *Server) apiUserRegisterPOST(w http.ResponseWriter, r *http.Request) {
-
+// readBody читает тело запроса. Если тело сжато (Content-Encoding gzip или zstd), то распаковывает его.
+// Размер тела ограничен constants.MaxBodySize и до, и после распаковки.
+// Ошибки уже приведены к ошибкам пакета errs: ErrTooLarge, ErrUnsupportedEncoding или InvalidFormat
+func readBody(r *http.Request) ([]byte, error) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		constants.Logger.ErrorLog(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			return nil, errs.ErrTooLarge
+		}
+		return nil, errs.Invalid(err)
 	}
 
-	contentEncoding := r.Header.Get("Content-Encoding")
-	if strings.Contains(contentEncoding, "gzip") {
-		body, err = compression.Decompress(body)
-		if err != nil {
-			constants.Logger.ErrorLog(err)
-			http.Error(w, "Ошибка распаковки", http.StatusInternalServerError)
-			return
-		}
+	body, err = compression.Decode(r.Header.Get("Content-Encoding"), body, constants.MaxBodySize)
+	if err != nil && !errors.Is(err, errs.ErrTooLarge) && !errors.Is(err, errs.ErrUnsupportedEncoding) {
+		return nil, errs.Invalid(err)
 	}
+	return body, err
+}
 
+// readUser читает и проверяет пользователя из тела запроса
+func readUser(r *http.Request) (model.User, error) {
 	user := model.User{}
-	if err := json.Unmarshal(body, &user); err != nil {
-		constants.Logger.ErrorLog(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
 
-	tokenString := ""
-	user.New = true
-	err = srv.DBConnector.NewAccount(&user)
+	body, err := readBody(r)
 	if err != nil {
-		w.Header().Add(constants.HeaderAuthorization, tokenString)
-		http.Error(w, err.Error(), errs.HTTPErrors(err))
-		return
+		return user, err
 	}
-
-	tc := token.NewClaims(user.Name)
-	if tokenString, err = tc.GenerateJWT(); err != nil {
-		w.Header().Add(constants.HeaderAuthorization, "")
-		http.Error(w, "Ошибка получения токена", http.StatusInternalServerError)
-		return
+	if err = json.Unmarshal(body, &user); err != nil {
+		return user, errs.Invalid(err)
 	}
-
-	w.Header().Add(constants.HeaderAuthorization, tokenString)
-	w.WriteHeader(http.StatusOK)
+	return user, user.Validate()
 }
 
-// apiUserRegisterPOST хендлер входа пользователя в систему
-func (srv *Server) apiUserLoginPOST(w http.ResponseWriter, r *http.Request) {
+// apiRecordPOST общий хендлер записи пользователя типа t, переданной в теле запроса с УИДом и событием.
+// Запись и квоты пользователя проверяются до помещения в хранилище сервера
+func (srv *Server) apiRecordPOST(w http.ResponseWriter, r *http.Request, t string) {
 
-	body, err := io.ReadAll(r.Body)
+	body, err := readBody(r)
 	if err != nil {
-		constants.Logger.ErrorLog(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	contentEncoding := r.Header.Get("Content-Encoding")
-	if strings.Contains(contentEncoding, "gzip") {
-		body, err = compression.Decompress(body)
-		if err != nil {
-			constants.Logger.ErrorLog(err)
-			http.Error(w, "Ошибка распаковки", http.StatusInternalServerError)
-			return
-		}
-	}
-
-	user := model.User{}
-
-	if err := json.Unmarshal(body, &user); err != nil {
-		constants.Logger.ErrorLog(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		constants.Logger.Ctx(r.Context()).ErrorLog(err)
+		errs.WriteError(w, err)
 		return
 	}
 
-	tokenString := ""
-	err = srv.DBConnector.CheckAccount(&user)
+	res, err := model.NewResource(t)
 	if err != nil {
-		w.Header().Add(constants.HeaderAuthorization, tokenString)
-		http.Error(w, err.Error(), errs.HTTPErrors(err))
+		errs.WriteError(w, err)
 		return
 	}
-
-	tc := token.NewClaims(user.Name)
-	if tokenString, err = tc.GenerateJWT(); err != nil {
-		w.Header().Add(constants.HeaderAuthorization, "")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err = json.Unmarshal(body, res); err != nil {
+		constants.Logger.Ctx(r.Context()).ErrorLog(err)
+		errs.WriteError(w, errs.Invalid(err))
 		return
 	}
+	res.SetIdentity(r.Header.Get(constants.HeaderAuthorization), res.GetMainText(), res.GetEvent())
 
-	w.Header().Add(constants.HeaderAuthorization, tokenString)
-	w.WriteHeader(http.StatusOK)
-}
-
-// apiPairLoginPasswordPOST хендлер для работы с данными типа "пары логин/пароль"
-func (srv *Server) apiPairLoginPasswordPOST(w http.ResponseWriter, r *http.Request) {
-
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		constants.Logger.ErrorLog(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err = res.Validate(); err != nil {
+		errs.WriteError(w, err)
 		return
 	}
-
-	contentEncoding := r.Header.Get("Content-Encoding")
-	if strings.Contains(contentEncoding, "gzip") {
-		body, err = compression.Decompress(body)
-		if err != nil {
-			constants.Logger.ErrorLog(err)
-			http.Error(w, "Ошибка распаковки", http.StatusInternalServerError)
-			return
-		}
-	}
-
-	var plp model.PairLoginPassword
-	if err = json.Unmarshal(body, &plp); err != nil {
-		constants.Logger.ErrorLog(err)
-		http.Error(w, "Ошибка распаковки", http.StatusInternalServerError)
+	if err = srv.checkResourceQuota(r, t, res); err != nil {
+		errs.WriteError(w, err)
 		return
 	}
 
-	plp.User = r.Header.Get("Authorization")
-
-	srv.Mutex.Lock()
-	defer srv.Mutex.Unlock()
-
-	plpInListUserData, ok := srv.InListUserData[constants.TypePairLoginPassword.String()]
-	if !ok {
-		plpInListUserData = model.Appender{}
+	if err = srv.stageResource(r, t, res); err != nil {
+		srv.writeStageError(w, err)
+		return
 	}
-	plp.SetFromInListUserData(plpInListUserData)
-
-	srv.InListUserData[constants.TypePairLoginPassword.String()] = plpInListUserData
 	w.WriteHeader(http.StatusOK)
 }
 
-// apiTextDataPOST хендлер для работы с данными типа "произвольные текстовые данные"
-func (srv *Server) apiTextDataPOST(w http.ResponseWriter, r *http.Request) {
-	td := model.TextData{}
+// apiUserRegisterPOST хендлер создания пользователя
+func (srv *Server) apiUserRegisterPOST(w http.ResponseWriter, r *http.Request) {
 
-	body, err := io.ReadAll(r.Body)
+	user, err := readUser(r)
 	if err != nil {
-		constants.Logger.ErrorLog(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		constants.Logger.Ctx(r.Context()).ErrorLog(err)
+		errs.WriteError(w, err)
 		return
 	}
 
-	contentEncoding := r.Header.Get("Content-Encoding")
-	if strings.Contains(contentEncoding, "gzip") {
-		body, err = compression.Decompress(body)
-		if err != nil {
-			constants.Logger.ErrorLog(err)
-			http.Error(w, "Ошибка распаковки", http.StatusInternalServerError)
-			return
-		}
-	}
-
-	if err := json.Unmarshal(body, &td); err != nil {
-		constants.Logger.ErrorLog(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	tokenString := ""
+	user.New = true
+	err = srv.DBConnector.NewAccount(r.Context(), &user)
+	if err != nil {
+		w.Header().Add(constants.HeaderAuthorization, tokenString)
+		errs.WriteError(w, err)
+		return
 	}
 
-	td.User = r.Header.Get("Authorization")
-
-	srv.Mutex.Lock()
-	defer srv.Mutex.Unlock()
-
-	tdInListUserData, ok := srv.InListUserData[constants.TypeTextData.String()]
-	if !ok {
-		tdInListUserData = model.Appender{}
+	if tokenString, err = srv.newSessionToken(r, user.Name); err != nil {
+		w.Header().Add(constants.HeaderAuthorization, "")
+		errs.WriteError(w, errs.ErrErrorServer)
+		return
 	}
-	td.SetFromInListUserData(tdInListUserData)
+	srv.audit(r, model.AuditRecord{
+		User:    user.Name,
+		Event:   constants.AuditRegister,
+		Session: token.SessionFromToken(tokenString),
+		Success: true,
+	})
 
-	srv.InListUserData[constants.TypeTextData.String()] = tdInListUserData
+	w.Header().Add(constants.HeaderAuthorization, tokenString)
 	w.WriteHeader(http.StatusOK)
-
 }
 
-// apiBinaryPOST хендлер для работы с данными типа "произвольные бинарные данные"
-func (srv *Server) apiBinaryPOST(w http.ResponseWriter, r *http.Request) {
-	bd := model.BinaryData{}
+// apiUserLoginPOST хендлер входа пользователя в систему.
+// Заблокированный администратором пользователь не может войти
+func (srv *Server) apiUserLoginPOST(w http.ResponseWriter, r *http.Request) {
 
-	body, err := io.ReadAll(r.Body)
+	user, err := readUser(r)
 	if err != nil {
-		constants.Logger.ErrorLog(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		constants.Logger.Ctx(r.Context()).ErrorLog(err)
+		errs.WriteError(w, err)
 		return
 	}
 
-	contentEncoding := r.Header.Get("Content-Encoding")
-	if strings.Contains(contentEncoding, "gzip") {
-		body, err = compression.Decompress(body)
-		if err != nil {
-			constants.Logger.ErrorLog(err)
-			http.Error(w, "Ошибка распаковки", http.StatusInternalServerError)
-			return
-		}
-	}
-
-	if err := json.Unmarshal(body, &bd); err != nil {
-		constants.Logger.ErrorLog(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	tokenString := ""
+	status := model.UserStatus{}
+	err = srv.DBConnector.CheckAccount(r.Context(), &user)
+	if err == nil {
+		ctx := context.WithValue(r.Context(), model.KeyContext("user"), user.Name)
+		status, err = srv.DBConnector.SelectUserStatus(ctx)
 	}
-
-	bd.User = r.Header.Get("Authorization")
-
-	srv.Mutex.Lock()
-	defer srv.Mutex.Unlock()
-
-	tdInListUserData, ok := srv.InListUserData[constants.TypeBinaryData.String()]
-	if !ok {
-		tdInListUserData = model.Appender{}
+	if err == nil && status.Disabled {
+		err = errs.ErrAccountDisabled
 	}
-	bd.SetFromInListUserData(tdInListUserData)
-
-	srv.InListUserData[constants.TypeBinaryData.String()] = tdInListUserData
-
-	w.WriteHeader(http.StatusOK)
-}
-
-// apiBankCardPOST хендлер для работы с данными типа "данные банковских карт"
-func (srv *Server) apiBankCardPOST(w http.ResponseWriter, r *http.Request) {
-
-	bc := model.BankCard{}
-
-	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		constants.Logger.ErrorLog(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		srv.audit(r, model.AuditRecord{User: user.Name, Event: constants.AuditLogin, Success: false})
+		w.Header().Add(constants.HeaderAuthorization, tokenString)
+		errs.WriteError(w, err)
 		return
 	}
 
-	contentEncoding := r.Header.Get("Content-Encoding")
-	if strings.Contains(contentEncoding, "gzip") {
-		body, err = compression.Decompress(body)
-		if err != nil {
-			constants.Logger.ErrorLog(err)
-			http.Error(w, "Ошибка распаковки", http.StatusInternalServerError)
-			return
-		}
-	}
-
-	if err := json.Unmarshal(body, &bc); err != nil {
-		constants.Logger.ErrorLog(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if tokenString, err = srv.newSessionToken(r, user.Name); err != nil {
+		w.Header().Add(constants.HeaderAuthorization, "")
+		errs.WriteError(w, errs.ErrErrorServer)
+		return
 	}
+	srv.audit(r, model.AuditRecord{
+		User:    user.Name,
+		Event:   constants.AuditLogin,
+		Session: token.SessionFromToken(tokenString),
+		Success: true,
+	})
 
-	bc.User = r.Header.Get("Authorization")
+	w.Header().Add(constants.HeaderAuthorization, tokenString)
+	w.WriteHeader(http.StatusOK)
+}
 
-	srv.Mutex.Lock()
-	defer srv.Mutex.Unlock()
+// apiPairLoginPasswordPOST хендлер для работы с данными типа "пары логин/пароль"
+func (srv *Server) apiPairLoginPasswordPOST(w http.ResponseWriter, r *http.Request) {
+	srv.apiRecordPOST(w, r, constants.TypePairLoginPassword.String())
+}
 
-	tdInListUserData, ok := srv.InListUserData[constants.TypeBankCardData.String()]
-	if !ok {
-		tdInListUserData = model.Appender{}
-	}
-	bc.SetFromInListUserData(tdInListUserData)
-	srv.InListUserData[constants.TypeBankCardData.String()] = tdInListUserData
+// apiTextDataPOST хендлер для работы с данными типа "произвольные текстовые данные"
+func (srv *Server) apiTextDataPOST(w http.ResponseWriter, r *http.Request) {
+	srv.apiRecordPOST(w, r, constants.TypeTextData.String())
+}
 
-	w.WriteHeader(http.StatusOK)
+// apiBinaryPOST хендлер для работы с данными типа "произвольные бинарные данные"
+func (srv *Server) apiBinaryPOST(w http.ResponseWriter, r *http.Request) {
+	srv.apiRecordPOST(w, r, constants.TypeBinaryData.String())
 }
 
-// Shutdown функция, работающая при отключеннии сервера
-func (srv *Server) Shutdown() {
-	constants.Logger.InfoLog("server stopped")
+// apiBankCardPOST хендлер для работы с данными типа "данные банковских карт"
+func (srv *Server) apiBankCardPOST(w http.ResponseWriter, r *http.Request) {
+	srv.apiRecordPOST(w, r, constants.TypeBankCardData.String())
 }
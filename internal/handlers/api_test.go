@@ -14,8 +14,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"time"
 
 	"github.com/caarlos0/env/v6"
+	"github.com/google/uuid"
 )
 
 type serverConfigENV struct {
@@ -167,14 +169,13 @@ func ExampleServer_apiPairLoginPasswordPOST() {
 	ts := httptest.NewServer(r)
 	defer ts.Close()
 
-	tc := token.NewClaims("test")
-	strToken, _ := tc.GenerateJWT()
+	strToken := exampleToken("test")
 	ck := "test crypto key"
 
 	plp := tests.CreatePairLoginPassword(strToken, "", ck)
 	uid := plp.Uid
 
-	err := srv.DBConnector.Update(&plp)
+	err := srv.DBConnector.Update(context.Background(), &plp)
 	if err != nil {
 		return
 	}
@@ -204,7 +205,7 @@ func ExampleServer_apiPairLoginPasswordPOST() {
 	}
 	fmt.Println(msg)
 
-	err = srv.DBConnector.Delete(&plp)
+	err = srv.DBConnector.Delete(context.Background(), &plp)
 	if err != nil {
 		constants.Logger.ErrorLog(err)
 	}
@@ -218,14 +219,13 @@ func ExampleServer_apiTextDataPOST() {
 	ts := httptest.NewServer(r)
 	defer ts.Close()
 
-	tc := token.NewClaims("test")
-	strToken, _ := tc.GenerateJWT()
+	strToken := exampleToken("test")
 	ck := "test crypto key"
 
 	td := tests.CreateTextData(strToken, "", ck)
 	uid := td.Uid
 
-	err := srv.DBConnector.Update(&td)
+	err := srv.DBConnector.Update(context.Background(), &td)
 	if err != nil {
 		return
 	}
@@ -255,7 +255,7 @@ func ExampleServer_apiTextDataPOST() {
 	}
 	fmt.Println(msg)
 
-	err = srv.DBConnector.Delete(&td)
+	err = srv.DBConnector.Delete(context.Background(), &td)
 	if err != nil {
 		constants.Logger.ErrorLog(err)
 	}
@@ -269,13 +269,12 @@ func ExampleServer_apiBinaryPOST() {
 	ts := httptest.NewServer(r)
 	defer ts.Close()
 
-	tc := token.NewClaims("test")
-	strToken, _ := tc.GenerateJWT()
+	strToken := exampleToken("test")
 
 	bd := tests.CreateBinaryData(strToken, "")
 	uid := bd.Uid
 
-	err := srv.DBConnector.Update(&bd)
+	err := srv.DBConnector.Update(context.Background(), &bd)
 	if err != nil {
 		return
 	}
@@ -305,7 +304,7 @@ func ExampleServer_apiBinaryPOST() {
 	}
 	fmt.Println(msg)
 
-	err = srv.DBConnector.Delete(&bd)
+	err = srv.DBConnector.Delete(context.Background(), &bd)
 	if err != nil {
 		constants.Logger.ErrorLog(err)
 	}
@@ -319,14 +318,13 @@ func ExampleServer_apiBankCardPOST() {
 	ts := httptest.NewServer(r)
 	defer ts.Close()
 
-	tc := token.NewClaims("test")
-	strToken, _ := tc.GenerateJWT()
+	strToken := exampleToken("test")
 	ck := "test crypto key"
 
 	bc := tests.CreateBankCard(strToken, "", ck)
 	uid := bc.Uid
 
-	err := srv.DBConnector.Update(&bc)
+	err := srv.DBConnector.Update(context.Background(), &bc)
 	if err != nil {
 		return
 	}
@@ -356,7 +354,7 @@ func ExampleServer_apiBankCardPOST() {
 	}
 	fmt.Println(msg)
 
-	err = srv.DBConnector.Delete(&bc)
+	err = srv.DBConnector.Delete(context.Background(), &bc)
 	if err != nil {
 		constants.Logger.ErrorLog(err)
 	}
@@ -365,6 +363,64 @@ func ExampleServer_apiBankCardPOST() {
 	// UID: bf340769-687e-485e-968b-976cf12f7b64. HTTP-Status: 200
 }
 
+func ExampleServer_apiResourceGET() {
+	r := srv.Router
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	strToken := exampleToken("test")
+	ck := "test crypto key"
+
+	plp := tests.CreatePairLoginPassword(strToken, "", ck)
+	uid := plp.Uid
+
+	err := srv.DBConnector.Update(context.Background(), &plp)
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequest("GET", ts.URL+"/api/resource/pairs/"+uid, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Authorization", strToken)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	var res model.PairLoginPassword
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return
+	}
+
+	msg := ""
+	if resp.StatusCode == 200 {
+		msg = fmt.Sprintf("UID: %s. User: %s. HTTP-Status: %d", res.Uid, res.User, resp.StatusCode)
+	}
+	fmt.Println(msg)
+
+	err = srv.DBConnector.Delete(context.Background(), &plp)
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+	}
+
+	// Output:
+	// UID: bf340769-687e-485e-968b-976cf12f7b64. User: test. HTTP-Status: 200
+}
+
+// exampleToken токен пользователя user с сессией, зарегистрированной на сервере srv
+func exampleToken(user string) string {
+	tc := token.NewClaims(user)
+	tc.Session = uuid.NewString()
+	strToken, _ := tc.GenerateJWT()
+	srv.Sessions.Add(tc.Session, user, time.Unix(tc.Exp, 0))
+	return strToken
+}
+
 func NewConfigServer() (*environment.ServerConfig, error) {
 
 	var cfgENV serverConfigENV
@@ -404,6 +460,4 @@ func init() {
 
 	srv.InitDataBase()
 	srv.InitRouters()
-
-	srv.InListUserData = map[string]model.Appender{}
 }
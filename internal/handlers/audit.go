@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"gophkeeper/internal/auditchain"
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/constants/errs"
+	"gophkeeper/internal/environment"
+	"gophkeeper/internal/midware"
+	"gophkeeper/internal/postgresql"
+	"gophkeeper/internal/postgresql/model"
+	"gophkeeper/internal/staging"
+	"gophkeeper/internal/token"
+)
+
+// auditQueue очередь записей журнала аудита. Запросы добавляют записи, не дожидаясь БД, единственный писатель
+// экземпляра сервера (Server.WriteAudit) сохраняет их пачками в порядке добавления
+type auditQueue struct {
+	sync.Mutex
+	items []model.AuditRecord
+	ready chan struct{}
+}
+
+// signal канал, в который приходит сигнал о новых записях очереди
+func (q *auditQueue) signal() <-chan struct{} {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.ready == nil {
+		q.ready = make(chan struct{}, 1)
+	}
+	return q.ready
+}
+
+// push добавляет записи в конец очереди. Не блокируется: при переполнении самые старые записи пишутся в лог ошибок
+func (q *auditQueue) push(arr ...model.AuditRecord) {
+	if len(arr) == 0 {
+		return
+	}
+
+	q.Lock()
+	q.items = append(q.items, arr...)
+	if n := len(q.items) - constants.AuditQueueLimit; n > 0 {
+		for _, a := range q.items[:n] {
+			constants.Logger.ErrorLog(fmt.Errorf("audit queue is full, record dropped: %+v", a))
+		}
+		q.items = q.items[n:]
+	}
+	if q.ready == nil {
+		q.ready = make(chan struct{}, 1)
+	}
+	q.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// take забирает все записи очереди
+func (q *auditQueue) take() []model.AuditRecord {
+	q.Lock()
+	defer q.Unlock()
+
+	arr := q.items
+	q.items = nil
+	return arr
+}
+
+// requeue возвращает в начало очереди записи, которые не удалось сохранить
+func (q *auditQueue) requeue(arr []model.AuditRecord) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.items = append(arr[:len(arr):len(arr)], q.items...)
+}
+
+// Len количество записей в очереди
+func (q *auditQueue) Len() int {
+	q.Lock()
+	defer q.Unlock()
+
+	return len(q.items)
+}
+
+// auditEntry дополняет запись журнала аудита данными запроса r: IP адрес, сессия, пользователь и время
+func auditEntry(r *http.Request, a model.AuditRecord) model.AuditRecord {
+	a.IP = midware.RemoteIP(r)
+	if a.Session == "" {
+		a.Session = token.SessionFromToken(r.Header.Get(constants.HeaderAuthorization))
+	}
+	if a.User == "" {
+		if claims, ok := token.ExtractClaims(r.Header.Get(constants.HeaderAuthorization)); ok {
+			a.User, _ = claims["user"].(string)
+		}
+	}
+	a.Date = time.Now()
+	return a
+}
+
+// audit добавляет запись в очередь журнала аудита. IP адрес и сессия берутся из запроса.
+// Запрос не ждет записи в БД, ошибки записи журнала логируются писателем (см. WriteAudit)
+func (srv *Server) audit(r *http.Request, a model.AuditRecord) {
+	if srv.DBConnector == nil {
+		return
+	}
+	srv.audits.push(auditEntry(r, a))
+}
+
+// WriteAudit горутина записи журнала аудита: единственный писатель экземпляра сервера сохраняет записи очереди
+// в порядке добавления пачками по constants.AuditBatch, каждую одной транзакцией. После ошибки БД записи
+// остаются в очереди и сохраняются повторно через constants.AuditRetryInterval.
+// Записи, добавленные после остановки горутины, сохраняет Shutdown
+func (srv *Server) WriteAudit(ctx context.Context) {
+	if srv.DBConnector == nil {
+		return
+	}
+
+	ticker := time.NewTicker(constants.AuditRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-srv.audits.signal():
+			_ = srv.flushAudit(detach(ctx))
+		case <-ticker.C:
+			_ = srv.flushAudit(detach(ctx))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// flushAudit сохраняет в БД все записи очереди журнала аудита. При ошибке несохраненные записи
+// возвращаются в начало очереди
+func (srv *Server) flushAudit(ctx context.Context) error {
+	arr := srv.audits.take()
+	for len(arr) > 0 {
+		n := len(arr)
+		if n > constants.AuditBatch {
+			n = constants.AuditBatch
+		}
+		if err := srv.DBConnector.InsertAudits(ctx, arr[:n]); err != nil {
+			constants.Logger.ErrorLog(fmt.Errorf("audit: %d records not saved: %w", len(arr), err))
+			srv.audits.requeue(arr)
+			return err
+		}
+		arr = arr[n:]
+	}
+	return nil
+}
+
+// detachedContext контекст со значениями родителя (span трассировки, логер запроса), но без его отмены
+type detachedContext struct {
+	parent context.Context
+}
+
+// detach контекст без отмены для записей, которые не должны теряться, если клиент закрыл соединение.
+// Время обращения к БД все равно ограничено настройкой database.query_timeout
+func detach(ctx context.Context) context.Context {
+	return detachedContext{parent: ctx}
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+func (dc detachedContext) Value(key interface{}) interface{} {
+	return dc.parent.Value(key)
+}
+
+// recordAudit запись журнала аудита о создании/изменении/удалении данных пользователя запросом r
+func recordAudit(r *http.Request, u model.Updater) model.AuditRecord {
+	event := u.GetEvent()
+	if event == "" {
+		event = constants.EventAddEdit.String()
+	}
+
+	return auditEntry(r, model.AuditRecord{
+		Event:   event,
+		Type:    u.GetType(),
+		Uid:     u.GetMainText(),
+		Success: true,
+	})
+}
+
+// auditRecord добавляет в очередь журнала аудита запись о создании/изменении/удалении данных пользователя,
+// которые уже сохранены в БД
+func (srv *Server) auditRecord(r *http.Request, u model.Updater) {
+	if srv.DBConnector == nil {
+		return
+	}
+	srv.audits.push(recordAudit(r, u))
+}
+
+// auditStaged добавляет в очередь журнала аудита записи запросов, которыми записи хранилища сервера
+// попали в хранилище, после сохранения в БД (arrErr ошибки сохранения записей, nil - все сохранены)
+func (srv *Server) auditStaged(items []staging.Item, arrErr []error) {
+	for i, item := range items {
+		if arrErr == nil || arrErr[i] == nil {
+			srv.audits.push(item.Audit...)
+		}
+	}
+}
+
+// auditFailed добавляет в очередь журнала аудита записи запросов записи хранилища item,
+// которую не удалось сохранить в БД, с признаком неуспеха
+func (srv *Server) auditFailed(item staging.Item) {
+	arr := make([]model.AuditRecord, len(item.Audit))
+	for i, a := range item.Audit {
+		a.Success = false
+		arr[i] = a
+	}
+	srv.audits.push(arr...)
+}
+
+// apiUserAuditGET хендлер журнала аудита текущего пользователя.
+// Параметры: from, to (RFC3339) и limit. При format=jsonl журнал отдается в формате JSON lines
+func (srv *Server) apiUserAuditGET(w http.ResponseWriter, r *http.Request) {
+
+	claims, ok := token.ExtractClaims(r.Header.Get(constants.HeaderAuthorization))
+	if !ok {
+		errs.WriteError(w, errs.ErrUnauthorized)
+		return
+	}
+
+	f := model.AuditFilter{
+		User:  claims["user"].(string),
+		From:  time.Time{},
+		To:    time.Now(),
+		Limit: constants.AuditLimitDefault,
+	}
+
+	q := r.URL.Query()
+	var err error
+	if v := q.Get("from"); v != "" {
+		if f.From, err = time.Parse(time.RFC3339, v); err != nil {
+			errs.WriteError(w, errs.Invalid(err))
+			return
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if f.To, err = time.Parse(time.RFC3339, v); err != nil {
+			errs.WriteError(w, errs.Invalid(err))
+			return
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit <= 0 {
+			errs.WriteError(w, fmt.Errorf("%w: invalid limit", errs.InvalidFormat))
+			return
+		}
+	}
+
+	ctxVW := context.WithValue(r.Context(), model.KeyContext("data"), f)
+	arrAudit, err := srv.DBConnector.SelectAudit(ctxVW)
+	if err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+
+	if q.Get("format") == "jsonl" {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		enc := json.NewEncoder(w)
+		for _, v := range arrAudit {
+			if err = enc.Encode(v); err != nil {
+				constants.Logger.Ctx(r.Context()).ErrorLog(err)
+				return
+			}
+		}
+		return
+	}
+
+	msg, err := json.MarshalIndent(arrAudit, "", " ")
+	if err != nil {
+		constants.Logger.Ctx(r.Context()).ErrorLog(err)
+		errs.WriteError(w, errs.ErrErrorServer)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write(msg); err != nil {
+		constants.Logger.Ctx(r.Context()).ErrorLog(err)
+	}
+}
+
+// InitAudit загружает ключ подписи контрольных точек журнала аудита.
+// Если файла ключа нет, то ключ создается
+func (srv *Server) InitAudit() {
+	key, err := auditchain.LoadKey(srv.Audit.KeyFile)
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+		return
+	}
+	srv.AuditKey = key
+}
+
+// CheckpointAudit горутина создания подписанных контрольных точек журнала аудита
+func (srv *Server) CheckpointAudit(ctx context.Context) {
+	if srv.AuditKey == nil || srv.Audit.CheckpointInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(srv.Audit.CheckpointInterval)
+
+	for {
+		select {
+		case <-ticker.C:
+			err := srv.DBConnector.InsertAuditCheckpoint(ctx, func(c model.AuditCheckpoint) string {
+				return auditchain.Sign(srv.AuditKey, c)
+			})
+			if err != nil {
+				constants.Logger.Ctx(ctx).ErrorLog(err)
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// VerifyAuditCommand команда проверки целостности журнала аудита.
+// Пример: server verify-audit -d postgresql://... -audit-pub audit.key.pub
+// Обходит цепочку хешей и проверяет подписи контрольных точек открытым ключем. Сообщает о первом разрыве
+func VerifyAuditCommand(args []string) error {
+	fs := flag.NewFlagSet("verify-audit", flag.ContinueOnError)
+	dsnPtr := fs.String("d", "", "строка соединения с базой")
+	keyPtr := fs.String("audit-pub", auditchain.PublicKeyFile("audit.key"), "файл открытого ключа контрольных точек журнала аудита")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	dsn := *dsnPtr
+	if v, ok := os.LookupEnv("DATABASE_URI"); ok {
+		dsn = v
+	}
+	keyFile := *keyPtr
+	if v, ok := os.LookupEnv("AUDIT_PUBLIC_KEY"); ok {
+		keyFile = v
+	}
+
+	pub, err := auditchain.LoadPublicKey(keyFile)
+	if err != nil {
+		return err
+	}
+
+	dbc, err := postgresql.NewDBConnector(&environment.DBConfig{DatabaseDsn: dsn})
+	if err != nil {
+		return err
+	}
+	defer dbc.Pool.Close()
+
+	ctx := context.Background()
+	v := auditchain.NewVerifier()
+	if err = dbc.WalkAudit(ctx, v.Next); err != nil {
+		return err
+	}
+
+	arrCheckpoint, err := dbc.SelectAuditCheckpoints(ctx)
+	if err != nil {
+		return err
+	}
+	for _, c := range arrCheckpoint {
+		if err = v.Checkpoint(pub, c); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("audit chain OK: %d entries, %d legacy entries without hash, %d checkpoints\n",
+		v.Checked, v.Legacy, len(arrCheckpoint))
+	return nil
+}
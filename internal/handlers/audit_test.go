@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"gophkeeper/internal/postgresql/model"
+	"gophkeeper/internal/staging"
+)
+
+func TestAuditQueue(t *testing.T) {
+	t.Run("Checking order", func(t *testing.T) {
+		q := auditQueue{}
+		q.push(model.AuditRecord{Uid: "1"}, model.AuditRecord{Uid: "2"})
+		select {
+		case <-q.signal():
+		default:
+			t.Fatal("No signal after push")
+		}
+
+		arr := q.take()
+		q.push(model.AuditRecord{Uid: "3"})
+		// несохраненные записи возвращаются перед новыми
+		q.requeue(arr)
+		arr = q.take()
+		if len(arr) != 3 || arr[0].Uid != "1" || arr[1].Uid != "2" || arr[2].Uid != "3" {
+			t.Errorf("Unexpected order %+v", arr)
+		}
+		if q.Len() != 0 {
+			t.Errorf("Queue is not empty: %d", q.Len())
+		}
+	})
+
+	t.Run("Checking staged records", func(t *testing.T) {
+		s := &Server{}
+		r := httptest.NewRequest("POST", "/api/resource/text", nil)
+		items := []staging.Item{
+			{Key: staging.Key{User: "user", Type: "text", Uid: "1"},
+				Audit: []model.AuditRecord{recordAudit(r, &model.TextData{Uid: "1"})}},
+			{Key: staging.Key{User: "user", Type: "text", Uid: "2"},
+				Audit: []model.AuditRecord{recordAudit(r, &model.TextData{Uid: "2"})}},
+		}
+		// в журнал попадают только сохраненные записи
+		s.auditStaged(items, []error{nil, errors.New("db is down")})
+		arr := s.audits.take()
+		if len(arr) != 1 || arr[0].Uid != "1" || !arr[0].Success {
+			t.Fatalf("Unexpected audit %+v", arr)
+		}
+
+		s.auditFailed(items[1])
+		arr = s.audits.take()
+		if len(arr) != 1 || arr[0].Uid != "2" || arr[0].Success || !items[1].Audit[0].Success {
+			t.Errorf("Unexpected audit of failed record %+v", arr)
+		}
+	})
+}
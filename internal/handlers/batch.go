@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/constants/errs"
+	"gophkeeper/internal/postgresql/model"
+	"gophkeeper/internal/staging"
+	"gophkeeper/internal/token"
+)
+
+// batchReply ответ на пакетный запрос, который не был применен.
+// Операция failed получает ошибку err, остальные помечаются пропущенными
+func batchReply(batch model.Batch, failed int, err error) model.BatchReply {
+	reply := model.BatchReply{Results: make([]model.BatchResult, len(batch.Operations))}
+	for i, op := range batch.Operations {
+		reply.Results[i] = model.BatchResult{Op: op.Op, Type: op.Type, Uid: op.Uid, Status: model.BatchSkipped}
+		if i == failed {
+			reply.Results[i].Status = model.BatchError
+			reply.Results[i].Error = err.Error()
+		}
+	}
+	return reply
+}
+
+// writeBatchError отправка ошибки пакетного запроса. Результаты операций передаются в подробностях ошибки
+func writeBatchError(w http.ResponseWriter, batch model.Batch, failed int, err error) {
+	errs.WriteErrorDetails(w, err, batchReply(batch, failed, err))
+}
+
+// batchResource запись хранилища по операции пакетного запроса
+func batchResource(tkn string, op model.BatchOperation) (model.Resource, error) {
+	t, ok := resourceTypes[op.Type]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown type %q", errs.InvalidFormat, op.Type)
+	}
+
+	res, err := model.NewResource(t)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case model.BatchPut:
+		if len(op.Data) == 0 {
+			return nil, fmt.Errorf("%w: empty data", errs.InvalidFormat)
+		}
+		if err = json.Unmarshal(op.Data, res); err != nil {
+			return nil, fmt.Errorf("%w: %s", errs.InvalidFormat, err.Error())
+		}
+		res.SetIdentity(tkn, op.Uid, constants.EventAddEdit.String())
+	case model.BatchDelete:
+		res.SetIdentity(tkn, op.Uid, constants.EventDel.String())
+	default:
+		return nil, fmt.Errorf("%w: unknown operation %q", errs.InvalidFormat, op.Op)
+	}
+	return res, res.Validate()
+}
+
+// apiBatchPOST хендлер пакетного запроса: добавление, изменение и удаление записей разных типов.
+// Операции применяются в одной транзакции БД, минуя хранилище сервера.
+// Ожидающие сохранения изменения тех же записей из хранилища убираются, что бы не перезаписать результат пакета.
+// Квоты пользователя проверяются с учетом добавленных предыдущими операциями пакета записей.
+// Если хотя бы одна операция не применилась, то не применяется ни одна
+func (srv *Server) apiBatchPOST(w http.ResponseWriter, r *http.Request) {
+
+	body, err := readBody(r)
+	if err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+
+	batch := model.Batch{}
+	if err = json.Unmarshal(body, &batch); err != nil {
+		errs.WriteError(w, errs.Invalid(err))
+		return
+	}
+	if len(batch.Operations) == 0 || len(batch.Operations) > constants.BatchLimit {
+		errs.WriteError(w, fmt.Errorf("%w: operations count must be from 1 to %d", errs.InvalidFormat, constants.BatchLimit))
+		return
+	}
+
+	tkn := r.Header.Get(constants.HeaderAuthorization)
+	claims, ok := token.ExtractClaims(tkn)
+	if !ok {
+		errs.WriteError(w, errs.ErrUnauthorized)
+		return
+	}
+	name := claims["user"].(string)
+
+	q := srv.quota()
+	arrRes := make([]model.Resource, len(batch.Operations))
+	records := map[string]map[string]model.Resource{}
+	var stored map[string]int64
+	for i, op := range batch.Operations {
+		res, err := batchResource(tkn, op)
+		if err != nil {
+			writeBatchError(w, batch, i, err)
+			return
+		}
+		arrRes[i] = res
+
+		t := res.GetType()
+		if op.Op != model.BatchDelete && !quotaEnabled(q, t) {
+			continue
+		}
+		if _, ok := records[t]; !ok {
+			if records[t], err = srv.userRecords(r, t); err != nil {
+				writeBatchError(w, batch, i, err)
+				return
+			}
+		}
+		if op.Op == model.BatchDelete {
+			if _, ok := records[t][op.Uid]; !ok {
+				writeBatchError(w, batch, i, errs.ErrNotFound)
+				return
+			}
+			continue
+		}
+		if stored == nil && q.Bytes > 0 && t == constants.TypeBinaryData.String() {
+			if stored, err = srv.filesStored(r); err != nil {
+				writeBatchError(w, batch, i, err)
+				return
+			}
+		}
+		if err = checkQuota(q, records[t], stored, res); err != nil {
+			writeBatchError(w, batch, i, err)
+			return
+		}
+		records[t][op.Uid] = res
+	}
+
+	arrUpdater := make([]model.Updater, len(arrRes))
+	for i, res := range arrRes {
+		arrUpdater[i] = res
+	}
+
+	unlock := srv.Staging.LockUser(name)
+	ctxVW := context.WithValue(r.Context(), model.KeyContext("data"), arrUpdater)
+	failed, err := srv.DBConnector.ApplyBatch(ctxVW)
+	if err == nil {
+		srv.unstageResources(name, arrRes)
+	}
+	unlock()
+
+	if err != nil {
+		constants.Logger.Ctx(r.Context()).ErrorLog(err)
+		writeBatchError(w, batch, failed, err)
+		return
+	}
+
+	srv.Cache.Invalidate(name)
+	srv.publishChanged(r.Context(), name)
+
+	reply := model.BatchReply{Committed: true, Results: make([]model.BatchResult, len(batch.Operations))}
+	for i, op := range batch.Operations {
+		reply.Results[i] = model.BatchResult{Op: op.Op, Type: op.Type, Uid: op.Uid, Status: model.BatchOK}
+		srv.auditRecord(r, arrRes[i])
+	}
+	writeJSON(w, reply)
+}
+
+// unstageResources убирает из хранилища сервера изменения записей пользователя name,
+// которые уже применены напрямую в БД. Вызывается под блокировкой сохранения шарда пользователя
+func (srv *Server) unstageResources(name string, arrRes []model.Resource) {
+	keys := make([]staging.Key, len(arrRes))
+	for i, res := range arrRes {
+		keys[i] = staging.Key{Type: res.GetType(), Uid: res.GetMainText()}
+	}
+	srv.Staging.Remove(name, keys...)
+}
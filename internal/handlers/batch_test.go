@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/postgresql/model"
+	"gophkeeper/internal/staging"
+	"gophkeeper/internal/token"
+)
+
+func TestBatch(t *testing.T) {
+	s := &Server{}
+	s.InitRouters()
+
+	tokenString := sessionToken(t, s, "user")
+
+	post := func(body string) (*httptest.ResponseRecorder, model.BatchReply) {
+		req := httptest.NewRequest("POST", "/api/batch", strings.NewReader(body))
+		req.Header.Set(constants.HeaderAuthorization, tokenString)
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, req)
+
+		reply := struct {
+			Details model.BatchReply `json:"details"`
+		}{}
+		_ = json.Unmarshal(w.Body.Bytes(), &reply)
+		return w, reply.Details
+	}
+
+	t.Run("Checking empty batch", func(t *testing.T) {
+		w, _ := post(`{"operations":[]}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+
+	t.Run("Checking invalid operation", func(t *testing.T) {
+		w, reply := post(`{"operations":[
+			{"op":"put","type":"text","uid":"0f8fad5b-d9cb-469f-a165-70867728950e","data":{"text":"text"}},
+			{"op":"put","type":"unknown","uid":"7c9e6679-7425-40de-944b-e07fc1f90ae7","data":{}},
+			{"op":"merge","type":"text","uid":"3"}]}`)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("Expected %d, got %d", http.StatusBadRequest, w.Code)
+		}
+		if reply.Committed || len(reply.Results) != 3 {
+			t.Fatalf("Unexpected reply %+v", reply)
+		}
+		statuses := []string{model.BatchSkipped, model.BatchError, model.BatchSkipped}
+		for i, v := range reply.Results {
+			if v.Status != statuses[i] {
+				t.Errorf("Operation %d: expected %s, got %s", i, statuses[i], v.Status)
+			}
+		}
+	})
+
+	t.Run("Checking validation", func(t *testing.T) {
+		w, reply := post(`{"operations":[
+			{"op":"put","type":"text","uid":"0f8fad5b-d9cb-469f-a165-70867728950e","data":{"text":"text"}},
+			{"op":"put","type":"card","uid":"1","data":{"cvc":"123"}}]}`)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("Expected %d, got %d", http.StatusBadRequest, w.Code)
+		}
+		if len(reply.Results) != 2 || reply.Results[1].Status != model.BatchError ||
+			!strings.Contains(reply.Results[1].Error, "uid") || !strings.Contains(reply.Results[1].Error, "number") {
+			t.Errorf("Unexpected reply %+v", reply)
+		}
+	})
+
+	t.Run("Checking unstage resources", func(t *testing.T) {
+		other, err := token.NewClaims("other").GenerateJWT()
+		if err != nil {
+			t.Fatal(err)
+		}
+		typeText := constants.TypeTextData.String()
+		for _, v := range []*model.TextData{{User: tokenString, Uid: "1"}, {User: other, Uid: "2"}} {
+			if err = s.Staging.Put(staging.Item{Key: staging.Key{User: userName(v), Type: typeText, Uid: v.Uid}, Record: v}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		s.unstageResources("user", []model.Resource{&model.TextData{Uid: "1"}, &model.TextData{Uid: "2"}})
+
+		if _, ok := s.Staging.Get("user", staging.Key{Type: typeText, Uid: "1"}); ok {
+			t.Error("Record of the user is not unstaged")
+		}
+		if _, ok := s.Staging.Get("other", staging.Key{Type: typeText, Uid: "2"}); !ok {
+			t.Error("Record of other user is unstaged")
+		}
+	})
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"gophkeeper/internal/bus"
+	"gophkeeper/internal/cache"
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/postgresql/model"
+	"gophkeeper/internal/staging"
+)
+
+// Описания метрик кеша записей пользователей
+var (
+	cacheHitsDesc = prometheus.NewDesc("gophkeeper_cache_hits_total",
+		"Reads of user records served from the cache.", nil, nil)
+	cacheMissesDesc = prometheus.NewDesc("gophkeeper_cache_misses_total",
+		"Reads of user records that went to the database.", nil, nil)
+	cacheEvictionsDesc = prometheus.NewDesc("gophkeeper_cache_evictions_total",
+		"Users evicted from the cache to stay within its limits.", nil, nil)
+	cacheUsersDesc = prometheus.NewDesc("gophkeeper_cache_users",
+		"Users in the cache.", nil, nil)
+	cacheRecordsDesc = prometheus.NewDesc("gophkeeper_cache_records",
+		"Records in the cache.", nil, nil)
+)
+
+// cacheCollector сборщик метрик кеша записей пользователей. Доля попаданий считается по счетчикам
+// hits и misses, значения читаются при каждом запросе метрик
+type cacheCollector struct {
+	srv *Server
+}
+
+// Describe описание метрик сборщика
+func (cc cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheHitsDesc
+	ch <- cacheMissesDesc
+	ch <- cacheEvictionsDesc
+	ch <- cacheUsersDesc
+	ch <- cacheRecordsDesc
+}
+
+// Collect статистика кеша
+func (cc cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	if cc.srv.Cache == nil {
+		return
+	}
+	st := cc.srv.Cache.Stats()
+	ch <- prometheus.MustNewConstMetric(cacheHitsDesc, prometheus.CounterValue, float64(st.Hits))
+	ch <- prometheus.MustNewConstMetric(cacheMissesDesc, prometheus.CounterValue, float64(st.Misses))
+	ch <- prometheus.MustNewConstMetric(cacheEvictionsDesc, prometheus.CounterValue, float64(st.Evictions))
+	ch <- prometheus.MustNewConstMetric(cacheUsersDesc, prometheus.GaugeValue, float64(st.Users))
+	ch <- prometheus.MustNewConstMetric(cacheRecordsDesc, prometheus.GaugeValue, float64(st.Records))
+}
+
+// InitCache инициализация кеша записей пользователей по конфигурации (cache.users, cache.records)
+func (srv *Server) InitCache() {
+	if srv.ServerConfig == nil {
+		srv.Cache = cache.New(0, 0)
+		return
+	}
+	srv.Cache = cache.New(srv.ServerConfig.Cache.Users, srv.ServerConfig.Cache.Records)
+}
+
+// selectRecords записи пользователя токена tkn типа t, сохраненные в БД. Записи читаются из кеша,
+// при промахе из БД. Возвращенный набор записей нельзя изменять
+func (srv *Server) selectRecords(ctx context.Context, tkn, t string) (model.Appender, error) {
+	name := tokenUser(tkn)
+	app, tk, ok := srv.Cache.Get(name, t)
+	if ok {
+		return app, nil
+	}
+
+	ctxWV := context.WithValue(ctx, model.KeyContext("user"), tkn)
+	app, err := srv.DBConnector.Select(ctxWV, t)
+	if err != nil {
+		return nil, err
+	}
+	srv.Cache.Fill(tk, t, app)
+	return app, nil
+}
+
+// cacheStaged обновляет кеш записями хранилища сервера, сохраненными в БД (arrErr ошибки сохранения записей,
+// nil - все сохранены). Кеш обновляется до подтверждения записей в хранилище: запись, которую уже нет
+// в хранилище, есть в кеше. Если запись не удалось привести к виду записи БД, то записи пользователя сбрасываются
+func (srv *Server) cacheStaged(items []staging.Item, arrErr []error) {
+	type userType struct{ user, t string }
+	changes := map[userType]map[string]model.Updater{}
+	for i, item := range items {
+		if arrErr != nil && arrErr[i] != nil {
+			continue
+		}
+		key := userType{item.User, item.Type}
+		if changes[key] == nil {
+			changes[key] = map[string]model.Updater{}
+		}
+		if item.Record.GetEvent() == constants.EventDel.String() {
+			changes[key][item.Uid] = nil
+			continue
+		}
+		res, err := cloneResource(item.Type, item.Record, item.User)
+		if err != nil {
+			constants.Logger.ErrorLog(err)
+			srv.Cache.Invalidate(item.User)
+			continue
+		}
+		changes[key][item.Uid] = res
+	}
+
+	for key, arr := range changes {
+		srv.Cache.Apply(key.user, key.t, arr)
+	}
+}
+
+// dropCached сбрасывает кеш по событию другого экземпляра сервера: записи пользователя изменены или удалены
+// в БД в обход кеша этого экземпляра. После переподключения к шине сбрасывается весь кеш.
+// Вызывается каждым подписчиком, который после события читает записи, что бы не прочитать их из кеша до сброса
+func (srv *Server) dropCached(ev bus.Event) {
+	if ev.Instance == srv.instance {
+		return
+	}
+
+	switch ev.Kind {
+	case bus.KindChanged:
+		srv.Cache.Invalidate(ev.User)
+	case bus.KindUserDeleted:
+		srv.Cache.Remove(ev.User)
+	case bus.KindResync:
+		srv.Cache.Clear()
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"gophkeeper/internal/bus"
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/postgresql/model"
+	"gophkeeper/internal/staging"
+	"gophkeeper/internal/token"
+)
+
+func TestCacheStaged(t *testing.T) {
+	s := &Server{}
+	s.InitRouters()
+
+	tkn, err := token.NewClaims("user").GenerateJWT()
+	if err != nil {
+		t.Fatal(err)
+	}
+	typeText := constants.TypeTextData.String()
+	_, tk, _ := s.Cache.Get("user", typeText)
+	s.Cache.Fill(tk, typeText, model.Appender{
+		"1": &model.TextData{User: "user", Uid: "1", Text: "old"},
+		"2": &model.TextData{User: "user", Uid: "2"},
+	})
+
+	t.Run("Checking saved records", func(t *testing.T) {
+		items := []staging.Item{
+			{Key: staging.Key{User: "user", Type: typeText, Uid: "1"},
+				Record: &model.TextData{User: tkn, Uid: "1", Text: "new"}},
+			{Key: staging.Key{User: "user", Type: typeText, Uid: "2"},
+				Record: &model.TextData{User: tkn, Uid: "2", Event: constants.EventDel.String()}},
+			{Key: staging.Key{User: "user", Type: typeText, Uid: "3"},
+				Record: &model.TextData{User: tkn, Uid: "3"}},
+		}
+		s.cacheStaged(items, []error{nil, nil, errors.New("db is down")})
+
+		app, _, ok := s.Cache.Get("user", typeText)
+		if !ok || len(app) != 1 {
+			t.Fatalf("Expected 1 cached record, got %v", app)
+		}
+		td := app["1"].(*model.TextData)
+		if td.Text != "new" || td.User != "user" || td.Event != "" {
+			t.Errorf("Record is not converted to database form: %+v", td)
+		}
+	})
+
+	t.Run("Checking events", func(t *testing.T) {
+		s.dropCached(bus.Event{Kind: bus.KindChanged, User: "user", Instance: s.instance})
+		if _, _, ok := s.Cache.Get("user", typeText); !ok {
+			t.Error("Cache is dropped by own event")
+		}
+		s.dropCached(bus.Event{Kind: bus.KindChanged, User: "user", Instance: "other"})
+		if _, _, ok := s.Cache.Get("user", typeText); ok {
+			t.Error("Cache is not dropped by event of other instance")
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"gophkeeper/internal/bus"
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/token"
+)
+
+// InitBus инициализация шины событий между экземплярами сервера по конфигурации (cluster.bus).
+// Без БД или конфигурации используется шина внутри процесса
+func (srv *Server) InitBus() {
+	srv.instance = uuid.New().String()
+	if srv.ServerConfig != nil && srv.DBConnector != nil && strings.EqualFold(srv.Cluster.Bus, "postgres") {
+		srv.Bus = bus.NewPostgres(srv.Pool, srv.Cluster.Channel)
+		return
+	}
+	srv.Bus = bus.NewLocal()
+}
+
+// clustered признак, что с БД работают несколько экземпляров сервера (шина postgres).
+// Тогда запись пользователя сохраняется в БД до ответа на запрос, что бы ее сразу видели все экземпляры
+func (srv *Server) clustered() bool {
+	_, ok := srv.Bus.(*bus.Postgres)
+	return ok
+}
+
+// publish публикует событие шины от имени экземпляра сервера. Ошибка публикации пишется в лог:
+// другие экземпляры узнают об изменении при следующем опросе БД или по событию KindResync
+func (srv *Server) publish(ctx context.Context, ev bus.Event) {
+	ev.Instance = srv.instance
+	if err := srv.Bus.Publish(ctx, ev); err != nil {
+		constants.Logger.Ctx(ctx).ErrorLog(err)
+	}
+}
+
+// publishChanged публикует изменение данных пользователей users
+func (srv *Server) publishChanged(ctx context.Context, users ...string) {
+	for _, name := range users {
+		if name != "" {
+			srv.publish(ctx, bus.Event{Kind: bus.KindChanged, User: name})
+		}
+	}
+}
+
+// revokeSession отзывает сессию на всех экземплярах сервера и закрывает ее websocket соединения
+func (srv *Server) revokeSession(ctx context.Context, uid string) {
+	srv.Sessions.Revoke(uid)
+	srv.publish(ctx, bus.Event{Kind: bus.KindSessionRevoked, Uid: uid})
+}
+
+// revokeDevice отзывает устройство на всех экземплярах сервера
+func (srv *Server) revokeDevice(ctx context.Context, uid string) {
+	srv.Devices.Revoke(uid)
+	srv.publish(ctx, bus.Event{Kind: bus.KindDeviceRevoked, Uid: uid})
+}
+
+// Coordinate горутина применения событий других экземпляров сервера: отзыв сессий и устройств,
+// удаление записей удаленного пользователя из хранилища, сброс кеша записей. Для шины postgres запускает слушателя канала
+func (srv *Server) Coordinate(ctx context.Context) {
+	if pb, ok := srv.Bus.(*bus.Postgres); ok {
+		srv.workers.Add(1)
+		go func() {
+			defer srv.workers.Done()
+			pb.Run(ctx)
+		}()
+	}
+
+	events, unsubscribe := srv.Bus.Subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			srv.applyEvent(ctx, ev)
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// applyEvent применяет событие другого экземпляра сервера. События своего экземпляра уже применены
+func (srv *Server) applyEvent(ctx context.Context, ev bus.Event) {
+	if ev.Instance == srv.instance {
+		return
+	}
+
+	srv.dropCached(ev)
+	switch ev.Kind {
+	case bus.KindSessionRevoked:
+		srv.Sessions.Revoke(ev.Uid)
+	case bus.KindDeviceRevoked:
+		srv.Devices.Revoke(ev.Uid)
+	case bus.KindUserDeleted:
+		unlock := srv.Staging.LockUser(ev.User)
+		srv.delUserFromStaging(ev.User)
+		unlock()
+	case bus.KindResync:
+		srv.reloadRevoked(ctx)
+	}
+}
+
+// reloadRevoked перечитывает отозванные сессии и устройства из БД после возможной потери событий
+func (srv *Server) reloadRevoked(ctx context.Context) {
+	if srv.DBConnector == nil {
+		return
+	}
+
+	arrUID, err := srv.DBConnector.SelectRevokedSessions(ctx)
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+	}
+	for _, uid := range arrUID {
+		srv.Sessions.Revoke(uid)
+	}
+
+	arrUID, err = srv.DBConnector.SelectRevokedDevices(ctx)
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+	}
+	srv.Devices.LoadRevoked(arrUID)
+}
+
+// changedFor признак, что после события ev данные пользователя user нужно перечитать
+func changedFor(ev bus.Event, user string) bool {
+	switch ev.Kind {
+	case bus.KindChanged, bus.KindUserDeleted:
+		return ev.User == user
+	case bus.KindResync:
+		return true
+	}
+	return false
+}
+
+// tokenUser имя пользователя токена
+func tokenUser(tkn string) string {
+	claims, ok := token.ExtractClaims(tkn)
+	if !ok {
+		return ""
+	}
+	name, _ := claims["user"].(string)
+	return name
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gophkeeper/internal/bus"
+	"gophkeeper/internal/postgresql/model"
+	"gophkeeper/internal/staging"
+)
+
+func TestCluster(t *testing.T) {
+	s := &Server{}
+	s.InitRouters()
+	ctx := context.Background()
+
+	t.Run("Checking event of other instance", func(t *testing.T) {
+		_ = s.Staging.Put(staging.Item{Key: staging.Key{User: "deleted", Type: "text", Uid: "1"},
+			Record: &model.TextData{Uid: "1"}})
+		_ = s.Staging.Put(staging.Item{Key: staging.Key{User: "other", Type: "text", Uid: "2"},
+			Record: &model.TextData{Uid: "2"}})
+
+		s.applyEvent(ctx, bus.Event{Kind: bus.KindSessionRevoked, Uid: "session", Instance: "other"})
+		s.applyEvent(ctx, bus.Event{Kind: bus.KindUserDeleted, User: "deleted", Instance: "other"})
+
+		if active, _ := s.Sessions.Active("session", "user"); active {
+			t.Error("Session is not revoked")
+		}
+		if len(s.Staging.User("deleted", "text")) != 0 || len(s.Staging.User("other", "text")) != 1 {
+			t.Errorf("Error removing records of deleted user: %d", s.Staging.Len())
+		}
+	})
+
+	t.Run("Checking own event", func(t *testing.T) {
+		s.Sessions.Add("own", "user", time.Now().Add(time.Hour))
+		s.applyEvent(ctx, bus.Event{Kind: bus.KindSessionRevoked, Uid: "own", Instance: s.instance})
+		if active, _ := s.Sessions.Active("own", "user"); !active {
+			t.Error("Own event is applied twice")
+		}
+	})
+
+	t.Run("Checking revoke publishes event", func(t *testing.T) {
+		events, unsubscribe := s.Bus.Subscribe()
+		defer unsubscribe()
+
+		s.revokeDevice(ctx, "device")
+		select {
+		case ev := <-events:
+			if ev.Kind != bus.KindDeviceRevoked || ev.Uid != "device" || ev.Instance != s.instance {
+				t.Errorf("Unexpected event %+v", ev)
+			}
+		case <-time.After(time.Second):
+			t.Error("Event is not published")
+		}
+		if !s.Devices.Revoked("device") {
+			t.Error("Device is not revoked")
+		}
+	})
+
+	t.Run("Checking changed for user", func(t *testing.T) {
+		if !changedFor(bus.Event{Kind: bus.KindChanged, User: "user"}, "user") ||
+			changedFor(bus.Event{Kind: bus.KindChanged, User: "other"}, "user") ||
+			!changedFor(bus.Event{Kind: bus.KindResync}, "user") ||
+			changedFor(bus.Event{Kind: bus.KindSessionRevoked}, "user") {
+			t.Error("Error checking changed event")
+		}
+	})
+}
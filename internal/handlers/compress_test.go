@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"gophkeeper/internal/compression"
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/constants/errs"
+)
+
+func TestCompression(t *testing.T) {
+	s := &Server{}
+	s.InitRouters()
+
+	tokenString := sessionToken(t, s, "user")
+
+	post := func(encoding string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/resource/text", bytes.NewReader(body))
+		req.Header.Set(constants.HeaderAuthorization, tokenString)
+		req.Header.Set("Content-Encoding", encoding)
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Checking zstd request body", func(t *testing.T) {
+		body, err := compression.Encode(compression.Zstd,
+			[]byte(`{"uid":"0f8fad5b-d9cb-469f-a165-70867728950e","text":"text","event":"edit"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := post(compression.Zstd, body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("Accept-Encoding"); got != compression.AcceptEncoding {
+			t.Errorf("Expected Accept-Encoding %q, got %q", compression.AcceptEncoding, got)
+		}
+	})
+
+	t.Run("Checking unsupported request encoding", func(t *testing.T) {
+		w := post("br", []byte(`{}`))
+		if w.Code != http.StatusUnsupportedMediaType {
+			t.Fatalf("Expected %d, got %d: %s", http.StatusUnsupportedMediaType, w.Code, w.Body.String())
+		}
+		resp := struct {
+			Code string `json:"code"`
+		}{}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Code != errs.CodeUnsupportedEncoding {
+			t.Errorf("Expected code %s, got %s", errs.CodeUnsupportedEncoding, resp.Code)
+		}
+	})
+
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if accept != "" {
+			req.Header.Set("Accept-Encoding", accept)
+		}
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	plain := get("/api/openapi.json", "").Body.Bytes()
+	if len(plain) < 1024 {
+		t.Fatalf("Specification is too small to be compressed: %d", len(plain))
+	}
+
+	tests := []struct {
+		name     string
+		accept   string
+		encoding string
+	}{
+		{name: "Checking zstd response", accept: "gzip, zstd", encoding: compression.Zstd},
+		{name: "Checking gzip response", accept: "gzip", encoding: compression.Gzip},
+		{name: "Checking weighted response", accept: "zstd;q=0.5, gzip", encoding: compression.Gzip},
+		{name: "Checking plain response", accept: "br", encoding: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get("/api/openapi.json", tt.accept)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected %d, got %d", http.StatusOK, w.Code)
+			}
+			if got := w.Header().Get("Content-Encoding"); got != tt.encoding {
+				t.Fatalf("Expected Content-Encoding %q, got %q", tt.encoding, got)
+			}
+			if !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+				t.Errorf("Unexpected Content-Type %q", w.Header().Get("Content-Type"))
+			}
+			body, err := compression.Decode(tt.encoding, w.Body.Bytes(), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(body, plain) {
+				t.Error("Decoded response differs from plain response")
+			}
+		})
+	}
+
+	t.Run("Checking small response", func(t *testing.T) {
+		w := get("/healthz", "zstd")
+		if got := w.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("Small response is compressed: %q", got)
+		}
+	})
+
+	t.Run("Checking message encoding", func(t *testing.T) {
+		ts := httptest.NewServer(s.Router)
+		defer ts.Close()
+		url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/socket"
+
+		for accept, expected := range map[string]string{
+			"":                           compression.Gzip,
+			compression.MessageEncodings: compression.Zstd,
+			"gzip":                       compression.Gzip,
+			"br":                         compression.Identity,
+		} {
+			h := http.Header{}
+			if accept != "" {
+				h.Set(compression.HeaderMessageEncoding, accept)
+			}
+			conn, resp, err := websocket.DefaultDialer.Dial(url, h)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = conn.Close()
+			if got := resp.Header.Get(compression.HeaderMessageEncoding); got != expected {
+				t.Errorf("%q: expected %q, got %q", accept, expected, got)
+			}
+		}
+	})
+
+	t.Run("Checking file message encoding", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/socket_file", nil)
+		req.Header.Set(compression.HeaderMessageEncoding, compression.MessageEncodings)
+		if got := messageEncoding(req, fileEncodings); got != compression.Identity {
+			t.Errorf("Expected %q, got %q", compression.Identity, got)
+		}
+	})
+}
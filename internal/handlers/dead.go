@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/postgresql/model"
+	"gophkeeper/internal/staging"
+)
+
+// deadItem запись хранилища сервера, которую не удалось сохранить в БД, вместе с самой записью.
+// Запись хранится, что бы администратор мог вернуть ее в хранилище после устранения причины ошибки
+type deadItem struct {
+	model.DeadItem
+	item staging.Item
+}
+
+// deadList список неисправных записей хранилища сервера
+type deadList struct {
+	sync.Mutex
+	items []deadItem
+}
+
+// Len количество неисправных записей
+func (dl *deadList) Len() int {
+	dl.Lock()
+	defer dl.Unlock()
+
+	return len(dl.items)
+}
+
+// flushFailed учитывает неудачную попытку сохранить запись хранилища сервера в БД.
+// После constants.FlushMaxAttempts попыток запись переносится из хранилища в список неисправных записей,
+// что бы не повторять запрос в БД бесконечно. Возвращает true, если запись нужно убрать из хранилища.
+// Вызывается под блокировкой шарда хранилища, поэтому не обращается к БД
+func (srv *Server) flushFailed(item staging.Item, err error) bool {
+	constants.Logger.ErrorLog(err)
+	srv.flushError()
+	if item.Attempts < constants.FlushMaxAttempts {
+		return false
+	}
+
+	srv.dead.Lock()
+	srv.dead.items = append(srv.dead.items, deadItem{
+		DeadItem: model.DeadItem{
+			Type:     item.Type,
+			Uid:      item.Uid,
+			User:     item.User,
+			Event:    item.Record.GetEvent(),
+			Error:    err.Error(),
+			Attempts: item.Attempts,
+			Date:     time.Now(),
+		},
+		item: item,
+	})
+	if len(srv.dead.items) > constants.DeadItemsLimit {
+		constants.Logger.ErrorLog(fmt.Errorf("dead item %s %s dropped: limit %d exceeded",
+			srv.dead.items[0].Type, srv.dead.items[0].Uid, constants.DeadItemsLimit))
+		srv.dead.items = srv.dead.items[1:]
+	}
+	srv.dead.Unlock()
+	srv.auditFailed(item)
+
+	constants.Logger.ErrorLog(fmt.Errorf("record %s %s moved to dead items after %d attempts: %w",
+		item.Type, item.Uid, item.Attempts, err))
+	return true
+}
+
+// delUserDeadItems удаляет неисправные записи пользователя name
+func (srv *Server) delUserDeadItems(name string) {
+	srv.dead.Lock()
+	defer srv.dead.Unlock()
+
+	arr := srv.dead.items[:0]
+	for _, v := range srv.dead.items {
+		if v.User != name {
+			arr = append(arr, v)
+		}
+	}
+	srv.dead.items = arr
+}
+
+// apiAdminDeadGET хендлер списка неисправных записей хранилища сервера (без данных записей).
+// Доступен только администратору
+func (srv *Server) apiAdminDeadGET(w http.ResponseWriter, r *http.Request) {
+	srv.dead.Lock()
+	arr := make([]model.DeadItem, len(srv.dead.items))
+	for i, v := range srv.dead.items {
+		arr[i] = v.DeadItem
+	}
+	srv.dead.Unlock()
+
+	writeJSON(w, arr)
+}
+
+// apiAdminDeadRetryPOST хендлер возврата неисправных записей в хранилище сервера для повторного сохранения в БД.
+// Если в хранилище уже есть более новая версия записи, то неисправная запись отбрасывается.
+// Возвращает количество возвращенных записей. Доступен только администратору
+func (srv *Server) apiAdminDeadRetryPOST(w http.ResponseWriter, r *http.Request) {
+	srv.dead.Lock()
+	arrDead := srv.dead.items
+	srv.dead.items = nil
+	srv.dead.Unlock()
+
+	requeued := 0
+	for _, v := range arrDead {
+		if srv.Staging.Requeue(v.item) {
+			requeued++
+		}
+	}
+
+	writeJSON(w, map[string]int{"requeued": requeued})
+}
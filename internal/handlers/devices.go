@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/constants/errs"
+	"gophkeeper/internal/midware"
+	"gophkeeper/internal/postgresql/model"
+	"gophkeeper/internal/tlsutil"
+	"gophkeeper/internal/token"
+)
+
+// Devices хранилище отозванных устройств. Сертификат отозванного устройства не принимается сервером
+type Devices struct {
+	sync.Mutex
+	revoked map[string]bool
+}
+
+// NewDevices создание хранилища отозванных устройств
+func NewDevices() *Devices {
+	return &Devices{revoked: map[string]bool{}}
+}
+
+// Revoked проверяет, что устройство отозвано
+func (d *Devices) Revoked(device string) bool {
+	d.Lock()
+	defer d.Unlock()
+
+	return d.revoked[device]
+}
+
+// Revoke отзывает устройство
+func (d *Devices) Revoke(device string) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.revoked[device] = true
+}
+
+// LoadRevoked загружает отозванные устройства из БД при старте сервера
+func (d *Devices) LoadRevoked(arrUID []string) {
+	d.Lock()
+	defer d.Unlock()
+
+	for _, v := range arrUID {
+		d.revoked[v] = true
+	}
+}
+
+// InitDevices инициализация удостоверяющего центра устройств.
+// Сертификаты устройств проверяются только если сервер запущен с TLS и включена проверка устройств
+func (srv *Server) InitDevices() {
+	srv.Devices = NewDevices()
+	if srv.TLSConfig == nil || !srv.TLS.ClientCerts {
+		return
+	}
+
+	ca, err := tlsutil.LoadOrCreateCA(srv.TLS.CACertFile, srv.TLS.CAKeyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv.DeviceCA = ca
+	srv.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	srv.TLSConfig.ClientCAs = ca.Pool
+
+	if srv.DBConnector == nil {
+		return
+	}
+	arrUID, err := srv.DBConnector.SelectRevokedDevices(context.Background())
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+		return
+	}
+	srv.Devices.LoadRevoked(arrUID)
+}
+
+// deviceAuthorized проверка сертификата устройства для маршрутов, защищенных токеном
+func (srv *Server) deviceAuthorized(endpoint func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	if srv.DeviceCA == nil {
+		return endpoint
+	}
+	return midware.IsDevice(srv.Devices.Revoked, endpoint).ServeHTTP
+}
+
+// sessionDevice возвращает УИД устройства из сертификата запроса, если сертификат выдан пользователю name
+func (srv *Server) sessionDevice(r *http.Request, name string) string {
+	if srv.DeviceCA == nil {
+		return ""
+	}
+	user, device, ok := midware.DeviceCertificate(r)
+	if !ok || user != name || srv.Devices.Revoked(device) {
+		return ""
+	}
+	return device
+}
+
+// apiUserDeviceEnrollPOST хендлер выпуска сертификата устройства.
+// Перед выпуском пользователь повторно аутентифицируется по паролю.
+// Ключ устройства не покидает клиент, сервер подписывает запрос на сертификат
+func (srv *Server) apiUserDeviceEnrollPOST(w http.ResponseWriter, r *http.Request) {
+
+	if srv.DeviceCA == nil {
+		errs.WriteError(w, fmt.Errorf("%w: device certificates are disabled", errs.ErrNotFound))
+		return
+	}
+
+	claims, ok := token.ExtractClaims(r.Header.Get(constants.HeaderAuthorization))
+	if !ok {
+		errs.WriteError(w, errs.ErrUnauthorized)
+		return
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+	de := model.DeviceEnrollment{}
+	if err = json.Unmarshal(body, &de); err != nil {
+		errs.WriteError(w, errs.Invalid(err))
+		return
+	}
+
+	user := model.User{Name: claims["user"].(string), Password: de.Password}
+	if err = srv.DBConnector.CheckAccount(r.Context(), &user); err != nil {
+		srv.audit(r, model.AuditRecord{Event: constants.AuditEnroll, Success: false})
+		errs.WriteError(w, err)
+		return
+	}
+
+	d := model.Device{
+		Uid:     uuid.New().String(),
+		User:    user.Name,
+		Name:    de.Name,
+		Created: time.Now(),
+	}
+	certPEM, cert, err := srv.DeviceCA.IssueDevice([]byte(de.CSR), d.User, d.Uid, constants.TimeLiveDeviceCert)
+	if err != nil {
+		errs.WriteError(w, errs.Invalid(err))
+		return
+	}
+	d.Serial = cert.SerialNumber.Text(16)
+	d.NotAfter = cert.NotAfter
+
+	ctxVW := context.WithValue(r.Context(), model.KeyContext("data"), d)
+	if err = srv.DBConnector.NewDevice(ctxVW); err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+	srv.audit(r, model.AuditRecord{Event: constants.AuditEnroll, Uid: d.Uid, Success: true})
+
+	msg, err := json.MarshalIndent(model.DeviceCertificate{
+		Uid:         d.Uid,
+		Certificate: string(certPEM),
+		CA:          string(srv.DeviceCA.CertPEM()),
+	}, "", " ")
+	if err != nil {
+		constants.Logger.Ctx(r.Context()).ErrorLog(err)
+		errs.WriteError(w, errs.ErrErrorServer)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write(msg); err != nil {
+		constants.Logger.Ctx(r.Context()).ErrorLog(err)
+	}
+}
+
+// apiUserDevicesGET хендлер списка действующих устройств пользователя
+func (srv *Server) apiUserDevicesGET(w http.ResponseWriter, r *http.Request) {
+
+	tkn := r.Header.Get(constants.HeaderAuthorization)
+	claims, ok := token.ExtractClaims(tkn)
+	if !ok {
+		errs.WriteError(w, errs.ErrUnauthorized)
+		return
+	}
+	current := token.DeviceFromToken(tkn)
+
+	ctx := context.WithValue(r.Context(), model.KeyContext("user"), claims["user"])
+	arrDevice, err := srv.DBConnector.SelectDevices(ctx)
+	if err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+	for i := range arrDevice {
+		arrDevice[i].Current = arrDevice[i].Uid == current
+	}
+
+	msg, err := json.MarshalIndent(arrDevice, "", " ")
+	if err != nil {
+		constants.Logger.Ctx(r.Context()).ErrorLog(err)
+		errs.WriteError(w, errs.ErrErrorServer)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write(msg); err != nil {
+		constants.Logger.Ctx(r.Context()).ErrorLog(err)
+	}
+}
+
+// apiUserDevicesRevokePOST хендлер отзыва устройства пользователя.
+// Сертификат устройства перестает приниматься, сессии, открытые с устройства, отзываются
+func (srv *Server) apiUserDevicesRevokePOST(w http.ResponseWriter, r *http.Request) {
+
+	claims, ok := token.ExtractClaims(r.Header.Get(constants.HeaderAuthorization))
+	if !ok {
+		errs.WriteError(w, errs.ErrUnauthorized)
+		return
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+
+	d := model.Device{}
+	if err = json.Unmarshal(body, &d); err != nil {
+		errs.WriteError(w, errs.Invalid(err))
+		return
+	}
+	d.User = claims["user"].(string)
+
+	ctxVW := context.WithValue(r.Context(), model.KeyContext("data"), d)
+	if err = srv.DBConnector.RevokeDevice(ctxVW); err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+	srv.revokeDevice(r.Context(), d.Uid)
+	srv.revokeDeviceSessions(r.Context(), d)
+	srv.audit(r, model.AuditRecord{Event: constants.AuditRevokeDevice, Uid: d.Uid, Success: true})
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// revokeDeviceSessions отзывает сессии пользователя, открытые с устройства
+func (srv *Server) revokeDeviceSessions(ctx context.Context, d model.Device) {
+	arrSession, err := srv.DBConnector.SelectSessions(context.WithValue(ctx, model.KeyContext("user"), d.User))
+	if err != nil {
+		constants.Logger.Ctx(ctx).ErrorLog(err)
+		return
+	}
+
+	for _, s := range arrSession {
+		if s.DeviceID != d.Uid {
+			continue
+		}
+		ctxVW := context.WithValue(ctx, model.KeyContext("data"), s)
+		if err = srv.DBConnector.RevokeSession(ctxVW); err != nil {
+			constants.Logger.Ctx(ctx).ErrorLog(err)
+		}
+		srv.revokeSession(ctx, s.Uid)
+	}
+}
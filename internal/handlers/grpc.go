@@ -0,0 +1,520 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/constants/errs"
+	"gophkeeper/internal/grpcapi"
+	"gophkeeper/internal/postgresql/model"
+)
+
+// grpcRecordTypes соответствие типа записи gRPC типу записи в адресе REST API
+var grpcRecordTypes = map[grpcapi.RecordType]string{
+	grpcapi.RecordType_PAIRS:  "pairs",
+	grpcapi.RecordType_TEXT:   "text",
+	grpcapi.RecordType_BINARY: "binary",
+	grpcapi.RecordType_CARD:   "card",
+}
+
+// grpcServer реализация gRPC API.
+// Вызовы без потоков выполняются хендлерами HTTP API через роутер сервера, поэтому хранилище,
+// авторизация, ограничение попыток входа и аудит общие с HTTP API
+type grpcServer struct {
+	grpcapi.UnimplementedKeeperServer
+	srv *Server
+}
+
+// InitGRPC инициализация gRPC сервера. Используется тот же TLS, что и у HTTP API,
+// включая проверку сертификатов устройств. Пустой адрес отключает gRPC
+func (srv *Server) InitGRPC() {
+	if srv.GRPCAddress == "" {
+		return
+	}
+
+	var opts []grpc.ServerOption
+	if srv.TLSConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(srv.TLSConfig)))
+	}
+	srv.GRPC = grpc.NewServer(opts...)
+	grpcapi.RegisterKeeperServer(srv.GRPC, &grpcServer{srv: srv})
+}
+
+// RunGRPC запуск gRPC сервера на отдельном порту
+func (srv *Server) RunGRPC() {
+	if srv.GRPC == nil {
+		return
+	}
+
+	listen, err := net.Listen("tcp", srv.GRPCAddress)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err = srv.GRPC.Serve(listen); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// grpcResponse ответ хендлера HTTP API, вызванного из gRPC
+type grpcResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newGRPCResponse() *grpcResponse {
+	return &grpcResponse{header: http.Header{}, status: http.StatusOK}
+}
+
+func (gr *grpcResponse) Header() http.Header {
+	return gr.header
+}
+
+func (gr *grpcResponse) Write(b []byte) (int, error) {
+	return gr.body.Write(b)
+}
+
+func (gr *grpcResponse) WriteHeader(status int) {
+	gr.status = status
+}
+
+// err ошибка gRPC по статусу ответа хендлера
+func (gr *grpcResponse) err() error {
+	if gr.status == http.StatusOK {
+		return nil
+	}
+	e := errs.ErrorResponse{}
+	if err := json.Unmarshal(gr.body.Bytes(), &e); err != nil || e.Message == "" {
+		return status.Error(grpcCode(gr.status, ""), strings.TrimSpace(gr.body.String()))
+	}
+	return status.Error(grpcCode(gr.status, e.Code), e.Message)
+}
+
+// grpcError ошибка gRPC по ошибке сервера
+func grpcError(err error) error {
+	return status.Error(grpcCode(errs.HTTPErrors(err), errs.Code(err)), err.Error())
+}
+
+// grpcCode код ошибки gRPC по HTTP статусу и коду ошибки API. Превышение квоты - codes.ResourceExhausted
+func grpcCode(httpStatus int, code string) codes.Code {
+	if code == errs.CodeQuotaExceeded {
+		return codes.ResourceExhausted
+	}
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusTooManyRequests, http.StatusRequestEntityTooLarge:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	}
+	return codes.Internal
+}
+
+// grpcRequest HTTP запрос по метаданным и соединению gRPC вызова.
+// Токен, имя устройства, версия клиента и контекст трассировки (traceparent, tracestate) берутся из метаданных,
+// IP адрес и сертификат устройства из соединения
+func grpcRequest(ctx context.Context, method, path string, in interface{}) (*http.Request, error) {
+	var body io.Reader = http.NoBody
+	if in != nil {
+		arrJSON, err := json.Marshal(in)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		body = bytes.NewReader(arrJSON)
+	}
+
+	r, err := http.NewRequestWithContext(ctx, method, path, body)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, h := range []string{constants.HeaderAuthorization, constants.HeaderDeviceName, constants.HeaderClientBuild,
+		"traceparent", "tracestate"} {
+		if v := md.Get(strings.ToLower(h)); len(v) > 0 {
+			r.Header.Set(h, v[0])
+		}
+	}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			r.TLS = &tlsInfo.State
+		}
+	}
+	return r, nil
+}
+
+// serve выполняет запрос хендлером HTTP API. Ответ в JSON раскладывается в out
+func (gs *grpcServer) serve(ctx context.Context, method, path string, in, out interface{}) (*grpcResponse, error) {
+	r, err := grpcRequest(ctx, method, path, in)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := newGRPCResponse()
+	gs.srv.Router.ServeHTTP(resp, r)
+	if err = resp.err(); err != nil {
+		return nil, err
+	}
+
+	if out != nil {
+		if err = json.Unmarshal(resp.body.Bytes(), out); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+	return resp, nil
+}
+
+// authorize проверка токена, сессии и, если включена проверка устройств, сертификата устройства
+// так же, как в HTTP API. Возвращает HTTP запрос вызова для хендлеров сервера
+func (gs *grpcServer) authorize(ctx context.Context) (*http.Request, error) {
+	r, err := grpcRequest(ctx, "GET", "/", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	authorized := false
+	resp := newGRPCResponse()
+	gs.srv.authorized(func(w http.ResponseWriter, r *http.Request) {
+		authorized = true
+	}).ServeHTTP(resp, r)
+
+	if !authorized {
+		if err = resp.err(); err != nil {
+			return nil, err
+		}
+		return nil, status.Error(codes.Unauthenticated, "unauthorized")
+	}
+	return r, nil
+}
+
+// auth вход или регистрация пользователя
+func (gs *grpcServer) auth(ctx context.Context, path string, in *grpcapi.Credentials) (*grpcapi.AuthReply, error) {
+	resp, err := gs.serve(ctx, "POST", path, model.User{Name: in.Login, Password: in.Password}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &grpcapi.AuthReply{Token: resp.header.Get(constants.HeaderAuthorization)}, nil
+}
+
+// Register регистрация пользователя
+func (gs *grpcServer) Register(ctx context.Context, in *grpcapi.Credentials) (*grpcapi.AuthReply, error) {
+	return gs.auth(ctx, "/api/user/register", in)
+}
+
+// Login вход пользователя
+func (gs *grpcServer) Login(ctx context.Context, in *grpcapi.Credentials) (*grpcapi.AuthReply, error) {
+	return gs.auth(ctx, "/api/user/login", in)
+}
+
+// ListRecords список записей пользователя по типу
+func (gs *grpcServer) ListRecords(ctx context.Context, in *grpcapi.ListRequest) (*grpcapi.ListReply, error) {
+	path, ok := grpcRecordTypes[in.Type]
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "unknown record type")
+	}
+
+	var arr []json.RawMessage
+	if _, err := gs.serve(ctx, "GET", "/api/resource/"+path, nil, &arr); err != nil {
+		return nil, err
+	}
+
+	reply := &grpcapi.ListReply{}
+	for _, v := range arr {
+		res, err := model.NewResource(resourceTypes[path])
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if err = json.Unmarshal(v, res); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		reply.Records = append(reply.Records, recordFromResource(res))
+	}
+	return reply, nil
+}
+
+// GetRecord запись пользователя по типу и УИДу
+func (gs *grpcServer) GetRecord(ctx context.Context, in *grpcapi.RecordRef) (*grpcapi.Record, error) {
+	path, ok := grpcRecordTypes[in.Type]
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "unknown record type")
+	}
+
+	res, err := model.NewResource(resourceTypes[path])
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	address, err := resourcePath(path, in.Uid)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = gs.serve(ctx, "GET", address, nil, res); err != nil {
+		return nil, err
+	}
+	return recordFromResource(res), nil
+}
+
+// PutRecord добавление/изменение записи пользователя
+func (gs *grpcServer) PutRecord(ctx context.Context, in *grpcapi.Record) (*grpcapi.PutReply, error) {
+	path, res := resourceFromRecord(in)
+	if res == nil {
+		return nil, status.Error(codes.InvalidArgument, "record data is empty")
+	}
+	if in.Uid == "" {
+		return nil, status.Error(codes.InvalidArgument, "record uid is empty")
+	}
+	address, err := resourcePath(path, in.Uid)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = gs.serve(ctx, "PUT", address, res, nil); err != nil {
+		return nil, err
+	}
+	return &grpcapi.PutReply{}, nil
+}
+
+// DeleteRecord удаление записи пользователя
+func (gs *grpcServer) DeleteRecord(ctx context.Context, in *grpcapi.RecordRef) (*grpcapi.DeleteReply, error) {
+	path, ok := grpcRecordTypes[in.Type]
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "unknown record type")
+	}
+
+	address, err := resourcePath(path, in.Uid)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = gs.serve(ctx, "DELETE", address, nil, nil); err != nil {
+		return nil, err
+	}
+	return &grpcapi.DeleteReply{}, nil
+}
+
+// Changes поток изменений данных пользователя. Данные проверяются каждые 0.5 секунды,
+// как в websocket /socket, и сразу по событию шины об их изменении на любом экземпляре сервера,
+// но отправляются только при изменении. Если сессия или устройство отозваны, то поток завершается
+func (gs *grpcServer) Changes(_ *grpcapi.ChangesRequest, stream grpcapi.Keeper_ChangesServer) error {
+	ctx := stream.Context()
+	ticker := time.NewTicker(time.Second / 2)
+	defer ticker.Stop()
+	events, unsubscribe := gs.srv.Bus.Subscribe()
+	defer unsubscribe()
+
+	var last []byte
+	for {
+		r, err := gs.authorize(ctx)
+		if err != nil {
+			return err
+		}
+
+		snapshot, err := gs.snapshot(r)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		msg, err := proto.MarshalOptions{Deterministic: true}.Marshal(snapshot)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		if !bytes.Equal(msg, last) {
+			if err = stream.Send(snapshot); err != nil {
+				return err
+			}
+			last = msg
+		}
+
+		user := tokenUser(r.Header.Get(constants.HeaderAuthorization))
+		for changed := false; !changed; {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-gs.srv.stopping():
+				return status.Error(codes.Unavailable, "server shutting down")
+			case <-ticker.C:
+				changed = true
+			case ev, ok := <-events:
+				if !ok {
+					events = nil
+					continue
+				}
+				gs.srv.dropCached(ev)
+				changed = changedFor(ev, user)
+			}
+		}
+	}
+}
+
+// snapshot все данные пользователя, упорядоченные по типу и УИДу
+func (gs *grpcServer) snapshot(r *http.Request) (*grpcapi.Snapshot, error) {
+	snapshot := &grpcapi.Snapshot{}
+	for _, path := range []string{"pairs", "text", "binary", "card"} {
+		records, err := gs.srv.userRecords(r, resourceTypes[path])
+		if err != nil {
+			return nil, err
+		}
+
+		arrUID := make([]string, 0, len(records))
+		for uid := range records {
+			arrUID = append(arrUID, uid)
+		}
+		sort.Strings(arrUID)
+		for _, uid := range arrUID {
+			snapshot.Records = append(snapshot.Records, recordFromResource(records[uid]))
+		}
+	}
+	return snapshot, nil
+}
+
+// UploadFile выгрузка содержимого бинарных данных. Порции пишутся в БД пачками, как в websocket /socket_file.
+// Файл должен принадлежать пользователю токена, порции проверяются как в websocket (см. checkPortion),
+// в одном потоке передается один файл
+func (gs *grpcServer) UploadFile(stream grpcapi.Keeper_UploadFileServer) error {
+	ctx := stream.Context()
+	r, err := gs.authorize(ctx)
+	if err != nil {
+		return err
+	}
+
+	uid := ""
+	var portions int64
+	files := map[string]*model.BinaryData{}
+	buf := &portionBuffer{srv: gs.srv}
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			if err = buf.flush(ctx); err != nil {
+				constants.Logger.ErrorLog(err)
+				return status.Error(codes.Internal, err.Error())
+			}
+			return stream.SendAndClose(&grpcapi.UploadReply{Uid: uid, Portions: portions})
+		}
+		if err != nil {
+			return err
+		}
+
+		if uid == "" {
+			uid = chunk.Uid
+		}
+		if chunk.Uid != uid {
+			return status.Error(codes.InvalidArgument, "one file per stream")
+		}
+
+		pbd := model.PortionBinaryData{Uid: uid, Portion: chunk.Offset, Body: string(chunk.Body)}
+		if err = gs.srv.checkPortion(r, files, pbd); err != nil {
+			return grpcError(err)
+		}
+		if err = buf.add(ctx, pbd); err != nil {
+			constants.Logger.ErrorLog(err)
+			return status.Error(codes.Internal, err.Error())
+		}
+		portions++
+	}
+}
+
+// DownloadFile загрузка содержимого бинарных данных. Файл отдается только владельцу,
+// каждое скачивание записывается в журнал аудита. Порции читаются из БД частями (см. DBConnector.ExportPortions)
+// и отправляются по мере чтения
+func (gs *grpcServer) DownloadFile(in *grpcapi.RecordRef, stream grpcapi.Keeper_DownloadFileServer) error {
+	ctx := stream.Context()
+	r, err := gs.authorize(ctx)
+	if err != nil {
+		return err
+	}
+
+	bd := model.BinaryData{
+		User: r.Header.Get(constants.HeaderAuthorization),
+		Uid:  in.Uid,
+	}
+	recordExists, err := gs.srv.DBConnector.Exists(ctx, &bd)
+	if err != nil || !recordExists {
+		gs.srv.audit(r, model.AuditRecord{Event: constants.AuditDownload, Type: bd.GetType(), Uid: bd.Uid, Success: false})
+		return status.Error(codes.NotFound, errs.ErrNotFound.Error())
+	}
+	gs.srv.audit(r, model.AuditRecord{Event: constants.AuditDownload, Type: bd.GetType(), Uid: bd.Uid, Success: true})
+
+	var errSend error
+	err = gs.srv.DBConnector.ExportPortions(ctx, bd.Uid, func(v model.PortionBinaryData) error {
+		errSend = stream.Send(&grpcapi.FileChunk{Uid: v.Uid, Offset: v.Portion, Body: []byte(v.Body)})
+		return errSend
+	})
+	if errSend != nil {
+		return errSend
+	}
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+		return status.Error(codes.Internal, err.Error())
+	}
+	return nil
+}
+
+// resourcePath адрес записи в REST API. УИД должен быть UUID: иначе "/" и ".." в УИДе изменили бы адрес
+// (mux ответит переадресацией), поэтому ошибка codes.InvalidArgument возвращается до запроса
+func resourcePath(path, uid string) (string, error) {
+	if _, err := uuid.Parse(uid); err != nil {
+		return "", status.Error(codes.InvalidArgument, "record uid must be a UUID")
+	}
+	return "/api/resource/" + path + "/" + uid, nil
+}
+
+// recordFromResource запись gRPC по записи хранилища
+func recordFromResource(res model.Resource) *grpcapi.Record {
+	switch v := res.(type) {
+	case *model.PairLoginPassword:
+		return &grpcapi.Record{Uid: v.Uid, Data: &grpcapi.Record_Pair{Pair: &grpcapi.Pair{
+			TypePair: v.TypePair, Name: v.Name, Password: v.Password}}}
+	case *model.TextData:
+		return &grpcapi.Record{Uid: v.Uid, Data: &grpcapi.Record_Text{Text: &grpcapi.Text{Text: v.Text}}}
+	case *model.BinaryData:
+		return &grpcapi.Record{Uid: v.Uid, Data: &grpcapi.Record_Binary{Binary: &grpcapi.Binary{
+			Name: v.Name, Expansion: v.Expansion, Size: v.Size, Patch: v.Patch}}}
+	case *model.BankCard:
+		return &grpcapi.Record{Uid: v.Uid, Data: &grpcapi.Record_Card{Card: &grpcapi.Card{
+			Number: v.Number, Cvc: v.Cvc}}}
+	}
+	return &grpcapi.Record{Uid: res.GetMainText()}
+}
+
+// resourceFromRecord тип записи в адресе REST API и запись хранилища по записи gRPC
+func resourceFromRecord(rec *grpcapi.Record) (string, model.Resource) {
+	switch v := rec.Data.(type) {
+	case *grpcapi.Record_Pair:
+		return "pairs", &model.PairLoginPassword{Uid: rec.Uid, TypePair: v.Pair.TypePair, Name: v.Pair.Name, Password: v.Pair.Password}
+	case *grpcapi.Record_Text:
+		return "text", &model.TextData{Uid: rec.Uid, Text: v.Text.Text}
+	case *grpcapi.Record_Binary:
+		return "binary", &model.BinaryData{Uid: rec.Uid, Name: v.Binary.Name, Expansion: v.Binary.Expansion,
+			Size: v.Binary.Size, Patch: v.Binary.Patch}
+	case *grpcapi.Record_Card:
+		return "card", &model.BankCard{Uid: rec.Uid, Number: v.Card.Number, Cvc: v.Card.Cvc}
+	}
+	return "", nil
+}
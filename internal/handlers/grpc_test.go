@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/grpcapi"
+	"gophkeeper/internal/postgresql/model"
+	"gophkeeper/internal/staging"
+)
+
+func TestGRPC(t *testing.T) {
+	s := &Server{}
+	s.InitRouters()
+
+	listen := bufconn.Listen(1024 * 1024)
+	gs := grpc.NewServer()
+	grpcapi.RegisterKeeperServer(gs, &grpcServer{srv: s})
+	go func() { _ = gs.Serve(listen) }()
+	defer gs.Stop()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listen.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := grpcapi.NewKeeperClient(conn)
+
+	tokenString := sessionToken(t, s, "user")
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", tokenString)
+
+	rec := &grpcapi.Record{Uid: "0f8fad5b-d9cb-469f-a165-70867728950e", Data: &grpcapi.Record_Text{Text: &grpcapi.Text{Text: "text"}}}
+
+	t.Run("Checking authorization", func(t *testing.T) {
+		_, err := client.PutRecord(context.Background(), rec)
+		if status.Code(err) != codes.Unauthenticated {
+			t.Errorf("Expected Unauthenticated, got %v", err)
+		}
+	})
+
+	t.Run("Checking put record", func(t *testing.T) {
+		if _, err := client.PutRecord(ctx, rec); err != nil {
+			t.Fatal(err)
+		}
+
+		item, _ := s.Staging.Get("user", staging.Key{Type: constants.TypeTextData.String(), Uid: "0f8fad5b-d9cb-469f-a165-70867728950e"})
+		td, ok := item.Record.(*model.TextData)
+		if !ok || td.Text != "text" || td.User != tokenString {
+			t.Errorf("Record is not staged: %+v", item)
+		}
+	})
+
+	t.Run("Checking empty record", func(t *testing.T) {
+		_, err := client.PutRecord(ctx, &grpcapi.Record{Uid: "0f8fad5b-d9cb-469f-a165-70867728950e"})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument, got %v", err)
+		}
+	})
+
+	t.Run("Checking invalid uid", func(t *testing.T) {
+		for _, uid := range []string{"../pairs", "a/b", "1"} {
+			_, err := client.GetRecord(ctx, &grpcapi.RecordRef{Type: grpcapi.RecordType_TEXT, Uid: uid})
+			if status.Code(err) != codes.InvalidArgument {
+				t.Errorf("%s: expected InvalidArgument, got %v", uid, err)
+			}
+			_, err = client.DeleteRecord(ctx, &grpcapi.RecordRef{Type: grpcapi.RecordType_TEXT, Uid: uid})
+			if status.Code(err) != codes.InvalidArgument {
+				t.Errorf("%s: expected InvalidArgument, got %v", uid, err)
+			}
+		}
+	})
+
+	t.Run("Checking record conversion", func(t *testing.T) {
+		records := []*grpcapi.Record{
+			{Uid: "1", Data: &grpcapi.Record_Pair{Pair: &grpcapi.Pair{TypePair: "t", Name: "n", Password: "p"}}},
+			{Uid: "2", Data: &grpcapi.Record_Text{Text: &grpcapi.Text{Text: "text"}}},
+			{Uid: "3", Data: &grpcapi.Record_Binary{Binary: &grpcapi.Binary{Name: "n", Expansion: "e", Size: "1", Patch: "p"}}},
+			{Uid: "4", Data: &grpcapi.Record_Card{Card: &grpcapi.Card{Number: "4111", Cvc: "123"}}},
+		}
+		for _, v := range records {
+			_, res := resourceFromRecord(v)
+			if got := recordFromResource(res); !proto.Equal(got, v) {
+				t.Errorf("Expected %v, got %v", v, got)
+			}
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/metrics"
+)
+
+// readyTimeout время ожидания ответа БД при проверке готовности
+const readyTimeout = 2 * time.Second
+
+// Health ответ проверки готовности сервера. Checks результаты проверок: ok или текст ошибки
+type Health struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// stagingDesc описание метрики глубины хранилища сервера
+var stagingDesc = prometheus.NewDesc("gophkeeper_staging_records",
+	"Records waiting in the staging buffer to be saved to the database, by type.", []string{"type"}, nil)
+
+// deadDesc описание метрики количества неисправных записей хранилища сервера
+var deadDesc = prometheus.NewDesc("gophkeeper_dead_items",
+	"Staged records that failed to flush to the database too many times.", nil, nil)
+
+// stagingCollector сборщик метрик глубины хранилища сервера и количества неисправных записей.
+// Значения читаются при каждом запросе метрик
+type stagingCollector struct {
+	srv *Server
+}
+
+// Describe описание метрик сборщика
+func (sc stagingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- stagingDesc
+	ch <- deadDesc
+}
+
+// Collect количество записей хранилища по типам (типы без записей отдаются с нулем) и количество неисправных записей
+func (sc stagingCollector) Collect(ch chan<- prometheus.Metric) {
+	depth := map[string]int{}
+	for _, t := range []string{constants.TypePairLoginPassword.String(), constants.TypeTextData.String(),
+		constants.TypeBinaryData.String(), constants.TypeBankCardData.String()} {
+		depth[t] = 0
+	}
+
+	for t, n := range sc.srv.Staging.LenByType() {
+		depth[t] = n
+	}
+	dead := sc.srv.dead.Len()
+
+	for t, n := range depth {
+		ch <- prometheus.MustNewConstMetric(stagingDesc, prometheus.GaugeValue, float64(n), t)
+	}
+	ch <- prometheus.MustNewConstMetric(deadDesc, prometheus.GaugeValue, float64(dead))
+}
+
+// InitMetrics инициализация метрик сервера
+func (srv *Server) InitMetrics() {
+	srv.Metrics = metrics.New()
+	srv.Metrics.Registry.MustRegister(stagingCollector{srv: srv}, cacheCollector{srv: srv})
+}
+
+// apiHealthzGET хендлер проверки жизни процесса сервера. Зависимости не проверяются
+func (srv *Server) apiHealthzGET(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, Health{Status: "ok"})
+}
+
+// apiReadyzGET хендлер проверки готовности сервера принимать запросы:
+// доступность пула соединений с БД и работа горутины сохранения хранилища сервера в БД
+func (srv *Server) apiReadyzGET(w http.ResponseWriter, r *http.Request) {
+	h := Health{Status: "ok", Checks: map[string]string{"database": "ok", "flusher": "ok"}}
+
+	if srv.DBConnector == nil || srv.Pool == nil {
+		h.Checks["database"] = "not connected"
+	} else {
+		ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+		if err := srv.Pool.Ping(ctx); err != nil {
+			h.Checks["database"] = err.Error()
+		}
+		cancel()
+	}
+
+	if last := srv.lastFlush.Load(); last == 0 {
+		h.Checks["flusher"] = "not started"
+	} else if since := time.Since(time.Unix(0, last)); since > srv.flushStale() {
+		h.Checks["flusher"] = "last flush " + since.Truncate(time.Second).String() + " ago"
+	}
+
+	for _, v := range h.Checks {
+		if v != "ok" {
+			h.Status = "unavailable"
+		}
+	}
+	status := http.StatusOK
+	if h.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSONStatus(w, status, h)
+}
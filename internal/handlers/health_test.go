@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/constants/errs"
+	"gophkeeper/internal/logger"
+	"gophkeeper/internal/postgresql/model"
+	"gophkeeper/internal/staging"
+	"gophkeeper/internal/token"
+	"gophkeeper/internal/tracing"
+)
+
+func TestHealth(t *testing.T) {
+	s := &Server{}
+	s.InitRouters()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	t.Run("Checking healthz", func(t *testing.T) {
+		if w := get("/healthz"); w.Code != http.StatusOK {
+			t.Errorf("Expected %d, got %d", http.StatusOK, w.Code)
+		}
+	})
+
+	t.Run("Checking readyz", func(t *testing.T) {
+		s.lastFlush.Store(time.Now().UnixNano())
+		w := get("/readyz")
+		if w.Code != http.StatusServiceUnavailable {
+			t.Fatalf("Expected %d, got %d", http.StatusServiceUnavailable, w.Code)
+		}
+		h := Health{}
+		if err := json.Unmarshal(w.Body.Bytes(), &h); err != nil {
+			t.Fatal(err)
+		}
+		if h.Checks["database"] == "ok" || h.Checks["flusher"] != "ok" {
+			t.Errorf("Unexpected checks %+v", h.Checks)
+		}
+	})
+
+	t.Run("Checking metrics", func(t *testing.T) {
+		item := staging.Item{Key: staging.Key{Type: constants.TypeTextData.String(), Uid: "1"}, Record: &model.TextData{Uid: "1"}}
+		if err := s.Staging.Put(item); err != nil {
+			t.Fatal(err)
+		}
+		get("/healthz")
+
+		w := get("/metrics")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected %d, got %d", http.StatusOK, w.Code)
+		}
+		body := w.Body.String()
+		for _, v := range []string{
+			`gophkeeper_staging_records{type="` + constants.TypeTextData.String() + `"} 1`,
+			`gophkeeper_http_request_duration_seconds_count{code="200",method="GET",route="/healthz"}`,
+			`gophkeeper_staging_flush_errors_total 0`,
+			`gophkeeper_cache_hits_total 0`,
+		} {
+			if !strings.Contains(body, v) {
+				t.Errorf("Metric %s not found", v)
+			}
+		}
+	})
+
+	t.Run("Checking access log", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		defaultLogger := constants.Logger
+		constants.Logger = logger.Logger{Log: zerolog.New(logger.RedactWriter(buf))}
+		defer func() { constants.Logger = defaultLogger }()
+
+		tokenString, err := token.NewClaims("user").GenerateJWT()
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest("GET", "/healthz", nil)
+		req.Header.Set(constants.HeaderAuthorization, tokenString)
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, req)
+
+		line := buf.String()
+		for _, v := range []string{`"route":"/healthz"`, `"status":200`, `"user":"user"`,
+			`"request_id":"` + w.Header().Get(errs.HeaderRequestID) + `"`} {
+			if !strings.Contains(line, v) {
+				t.Errorf("%s not found in %s", v, line)
+			}
+		}
+		if strings.Contains(line, tokenString) {
+			t.Errorf("Token in access log: %s", line)
+		}
+	})
+
+	t.Run("Checking trace id in errors", func(t *testing.T) {
+		if _, err := tracing.Init(tracing.Config{}); err != nil {
+			t.Fatal(err)
+		}
+		traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+		req := httptest.NewRequest("GET", "/api/resource/text", nil)
+		req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected %d, got %d", http.StatusUnauthorized, w.Code)
+		}
+		e := errs.ErrorResponse{}
+		if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.TraceID != traceID || w.Header().Get(errs.HeaderTraceID) != traceID {
+			t.Errorf("Expected trace id %s, got %q", traceID, e.TraceID)
+		}
+	})
+}
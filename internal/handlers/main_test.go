@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"gophkeeper/internal/tests"
+	"gophkeeper/internal/token"
+)
+
+func TestMain(m *testing.M) {
+	tests.InitTokenKey()
+	os.Exit(m.Run())
+}
+
+// sessionToken токен пользователя user с новой сессией, зарегистрированной на сервере s
+func sessionToken(t *testing.T, s *Server, user string) string {
+	t.Helper()
+
+	tc := token.NewClaims(user)
+	tc.Session = uuid.NewString()
+	tokenString, err := tc.GenerateJWT()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Sessions.Add(tc.Session, user, time.Unix(tc.Exp, 0))
+	return tokenString
+}
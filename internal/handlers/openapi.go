@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	_ "embed"
+	"net/http"
+
+	"gophkeeper/internal/constants"
+)
+
+// openAPI описание API сервера в формате OpenAPI. Описывает все маршруты InitRouters
+//
+//go:embed openapi.json
+var openAPI []byte
+
+// apiOpenAPIGET хендлер описания API в формате OpenAPI
+func (srv *Server) apiOpenAPIGET(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(openAPI); err != nil {
+		constants.Logger.Ctx(r.Context()).ErrorLog(err)
+	}
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestOpenAPI(t *testing.T) {
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPI, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{}
+	s.InitRouters()
+
+	t.Run("Checking all routes are described", func(t *testing.T) {
+		err := s.Router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+			path, err := route.GetPathTemplate()
+			if err != nil {
+				return nil
+			}
+			methods, err := route.GetMethods()
+			if err != nil {
+				methods = []string{"GET"}
+			}
+
+			for _, m := range methods {
+				if _, ok := doc.Paths[path][strings.ToLower(m)]; !ok {
+					t.Errorf("Route %s %s is not described in openapi.json", m, path)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/constants/errs"
+	"gophkeeper/internal/environment"
+	"gophkeeper/internal/postgresql/model"
+	"gophkeeper/internal/token"
+)
+
+// Квоты пользователя, которые передаются в QuotaError
+const (
+	quotaBytes    = "bytes"
+	quotaRecords  = "records"
+	quotaFileSize = "file_size"
+)
+
+// quota квоты пользователя из конфигурации сервера. Без конфигурации квот нет
+func (srv *Server) quota() environment.QuotaConfig {
+	return srv.live().Quota
+}
+
+// quotaEnabled признак, что для записей типа t нужно проверять квоты по записям пользователя
+func quotaEnabled(q environment.QuotaConfig, t string) bool {
+	return q.Records > 0 || (q.Bytes > 0 && t == constants.TypeBinaryData.String())
+}
+
+// checkQuota проверяет, что добавление или изменение записи res не превысит квоты пользователя.
+// records записи пользователя того же типа с учетом хранилища сервера (см. userRecords), могут быть nil,
+// если квоты по записям не проверяются. stored объем порций файлов, сохраненных в БД (см. filesStored).
+// Удаление записи квоты не проверяет, файл без размера отклоняется
+func checkQuota(q environment.QuotaConfig, records map[string]model.Resource, stored map[string]int64,
+	res model.Resource) error {
+	if res.GetEvent() == constants.EventDel.String() {
+		return nil
+	}
+
+	uid := res.GetMainText()
+	_, exists := records[uid]
+	if q.Records > 0 && !exists && len(records) >= q.Records {
+		return &errs.QuotaError{Quota: quotaRecords, Limit: int64(q.Records), Used: int64(len(records)), Requested: 1}
+	}
+
+	bd, ok := res.(*model.BinaryData)
+	if !ok {
+		return nil
+	}
+	size, ok := bd.FileSize()
+	if !ok {
+		return fmt.Errorf("%w: unknown size of file %s", errs.InvalidFormat, uid)
+	}
+	if q.FileSize > 0 && size > q.FileSize {
+		return &errs.QuotaError{Quota: quotaFileSize, Limit: q.FileSize, Used: 0, Requested: size}
+	}
+	if q.Bytes > 0 {
+		used := filesSize(records, stored)
+		if old, ok := records[uid].(*model.BinaryData); ok {
+			used -= fileUsage(old, stored[uid])
+		}
+		if used+size > q.Bytes {
+			return &errs.QuotaError{Quota: quotaBytes, Limit: q.Bytes, Used: used, Requested: size}
+		}
+	}
+	return nil
+}
+
+// filesSize общий объем файлов среди записей. stored объем порций файлов, сохраненных в БД, может быть nil
+func filesSize(records map[string]model.Resource, stored map[string]int64) int64 {
+	var total int64
+	for uid, v := range records {
+		if bd, ok := v.(*model.BinaryData); ok {
+			total += fileUsage(bd, stored[uid])
+		}
+	}
+	return total
+}
+
+// fileUsage объем файла для квоты: больший из размера файла и объема его порций stored, сохраненных в БД.
+// Размер резервирует место под файл, который еще загружается, сохраненные порции учитывают файлы без размера
+func fileUsage(bd *model.BinaryData, stored int64) int64 {
+	size, _ := bd.FileSize()
+	if stored > size {
+		return stored
+	}
+	return size
+}
+
+// filesStored объем порций файлов пользователя запроса r, сохраненных в БД, по УИДам файлов. Без БД nil
+func (srv *Server) filesStored(r *http.Request) (map[string]int64, error) {
+	if srv.DBConnector == nil {
+		return nil, nil
+	}
+	claims, ok := token.ExtractClaims(r.Header.Get(constants.HeaderAuthorization))
+	if !ok {
+		return nil, errs.ErrInvalidLoginPassword
+	}
+	ctx := context.WithValue(r.Context(), model.KeyContext("user"), claims["user"].(string))
+	return srv.DBConnector.SelectFilesStored(ctx)
+}
+
+// checkResourceQuota проверяет квоты пользователя перед помещением записи res типа t в хранилище сервера
+func (srv *Server) checkResourceQuota(r *http.Request, t string, res model.Resource) error {
+	q := srv.quota()
+	var records map[string]model.Resource
+	var stored map[string]int64
+	if quotaEnabled(q, t) && res.GetEvent() != constants.EventDel.String() {
+		var err error
+		if records, err = srv.userRecords(r, t); err != nil {
+			return err
+		}
+		if q.Bytes > 0 && t == constants.TypeBinaryData.String() {
+			if stored, err = srv.filesStored(r); err != nil {
+				return err
+			}
+		}
+	}
+	return checkQuota(q, records, stored, res)
+}
+
+// apiUserQuotaGET хендлер квот текущего пользователя и их использования
+func (srv *Server) apiUserQuotaGET(w http.ResponseWriter, r *http.Request) {
+	q := srv.quota()
+	usage := model.QuotaUsage{
+		Records: map[string]int{},
+		Limits:  model.QuotaLimits{Bytes: q.Bytes, Records: q.Records, FileSize: q.FileSize},
+	}
+	stored, err := srv.filesStored(r)
+	if err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+	for name, t := range resourceTypes {
+		records, err := srv.userRecords(r, t)
+		if err != nil {
+			errs.WriteError(w, err)
+			return
+		}
+		usage.Records[name] = len(records)
+		usage.Bytes += filesSize(records, stored)
+	}
+	writeJSON(w, usage)
+}
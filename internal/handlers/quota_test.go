@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/constants/errs"
+	"gophkeeper/internal/environment"
+	"gophkeeper/internal/postgresql/model"
+)
+
+func TestCheckQuota(t *testing.T) {
+	file := func(uid, size string) *model.BinaryData {
+		return &model.BinaryData{Uid: uid, Size: size, Event: constants.EventAddEdit.String()}
+	}
+	records := map[string]model.Resource{"1": file("1", "60"), "2": file("2", "30")}
+	q := environment.QuotaConfig{Bytes: 100, Records: 2, FileSize: 50}
+
+	tests := []struct {
+		name  string
+		res   model.Resource
+		quota string
+	}{
+		{name: "Edit within quota", res: file("2", "40")},
+		{name: "Too many records", res: file("3", "1"), quota: quotaRecords},
+		{name: "File too large", res: file("2", "51"), quota: quotaFileSize},
+		{name: "Delete", res: &model.BinaryData{Uid: "3", Event: constants.EventDel.String()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkQuota(q, records, nil, tt.res)
+			if tt.quota == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error %v", err)
+				}
+				return
+			}
+			qe := &errs.QuotaError{}
+			if !errors.As(err, &qe) || qe.Quota != tt.quota || !errors.Is(err, errs.ErrQuotaExceeded) {
+				t.Fatalf("Expected %s quota error, got %v", tt.quota, err)
+			}
+		})
+	}
+
+	t.Run("Bytes", func(t *testing.T) {
+		q := environment.QuotaConfig{Bytes: 100}
+		if err := checkQuota(q, records, nil, file("3", "11")); err == nil {
+			t.Fatal("Expected bytes quota error")
+		}
+		// замена файла учитывает освободившийся объем старой версии
+		if err := checkQuota(q, records, nil, file("1", "70")); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Stored portions", func(t *testing.T) {
+		q := environment.QuotaConfig{Bytes: 100}
+		// сохраненные порции файла 2 больше его размера: занято 60 + 45 байт
+		stored := map[string]int64{"2": 45}
+		if err := checkQuota(q, records, stored, file("3", "1")); err == nil {
+			t.Fatal("Expected bytes quota error")
+		}
+		if err := checkQuota(q, records, stored, file("1", "55")); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Unknown size", func(t *testing.T) {
+		// файл без размера обошел бы ограничения размера файла и объема
+		for _, size := range []string{"", "0", "big"} {
+			if err := checkQuota(q, records, nil, file("2", size)); !errors.Is(err, errs.InvalidFormat) {
+				t.Errorf("%q: expected invalid format, got %v", size, err)
+			}
+		}
+	})
+
+	t.Run("Other types", func(t *testing.T) {
+		q := environment.QuotaConfig{Bytes: 1, FileSize: 1}
+		res := &model.TextData{Uid: "1", Event: constants.EventAddEdit.String()}
+		if err := checkQuota(q, nil, nil, res); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
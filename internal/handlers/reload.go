@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+	"time"
+
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/environment"
+	"gophkeeper/internal/limiter"
+	"gophkeeper/internal/logger"
+)
+
+// minFlushStale минимальное время после последнего сохранения хранилища, после которого сервер считается не готовым
+const minFlushStale = 5 * time.Second
+
+// liveConfig часть конфигурации сервера, которая меняется без перезапуска (по SIGHUP)
+type liveConfig struct {
+	Quota         environment.QuotaConfig
+	FlushInterval time.Duration
+}
+
+// live текущая изменяемая часть конфигурации. Без перезагрузки берется из конфигурации сервера
+func (srv *Server) live() liveConfig {
+	if lc := srv.liveCfg.Load(); lc != nil {
+		return *lc
+	}
+	if srv.ServerConfig == nil {
+		return liveConfig{FlushInterval: time.Second / 2}
+	}
+	return liveConfig{Quota: srv.Quota, FlushInterval: srv.Flush.Interval}
+}
+
+// flushInterval период сохранения хранилища сервера в БД
+func (srv *Server) flushInterval() time.Duration {
+	if d := srv.live().FlushInterval; d > 0 {
+		return d
+	}
+	return time.Second / 2
+}
+
+// flushStale через сколько после последнего сохранения хранилища сервер считается не готовым:
+// несколько периодов сохранения, но не меньше minFlushStale
+func (srv *Server) flushStale() time.Duration {
+	if d := 4 * srv.flushInterval(); d > minFlushStale {
+		return d
+	}
+	return minFlushStale
+}
+
+// limiterConfig параметры ограничителя попыток по конфигурации сервера
+func limiterConfig(rl environment.RateLimitConfig) limiter.Config {
+	return limiter.Config{
+		MaxAttempts: rl.Attempts,
+		Window:      rl.Window,
+		Lockout:     rl.Lockout,
+		MaxLockout:  rl.MaxLockout,
+	}
+}
+
+// ReloadConfig горутина перезагрузки конфигурации по сигналу SIGHUP
+func (srv *Server) ReloadConfig(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-hup:
+			if err := srv.Reload(); err != nil {
+				constants.Logger.ErrorLog(err)
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Reload повторное чтение конфигурации и применение изменений, безопасных без перезапуска:
+// уровень лога, ограничение попыток входа, квоты и период сохранения хранилища.
+// Если новая конфигурация не проходит проверку, то остается текущая.
+// Об изменениях, которые требуют перезапуска, пишется предупреждение
+func (srv *Server) Reload() error {
+	cfg, err := srv.ServerConfig.Reload()
+	if err != nil {
+		return err
+	}
+
+	if err = logger.SetLevel(cfg.Log.Level); err != nil {
+		return err
+	}
+	srv.Limiter.SetConfig(limiterConfig(cfg.RateLimit))
+	srv.liveCfg.Store(&liveConfig{Quota: cfg.Quota, FlushInterval: cfg.Flush.Interval})
+
+	if fields := restartFields(srv.ServerConfig, cfg); len(fields) > 0 {
+		constants.Logger.Log.Warn().Msg("config reloaded, restart required to apply: " + strings.Join(fields, ", "))
+		return nil
+	}
+	constants.Logger.InfoLog("config reloaded")
+	return nil
+}
+
+// restartFields разделы конфигурации, изменения которых применяются только после перезапуска
+func restartFields(old, cfg *environment.ServerConfig) []string {
+	var fields []string
+	check := func(name string, a, b interface{}) {
+		if !reflect.DeepEqual(a, b) {
+			fields = append(fields, name)
+		}
+	}
+
+	check("address", old.Address, cfg.Address)
+	check("token_key", old.TokenKey, cfg.TokenKey)
+	check("grpc_address", old.GRPCAddress, cfg.GRPCAddress)
+	check("shutdown_timeout", old.ShutdownTimeout, cfg.ShutdownTimeout)
+	check("database", old.DBConfig, cfg.DBConfig)
+	check("flush.shards", old.Flush.Shards, cfg.Flush.Shards)
+	check("flush.capacity", old.Flush.Capacity, cfg.Flush.Capacity)
+	check("audit", old.Audit, cfg.Audit)
+	check("tls", old.TLS, cfg.TLS)
+	check("log.format", old.Log.Format, cfg.Log.Format)
+	check("log.file", old.Log.File, cfg.Log.File)
+	check("trace", old.Trace, cfg.Trace)
+	check("cluster", old.Cluster, cfg.Cluster)
+	check("cache", old.Cache, cfg.Cache)
+	return fields
+}
@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/constants/errs"
+	"gophkeeper/internal/postgresql/model"
+	"gophkeeper/internal/staging"
+	"gophkeeper/internal/token"
+	"gophkeeper/internal/tracing"
+)
+
+// resourceTypes соответствие типа записи в адресе запроса типу хранимой информации
+var resourceTypes = map[string]string{
+	"pairs":  constants.TypePairLoginPassword.String(),
+	"text":   constants.TypeTextData.String(),
+	"binary": constants.TypeBinaryData.String(),
+	"card":   constants.TypeBankCardData.String(),
+}
+
+// resourceType тип хранимой информации из адреса запроса
+func resourceType(r *http.Request) (string, error) {
+	t, ok := resourceTypes[mux.Vars(r)["type"]]
+	if !ok {
+		return "", errs.ErrNotFound
+	}
+	return t, nil
+}
+
+// cloneResource копия записи с владельцем name. Используется, что бы не отдавать токен
+// и не менять записи, ожидающие сохранения в хранилище сервера
+func cloneResource(t string, u model.Updater, name string) (model.Resource, error) {
+	res, err := model.NewResource(t)
+	if err != nil {
+		return nil, err
+	}
+	arrJSON, err := json.Marshal(u)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(arrJSON, res); err != nil {
+		return nil, err
+	}
+	res.SetIdentity(name, res.GetMainText(), "")
+	return res, nil
+}
+
+// userRecords записи пользователя из БД (через кеш записей) с учетом изменений, которые еще не перенесены
+// из хранилища сервера. Хранилище читается до БД: если запись будет сохранена между чтениями, то она есть
+// в обоих источниках (кеш обновляется до подтверждения записи в хранилище)
+func (srv *Server) userRecords(r *http.Request, t string) (map[string]model.Resource, error) {
+	tkn := r.Header.Get(constants.HeaderAuthorization)
+	claims, ok := token.ExtractClaims(tkn)
+	if !ok {
+		return nil, errs.ErrInvalidLoginPassword
+	}
+	name := claims["user"].(string)
+
+	staged := map[string]model.Resource{}
+	for _, item := range srv.Staging.User(name, t) {
+		if res, ok := item.Record.(model.Resource); ok {
+			staged[item.Uid] = res
+		}
+	}
+
+	arr, err := srv.selectRecords(r.Context(), tkn, t)
+	if err != nil {
+		return nil, err
+	}
+
+	records := map[string]model.Resource{}
+	for uid, v := range arr {
+		res, err := cloneResource(t, v, name)
+		if err != nil {
+			return nil, err
+		}
+		records[uid] = res
+	}
+	for uid, v := range staged {
+		if v.GetEvent() == constants.EventDel.String() {
+			delete(records, uid)
+			continue
+		}
+		res, err := cloneResource(t, v, name)
+		if err != nil {
+			return nil, err
+		}
+		records[uid] = res
+	}
+
+	return records, nil
+}
+
+// stageResource кладет запись в хранилище сервера для сохранения в БД.
+// Span помещения записи запоминается, что бы сохранение записи в БД было связано с трассировкой запроса.
+// Если хранилище заполнено, то возвращает ErrUnavailable: клиент повторяет запрос позже.
+// Если с БД работают несколько экземпляров сервера, то записи пользователя сохраняются в БД до ответа на запрос,
+// что бы следующий запрос клиента видел их на любом экземпляре. Если сохранить не удалось, то запись остается
+// в хранилище до следующего сохранения
+func (srv *Server) stageResource(r *http.Request, t string, res model.Resource) error {
+	_, span := tracing.Tracer().Start(r.Context(), "staging.stage", tracing.Record(t, res.GetMainText()))
+	defer span.End()
+
+	err := srv.Staging.Put(staging.Item{
+		Key:    staging.Key{User: userName(res), Type: t, Uid: res.GetMainText()},
+		Record: res,
+		Span:   span.SpanContext(),
+		Audit:  []model.AuditRecord{recordAudit(r, res)},
+	})
+	if err != nil {
+		tracing.SetError(span, err)
+		return fmt.Errorf("%w: %s", errs.ErrUnavailable, err.Error())
+	}
+	if srv.clustered() {
+		srv.Staging.FlushUser(r.Context(), userName(res), srv.saveStaged, srv.flushFailed)
+	}
+	return nil
+}
+
+// writeStageError ответ на запрос, запись которого не принята хранилищем сервера.
+// Retry-After подсказывает клиенту повторить запрос после следующего сохранения хранилища в БД
+func (srv *Server) writeStageError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errs.ErrUnavailable) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(srv.flushInterval().Seconds()))))
+	}
+	errs.WriteError(w, err)
+}
+
+// writeJSON отправка ответа в формате JSON
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	writeJSONStatus(w, http.StatusOK, v)
+}
+
+// writeJSONStatus отправка ответа в формате JSON с HTTP статусом status
+func writeJSONStatus(w http.ResponseWriter, status int, v interface{}) {
+	msg, err := json.MarshalIndent(v, "", " ")
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+		errs.WriteError(w, errs.ErrErrorServer)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err = w.Write(msg); err != nil {
+		constants.Logger.ErrorLog(err)
+	}
+}
+
+// apiResourceListGET хендлер списка записей пользователя по типу: pairs, text, binary, card.
+// Данные отдаются в том виде, в котором их зашифровал клиент
+func (srv *Server) apiResourceListGET(w http.ResponseWriter, r *http.Request) {
+
+	t, err := resourceType(r)
+	if err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+
+	records, err := srv.userRecords(r, t)
+	if err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+
+	arrUID := make([]string, 0, len(records))
+	for uid := range records {
+		arrUID = append(arrUID, uid)
+	}
+	sort.Strings(arrUID)
+
+	arrRecord := make([]model.Resource, 0, len(records))
+	for _, uid := range arrUID {
+		arrRecord = append(arrRecord, records[uid])
+	}
+
+	writeJSON(w, arrRecord)
+}
+
+// apiResourceGET хендлер записи пользователя по типу и УИДу
+func (srv *Server) apiResourceGET(w http.ResponseWriter, r *http.Request) {
+
+	t, err := resourceType(r)
+	if err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+
+	records, err := srv.userRecords(r, t)
+	if err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+
+	res, ok := records[mux.Vars(r)["uid"]]
+	if !ok {
+		errs.WriteError(w, errs.ErrNotFound)
+		return
+	}
+
+	writeJSON(w, res)
+}
+
+// apiResourcePUT хендлер добавления/изменения записи пользователя по типу и УИДу.
+// УИД берется из адреса, событие из метода запроса, поле event тела запроса не используется
+func (srv *Server) apiResourcePUT(w http.ResponseWriter, r *http.Request) {
+
+	t, err := resourceType(r)
+	if err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+
+	res, err := model.NewResource(t)
+	if err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+	if err = json.Unmarshal(body, res); err != nil {
+		errs.WriteError(w, errs.Invalid(err))
+		return
+	}
+	res.SetIdentity(r.Header.Get(constants.HeaderAuthorization), mux.Vars(r)["uid"], constants.EventAddEdit.String())
+	if err = res.Validate(); err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+	if err = srv.checkResourceQuota(r, t, res); err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+
+	if err = srv.stageResource(r, t, res); err != nil {
+		srv.writeStageError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// apiResourceDELETE хендлер удаления записи пользователя по типу и УИДу
+func (srv *Server) apiResourceDELETE(w http.ResponseWriter, r *http.Request) {
+
+	t, err := resourceType(r)
+	if err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+
+	uid := mux.Vars(r)["uid"]
+	records, err := srv.userRecords(r, t)
+	if err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+	if _, ok := records[uid]; !ok {
+		errs.WriteError(w, errs.ErrNotFound)
+		return
+	}
+
+	res, err := model.NewResource(t)
+	if err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+	res.SetIdentity(r.Header.Get(constants.HeaderAuthorization), uid, constants.EventDel.String())
+
+	if err = srv.stageResource(r, t, res); err != nil {
+		srv.writeStageError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
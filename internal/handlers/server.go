@@ -2,21 +2,39 @@ package handlers
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"errors"
+	"gophkeeper/internal/bus"
+	"gophkeeper/internal/cache"
+	"gophkeeper/internal/compression"
 	"gophkeeper/internal/constants"
 	"gophkeeper/internal/environment"
+	"gophkeeper/internal/limiter"
+	"gophkeeper/internal/logger"
+	"gophkeeper/internal/metrics"
 	"gophkeeper/internal/midware"
 	"gophkeeper/internal/postgresql"
 	"gophkeeper/internal/postgresql/model"
+	"gophkeeper/internal/staging"
+	"gophkeeper/internal/tlsutil"
+	"gophkeeper/internal/token"
+	"gophkeeper/internal/tracing"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
 )
 
 // Server общая структура. Хранит все необходимые данные сервера.
@@ -24,35 +42,88 @@ type Server struct {
 	*mux.Router
 	*postgresql.DBConnector
 	*environment.ServerConfig
-
-	sync.Mutex
-	InListUserData map[string]model.Appender
+	Limiter  *limiter.Limiter
+	Sessions *Sessions
+	AuditKey ed25519.PrivateKey
+
+	TLSConfig *tls.Config
+	DeviceCA  *tlsutil.CA
+	Devices   *Devices
+
+	GRPC    *grpc.Server
+	Metrics *metrics.Metrics
+
+	lastFlush     atomic.Int64
+	liveCfg       atomic.Pointer[liveConfig]
+	logCloser     io.Closer
+	traceShutdown tracing.ShutdownFunc
+
+	httpServer    *http.Server
+	wsConns       wsConns
+	stop          chan struct{}
+	cancelWorkers context.CancelFunc
+	workers       sync.WaitGroup
+
+	Staging *staging.Buffer
+	dead    deadList
+	audits  auditQueue
+	Cache   *cache.Cache
+
+	Bus      bus.Bus
+	instance string
 }
 
-// NewServer создание сервера
-func NewServer() *Server {
+// NewServer создание сервера по ключам запуска args
+func NewServer(args []string) *Server {
 	srv := &Server{}
 
-	srv.InitConfig()
+	srv.InitConfig(args)
+	srv.InitLogger()
+	srv.InitTracing()
 	srv.InitDataBase()
+	srv.InitLimiter()
+	srv.InitSessions()
+	srv.InitAudit()
+	srv.InitTLS()
+	srv.InitDevices()
+	srv.InitStaging()
+	srv.InitCache()
+	srv.InitBus()
+	srv.InitMetrics()
 	srv.InitRouters()
-
-	srv.InListUserData = map[string]model.Appender{}
+	srv.InitGRPC()
 
 	return srv
 }
 
-// Run Запуск сервера
+// Run Запуск сервера. Фоновые горутины работают до остановки сервера по сигналу (см. Shutdown)
 func (srv *Server) Run() {
-	ctx := context.Background()
-	go srv.SaveDataInDB(ctx)
+	ctx, cancel := context.WithCancel(context.Background())
+	srv.cancelWorkers = cancel
+	srv.stop = make(chan struct{})
+
+	for _, worker := range []func(context.Context){srv.SaveDataInDB, srv.ReloadConfig, srv.CleanLimiter,
+		srv.WriteAudit, srv.CheckpointAudit, srv.Coordinate} {
+		srv.workers.Add(1)
+		go func(worker func(context.Context)) {
+			defer srv.workers.Done()
+			worker(ctx)
+		}(worker)
+	}
+	go srv.RunGRPC()
 
+	srv.httpServer = &http.Server{
+		Addr:      srv.Address,
+		Handler:   srv.Router,
+		TLSConfig: srv.TLSConfig}
 	go func() {
-		s := &http.Server{
-			Addr:    srv.Address,
-			Handler: srv.Router}
-
-		if err := s.ListenAndServe(); err != nil {
+		var err error
+		if srv.TLSConfig != nil {
+			err = srv.httpServer.ListenAndServeTLS("", "")
+		} else {
+			err = srv.httpServer.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalln(err)
 		}
 	}()
@@ -60,64 +131,183 @@ func (srv *Server) Run() {
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
 	<-stop
+	signal.Stop(stop)
 	srv.Shutdown()
 }
 
-// InitRouters инициализация роутера. Описание middleware.
-func (srv *Server) InitRouters() {
-	r := mux.NewRouter()
+// upgrader параметры websocket соединений сервера
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// Способы сжатия сообщений websocket в порядке предпочтения сервера. Порции файлов зашифрованы и почти
+// не сжимаются, поэтому сокеты файлов передают их без сжатия, если клиент это поддерживает
+var (
+	dataEncodings = []string{compression.Zstd, compression.Gzip, compression.Identity}
+	fileEncodings = []string{compression.Identity, compression.Zstd, compression.Gzip}
+)
 
-	var upgrader = websocket.Upgrader{
-		ReadBufferSize:  1024,
-		WriteBufferSize: 1024,
+// messageEncoding способ сжатия сообщений websocket из offers по хедеру открытия соединения
+// (см. compression.HeaderMessageEncoding). Клиенты, которые не выбирают способ сжатия, получают gzip
+func messageEncoding(r *http.Request, offers []string) string {
+	accept := r.Header.Get(compression.HeaderMessageEncoding)
+	if accept == "" {
+		return compression.Gzip
+	}
+	if encoding := compression.Negotiate(accept, offers...); encoding != "" {
+		return encoding
 	}
+	return compression.Gzip
+}
 
-	r.HandleFunc("/socket", func(w http.ResponseWriter, r *http.Request) {
-		conn, err := upgrader.Upgrade(w, r, nil)
+// websocketHandler хендлер websocket name. Соединение учитывается в метриках и закрывается при остановке сервера.
+// Способ сжатия сообщений выбирается из offers и передается клиенту в хедере ответа на открытие соединения
+func (srv *Server) websocketHandler(name string, offers []string,
+	serve func(conn *websocket.Conn, r *http.Request, encoding string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		encoding := messageEncoding(r, offers)
+		conn, err := upgrader.Upgrade(w, r, http.Header{compression.HeaderMessageEncoding: {encoding}})
 		if err != nil {
-			constants.Logger.ErrorLog(err)
+			constants.Logger.Ctx(r.Context()).ErrorLog(err)
 			return
 		}
+		defer srv.Metrics.WebSocket(name)()
 
-		srv.wsPingData(conn)
-	})
-
-	r.HandleFunc("/socket_file", func(w http.ResponseWriter, r *http.Request) {
-
-		conn, err := upgrader.Upgrade(w, r, nil)
-		if err != nil {
-			log.Println(err)
+		if !srv.wsConns.add(conn) {
+			msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+			_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+			_ = conn.Close()
 			return
 		}
-		srv.wsBinaryData(conn)
-	})
+		defer srv.wsConns.del(conn)
 
-	r.HandleFunc("/socket_download_file", func(w http.ResponseWriter, r *http.Request) {
+		serve(conn, r, encoding)
+	}
+}
 
-		conn, err := upgrader.Upgrade(w, r, nil)
-		if err != nil {
-			log.Println(err)
-			return
-		}
-		srv.wsDownloadBinaryData(conn, r)
-	})
+// InitRouters инициализация роутера. Описание middleware.
+func (srv *Server) InitRouters() {
+	r := mux.NewRouter()
+
+	if srv.Devices == nil {
+		srv.InitDevices()
+	}
+	if srv.Metrics == nil {
+		srv.InitMetrics()
+	}
+	if srv.Staging == nil {
+		srv.InitStaging()
+	}
+	if srv.Cache == nil {
+		srv.InitCache()
+	}
+	if srv.Bus == nil {
+		srv.InitBus()
+	}
+
+	r.HandleFunc("/socket", srv.websocketHandler("socket", dataEncodings, func(conn *websocket.Conn, r *http.Request,
+		encoding string) {
+		_, device, _ := midware.DeviceCertificate(r)
+		srv.wsPingData(r.Context(), conn, device, encoding)
+	}))
+	r.Handle("/socket_file", srv.authorized(srv.websocketHandler("socket_file", fileEncodings, srv.wsBinaryData)))
+	r.Handle("/socket_download_file", srv.authorized(srv.websocketHandler("socket_download_file", fileEncodings,
+		srv.wsDownloadBinaryData)))
+
+	if srv.Sessions == nil {
+		srv.InitSessions()
+	}
 
 	//POST
-	r.Handle("/api/resource/pairs", midware.IsAuthorized(srv.apiPairLoginPasswordPOST)).Methods("POST")
-	r.Handle("/api/resource/text", midware.IsAuthorized(srv.apiTextDataPOST)).Methods("POST")
-	r.Handle("/api/resource/binary", midware.IsAuthorized(srv.apiBinaryPOST)).Methods("POST")
-	r.Handle("/api/resource/card", midware.IsAuthorized(srv.apiBankCardPOST)).Methods("POST")
+	r.Handle("/api/resource/pairs", srv.authorized(srv.apiPairLoginPasswordPOST)).Methods("POST")
+	r.Handle("/api/resource/text", srv.authorized(srv.apiTextDataPOST)).Methods("POST")
+	r.Handle("/api/resource/binary", srv.authorized(srv.apiBinaryPOST)).Methods("POST")
+	r.Handle("/api/resource/card", srv.authorized(srv.apiBankCardPOST)).Methods("POST")
 
-	//POST Handle Func
-	r.HandleFunc("/api/user/register", srv.apiUserRegisterPOST).Methods("POST")
-	r.HandleFunc("/api/user/login", srv.apiUserLoginPOST).Methods("POST")
+	//REST
+	r.Handle("/api/resource/{type}", srv.authorized(srv.apiResourceListGET)).Methods("GET")
+	r.Handle("/api/resource/{type}/{uid}", srv.authorized(srv.apiResourceGET)).Methods("GET")
+	r.Handle("/api/resource/{type}/{uid}", srv.authorized(srv.apiResourcePUT)).Methods("PUT")
+	r.Handle("/api/resource/{type}/{uid}", srv.authorized(srv.apiResourceDELETE)).Methods("DELETE")
 
+	//Batch
+	r.Handle("/api/batch", srv.authorized(srv.apiBatchPOST)).Methods("POST")
+
+	//POST Handle Func
+	if srv.Limiter == nil {
+		srv.InitLimiter()
+	}
+	r.Handle("/api/user/register", midware.RateLimit(srv.Limiter, http.HandlerFunc(srv.apiUserRegisterPOST))).Methods("POST")
+	r.Handle("/api/user/login", midware.RateLimit(srv.Limiter, http.HandlerFunc(srv.apiUserLoginPOST))).Methods("POST")
+
+	//Admin
+	r.Handle("/api/admin/unlock", srv.admin(srv.apiAdminUnlockPOST)).Methods("POST")
+	r.Handle("/api/admin/users", srv.admin(srv.apiAdminUsersGET)).Methods("GET")
+	r.Handle("/api/admin/users/{login}", srv.admin(srv.apiAdminUserDELETE)).Methods("DELETE")
+	r.Handle("/api/admin/users/{login}/disable", srv.admin(srv.apiAdminUserDisablePOST)).Methods("POST")
+	r.Handle("/api/admin/users/{login}/enable", srv.admin(srv.apiAdminUserEnablePOST)).Methods("POST")
+	r.Handle("/api/admin/users/{login}/logout", srv.admin(srv.apiAdminUserLogoutPOST)).Methods("POST")
+	r.Handle("/api/admin/users/{login}/role", srv.admin(srv.apiAdminUserRolePOST)).Methods("POST")
+	r.Handle("/api/admin/dead", srv.admin(srv.apiAdminDeadGET)).Methods("GET")
+	r.Handle("/api/admin/dead/retry", srv.admin(srv.apiAdminDeadRetryPOST)).Methods("POST")
+
+	//Account
+	r.Handle("/api/user/password", srv.authorized(srv.apiUserPasswordPOST)).Methods("POST")
+	r.Handle("/api/user/delete", srv.authorized(srv.apiUserDeletePOST)).Methods("POST")
+	r.Handle("/api/user/export", srv.authorized(srv.apiUserExportGET)).Methods("GET")
+	r.Handle("/api/user/quota", srv.authorized(srv.apiUserQuotaGET)).Methods("GET")
+
+	//Sessions
+	r.Handle("/api/user/sessions", srv.authorized(srv.apiUserSessionsGET)).Methods("GET")
+	r.Handle("/api/user/sessions/revoke", srv.authorized(srv.apiUserSessionsRevokePOST)).Methods("POST")
+
+	//Devices
+	r.Handle("/api/user/devices/enroll", srv.authorizedSession(srv.apiUserDeviceEnrollPOST)).Methods("POST")
+	r.Handle("/api/user/devices", srv.authorized(srv.apiUserDevicesGET)).Methods("GET")
+	r.Handle("/api/user/devices/revoke", srv.authorized(srv.apiUserDevicesRevokePOST)).Methods("POST")
+
+	//Audit
+	r.Handle("/api/user/audit", srv.authorized(srv.apiUserAuditGET)).Methods("GET")
+
+	//Health
+	r.HandleFunc("/healthz", srv.apiHealthzGET).Methods("GET")
+	r.HandleFunc("/readyz", srv.apiReadyzGET).Methods("GET")
+	r.Handle("/metrics", srv.Metrics.Handler()).Methods("GET")
+
+	r.HandleFunc("/api/openapi.json", srv.apiOpenAPIGET).Methods("GET")
 	r.HandleFunc("/", srv.handleFunc).Methods("GET")
 
-	r.NotFoundHandler = http.HandlerFunc(srv.handlerNotFound)
+	r.NotFoundHandler = midware.RequestID(tracing.Middleware(midware.AccessLog(http.HandlerFunc(srv.handlerNotFound))))
+	r.Use(midware.RequestID, tracing.Middleware, midware.AccessLog, srv.Metrics.Middleware,
+		midware.MaxBytes(constants.MaxBodySize), midware.Compress)
 	srv.Router = r
 }
 
+// InitLogger инициализация лога сервера по конфигурации: уровень, формат и файл
+func (srv *Server) InitLogger() {
+	l, closer, err := logger.New(srv.Log.Level, srv.Log.Format, srv.Log.File)
+	if err != nil {
+		log.Fatal(err)
+	}
+	constants.Logger = l
+	srv.logCloser = closer
+}
+
+// InitTracing инициализация трассировки сервера по конфигурации: экспортер, адрес коллектора и файл
+func (srv *Server) InitTracing() {
+	shutdown, err := tracing.Init(tracing.Config{
+		Exporter: srv.Trace.Exporter,
+		Endpoint: srv.Trace.Endpoint,
+		File:     srv.Trace.File,
+		Service:  "gophkeeper-server",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv.traceShutdown = shutdown
+}
+
 // InitDataBase инициализация свойств базы данных сервера
 func (srv *Server) InitDataBase() {
 	dbc, err := postgresql.NewDBConnector(&srv.DBConfig)
@@ -128,29 +318,120 @@ func (srv *Server) InitDataBase() {
 	_ = postgresql.CreateModeLDB(srv.Pool)
 }
 
-// InitConfig инициализация свойств конфигурации сервера
-func (srv *Server) InitConfig() {
-	srvConfig, err := environment.NewConfigServer()
+// InitStaging инициализация хранилища сервера: количество шардов и емкость из конфигурации
+func (srv *Server) InitStaging() {
+	if srv.ServerConfig == nil {
+		srv.Staging = staging.New(0, 0)
+		return
+	}
+	srv.Staging = staging.New(srv.Flush.Shards, srv.Flush.Capacity)
+}
+
+// InitLimiter инициализация ограничителя неудачных попыток входа и регистрации.
+// Каждая блокировка записывается в аудит блокировок
+func (srv *Server) InitLimiter() {
+	cfg := limiter.Config{}
+	if srv.ServerConfig != nil {
+		cfg = limiterConfig(srv.RateLimit)
+	}
+	srv.Limiter = limiter.NewLimiter(cfg)
+	srv.Limiter.OnLockout = func(key string, failures int, until time.Time) {
+		srv.saveLockout(key, constants.EventLock, failures, until)
+	}
+}
+
+// InitSessions инициализация хранилища сессий.
+// Отозванные сессии, токены которых еще не истекли, загружаются из БД
+func (srv *Server) InitSessions() {
+	srv.Sessions = NewSessions()
+	if srv.DBConnector == nil {
+		return
+	}
+
+	arrUID, err := srv.DBConnector.SelectRevokedSessions(context.Background())
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+		return
+	}
+	srv.Sessions.LoadRevoked(arrUID)
+}
+
+// InitTLS инициализация TLS сервера.
+// Если сертификата нет, то создается самоподписанный. Отпечаток сертификата выводится в лог
+// для закрепления на клиенте
+func (srv *Server) InitTLS() {
+	if srv.TLS.Disabled {
+		constants.Logger.InfoLog("TLS disabled: the server accepts plaintext connections")
+		return
+	}
+
+	cert, err := tlsutil.LoadOrCreateServerCert(srv.TLS.CertFile, srv.TLS.KeyFile, tlsutil.ServerHosts(srv.Address))
+	if err != nil {
+		log.Fatal(err)
+	}
+	constants.Logger.InfoLog("TLS certificate fingerprint (SHA-256): " + tlsutil.Fingerprint(cert.Certificate[0]))
+
+	srv.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// InitConfig инициализация свойств конфигурации сервера по ключам запуска args.
+// С ключом -print-config итоговая конфигурация выводится в stdout и программа завершается
+func (srv *Server) InitConfig(args []string) {
+	srvConfig, err := environment.NewConfigServer(args)
 	if err != nil {
 		log.Fatal(err)
 	}
 	srv.ServerConfig = srvConfig
+	token.SetSigningKey([]byte(srvConfig.TokenKey))
 
+	if srvConfig.PrintConfig {
+		out, err := srvConfig.YAML()
+		if err != nil {
+			log.Fatal(err)
+		}
+		_, _ = os.Stdout.Write(out)
+		os.Exit(0)
+	}
 }
 
 // SaveDataInDB горутина сохранения данных в БД.
 // При переброски данных на сервер данные не записываются сразу в БД.
-// Данные сохраняются в хранилище сервера InListUserData.
-// И только после этого происходит обход InListUserData, перенос данных в БД.
-// Удаление из хранилища
+// Данные сохраняются в хранилище сервера Staging.
+// И только после этого происходит обход Staging, перенос данных в БД.
+// Удаление из хранилища. Период сохранения берется из конфигурации и может меняться при перезагрузке
 func (srv *Server) SaveDataInDB(ctx context.Context) {
 
-	ticker := time.NewTicker(time.Second / 2)
+	interval := srv.flushInterval()
+	ticker := time.NewTicker(interval)
+
+	for {
+		select {
+		case <-ticker.C:
+			srv.SaveData(ctx)
+			srv.SaveSessions(ctx)
+			if d := srv.flushInterval(); d != interval {
+				interval = d
+				ticker.Reset(interval)
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// CleanLimiter горутина очистки устаревших записей ограничителя неудачных попыток
+func (srv *Server) CleanLimiter(ctx context.Context) {
+
+	ticker := time.NewTicker(time.Minute)
 
 	for {
 		select {
 		case <-ticker.C:
-			srv.SaveData()
+			srv.Limiter.Clean()
 
 		case <-ctx.Done():
 			return
@@ -159,27 +440,105 @@ func (srv *Server) SaveDataInDB(ctx context.Context) {
 }
 
 // SaveData описание непосредственного сохранения данных в БД.
-func (srv *Server) SaveData() {
-	srv.Lock()
-	defer srv.Unlock()
-
-	for _, vType := range srv.InListUserData {
-		for k, v := range vType {
-
-			if v.GetEvent() == constants.EventDel.String() {
-				if err := srv.DBConnector.Delete(v); err != nil {
-					constants.Logger.ErrorLog(err)
-					continue
-				}
-				delete(vType, k)
-				continue
-			}
+// Шарды хранилища сохраняются параллельно, запись в хранилище во время сохранения не блокируется.
+// Длительность сохранения и ошибки записываются в метрики, время сохранения используется проверкой готовности.
+// Записи, которые не удалось сохранить за несколько попыток, переносятся в список неисправных записей.
+// Записи шарда сохраняются пакетами в одной транзакции. Сохранение непустого хранилища трассируется:
+// span сохранения пакета связан со span запросов, которыми записи попали в хранилище.
+// Сохранение прерывается, когда заканчивается время ctx
+func (srv *Server) SaveData(ctx context.Context) {
+	start := time.Now()
+	defer func() {
+		if srv.Metrics != nil {
+			srv.Metrics.FlushDuration.Observe(time.Since(start).Seconds())
+		}
+		srv.lastFlush.Store(time.Now().UnixNano())
+	}()
 
-			if err := srv.DBConnector.Update(v); err != nil {
-				constants.Logger.ErrorLog(err)
-				continue
-			}
-			delete(vType, k)
+	records := srv.Staging.Len()
+	if records == 0 {
+		return
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "staging.flush",
+		trace.WithAttributes(attribute.Int("gophkeeper.staging.records", records)))
+	defer span.End()
+
+	srv.Staging.Flush(ctx, srv.saveStaged, srv.flushFailed)
+}
+
+// saveStaged сохраняет в БД пакет записей хранилища сервера одной транзакцией (см. DBConnector.SaveBatch).
+// Если пакет не сохранился, то записи сохраняются по одной, что бы ошибка одной записи не задерживала остальные
+// и попадала в счетчик попыток только этой записи. Сохраненные записи обновляются в кеше записей, об изменении данных пользователей сохраненных записей
+// сообщается всем экземплярам сервера (см. bus.KindChanged). Span сохранения пакета связан со span запросов,
+// которыми записи попали в хранилище
+func (srv *Server) saveStaged(ctx context.Context, items []staging.Item) []error {
+	links := make([]trace.Link, 0, len(items))
+	arrUpdater := make([]model.Updater, 0, len(items))
+	for _, item := range items {
+		if item.Span.IsValid() {
+			links = append(links, trace.Link{SpanContext: item.Span})
+		}
+		arrUpdater = append(arrUpdater, item.Record)
+	}
+	ctx, span := tracing.Tracer().Start(ctx, "staging.save", trace.WithLinks(links...),
+		trace.WithAttributes(attribute.Int("gophkeeper.staging.records", len(items))))
+	defer span.End()
+
+	ctxVW := context.WithValue(ctx, model.KeyContext("data"), arrUpdater)
+	err := srv.DBConnector.SaveBatch(ctxVW)
+	if err == nil {
+		srv.cacheStaged(items, nil)
+		srv.auditStaged(items, nil)
+		srv.publishChanged(ctx, stagedUsers(items, nil)...)
+		return nil
+	}
+	tracing.SetError(span, err)
+	if len(items) == 1 {
+		return []error{err}
+	}
+
+	arrErr := make([]error, len(items))
+	for i, item := range items {
+		arrErr[i] = srv.saveStagedItem(ctx, item)
+	}
+	srv.cacheStaged(items, arrErr)
+	srv.auditStaged(items, arrErr)
+	srv.publishChanged(ctx, stagedUsers(items, arrErr)...)
+	return arrErr
+}
+
+// stagedUsers пользователи сохраненных записей хранилища (arrErr ошибки сохранения записей, nil - все сохранены)
+func stagedUsers(items []staging.Item, arrErr []error) []string {
+	set := map[string]bool{}
+	var users []string
+	for i, item := range items {
+		if (arrErr == nil || arrErr[i] == nil) && !set[item.User] {
+			set[item.User] = true
+			users = append(users, item.User)
 		}
 	}
+	return users
+}
+
+// saveStagedItem сохраняет в БД одну запись хранилища сервера: удаляет по событию EventDel, иначе добавляет/обновляет
+func (srv *Server) saveStagedItem(ctx context.Context, item staging.Item) error {
+	ctx, span := tracing.Tracer().Start(ctx, "staging.save_record", tracing.Record(item.Type, item.Uid))
+	defer span.End()
+
+	var err error
+	if item.Record.GetEvent() == constants.EventDel.String() {
+		err = srv.DBConnector.Delete(ctx, item.Record)
+	} else {
+		err = srv.DBConnector.Update(ctx, item.Record)
+	}
+	tracing.SetError(span, err)
+	return err
+}
+
+// flushError учитывает в метриках запись, которую не удалось сохранить в БД
+func (srv *Server) flushError() {
+	if srv.Metrics != nil {
+		srv.Metrics.FlushErrors.Inc()
+	}
 }
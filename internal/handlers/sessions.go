@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/constants/errs"
+	"gophkeeper/internal/midware"
+	"gophkeeper/internal/postgresql/model"
+	"gophkeeper/internal/token"
+)
+
+// Sessions хранилище состояния сессий пользователей на сервере.
+// Хранит активные сессии (принимаются только токены сессий из этого списка), отозванные сессии,
+// websocket соединения сессий и время последней активности, которое периодически сбрасывается в БД
+type Sessions struct {
+	sync.Mutex
+	active   map[string]activeSession
+	revoked  map[string]bool
+	conns    map[string]map[*websocket.Conn]bool
+	lastSeen map[string]time.Time
+}
+
+// activeSession активная сессия пользователя user, которая истекает в expires
+type activeSession struct {
+	user    string
+	expires time.Time
+}
+
+// NewSessions создание хранилища сессий
+func NewSessions() *Sessions {
+	return &Sessions{
+		active:   map[string]activeSession{},
+		revoked:  map[string]bool{},
+		conns:    map[string]map[*websocket.Conn]bool{},
+		lastSeen: map[string]time.Time{},
+	}
+}
+
+// Add отмечает сессию пользователя user активной до expires: сессия создана при входе или найдена в БД
+func (s *Sessions) Add(session, user string, expires time.Time) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.revoked[session] {
+		return
+	}
+	s.active[session] = activeSession{user: user, expires: expires}
+}
+
+// Active проверяет, что сессия пользователя user есть в списке активных, не отозвана и не истекла,
+// и отмечает время последней активности. known - ответ известен без БД: сессии без УИДа, отозванные
+// и сессии из списка. Иначе сессию нужно проверить по БД (см. Server.sessionActive)
+func (s *Sessions) Active(session, user string) (active bool, known bool) {
+	if session == "" {
+		return false, true
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s.revoked[session] {
+		return false, true
+	}
+	as, ok := s.active[session]
+	if !ok {
+		return false, false
+	}
+	if as.user != user || time.Now().After(as.expires) {
+		return false, true
+	}
+	s.lastSeen[session] = time.Now()
+	return true, true
+}
+
+// Prune удаляет из списка активных истекшие сессии
+func (s *Sessions) Prune() {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	for session, as := range s.active {
+		if now.After(as.expires) {
+			delete(s.active, session)
+		}
+	}
+}
+
+// AddConn привязывает websocket соединение к сессии
+func (s *Sessions) AddConn(session string, conn *websocket.Conn) {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.conns[session]; !ok {
+		s.conns[session] = map[*websocket.Conn]bool{}
+	}
+	s.conns[session][conn] = true
+}
+
+// DelConn отвязывает websocket соединение от сессии
+func (s *Sessions) DelConn(session string, conn *websocket.Conn) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.conns[session], conn)
+	if len(s.conns[session]) == 0 {
+		delete(s.conns, session)
+	}
+}
+
+// Revoke отзывает сессию и сразу закрывает все ее websocket соединения
+func (s *Sessions) Revoke(session string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.revoked[session] = true
+	delete(s.active, session)
+	delete(s.lastSeen, session)
+
+	msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session revoked")
+	for conn := range s.conns[session] {
+		if err := conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second)); err != nil {
+			constants.Logger.ErrorLog(err)
+		}
+		if err := conn.Close(); err != nil {
+			constants.Logger.ErrorLog(err)
+		}
+	}
+	delete(s.conns, session)
+}
+
+// LoadRevoked загружает отозванные сессии из БД при старте сервера
+func (s *Sessions) LoadRevoked(arrUID []string) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, v := range arrUID {
+		s.revoked[v] = true
+	}
+}
+
+// TakeLastSeen возвращает накопленное время последней активности сессий и очищает его
+func (s *Sessions) TakeLastSeen() map[string]time.Time {
+	s.Lock()
+	defer s.Unlock()
+
+	lastSeen := s.lastSeen
+	s.lastSeen = map[string]time.Time{}
+	return lastSeen
+}
+
+// authorized обертка над midware.IsAuthorized. Дополнительно проверяет, что сессия токена активна,
+// и, если включена проверка устройств, сертификат устройства
+func (srv *Server) authorized(endpoint func(http.ResponseWriter, *http.Request)) http.Handler {
+	return srv.authorizedSession(srv.deviceAuthorized(endpoint))
+}
+
+// authorizedSession обертка над midware.IsAuthorized, проверяющая только сессию токена.
+// Используется для выпуска сертификата устройства, когда сертификата еще нет
+func (srv *Server) authorizedSession(endpoint func(http.ResponseWriter, *http.Request)) http.Handler {
+	return midware.IsAuthorized(func(w http.ResponseWriter, r *http.Request) {
+		if !srv.sessionActive(r.Context(), r.Header.Get(constants.HeaderAuthorization)) {
+			errs.WriteError(w, errs.ErrUnauthorized)
+			return
+		}
+		endpoint(w, r)
+	})
+}
+
+// sessionActive проверяет сессию токена tkn по списку активных сессий: токены без сессии, с неизвестной,
+// отозванной или истекшей сессией не принимаются. Сессия, которой нет в списке (создана другим экземпляром
+// сервера или до перезапуска), проверяется по БД и добавляется в список
+func (srv *Server) sessionActive(ctx context.Context, tkn string) bool {
+	claims, ok := token.ExtractClaims(tkn)
+	if !ok {
+		return false
+	}
+	session, _ := claims["session"].(string)
+	user, _ := claims["user"].(string)
+
+	active, known := srv.Sessions.Active(session, user)
+	if known || srv.DBConnector == nil {
+		return active
+	}
+
+	s, err := srv.DBConnector.SelectActiveSession(ctx, session)
+	if err != nil {
+		if !errors.Is(err, errs.ErrNotFound) {
+			constants.Logger.Ctx(ctx).ErrorLog(err)
+		}
+		return false
+	}
+	if s.User != user {
+		return false
+	}
+	srv.Sessions.Add(session, user, s.Created.Add(time.Hour*constants.TimeLiveToken))
+	active, _ = srv.Sessions.Active(session, user)
+	return active
+}
+
+// newSessionToken создает сессию пользователя в БД и возвращает токен, привязанный к сессии.
+// Имя устройства и версия клиента передаются в хедерах запроса.
+// Если запрос пришел с сертификатом устройства пользователя, то токен привязывается и к устройству
+func (srv *Server) newSessionToken(r *http.Request, name string) (string, error) {
+	s := model.Session{
+		Uid:      uuid.New().String(),
+		User:     name,
+		Device:   r.Header.Get(constants.HeaderDeviceName),
+		Build:    r.Header.Get(constants.HeaderClientBuild),
+		IP:       midware.RemoteIP(r),
+		Created:  time.Now(),
+		DeviceID: srv.sessionDevice(r, name),
+	}
+
+	ctxVW := context.WithValue(r.Context(), model.KeyContext("data"), s)
+	if err := srv.DBConnector.NewSession(ctxVW); err != nil {
+		return "", err
+	}
+
+	tc := token.NewClaims(name)
+	tc.Session = s.Uid
+	tc.Device = s.DeviceID
+	tokenString, err := tc.GenerateJWT()
+	if err != nil {
+		return "", err
+	}
+	srv.Sessions.Add(s.Uid, name, time.Unix(tc.Exp, 0))
+	return tokenString, nil
+}
+
+// SaveSessions сохраняет в БД время последней активности сессий. Истекшие сессии удаляются из списка активных
+func (srv *Server) SaveSessions(ctx context.Context) {
+	srv.Sessions.Prune()
+	lastSeen := srv.Sessions.TakeLastSeen()
+	if len(lastSeen) == 0 {
+		return
+	}
+	if err := srv.DBConnector.UpdateSessionsLastSeen(ctx, lastSeen); err != nil {
+		constants.Logger.ErrorLog(err)
+	}
+}
+
+// apiUserSessionsGET хендлер списка активных сессий пользователя
+func (srv *Server) apiUserSessionsGET(w http.ResponseWriter, r *http.Request) {
+
+	tkn := r.Header.Get(constants.HeaderAuthorization)
+	claims, ok := token.ExtractClaims(tkn)
+	if !ok {
+		errs.WriteError(w, errs.ErrUnauthorized)
+		return
+	}
+	current := token.SessionFromToken(tkn)
+
+	ctx := context.WithValue(r.Context(), model.KeyContext("user"), claims["user"])
+	arrSession, err := srv.DBConnector.SelectSessions(ctx)
+	if err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+	for i := range arrSession {
+		arrSession[i].Current = arrSession[i].Uid == current
+	}
+
+	msg, err := json.MarshalIndent(arrSession, "", " ")
+	if err != nil {
+		constants.Logger.Ctx(r.Context()).ErrorLog(err)
+		errs.WriteError(w, errs.ErrErrorServer)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write(msg); err != nil {
+		constants.Logger.Ctx(r.Context()).ErrorLog(err)
+	}
+}
+
+// apiUserSessionsRevokePOST хендлер отзыва сессии пользователя.
+// Websocket соединения отозванной сессии закрываются сразу
+func (srv *Server) apiUserSessionsRevokePOST(w http.ResponseWriter, r *http.Request) {
+
+	claims, ok := token.ExtractClaims(r.Header.Get(constants.HeaderAuthorization))
+	if !ok {
+		errs.WriteError(w, errs.ErrUnauthorized)
+		return
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+
+	s := model.Session{}
+	if err = json.Unmarshal(body, &s); err != nil {
+		errs.WriteError(w, errs.Invalid(err))
+		return
+	}
+	s.User = claims["user"].(string)
+
+	ctxVW := context.WithValue(r.Context(), model.KeyContext("data"), s)
+	if err = srv.DBConnector.RevokeSession(ctxVW); err != nil {
+		errs.WriteError(w, err)
+		return
+	}
+	srv.revokeSession(r.Context(), s.Uid)
+	srv.audit(r, model.AuditRecord{Event: constants.AuditRevoke, Uid: s.Uid, Success: true})
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/token"
+)
+
+func TestSessions(t *testing.T) {
+	s := &Server{}
+	s.InitRouters()
+
+	get := func(tokenString string) int {
+		req := httptest.NewRequest("GET", "/api/resource/text", nil)
+		req.Header.Set(constants.HeaderAuthorization, tokenString)
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	tc := token.NewClaims("user")
+	noSession, err := tc.GenerateJWT()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc.Session = "0f8fad5b-d9cb-469f-a165-70867728950e"
+	unknown, err := tc.GenerateJWT()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc.Session = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	s.Sessions.Add(tc.Session, "other", time.Now().Add(time.Hour))
+	otherUser, err := tc.GenerateJWT()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tokenString := range map[string]string{
+		"without session": noSession,
+		"unknown session": unknown,
+		"other user":      otherUser,
+	} {
+		t.Run("Checking token "+name, func(t *testing.T) {
+			if code := get(tokenString); code != http.StatusUnauthorized {
+				t.Errorf("Expected %d, got %d", http.StatusUnauthorized, code)
+			}
+		})
+	}
+
+	t.Run("Checking revoked session", func(t *testing.T) {
+		tokenString := sessionToken(t, s, "user")
+		if !s.sessionActive(context.Background(), tokenString) {
+			t.Fatal("Active session is rejected")
+		}
+		s.Sessions.Revoke(token.SessionFromToken(tokenString))
+		if code := get(tokenString); code != http.StatusUnauthorized {
+			t.Errorf("Expected %d, got %d", http.StatusUnauthorized, code)
+		}
+	})
+
+	t.Run("Checking expired session", func(t *testing.T) {
+		s.Sessions.Add("expired", "user", time.Now().Add(-time.Minute))
+		if active, _ := s.Sessions.Active("expired", "user"); active {
+			t.Error("Expired session is active")
+		}
+		s.Sessions.Prune()
+		if _, known := s.Sessions.Active("expired", "user"); known {
+			t.Error("Expired session is not pruned")
+		}
+	})
+}
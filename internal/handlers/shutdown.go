@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"gophkeeper/internal/constants"
+)
+
+// defaultShutdownTimeout время на остановку сервера без конфигурации
+const defaultShutdownTimeout = 30 * time.Second
+
+// wsConns открытые websocket соединения сервера. http.Server.Shutdown не ждет и не закрывает
+// соединения, захваченные websocket, поэтому при остановке они закрываются отдельно
+type wsConns struct {
+	sync.Mutex
+	conns  map[*websocket.Conn]bool
+	closed bool
+}
+
+// add регистрирует соединение. Если сервер уже останавливается, то возвращает false
+func (wc *wsConns) add(conn *websocket.Conn) bool {
+	wc.Lock()
+	defer wc.Unlock()
+
+	if wc.closed {
+		return false
+	}
+	if wc.conns == nil {
+		wc.conns = map[*websocket.Conn]bool{}
+	}
+	wc.conns[conn] = true
+	return true
+}
+
+// del удаляет соединение из открытых
+func (wc *wsConns) del(conn *websocket.Conn) {
+	wc.Lock()
+	defer wc.Unlock()
+
+	delete(wc.conns, conn)
+}
+
+// closeAll закрывает все открытые соединения с кодом CloseGoingAway и запрещает новые
+func (wc *wsConns) closeAll() {
+	wc.Lock()
+	defer wc.Unlock()
+
+	wc.closed = true
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for conn := range wc.conns {
+		if err := conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second)); err != nil {
+			constants.Logger.ErrorLog(err)
+		}
+		if err := conn.Close(); err != nil {
+			constants.Logger.ErrorLog(err)
+		}
+	}
+	wc.conns = nil
+}
+
+// shutdownTimeout время на остановку сервера из конфигурации
+func (srv *Server) shutdownTimeout() time.Duration {
+	if srv.ServerConfig == nil || srv.ShutdownTimeout <= 0 {
+		return defaultShutdownTimeout
+	}
+	return srv.ShutdownTimeout
+}
+
+// stopping канал, который закрывается в начале остановки сервера. Используется потоками gRPC,
+// которые иначе не завершаются. До запуска сервера канал nil и никогда не срабатывает
+func (srv *Server) stopping() <-chan struct{} {
+	return srv.stop
+}
+
+// Shutdown остановка сервера за время ShutdownTimeout:
+// прекращается прием запросов и ожидается завершение текущих, websocket соединения закрываются с кодом
+// CloseGoingAway, останавливаются фоновые горутины, хранилище сервера и очередь журнала аудита сохраняются в БД,
+// закрывается пул соединений с БД. Записи, которые не удалось сохранить до истечения времени, пишутся в лог
+func (srv *Server) Shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), srv.shutdownTimeout())
+	defer cancel()
+
+	constants.Logger.InfoLog("server shutting down")
+	if srv.stop != nil {
+		close(srv.stop)
+	}
+	srv.wsConns.closeAll()
+
+	var wg sync.WaitGroup
+	if srv.httpServer != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := srv.httpServer.Shutdown(ctx); err != nil {
+				constants.Logger.ErrorLog(err)
+			}
+		}()
+	}
+	if srv.GRPC != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stopped := make(chan struct{})
+			go func() {
+				srv.GRPC.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-ctx.Done():
+				srv.GRPC.Stop()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if srv.cancelWorkers != nil {
+		srv.cancelWorkers()
+	}
+	srv.workers.Wait()
+
+	if srv.DBConnector != nil {
+		srv.SaveData(ctx)
+		srv.SaveSessions(ctx)
+		if n := srv.Staging.Len(); n > 0 {
+			constants.Logger.Log.Error().Int("records", n).Msg("staging buffer not saved before shutdown deadline")
+		}
+		if srv.flushAudit(ctx) != nil {
+			for _, a := range srv.audits.take() {
+				constants.Logger.ErrorLog(fmt.Errorf("audit record not saved before shutdown: %+v", a))
+			}
+		}
+		srv.Pool.Close()
+	}
+	if srv.Bus != nil {
+		_ = srv.Bus.Close()
+	}
+
+	if srv.traceShutdown != nil {
+		tctx, tcancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := srv.traceShutdown(tctx); err != nil {
+			constants.Logger.ErrorLog(err)
+		}
+		tcancel()
+	}
+	constants.Logger.InfoLog("server stopped")
+	if srv.logCloser != nil {
+		_ = srv.logCloser.Close()
+	}
+}
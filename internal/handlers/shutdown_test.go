@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestShutdown(t *testing.T) {
+	s := &Server{}
+	s.InitRouters()
+
+	ts := httptest.NewServer(s.Router)
+	defer ts.Close()
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/socket"
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for i := 0; i < 100; i++ {
+		s.wsConns.Lock()
+		n := len(s.wsConns.conns)
+		s.wsConns.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.Shutdown()
+
+	t.Run("Checking going away", func(t *testing.T) {
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, _, err = conn.ReadMessage()
+		var ce *websocket.CloseError
+		if !errors.As(err, &ce) || ce.Code != websocket.CloseGoingAway {
+			t.Errorf("Expected close code %d, got %v", websocket.CloseGoingAway, err)
+		}
+	})
+
+	t.Run("Checking new connection", func(t *testing.T) {
+		c, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+
+		_ = c.SetReadDeadline(time.Now().Add(time.Second))
+		_, _, err = c.ReadMessage()
+		if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Errorf("Expected close code %d, got %v", websocket.CloseGoingAway, err)
+		}
+	})
+}
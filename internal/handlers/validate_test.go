@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gophkeeper/internal/compression"
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/constants/errs"
+)
+
+func TestValidation(t *testing.T) {
+	s := &Server{}
+	s.InitRouters()
+
+	tokenString := sessionToken(t, s, "user")
+
+	post := func(path string, body []byte, gzip bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, bytes.NewReader(body))
+		req.Header.Set(constants.HeaderAuthorization, tokenString)
+		if gzip {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	// fieldErrors поля с ошибками проверки из ответа 400
+	fieldErrors := func(t *testing.T, w *httptest.ResponseRecorder) map[string]bool {
+		t.Helper()
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("Expected %d, got %d", http.StatusBadRequest, w.Code)
+		}
+
+		resp := struct {
+			Code    string            `json:"code"`
+			Details []errs.FieldError `json:"details"`
+		}{}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Code != errs.CodeValidation {
+			t.Errorf("Expected code %s, got %s", errs.CodeValidation, resp.Code)
+		}
+		fields := map[string]bool{}
+		for _, f := range resp.Details {
+			fields[f.Field] = true
+		}
+		return fields
+	}
+
+	t.Run("Checking field errors", func(t *testing.T) {
+		w := post("/api/resource/binary", []byte(`{"uid":"1","name":"","size":"-1","event":"move"}`), false)
+		fields := fieldErrors(t, w)
+		for _, f := range []string{"uid", "event", "name", "size"} {
+			if !fields[f] {
+				t.Errorf("No error for field %s: %v", f, fields)
+			}
+		}
+		if s.Staging.Len() != 0 {
+			t.Errorf("Invalid record is staged: %d", s.Staging.Len())
+		}
+	})
+
+	t.Run("Checking file size", func(t *testing.T) {
+		for _, size := range []string{``, `,"size":""`, `,"size":"0"`, `,"size":"1kb"`} {
+			w := post("/api/resource/binary",
+				[]byte(`{"uid":"0f8fad5b-d9cb-469f-a165-70867728950e","name":"file"`+size+`}`), false)
+			if fields := fieldErrors(t, w); len(fields) != 1 || !fields["size"] {
+				t.Errorf("%s: expected error for field size, got %v", size, fields)
+			}
+		}
+	})
+
+	t.Run("Checking card number", func(t *testing.T) {
+		number := strings.Repeat("1", constants.MaxCardFieldLength+1)
+		w := post("/api/resource/card",
+			[]byte(`{"uid":"0f8fad5b-d9cb-469f-a165-70867728950e","patch":"`+number+`","cvc":"123"}`), false)
+		if fields := fieldErrors(t, w); len(fields) != 1 || !fields["number"] {
+			t.Errorf("Expected error for field number, got %v", fields)
+		}
+	})
+
+	t.Run("Checking valid record", func(t *testing.T) {
+		w := post("/api/resource/text", []byte(`{"uid":"0f8fad5b-d9cb-469f-a165-70867728950e","text":"text","event":"edit"}`), false)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("Checking deleted record", func(t *testing.T) {
+		w := post("/api/resource/card", []byte(`{"uid":"0f8fad5b-d9cb-469f-a165-70867728950e","event":"del"}`), false)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("Checking body size", func(t *testing.T) {
+		w := post("/api/resource/text", make([]byte, constants.MaxBodySize+1), false)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+		}
+
+		body, err := compression.Compress([]byte(`{"text":"` + strings.Repeat("a", constants.MaxBodySize) + `"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = post("/api/resource/text", body, true)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected %d for gzip body, got %d", http.StatusRequestEntityTooLarge, w.Code)
+		}
+	})
+}
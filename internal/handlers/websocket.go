@@ -3,26 +3,53 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"gophkeeper/internal/postgresql/model"
 	"gophkeeper/internal/token"
-	"log"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 
+	"gophkeeper/internal/bus"
 	"gophkeeper/internal/compression"
 	"gophkeeper/internal/constants"
+	"gophkeeper/internal/constants/errs"
+	"gophkeeper/internal/encryption"
+	"gophkeeper/internal/metrics"
 )
 
-// wsPingData websocket для отправки данных на клиент по имени
-func (srv *Server) wsPingData(conn *websocket.Conn) {
+// wsPingData websocket для отправки данных на клиент по имени.
+// Соединение привязывается к сессии токена. При отзыве сессии соединение закрывается.
+// device УИД устройства из сертификата соединения. Если включена проверка устройств, то данные
+// отправляются только токену этого устройства, иначе соединение закрывается с кодом ClosePolicyViolation.
+// После первого токена данные также отправляются при их изменении на любом экземпляре сервера (см. bus.KindChanged).
+// encoding способ сжатия сообщений, выбранный при открытии соединения
+func (srv *Server) wsPingData(ctx context.Context, conn *websocket.Conn, device, encoding string) {
+
+	push := &pushConn{conn: conn, encoding: encoding}
+	events, unsubscribe := srv.Bus.Subscribe()
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		unsubscribe()
+	}()
+	go srv.pushChanges(ctx, push, events, done)
+
+	session := ""
+	defer func() {
+		if session != "" {
+			srv.Sessions.DelConn(session, conn)
+		}
+	}()
 
 	for {
 		_, msgToken, err := conn.ReadMessage()
 		if err != nil {
-			log.Println("ReadMessage() error:", err)
+			constants.Logger.ErrorLog(err)
 			return
 		}
 
@@ -36,75 +63,255 @@ func (srv *Server) wsPingData(conn *websocket.Conn) {
 			continue
 		}
 
-		app := model.Appender{}
+		tknSession := token.SessionFromToken(tkn)
+		if !srv.sessionActive(ctx, tkn) {
+			msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session revoked")
+			if err = push.write(websocket.CloseMessage, msg); err != nil {
+				constants.Logger.ErrorLog(err)
+			}
+			return
+		}
+		if tknSession != session {
+			if session != "" {
+				srv.Sessions.DelConn(session, conn)
+			}
+			session = tknSession
+			srv.Sessions.AddConn(session, conn)
+		}
+
+		if srv.DeviceCA != nil {
+			// токен без устройства или не для сертификата соединения: клиент получает причину закрытия
+			// с кодом ошибки, как в ответах HTTP, а не остается без данных
+			tknDevice := token.DeviceFromToken(tkn)
+			if tknDevice == "" || tknDevice != device || srv.Devices.Revoked(device) {
+				msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, errs.CodeDeviceRequired)
+				if err = push.write(websocket.CloseMessage, msg); err != nil {
+					constants.Logger.ErrorLog(err)
+				}
+				return
+			}
+		}
 
-		ctx := context.Background()
-		ctxWV := context.WithValue(ctx, model.KeyContext("user"), tkn)
+		push.setToken(tkn)
+		srv.sendUserData(ctx, push, tkn)
+	}
+}
 
-		arrType := []string{constants.TypePairLoginPassword.String(), constants.TypeTextData.String(),
-			constants.TypeBinaryData.String(), constants.TypeBankCardData.String()}
+// pushConn websocket соединение отправки данных. Данные отправляются и на запрос клиента,
+// и по событию шины, поэтому запись в соединение разделяется мьютексом.
+// token последний проверенный токен клиента, encoding способ сжатия сообщений
+type pushConn struct {
+	sync.Mutex
+	conn     *websocket.Conn
+	token    string
+	encoding string
+}
 
-		for _, t := range arrType {
-			arr, err := srv.DBConnector.Select(ctxWV, t)
-			if err != nil {
-				constants.Logger.ErrorLog(err)
+// write запись сообщения в соединение
+func (p *pushConn) write(messageType int, data []byte) error {
+	p.Lock()
+	defer p.Unlock()
+	return p.conn.WriteMessage(messageType, data)
+}
+
+// setToken запоминает проверенный токен клиента
+func (p *pushConn) setToken(tkn string) {
+	p.Lock()
+	defer p.Unlock()
+	p.token = tkn
+}
+
+// currentToken последний проверенный токен клиента
+func (p *pushConn) currentToken() string {
+	p.Lock()
+	defer p.Unlock()
+	return p.token
+}
+
+// pushChanges горутина отправки данных клиенту по событиям шины об изменении его данных.
+// Пока клиент не прислал токен, события пропускаются
+func (srv *Server) pushChanges(ctx context.Context, push *pushConn, events <-chan bus.Event, done <-chan struct{}) {
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			srv.dropCached(ev)
+			tkn := push.currentToken()
+			if tkn == "" || !changedFor(ev, tokenUser(tkn)) {
 				continue
 			}
-			for _, val := range arr {
-				app[fmt.Sprintf("%s:%s", t, uuid.New().String())] = val
+			if !srv.sessionActive(ctx, tkn) {
+				continue
 			}
+			srv.sendUserData(ctx, push, tkn)
+
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
 		}
+	}
+}
+
+// sendUserData отправка всех данных пользователя токена tkn. Записи читаются через кеш записей
+func (srv *Server) sendUserData(ctx context.Context, push *pushConn, tkn string) {
+	app := model.Appender{}
+
+	arrType := []string{constants.TypePairLoginPassword.String(), constants.TypeTextData.String(),
+		constants.TypeBinaryData.String(), constants.TypeBankCardData.String()}
 
-		msg, err := json.MarshalIndent(&app, "", " ")
-		msg, err = compression.Compress(msg)
+	for _, t := range arrType {
+		arr, err := srv.selectRecords(ctx, tkn, t)
 		if err != nil {
 			constants.Logger.ErrorLog(err)
+			continue
 		}
-		if err = conn.WriteMessage(2, msg); err != nil {
-			constants.Logger.ErrorLog(err)
+		for _, val := range arr {
+			app[fmt.Sprintf("%s:%s", t, uuid.New().String())] = val
 		}
 	}
+
+	msg, err := json.MarshalIndent(&app, "", " ")
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+		return
+	}
+	if msg, err = compression.Encode(push.encoding, msg); err != nil {
+		constants.Logger.ErrorLog(err)
+		return
+	}
+	if err = push.write(2, msg); err != nil {
+		constants.Logger.ErrorLog(err)
+	}
 }
 
 // wsDownloadBinaryData websocket переноса бинарных данных с сервера на клиент.
-func (srv *Server) wsDownloadBinaryData(conn *websocket.Conn, r *http.Request) {
+// Файл отдается только владельцу. Каждое скачивание записывается в журнал аудита.
+// Порции сжимаются способом encoding, выбранным при открытии соединения
+func (srv *Server) wsDownloadBinaryData(conn *websocket.Conn, r *http.Request, encoding string) {
 
-	ctx := context.Background()
-	ctxWV := context.WithValue(ctx, model.KeyContext("uid"), r.Header.Get("UID"))
+	defer func() {
+		if err := conn.Close(); err != nil {
+			constants.Logger.Ctx(r.Context()).ErrorLog(err)
+		}
+	}()
+
+	bd := model.BinaryData{
+		User: r.Header.Get(constants.HeaderAuthorization),
+		Uid:  r.Header.Get("UID"),
+	}
+	recordExists, err := srv.DBConnector.Exists(r.Context(), &bd)
+	if err != nil || !recordExists {
+		srv.audit(r, model.AuditRecord{Event: constants.AuditDownload, Type: bd.GetType(), Uid: bd.Uid, Success: false})
+		msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "file not found")
+		if err = conn.WriteMessage(websocket.CloseMessage, msg); err != nil {
+			constants.Logger.Ctx(r.Context()).ErrorLog(err)
+		}
+		return
+	}
+	srv.audit(r, model.AuditRecord{Event: constants.AuditDownload, Type: bd.GetType(), Uid: bd.Uid, Success: true})
+
+	ctxWV := context.WithValue(r.Context(), model.KeyContext("uid"), bd.Uid)
 
 	arrPbd, err := srv.DBConnector.SelectPortionBinaryData(ctxWV)
 	if err != nil {
-		constants.Logger.ErrorLog(err)
+		constants.Logger.Ctx(r.Context()).ErrorLog(err)
 		return
 	}
 
 	for _, v := range arrPbd {
 		msg, err := json.MarshalIndent(&v, "", " ")
-		msg, err = compression.Compress(msg)
+		if err == nil {
+			msg, err = compression.Encode(encoding, msg)
+		}
 		if err != nil {
-			constants.Logger.ErrorLog(err)
+			// порцию не удалось подготовить: клиент получает причину закрытия, а не файл без порции
+			constants.Logger.Ctx(r.Context()).ErrorLog(err)
+			msg = websocket.FormatCloseMessage(websocket.CloseInternalServerErr, errs.CodeServerError)
+			if err = conn.WriteMessage(websocket.CloseMessage, msg); err != nil {
+				constants.Logger.Ctx(r.Context()).ErrorLog(err)
+			}
+			return
 		}
 		if err = conn.WriteMessage(1, msg); err != nil {
-			constants.Logger.ErrorLog(err)
+			constants.Logger.Ctx(r.Context()).ErrorLog(err)
+			return
 		}
+		srv.Metrics.FileBytes.WithLabelValues(metrics.DirectionDownload).Add(float64(len(msg)))
 	}
+}
 
-	if err = conn.Close(); err != nil {
-		constants.Logger.ErrorLog(err)
+// portionBuffer порции файла, накопленные для записи в БД одной командой COPY
+type portionBuffer struct {
+	srv *Server
+	arr []model.PortionBinaryData
+}
+
+// add добавляет порцию в буфер. Когда накоплено CopyPortions порций, они записываются в БД
+func (pb *portionBuffer) add(ctx context.Context, pbd model.PortionBinaryData) error {
+	pb.arr = append(pb.arr, pbd)
+	if len(pb.arr) < constants.CopyPortions {
+		return nil
+	}
+	return pb.flush(ctx)
+}
+
+// flush записывает накопленные порции в БД и очищает буфер
+func (pb *portionBuffer) flush(ctx context.Context) error {
+	if len(pb.arr) == 0 {
+		return nil
 	}
+	ctxVW := context.WithValue(ctx, model.KeyContext("data"), pb.arr)
+	err := pb.srv.DBConnector.CopyPortionBinaryData(ctxVW)
+	pb.arr = pb.arr[:0]
+	return err
 }
 
-// wsDownloadBinaryData websocket переноса бинарных данных с клиента на сервер.
-func (srv *Server) wsBinaryData(conn *websocket.Conn) {
+// wsBinaryData websocket переноса бинарных данных с клиента на сервер.
+// Порции принимаются только для файлов пользователя токена и только в пределах размера файла, указанного
+// в записи файла (квоты по размеру проверены при ее сохранении). Порция, которая выходит за размер файла
+// или квоту размера файла, не сохраняется: соединение закрывается с причиной.
+// Порции пишутся в БД пачками по CopyPortions (см. portionBuffer). На закрытие соединения клиентом сервер
+// отвечает после записи оставшихся порций, если записать их не удалось, то с кодом CloseInternalServerErr.
+// Порции сжаты способом encoding, выбранным при открытии соединения
+func (srv *Server) wsBinaryData(conn *websocket.Conn, r *http.Request, encoding string) {
+	conn.SetReadLimit(constants.MaxBodySize)
+	files := map[string]*model.BinaryData{}
+	portions := &portionBuffer{srv: srv}
+
+	conn.SetCloseHandler(func(code int, text string) error {
+		msg := []byte{}
+		if code != websocket.CloseNoStatusReceived {
+			msg = websocket.FormatCloseMessage(code, "")
+		}
+		if err := portions.flush(r.Context()); err != nil {
+			constants.Logger.Ctx(r.Context()).ErrorLog(err)
+			msg = websocket.FormatCloseMessage(websocket.CloseInternalServerErr, errs.Code(err))
+		}
+		err := conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		if err != nil && !errors.Is(err, websocket.ErrCloseSent) {
+			return err
+		}
+		return nil
+	})
+
 	for {
 		_, messageContent, err := conn.ReadMessage()
 		if err != nil {
 			constants.Logger.ErrorLog(err)
+			if err = portions.flush(r.Context()); err != nil {
+				constants.Logger.Ctx(r.Context()).ErrorLog(err)
+			}
 			return
 		}
-		messageContent, err = compression.Decompress(messageContent)
+		srv.Metrics.FileBytes.WithLabelValues(metrics.DirectionUpload).Add(float64(len(messageContent)))
+
+		messageContent, err = compression.Decode(encoding, messageContent, constants.MaxBodySize)
 		if err != nil {
 			constants.Logger.ErrorLog(err)
+			return
 		}
 
 		pbd := model.PortionBinaryData{}
@@ -113,19 +320,49 @@ func (srv *Server) wsBinaryData(conn *websocket.Conn) {
 			return
 		}
 
-		ctx := context.Background()
-		connDB, err := srv.Pool.Acquire(ctx)
-		if err != nil {
-			constants.Logger.ErrorLog(err)
+		if err = srv.checkPortion(r, files, pbd); err != nil {
+			constants.Logger.Ctx(r.Context()).ErrorLog(err)
+			msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, errs.Code(err))
+			if err = conn.WriteMessage(websocket.CloseMessage, msg); err != nil {
+				constants.Logger.Ctx(r.Context()).ErrorLog(err)
+			}
 			return
 		}
-		defer connDB.Release()
 
-		ctxVW := context.WithValue(ctx, model.KeyContext("data"), pbd)
-		if err = srv.DBConnector.InsertPortionBinaryData(ctxVW); err != nil {
+		if err = portions.add(r.Context(), pbd); err != nil {
 			constants.Logger.ErrorLog(err)
 			return
 		}
-		connDB.Release()
 	}
 }
+
+// checkPortion проверяет порцию файла до сохранения в БД: файл принадлежит пользователю токена запроса,
+// размер файла известен, порция не выходит за размер файла и квоту размера файла. files записи файлов, уже найденные в соединении
+func (srv *Server) checkPortion(r *http.Request, files map[string]*model.BinaryData, pbd model.PortionBinaryData) error {
+	bd, ok := files[pbd.Uid]
+	if !ok {
+		records, err := srv.userRecords(r, constants.TypeBinaryData.String())
+		if err != nil {
+			return err
+		}
+		if bd, ok = records[pbd.Uid].(*model.BinaryData); !ok {
+			return fmt.Errorf("%w: file %s", errs.ErrNotFound, pbd.Uid)
+		}
+		files[pbd.Uid] = bd
+	}
+
+	if pbd.Portion < 0 || len(pbd.Body) > encryption.EncryptedLen(constants.Step) {
+		return fmt.Errorf("%w: portion %d of file %s", errs.InvalidFormat, pbd.Portion, pbd.Uid)
+	}
+	size, ok := bd.FileSize()
+	if !ok {
+		return fmt.Errorf("%w: unknown size of file %s", errs.InvalidFormat, pbd.Uid)
+	}
+	if pbd.Portion >= size {
+		return fmt.Errorf("%w: portion %d outside of file %s size %d", errs.InvalidFormat, pbd.Portion, pbd.Uid, size)
+	}
+	if q := srv.quota(); q.FileSize > 0 && pbd.Portion >= q.FileSize {
+		return &errs.QuotaError{Quota: quotaFileSize, Limit: q.FileSize, Used: 0, Requested: pbd.Portion + 1}
+	}
+	return nil
+}
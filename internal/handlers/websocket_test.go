@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"gophkeeper/internal/constants/errs"
+	"gophkeeper/internal/tlsutil"
+)
+
+func TestWsDevice(t *testing.T) {
+	s := &Server{DeviceCA: &tlsutil.CA{}}
+	s.InitRouters()
+
+	ts := httptest.NewServer(s.Router)
+	defer ts.Close()
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/socket"
+
+	t.Run("Checking token without device", func(t *testing.T) {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		if err = conn.WriteMessage(websocket.TextMessage, []byte(sessionToken(t, s, "user"))); err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, _, err = conn.ReadMessage()
+		var ce *websocket.CloseError
+		if !errors.As(err, &ce) || ce.Code != websocket.ClosePolicyViolation || ce.Text != errs.CodeDeviceRequired {
+			t.Errorf("Expected close code %d with %s, got %v", websocket.ClosePolicyViolation, errs.CodeDeviceRequired, err)
+		}
+	})
+}
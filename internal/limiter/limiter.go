@@ -0,0 +1,224 @@
+// Package limiter: ограничение количества неудачных попыток (защита от перебора паролей)
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// Config параметры ограничения попыток.
+// MaxAttempts количество неудачных попыток в окне Window, после которых ключ блокируется.
+// Каждая следующая блокировка в два раза длиннее предыдущей, начиная с Lockout и не более MaxLockout
+type Config struct {
+	MaxAttempts int
+	Window      time.Duration
+	Lockout     time.Duration
+	MaxLockout  time.Duration
+}
+
+// LockoutFunc функция, вызываемая при блокировке ключа. Используется для записи аудита блокировок
+type LockoutFunc func(key string, failures int, until time.Time)
+
+// ReserveRetry время, через которое стоит повторить попытку, если по ключу уже выполняется
+// столько попыток, сколько осталось до блокировки
+const ReserveRetry = time.Second
+
+// entry состояние попыток по одному ключу (пользователь или IP).
+// pending попытки, которые разрешены Reserve и еще не завершены Fail, Success или Done
+type entry struct {
+	failures int
+	first    time.Time
+	lockouts int
+	until    time.Time
+	pending  int
+}
+
+// Limiter хранит состояние неудачных попыток по ключам
+type Limiter struct {
+	sync.Mutex
+	cfg       Config
+	entries   map[string]*entry
+	OnLockout LockoutFunc
+}
+
+// NewLimiter создание ограничителя попыток
+func NewLimiter(cfg Config) *Limiter {
+	return &Limiter{
+		cfg:     cfg,
+		entries: map[string]*entry{},
+	}
+}
+
+// Check проверяет, заблокирован ли ключ. Возвращает оставшееся время блокировки и признак разрешения
+func (l *Limiter) Check(key string) (time.Duration, bool) {
+	l.Lock()
+	defer l.Unlock()
+
+	e, ok := l.entries[key]
+	if !ok {
+		return 0, true
+	}
+
+	retryAfter := time.Until(e.until)
+	if retryAfter > 0 {
+		return retryAfter, false
+	}
+	return 0, true
+}
+
+// Reserve проверяет ключ и резервирует попытку одной операцией: параллельные попытки не проходят проверку,
+// пока не учтены неудачи предыдущих. Попытка разрешается, если ключ не заблокирован и неудачных попыток в окне
+// вместе с незавершенными меньше MaxAttempts. Разрешенная попытка завершается вызовом Fail, Success или Done.
+// Возвращает время, через которое повторить попытку, и признак разрешения
+func (l *Limiter) Reserve(key string) (time.Duration, bool) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.cfg.MaxAttempts <= 0 {
+		return 0, true
+	}
+
+	now := time.Now()
+	e, ok := l.entries[key]
+	if !ok {
+		e = &entry{}
+		l.entries[key] = e
+	}
+	if retryAfter := e.until.Sub(now); retryAfter > 0 {
+		return retryAfter, false
+	}
+	failures := e.failures
+	if now.Sub(e.first) > l.cfg.Window {
+		failures = 0
+	}
+	if failures+e.pending >= l.cfg.MaxAttempts {
+		return ReserveRetry, false
+	}
+	e.pending++
+	return 0, true
+}
+
+// Done завершает попытку, разрешенную Reserve, не изменяя счетчик неудачных попыток
+func (l *Limiter) Done(key string) {
+	l.Lock()
+	defer l.Unlock()
+
+	if e, ok := l.entries[key]; ok {
+		e.done()
+	}
+}
+
+// done завершает одну незавершенную попытку ключа
+func (e *entry) done() {
+	if e.pending > 0 {
+		e.pending--
+	}
+}
+
+// Fail регистрирует неудачную попытку и завершает попытку, разрешенную Reserve. При превышении порога ключ блокируется
+func (l *Limiter) Fail(key string) {
+	l.Lock()
+	e, ok := l.entries[key]
+	if ok {
+		e.done()
+	}
+	if l.cfg.MaxAttempts <= 0 {
+		l.Unlock()
+		return
+	}
+
+	now := time.Now()
+	if !ok {
+		e = &entry{}
+		l.entries[key] = e
+	}
+	if e.failures == 0 || now.Sub(e.first) > l.cfg.Window {
+		e.failures = 0
+		e.first = now
+	}
+	e.failures++
+
+	if e.failures < l.cfg.MaxAttempts {
+		l.Unlock()
+		return
+	}
+
+	lockout := l.cfg.Lockout << e.lockouts
+	if lockout <= 0 || (l.cfg.MaxLockout > 0 && lockout > l.cfg.MaxLockout) {
+		lockout = l.cfg.MaxLockout
+	}
+	e.lockouts++
+	e.until = now.Add(lockout)
+	failures := e.failures
+	e.failures = 0
+	until := e.until
+	l.Unlock()
+
+	if l.OnLockout != nil {
+		l.OnLockout(key, failures, until)
+	}
+}
+
+// SetConfig замена параметров ограничения попыток. Текущие счетчики и блокировки сохраняются
+func (l *Limiter) SetConfig(cfg Config) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.cfg = cfg
+}
+
+// Success сбрасывает счетчик неудачных попыток после успешной попытки и завершает попытку, разрешенную Reserve.
+// Незавершенные параллельные попытки остаются учтенными
+func (l *Limiter) Success(key string) {
+	l.Lock()
+	defer l.Unlock()
+
+	e, ok := l.entries[key]
+	if !ok {
+		return
+	}
+	e.done()
+	if e.pending == 0 {
+		delete(l.entries, key)
+		return
+	}
+	*e = entry{pending: e.pending}
+}
+
+// Release снимает блокировку с ключа. Возвращает признак, был ли ключ заблокирован
+func (l *Limiter) Release(key string) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	e, ok := l.entries[key]
+	if !ok {
+		return false
+	}
+	delete(l.entries, key)
+
+	return time.Until(e.until) > 0
+}
+
+// Clean удаляет устаревшие записи, что бы хранилище не росло бесконечно
+func (l *Limiter) Clean() {
+	l.Lock()
+	defer l.Unlock()
+
+	now := time.Now()
+	for k, e := range l.entries {
+		if e.pending == 0 && now.After(e.until) && now.Sub(e.first) > l.cfg.Window &&
+			(l.cfg.MaxLockout == 0 || now.Sub(e.until) > l.cfg.MaxLockout) {
+			delete(l.entries, k)
+		}
+	}
+}
+
+// KeyLogin ключ ограничения попыток по имени пользователя
+func KeyLogin(name string) string {
+	return "login:" + name
+}
+
+// KeyIP ключ ограничения попыток по IP адресу
+func KeyIP(ip string) string {
+	return "ip:" + ip
+}
@@ -0,0 +1,90 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(Config{
+		MaxAttempts: 3,
+		Window:      time.Minute,
+		Lockout:     time.Minute,
+		MaxLockout:  3 * time.Minute,
+	})
+
+	var lockouts []time.Duration
+	l.OnLockout = func(key string, failures int, until time.Time) {
+		lockouts = append(lockouts, time.Until(until).Round(time.Minute))
+	}
+
+	key := KeyLogin("test")
+
+	t.Run("Checking attempts before lockout", func(t *testing.T) {
+		l.Fail(key)
+		l.Fail(key)
+		if _, ok := l.Check(key); !ok {
+			t.Errorf("Error checking attempts before lockout")
+		}
+	})
+
+	t.Run("Checking lockout", func(t *testing.T) {
+		l.Fail(key)
+		retryAfter, ok := l.Check(key)
+		if ok || retryAfter <= 0 || len(lockouts) != 1 {
+			t.Errorf("Error checking lockout")
+		}
+	})
+
+	t.Run("Checking exponential lockout", func(t *testing.T) {
+		for i := 0; i < 6; i++ {
+			l.Fail(key)
+		}
+		if len(lockouts) != 3 || lockouts[1] != 2*time.Minute || lockouts[2] != 3*time.Minute {
+			t.Errorf("Error checking exponential lockout %v", lockouts)
+		}
+	})
+
+	t.Run("Checking release", func(t *testing.T) {
+		if !l.Release(key) {
+			t.Errorf("Error checking release")
+		}
+		if _, ok := l.Check(key); !ok {
+			t.Errorf("Error checking release")
+		}
+	})
+
+	t.Run("Checking other key", func(t *testing.T) {
+		if _, ok := l.Check(KeyIP("127.0.0.1")); !ok {
+			t.Errorf("Error checking other key")
+		}
+	})
+
+	t.Run("Checking reserve", func(t *testing.T) {
+		key := KeyIP("10.0.0.2")
+		allowed := 0
+		for i := 0; i < 5; i++ {
+			if _, ok := l.Reserve(key); ok {
+				allowed++
+			}
+		}
+		if allowed != 3 {
+			t.Errorf("Expected 3 reserved attempts, got %d", allowed)
+		}
+
+		// одна попытка завершена без неудачи, одна неудачно: одна неудача и одна незавершенная попытка
+		l.Done(key)
+		l.Fail(key)
+		if _, ok := l.Reserve(key); !ok {
+			t.Errorf("Attempt is not reserved under the limit")
+		}
+		if _, ok := l.Reserve(key); ok {
+			t.Errorf("Attempt is reserved over failures and pending attempts")
+		}
+		l.Success(key)
+		if _, ok := l.Reserve(key); !ok {
+			t.Errorf("Attempt is not reserved after success")
+		}
+	})
+
+}
@@ -2,14 +2,89 @@
 package logger
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
 	"github.com/rs/zerolog"
 )
 
+// Форматы вывода лога
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
 // Logger структура для обертки логирования на базе библиотеки zerolog.
 type Logger struct {
 	Log zerolog.Logger
 }
 
+// New создание логера. level уровень (debug, info, warn, error), format формат вывода (json или console),
+// file файл лога, пустой файл означает stderr. Все, что пишет логер, проходит через слой скрытия секретов.
+// Уровень задается глобально (см. SetLevel), что бы его можно было менять без пересоздания логера
+func New(level, format, file string) (Logger, io.Closer, error) {
+	lvl, err := parseLevel(level)
+	if err != nil {
+		return Logger{}, nil, err
+	}
+
+	var out io.Writer = os.Stderr
+	var closer io.Closer = nopCloser{}
+	if file != "" {
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return Logger{}, nil, err
+		}
+		out, closer = f, f
+	}
+
+	switch strings.ToLower(format) {
+	case "", FormatJSON:
+	case FormatConsole:
+		out = zerolog.ConsoleWriter{Out: out, NoColor: file != ""}
+	default:
+		_ = closer.Close()
+		return Logger{}, nil, fmt.Errorf("log format %q: must be %s or %s", format, FormatJSON, FormatConsole)
+	}
+
+	zerolog.SetGlobalLevel(lvl)
+	log := zerolog.New(RedactWriter(out)).With().Timestamp().Logger()
+	return Logger{Log: log}, closer, nil
+}
+
+// SetLevel смена уровня лога (debug, info, warn, error) во время работы
+func SetLevel(level string) error {
+	lvl, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+	zerolog.SetGlobalLevel(lvl)
+	return nil
+}
+
+// parseLevel разбор уровня лога, пустой уровень означает info
+func parseLevel(level string) (zerolog.Level, error) {
+	if level == "" {
+		return zerolog.InfoLevel, nil
+	}
+	lvl, err := zerolog.ParseLevel(strings.ToLower(level))
+	if err != nil {
+		return lvl, fmt.Errorf("log level %q: %w", level, err)
+	}
+	return lvl, nil
+}
+
+// nopCloser закрытие вывода лога, который не нужно закрывать (stderr)
+type nopCloser struct{}
+
+// Close ничего не делает
+func (nopCloser) Close() error {
+	return nil
+}
+
 // ErrorLog логироание уровня ошибка
 func (l *Logger) ErrorLog(err error) {
 	l.Log.Error().Err(err).Msg("")
@@ -19,3 +94,30 @@ func (l *Logger) ErrorLog(err error) {
 func (l *Logger) InfoLog(infoString string) {
 	l.Log.Info().Msgf("%+v\n", infoString)
 }
+
+// With логер с дополнительными полями fields (ключ, значение, ключ, значение...)
+func (l *Logger) With(fields ...string) *Logger {
+	c := l.Log.With()
+	for i := 0; i+1 < len(fields); i += 2 {
+		c = c.Str(fields[i], fields[i+1])
+	}
+	return &Logger{Log: c.Logger()}
+}
+
+// ctxKey ключ контекста с логером запроса
+type ctxKey struct{}
+
+// WithContext контекст с логером запроса
+func WithContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// Ctx логер запроса из контекста. Если в контексте логера нет, то возвращает l
+func (l *Logger) Ctx(ctx context.Context) *Logger {
+	if ctx != nil {
+		if cl, ok := ctx.Value(ctxKey{}).(*Logger); ok {
+			return cl
+		}
+	}
+	return l
+}
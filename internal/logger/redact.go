@@ -0,0 +1,68 @@
+package logger
+
+import (
+	"io"
+	"regexp"
+	"unicode"
+)
+
+// Redacted значение, которым заменяются секреты в логе
+const Redacted = "[REDACTED]"
+
+// redactKeys поля, значения которых никогда не попадают в лог: пароли, токены, зашифрованные данные
+var redactKeys = regexp.MustCompile(`"(?i:password|new_password|hash_password|token|authorization|cookie|text|cvc|patch|number|body|csr|key|secret)"\s*:\s*"(?:[^"\\]|\\.)*"`)
+
+// redactJWT токены JWT в тексте сообщений и ошибок
+var redactJWT = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*\.[A-Za-z0-9_-]*`)
+
+// redactCipher кандидаты в зашифрованные данные: длинные строки base64. Скрываются, только если в строке
+// есть буквы в обоих регистрах и цифры, что бы не скрывать УИДы и хеши в шестнадцатеричном виде
+var redactCipher = regexp.MustCompile(`[A-Za-z0-9+/_-]{24,}={0,2}`)
+
+// redactWriter вывод лога со скрытием секретов
+type redactWriter struct {
+	out io.Writer
+}
+
+// RedactWriter вывод лога, который скрывает секреты перед записью в out.
+// Ожидает, что каждый вызов Write это одна запись лога в формате JSON
+func RedactWriter(out io.Writer) io.Writer {
+	return redactWriter{out: out}
+}
+
+// Write запись строки лога со скрытыми секретами. Возвращает длину исходной строки
+func (rw redactWriter) Write(p []byte) (int, error) {
+	if _, err := rw.out.Write(Redact(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Redact скрывает секреты в строке лога
+func Redact(p []byte) []byte {
+	p = redactKeys.ReplaceAllFunc(p, func(m []byte) []byte {
+		i := 0
+		for i < len(m) && m[i] != ':' {
+			i++
+		}
+		return append(append([]byte{}, m[:i+1]...), `"`+Redacted+`"`...)
+	})
+	p = redactJWT.ReplaceAll(p, []byte(Redacted))
+	return redactCipher.ReplaceAllFunc(p, func(m []byte) []byte {
+		if mixed(m) {
+			return []byte(Redacted)
+		}
+		return m
+	})
+}
+
+// mixed проверяет, что в строке есть заглавные и строчные буквы и цифры
+func mixed(m []byte) bool {
+	var upper, lower, digit bool
+	for _, c := range string(m) {
+		upper = upper || unicode.IsUpper(c)
+		lower = lower || unicode.IsLower(c)
+		digit = digit || unicode.IsDigit(c)
+	}
+	return upper && lower && digit
+}
@@ -0,0 +1,124 @@
+// Package metrics: метрики сервера в формате Prometheus
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace префикс имен метрик
+const namespace = "gophkeeper"
+
+// Направления передачи файлов
+const (
+	DirectionUpload   = "upload"
+	DirectionDownload = "download"
+)
+
+// Metrics метрики сервера. У каждого сервера свой реестр, что бы метрики не пересекались
+// при нескольких серверах в одном процессе (например, в тестах)
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	HTTPDuration  *prometheus.HistogramVec
+	WebSockets    *prometheus.GaugeVec
+	FlushDuration prometheus.Histogram
+	FlushErrors   prometheus.Counter
+	FileBytes     *prometheus.CounterVec
+}
+
+// New создание метрик сервера и их регистрация в новом реестре.
+// Дополнительно регистрируются метрики процесса и среды Go
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		HTTPDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of HTTP requests by route, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "code"}),
+		WebSockets: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "websocket_connections",
+			Help:      "Open websocket connections by socket.",
+		}, []string{"socket"}),
+		FlushDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "staging_flush_duration_seconds",
+			Help:      "Duration of flushing the staging buffer to the database.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		FlushErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "staging_flush_errors_total",
+			Help:      "Records that failed to flush from the staging buffer to the database.",
+		}),
+		FileBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "file_transfer_bytes_total",
+			Help:      "Bytes of file portions transferred through the file sockets by direction.",
+		}, []string{"direction"}),
+	}
+
+	m.Registry.MustRegister(
+		m.HTTPDuration, m.WebSockets, m.FlushDuration, m.FlushErrors, m.FileBytes,
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewGoCollector(),
+	)
+	return m
+}
+
+// Handler хендлер выдачи метрик в текстовом формате Prometheus
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+// Middleware middleware замера длительности HTTP запросов по шаблону маршрута.
+// Запросы открытия websocket не замеряются: их длительность равна времени жизни соединения
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if websocket.IsWebSocketUpgrade(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route := "unknown"
+		if cr := mux.CurrentRoute(r); cr != nil {
+			if tpl, err := cr.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		m.HTTPDuration.WithLabelValues(route, r.Method, strconv.Itoa(sw.status)).Observe(time.Since(start).Seconds())
+	})
+}
+
+// WebSocket учитывает открытое соединение socket. Возвращает функцию, которую нужно вызвать при закрытии
+func (m *Metrics) WebSocket(socket string) func() {
+	g := m.WebSockets.WithLabelValues(socket)
+	g.Inc()
+	return g.Dec
+}
+
+// statusWriter запоминает HTTP статус ответа
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader запоминает статус и передает его дальше
+func (sw *statusWriter) WriteHeader(status int) {
+	sw.status = status
+	sw.ResponseWriter.WriteHeader(status)
+}
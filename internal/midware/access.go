@@ -0,0 +1,91 @@
+package midware
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/constants/errs"
+	"gophkeeper/internal/logger"
+	"gophkeeper/internal/token"
+)
+
+// accessWriter запоминает HTTP статус и размер ответа для журнала запросов
+type accessWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+// WriteHeader запоминает статус и передает его дальше
+func (aw *accessWriter) WriteHeader(status int) {
+	aw.status = status
+	aw.ResponseWriter.WriteHeader(status)
+}
+
+// Write учитывает размер ответа
+func (aw *accessWriter) Write(b []byte) (int, error) {
+	n, err := aw.ResponseWriter.Write(b)
+	aw.size += n
+	return n, err
+}
+
+// Hijack передает соединение дальше для websocket
+func (aw *accessWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := aw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijack is not supported")
+	}
+	aw.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+// AccessLog middleware журнала запросов. Создает логер запроса с идентификатором запроса, методом,
+// адресом и IP клиента (и идентификатором трассировки, если он есть) и кладет его в контекст запроса для хендлеров и БД.
+// После ответа пишет в лог пользователя, маршрут, статус, размер ответа и длительность.
+// Тело запроса, хедеры и параметры адреса в лог не пишутся
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		fields := []string{
+			"request_id", r.Header.Get(errs.HeaderRequestID),
+			"method", r.Method,
+			"path", r.URL.Path,
+			"ip", RemoteIP(r),
+		}
+		if traceID := w.Header().Get(errs.HeaderTraceID); traceID != "" {
+			fields = append(fields, "trace_id", traceID)
+		}
+		l := constants.Logger.With(fields...)
+		r = r.WithContext(logger.WithContext(r.Context(), l))
+
+		aw := &accessWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(aw, r)
+
+		route := ""
+		if cr := mux.CurrentRoute(r); cr != nil {
+			route, _ = cr.GetPathTemplate()
+		}
+		user := ""
+		if claims, ok := token.ExtractClaims(r.Header.Get(constants.HeaderAuthorization)); ok {
+			user, _ = claims["user"].(string)
+		}
+
+		ev := l.Log.Info()
+		if aw.status >= http.StatusInternalServerError {
+			ev = l.Log.Error()
+		}
+		ev.Str("user", user).
+			Str("route", route).
+			Int("status", aw.status).
+			Int("size", aw.size).
+			Dur("latency", time.Since(start)).
+			Msg("request")
+	})
+}
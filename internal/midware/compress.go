@@ -0,0 +1,155 @@
+package midware
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+
+	"gophkeeper/internal/compression"
+	"gophkeeper/internal/constants"
+)
+
+// minCompressSize размер ответа, меньше которого ответ не сжимается: сжатие не окупает заголовков формата
+const minCompressSize = 1024
+
+// Compress middleware сжатия ответов способом, который выбран по Accept-Encoding клиента (zstd или gzip).
+// Ответ сжимается потоком, пока он пишется. Не сжимаются ответы меньше minCompressSize, ответы без тела
+// и ответы, которые хендлер сжал сам (задан Content-Encoding). Открытие websocket не обрабатывается.
+// В каждом ответе сервер сообщает хедером Accept-Encoding, какими способами можно сжимать тела запросов
+func Compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if websocket.IsWebSocketUpgrade(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Accept-Encoding", compression.AcceptEncoding)
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := compression.Negotiate(r.Header.Get("Accept-Encoding"), compression.Zstd, compression.Gzip)
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding, status: http.StatusOK}
+		defer func() {
+			if err := cw.Close(); err != nil {
+				constants.Logger.Ctx(r.Context()).ErrorLog(err)
+			}
+		}()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressWriter ответ, который сжимается после первых minCompressSize байт. До этого тело копится в buf,
+// а статус запоминается, что бы успеть заменить хедеры ответа. plain - решено отдавать ответ без сжатия
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	status   int
+	buf      []byte
+	writer   io.WriteCloser
+	plain    bool
+}
+
+// WriteHeader запоминает статус. Ответы без тела и уже сжатые ответы отдаются без сжатия сразу
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.writer != nil || cw.plain {
+		return
+	}
+	cw.status = status
+	if !bodyAllowed(status) || cw.Header().Get("Content-Encoding") != "" {
+		cw.passThrough()
+	}
+}
+
+// Write пишет тело ответа: копит его до minCompressSize, затем сжимает
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.plain {
+		return cw.ResponseWriter.Write(p)
+	}
+	if cw.writer != nil {
+		return cw.writer.Write(p)
+	}
+	if cw.Header().Get("Content-Encoding") != "" {
+		cw.passThrough()
+		return cw.ResponseWriter.Write(p)
+	}
+
+	cw.buf = append(cw.buf, p...)
+	if len(cw.buf) < minCompressSize {
+		return len(p), nil
+	}
+	if err := cw.startCompression(); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush отправляет клиенту накопленную часть ответа. Ответ, который еще копится, отдается без сжатия
+func (cw *compressWriter) Flush() {
+	if cw.writer == nil && !cw.plain {
+		cw.passThrough()
+	}
+	if f, ok := cw.writer.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			constants.Logger.ErrorLog(err)
+		}
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close завершает ответ: небольшой ответ отдается без сжатия, сжатый дописывается
+func (cw *compressWriter) Close() error {
+	if cw.writer != nil {
+		return cw.writer.Close()
+	}
+	if !cw.plain {
+		cw.passThrough()
+	}
+	return nil
+}
+
+// startCompression отправляет хедеры сжатого ответа и накопленное тело через упаковщик
+func (cw *compressWriter) startCompression() error {
+	writer, err := compression.NewWriter(cw.encoding, cw.ResponseWriter)
+	if err != nil {
+		cw.passThrough()
+		return err
+	}
+	cw.writer = writer
+
+	h := cw.Header()
+	if h.Get("Content-Type") == "" {
+		// иначе тип определится по сжатым данным
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	h.Set("Content-Encoding", cw.encoding)
+	h.Del("Content-Length")
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	_, err = cw.writer.Write(buf)
+	return err
+}
+
+// passThrough отправляет ответ без сжатия: статус и накопленное тело
+func (cw *compressWriter) passThrough() {
+	cw.plain = true
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if len(cw.buf) > 0 {
+		if _, err := cw.ResponseWriter.Write(cw.buf); err != nil {
+			constants.Logger.ErrorLog(err)
+		}
+		cw.buf = nil
+	}
+}
+
+// bodyAllowed признак, что ответ со статусом status может иметь тело
+func bodyAllowed(status int) bool {
+	return status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified
+}
@@ -0,0 +1,47 @@
+package midware
+
+import (
+	"net/http"
+
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/constants/errs"
+	"gophkeeper/internal/tlsutil"
+	tkn "gophkeeper/internal/token"
+)
+
+// DeviceCertificate возвращает имя пользователя и УИД устройства из сертификата устройства.
+// Учитывается только сертификат, проверенный удостоверяющим центром сервера при рукопожатии TLS
+func DeviceCertificate(r *http.Request) (string, string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", "", false
+	}
+	user, device := tlsutil.DeviceFromCert(r.TLS.VerifiedChains[0][0])
+	return user, device, device != ""
+}
+
+// IsDevice middleware проверки сертификата устройства, второй фактор после токена.
+// Сертификат должен быть выдан тому же пользователю, что и токен, УИД устройства сертификата
+// должен совпадать с устройством токена, а устройство не должно быть отозвано
+func IsDevice(revoked func(device string) bool, endpoint func(http.ResponseWriter, *http.Request)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		user, device, ok := DeviceCertificate(r)
+		if !ok || revoked(device) {
+			DeviceNotAuthorized(w)
+			return
+		}
+
+		tokenStr := r.Header.Get(constants.HeaderAuthorization)
+		claims, ok := tkn.ExtractClaims(tokenStr)
+		if !ok || claims["user"] != user || tkn.DeviceFromToken(tokenStr) != device {
+			DeviceNotAuthorized(w)
+			return
+		}
+		endpoint(w, r)
+	})
+}
+
+// DeviceNotAuthorized действие если сертификат устройства не предъявлен или не подходит к токену
+func DeviceNotAuthorized(w http.ResponseWriter) {
+	errs.WriteError(w, errs.ErrDeviceRequired)
+}
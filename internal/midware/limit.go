@@ -0,0 +1,116 @@
+package midware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+
+	"gophkeeper/internal/compression"
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/constants/errs"
+	"gophkeeper/internal/limiter"
+)
+
+// statusRecorder обертка над http.ResponseWriter, запоминающая HTTP статус ответа
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader запоминает статус и передает его дальше
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+// RateLimit middleware ограничения неудачных попыток по IP адресу и имени пользователя.
+// Неудачной попыткой считается ответ 401 или 409, успешный ответ сбрасывает только счетчик имени пользователя.
+// Попытка резервируется до вызова хендлера (см. limiter.Reserve), поэтому параллельные запросы не получают
+// больше попыток, чем разрешено. Если ключ заблокирован, то возвращается 429 с заголовком Retry-After.
+// Может использоваться для любого маршрута
+func RateLimit(l *limiter.Limiter, endpoint http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		keys := []string{limiter.KeyIP(RemoteIP(r))}
+		if name := loginFromBody(r); name != "" {
+			keys = append(keys, limiter.KeyLogin(name))
+		}
+
+		for i, k := range keys {
+			if retryAfter, ok := l.Reserve(k); !ok {
+				for _, reserved := range keys[:i] {
+					l.Done(reserved)
+				}
+				w.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(retryAfter.Seconds()))))
+				errs.WriteError(w, errs.ErrTooManyRequests)
+				return
+			}
+		}
+
+		sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		served := false
+		defer func() {
+			// резерв снимается и при панике хендлера, иначе попытка осталась бы незавершенной
+			switch {
+			case served && (sr.status == http.StatusUnauthorized || sr.status == http.StatusForbidden ||
+				sr.status == http.StatusConflict):
+				for _, k := range keys {
+					l.Fail(k)
+				}
+			case served && sr.status == http.StatusOK:
+				// успешный вход сбрасывает только счетчик имени пользователя: иначе с одного IP можно перебирать
+				// пароли чужих учетных записей, чередуя их со входом в свою
+				l.Done(keys[0])
+				if len(keys) > 1 {
+					l.Success(keys[1])
+				}
+			default:
+				for _, k := range keys {
+					l.Done(k)
+				}
+			}
+		}()
+		endpoint.ServeHTTP(sr, r)
+		served = true
+	})
+}
+
+// RemoteIP возвращает IP адрес клиента без порта
+func RemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// loginFromBody получает имя пользователя из тела запроса, не изменяя тело для следующего хендлера
+func loginFromBody(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+		return ""
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	if body, err = compression.Decode(r.Header.Get("Content-Encoding"), body, constants.MaxBodySize); err != nil {
+		return ""
+	}
+
+	user := struct {
+		Name string `json:"login"`
+	}{}
+	if err = json.Unmarshal(body, &user); err != nil {
+		return ""
+	}
+
+	return user.Name
+}
@@ -0,0 +1,94 @@
+package midware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gophkeeper/internal/limiter"
+)
+
+func TestRateLimit(t *testing.T) {
+	l := limiter.NewLimiter(limiter.Config{
+		MaxAttempts: 2,
+		Window:      time.Minute,
+		Lockout:     time.Minute,
+		MaxLockout:  time.Minute,
+	})
+	h := RateLimit(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Password") != "valid" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+
+	login := func(name, password string) int {
+		req := httptest.NewRequest("POST", "/api/user/login", strings.NewReader(`{"login":"`+name+`"}`))
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Password", password)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	t.Run("Checking success does not reset IP", func(t *testing.T) {
+		login("victim", "wrong")
+		if code := login("attacker", "valid"); code != http.StatusOK {
+			t.Fatalf("Expected %d, got %d", http.StatusOK, code)
+		}
+		login("other", "wrong")
+		if _, ok := l.Check(limiter.KeyIP("10.0.0.1")); ok {
+			t.Error("IP is not locked after failures around a successful login")
+		}
+	})
+
+	t.Run("Checking success resets login", func(t *testing.T) {
+		l.Release(limiter.KeyIP("10.0.0.1"))
+		login("user", "wrong")
+		login("user", "valid")
+		login("user", "wrong")
+		if _, ok := l.Check(limiter.KeyLogin("user")); !ok {
+			t.Error("Login is locked after a successful login")
+		}
+	})
+
+	t.Run("Checking parallel attempts", func(t *testing.T) {
+		burst := limiter.NewLimiter(limiter.Config{MaxAttempts: 2, Window: time.Minute, Lockout: time.Minute})
+		gate := make(chan struct{})
+		var served int32
+		h := RateLimit(burst, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&served, 1)
+			<-gate
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+
+		var wg sync.WaitGroup
+		var rejected int32
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				req := httptest.NewRequest("POST", "/api/user/login", strings.NewReader(`{"login":"user"}`))
+				req.RemoteAddr = "10.0.0.3:1234"
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, req)
+				if w.Code == http.StatusTooManyRequests {
+					atomic.AddInt32(&rejected, 1)
+				}
+			}()
+		}
+		for deadline := time.Now().Add(time.Second); atomic.LoadInt32(&rejected) < 3 && time.Now().Before(deadline); {
+			time.Sleep(time.Millisecond)
+		}
+		close(gate)
+		wg.Wait()
+
+		if served != 2 {
+			t.Errorf("Expected 2 attempts to reach the handler, got %d", served)
+		}
+	})
+
+}
@@ -2,12 +2,13 @@
 package midware
 
 import (
-	"errors"
+	"fmt"
 	"net/http"
 
-	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
 
-	"gophkeeper/internal/constants"
+	"gophkeeper/internal/constants/errs"
+	tkn "gophkeeper/internal/token"
 )
 
 // IsAuthorized middleware проверки пользователя по токену.
@@ -28,15 +29,9 @@ func IsAuthorized(endpoint func(http.ResponseWriter, *http.Request)) http.Handle
 
 // TokenFindMatches проверки пользователя по токену.
 func TokenFindMatches(endpoint func(http.ResponseWriter, *http.Request), w http.ResponseWriter, r *http.Request) {
-	token, err := jwt.Parse(r.Header["Authorization"][0], func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("there was an error")
-		}
-		return constants.HashKey, nil
-	})
+	token, err := tkn.Parse(r.Header["Authorization"][0])
 	if err != nil {
-		w.WriteHeader(http.StatusForbidden)
-		w.Header().Add("Content-Type", "application/json")
+		errs.WriteError(w, fmt.Errorf("%w: %s", errs.ErrUnauthorized, err.Error()))
 		return
 	}
 
@@ -47,9 +42,45 @@ func TokenFindMatches(endpoint func(http.ResponseWriter, *http.Request), w http.
 
 // TokenNotFound действие если токен не валиден
 func TokenNotFound(w http.ResponseWriter) {
-	w.WriteHeader(http.StatusUnauthorized)
-	_, err := w.Write([]byte("Not Authorized"))
-	if err != nil {
-		constants.Logger.ErrorLog(err)
+	errs.WriteError(w, errs.ErrUnauthorized)
+}
+
+// RequestID middleware идентификатора запроса. Идентификатор берется из хедера X-Request-ID клиента
+// или создается, передается дальше в хедере запроса и возвращается в хедере ответа
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(errs.HeaderRequestID)
+		if !validRequestID(id) {
+			id = uuid.New().String()
+			r.Header.Set(errs.HeaderRequestID, id)
+		}
+		w.Header().Set(errs.HeaderRequestID, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validRequestID проверяет идентификатор запроса клиента: не длиннее 128 символов, только видимые ASCII символы
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// MaxBytes middleware ограничения размера тела запроса. При чтении тела больше limit байт
+// возвращается ошибка *http.MaxBytesError
+func MaxBytes(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, limit)
+			}
+			next.ServeHTTP(w, r)
+		})
 	}
 }
@@ -4,30 +4,62 @@ package postgresql
 import (
 	"context"
 	"errors"
+	"gophkeeper/internal/auditchain"
 	"gophkeeper/internal/constants"
 	"gophkeeper/internal/constants/errs"
 	"gophkeeper/internal/cryptography"
 	"gophkeeper/internal/postgresql/model"
+	"gophkeeper/internal/token"
+	"gophkeeper/internal/tracing"
+	"sort"
+	"time"
 
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 
 	"gophkeeper/internal/environment"
 )
 
+// portionsCopyTable временная таблица и колонки порций файлов для записи командой COPY
+var (
+	portionsCopyTable    = pgx.Identifier{"PortionsCopy"}
+	portionsFilesColumns = []string{"UID", "Portion", "Body"}
+)
+
 type DBConnector struct {
 	Pool *pgxpool.Pool
 	Cfg  *environment.DBConfig
 }
 
-// NewDBConnector создание конекта с базой и установка свойств конфигурации БД
+// NewDBConnector создание конекта с базой и установка свойств конфигурации БД.
+// Запросы к БД внутри трассировки записываются в нее отдельными span
 func NewDBConnector(dbCfg *environment.DBConfig) (*DBConnector, error) {
 
 	if dbCfg.DatabaseDsn == "" {
 		return nil, errors.New("пустой путь к базе")
 	}
 
+	poolCfg, err := pgxpool.ParseConfig(dbCfg.DatabaseDsn)
+	if err != nil {
+		return nil, err
+	}
+	poolCfg.ConnConfig.Logger = tracing.QueryLogger{}
+	poolCfg.ConnConfig.LogLevel = pgx.LogLevelInfo
+	if dbCfg.MaxConns > 0 {
+		poolCfg.MaxConns = dbCfg.MaxConns
+	}
+	if dbCfg.MinConns > 0 {
+		poolCfg.MinConns = dbCfg.MinConns
+	}
+	if dbCfg.MaxConnLifetime > 0 {
+		poolCfg.MaxConnLifetime = dbCfg.MaxConnLifetime
+	}
+	if dbCfg.MaxConnIdleTime > 0 {
+		poolCfg.MaxConnIdleTime = dbCfg.MaxConnIdleTime
+	}
+
 	ctx, cancelFunc := context.WithCancel(context.Background())
-	pool, err := pgxpool.Connect(ctx, dbCfg.DatabaseDsn)
+	pool, err := pgxpool.ConnectConfig(ctx, poolCfg)
 	if err != nil {
 		cancelFunc = nil
 		return nil, err
@@ -42,12 +74,23 @@ func NewDBConnector(dbCfg *environment.DBConfig) (*DBConnector, error) {
 	return &dbc, nil
 }
 
+// queryContext контекст запроса к БД: контекст вызова с ограничением времени Cfg.QueryTimeout.
+// Без ограничения времени в конфигурации запрос ограничен только контекстом вызова
+func (dbc *DBConnector) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if dbc.Cfg == nil || dbc.Cfg.QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, dbc.Cfg.QueryTimeout)
+}
+
 // NewAccount метод для создания нового экаунта из ДБ конектора
 // вызывает методы объекта user.
 // Проверяет есть ли такой пользователь.
 // Если нет, то создает
-func (dbc *DBConnector) NewAccount(user *model.User) error {
-	ctx := context.Background()
+func (dbc *DBConnector) NewAccount(ctx context.Context, user *model.User) error {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
 	conn, err := dbc.Pool.Acquire(ctx)
 	if err != nil {
 		return errs.ErrErrorServer
@@ -75,9 +118,10 @@ func (dbc *DBConnector) NewAccount(user *model.User) error {
 }
 
 // CheckAccount проверяет, существует ли пользователь в базе данных
-func (dbc *DBConnector) CheckAccount(user *model.User) error {
+func (dbc *DBConnector) CheckAccount(ctx context.Context, user *model.User) error {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
 
-	ctx := context.Background()
 	conn, err := dbc.Pool.Acquire(ctx)
 	if err != nil {
 		return errs.ErrErrorServer
@@ -102,9 +146,48 @@ func (dbc *DBConnector) CheckAccount(user *model.User) error {
 
 /////////////////////////////////////
 
-// DelAccount удаляет пользователя по имени и хешированному паролю
-func (dbc *DBConnector) DelAccount(user *model.User) error {
-	ctx := context.Background()
+// ChangePassword меняет пароль пользователя.
+// Перед сменой пользователь повторно проверяется по имени и текущему паролю
+func (dbc *DBConnector) ChangePassword(ctx context.Context, user *model.User) error {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	if user.NewPassword == "" {
+		return errs.InvalidFormat
+	}
+
+	if err := dbc.CheckAccount(ctx, user); err != nil {
+		return err
+	}
+
+	conn, err := dbc.Pool.Acquire(ctx)
+	if err != nil {
+		return errs.ErrErrorServer
+	}
+	defer conn.Release()
+
+	user.HashPassword = cryptography.HashSHA256(user.NewPassword, dbc.Cfg.Key)
+	ctxVW := context.WithValue(ctx, model.KeyContext("data"), user)
+	pc := PgxpoolConn{conn}
+
+	if err = pc.Update(ctxVW); err != nil {
+		return errs.ErrErrorServer
+	}
+
+	return nil
+}
+
+// DelAccount удаляет пользователя по имени и хешированному паролю.
+// Вместе с пользователем в одной транзакции удаляются все его данные, порции файлов и сессии,
+// устройства пользователя отзываются
+func (dbc *DBConnector) DelAccount(ctx context.Context, user *model.User) error {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	if err := dbc.CheckAccount(ctx, user); err != nil {
+		return err
+	}
+
 	conn, err := dbc.Pool.Acquire(ctx)
 	if err != nil {
 		return errs.ErrErrorServer
@@ -122,8 +205,88 @@ func (dbc *DBConnector) DelAccount(user *model.User) error {
 	return nil
 }
 
+// ExportAccount выбирает все записи пользователя. Порции файлов не выбираются, их читает ExportPortions.
+// Пользователь (токен) передается в контексте по ключу "user"
+func (dbc *DBConnector) ExportAccount(ctx context.Context) (*model.UserExport, error) {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	claims, ok := token.ExtractClaims(ctx.Value(model.KeyContext("user")).(string))
+	if !ok {
+		return nil, errs.ErrInvalidLoginPassword
+	}
+
+	ue := model.UserExport{
+		User: claims["user"].(string),
+		Date: time.Now(),
+	}
+
+	arrType := []string{constants.TypePairLoginPassword.String(), constants.TypeTextData.String(),
+		constants.TypeBinaryData.String(), constants.TypeBankCardData.String()}
+
+	for _, t := range arrType {
+		arr, err := dbc.Select(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range arr {
+			ue.SetValue(v)
+		}
+	}
+
+	return &ue, nil
+}
+
+// ExportPortions передает fn порции файла uid по возрастанию смещения. Порции читаются отдельными запросами
+// по constants.ExportPortions, поэтому файл не загружается в память целиком
+func (dbc *DBConnector) ExportPortions(ctx context.Context, uid string, fn func(model.PortionBinaryData) error) error {
+	after := int64(-1)
+	for {
+		arrPbd, err := dbc.selectPortionsPage(ctx, uid, after)
+		if err != nil {
+			return err
+		}
+		for _, pbd := range arrPbd {
+			if err = fn(pbd); err != nil {
+				return err
+			}
+		}
+		if len(arrPbd) < constants.ExportPortions {
+			return nil
+		}
+		after = arrPbd[len(arrPbd)-1].Portion
+	}
+}
+
+// selectPortionsPage выбирает не больше constants.ExportPortions порций файла uid со смещением больше after
+func (dbc *DBConnector) selectPortionsPage(ctx context.Context, uid string, after int64) ([]model.PortionBinaryData, error) {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	rows, err := dbc.Pool.Query(ctx, constants.QuerySelectPortionsPage, uid, after, constants.ExportPortions)
+	if err != nil {
+		return nil, errs.ErrErrorServer
+	}
+	defer rows.Close()
+
+	arrPbd := make([]model.PortionBinaryData, 0, constants.ExportPortions)
+	for rows.Next() {
+		var pbd model.PortionBinaryData
+		if err = rows.Scan(&pbd.Uid, &pbd.Portion, &pbd.Body); err != nil {
+			return nil, errs.ErrErrorServer
+		}
+		arrPbd = append(arrPbd, pbd)
+	}
+	if rows.Err() != nil {
+		return nil, errs.ErrErrorServer
+	}
+	return arrPbd, nil
+}
+
 // Select выбирает объекты из базы данных
 func (dbc *DBConnector) Select(ctx context.Context, t string) (model.Appender, error) {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
 
 	user := ctx.Value(model.KeyContext("user"))
 	conn, err := dbc.Pool.Acquire(ctx)
@@ -151,8 +314,10 @@ func (dbc *DBConnector) Select(ctx context.Context, t string) (model.Appender, e
 }
 
 // Update добавляет/обновляет объекты базы данных
-func (dbc *DBConnector) Update(u model.Updater) error {
-	ctx := context.Background()
+func (dbc *DBConnector) Update(ctx context.Context, u model.Updater) error {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
 	conn, err := dbc.Pool.Acquire(ctx)
 	if err != nil {
 		return errs.ErrErrorServer
@@ -183,8 +348,10 @@ func (dbc *DBConnector) Update(u model.Updater) error {
 }
 
 // Delete удаляет объекты из базы данных
-func (dbc *DBConnector) Delete(u model.Updater) error {
-	ctx := context.Background()
+func (dbc *DBConnector) Delete(ctx context.Context, u model.Updater) error {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
 	conn, err := dbc.Pool.Acquire(ctx)
 	if err != nil {
 		return errs.ErrErrorServer
@@ -203,8 +370,189 @@ func (dbc *DBConnector) Delete(u model.Updater) error {
 
 /////////////////////////////////////
 
+// ApplyBatch применяет изменения данных пользователя в одной транзакции.
+// Изменения передаются в контексте по ключу "data" ([]model.Updater), удаление по событию EventDel.
+// Если изменение не применилось, то транзакция откатывается и возвращается индекс этого изменения
+func (dbc *DBConnector) ApplyBatch(ctx context.Context) (int, error) {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	arrUpdater := ctx.Value(model.KeyContext("data")).([]model.Updater)
+
+	conn, err := dbc.Pool.Acquire(ctx)
+	if err != nil {
+		return -1, errs.ErrErrorServer
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return -1, errs.ErrErrorServer
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	for _, name := range updaterUsers(arrUpdater) {
+		if _, err = tx.Exec(ctx, constants.QueryLockUser, name); err != nil {
+			return -1, errs.ErrErrorServer
+		}
+	}
+	for i, u := range arrUpdater {
+		if err = applyUpdater(ctx, tx, u); err != nil {
+			return i, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		constants.Logger.Ctx(ctx).ErrorLog(err)
+		return -1, errs.ErrErrorServer
+	}
+	return -1, nil
+}
+
+// SaveBatch сохраняет объекты хранилища сервера в одной транзакции одним обращением к БД (pgx.Batch).
+// Объекты передаются в контексте по ключу "data" ([]model.Updater) и группируются по типу,
+// удаление по событию EventDel, иначе добавление/обновление одним запросом (INSERT ... ON CONFLICT).
+// Данные пользователей объектов блокируются до конца транзакции (см. QueryLockUser), поэтому несколько экземпляров
+// сервера могут сохранять свои хранилища одновременно. Если не сохранился хотя бы один объект, то транзакция откатывается
+func (dbc *DBConnector) SaveBatch(ctx context.Context) error {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	arrUpdater := append([]model.Updater(nil), ctx.Value(model.KeyContext("data")).([]model.Updater)...)
+	sort.SliceStable(arrUpdater, func(i, j int) bool {
+		return arrUpdater[i].GetType() < arrUpdater[j].GetType()
+	})
+
+	batch := &pgx.Batch{}
+	for _, name := range updaterUsers(arrUpdater) {
+		batch.Queue(constants.QueryLockUser, name)
+	}
+	for _, u := range arrUpdater {
+		if err := queueUpdater(batch, u); err != nil {
+			return err
+		}
+	}
+
+	tx, err := dbc.Pool.Begin(ctx)
+	if err != nil {
+		return errs.ErrErrorServer
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	br := tx.SendBatch(ctx, batch)
+	for i := 0; i < batch.Len(); i++ {
+		if _, err = br.Exec(); err != nil {
+			_ = br.Close()
+			constants.Logger.Ctx(ctx).ErrorLog(err)
+			return errs.InvalidFormat
+		}
+	}
+	if err = br.Close(); err != nil {
+		constants.Logger.Ctx(ctx).ErrorLog(err)
+		return errs.InvalidFormat
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		constants.Logger.Ctx(ctx).ErrorLog(err)
+		return errs.ErrErrorServer
+	}
+	return nil
+}
+
+// updaterUsers имена пользователей объектов по возрастанию. Данные пользователей блокируются в этом порядке,
+// что бы параллельные транзакции не ждали друг друга по кругу
+func updaterUsers(arrUpdater []model.Updater) []string {
+	set := map[string]bool{}
+	for _, u := range arrUpdater {
+		switch v := u.(type) {
+		case *model.User:
+			set[v.Name] = true
+		case model.Resource:
+			if claims, ok := token.ExtractClaims(v.GetUser()); ok {
+				if name, ok := claims["user"].(string); ok {
+					set[name] = true
+				}
+			}
+		}
+	}
+
+	arrName := make([]string, 0, len(set))
+	for name := range set {
+		arrName = append(arrName, name)
+	}
+	sort.Strings(arrName)
+	return arrName
+}
+
+// queueUpdater добавляет в пакет запросы удаления или добавления/обновления объекта
+func queueUpdater(batch *pgx.Batch, u model.Updater) error {
+	if u.GetEvent() == constants.EventDel.String() {
+		arrActionDatabase, err := u.InstructionsDelete()
+		if err != nil {
+			return err
+		}
+		for _, v := range arrActionDatabase {
+			batch.Queue(v.StrExec, v.Arg...)
+		}
+		return nil
+	}
+
+	strQuery, argQuery, err := u.InstructionsUpsert()
+	if err != nil {
+		return err
+	}
+	batch.Queue(strQuery, argQuery.([]interface{})...)
+	return nil
+}
+
+// applyUpdater добавляет, изменяет или удаляет объект в транзакции
+func applyUpdater(ctx context.Context, tx pgx.Tx, u model.Updater) error {
+	if u.GetEvent() == constants.EventDel.String() {
+		arrActionDatabase, err := u.InstructionsDelete()
+		if err != nil {
+			return err
+		}
+		for _, v := range arrActionDatabase {
+			if _, err = tx.Exec(ctx, v.StrExec, v.Arg...); err != nil {
+				return errs.InvalidFormat
+			}
+		}
+		return nil
+	}
+
+	strQuery, argQuery, err := u.CheckExistence()
+	if err != nil {
+		return err
+	}
+	rows, err := tx.Query(ctx, strQuery, argQuery.([]interface{})...)
+	if err != nil {
+		return errs.InvalidFormat
+	}
+	recordExists := rows.Next()
+	rows.Close()
+
+	if recordExists {
+		strQuery, argQuery, err = u.InstructionsUpdate()
+	} else {
+		strQuery, argQuery, err = u.InstructionsInsert()
+	}
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(ctx, strQuery, argQuery.([]interface{})...); err != nil {
+		return errs.InvalidFormat
+	}
+	return nil
+}
+
 // SelectPortionBinaryData выбирает порции реальных бинарных данных из БД
 func (dbc *DBConnector) SelectPortionBinaryData(ctx context.Context) ([]model.PortionBinaryData, error) {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
 
 	uid := ctx.Value(model.KeyContext("uid"))
 	rows, err := dbc.Pool.Query(ctx, constants.QuerySelectPortionsBinaryData, uid)
@@ -219,7 +567,7 @@ func (dbc *DBConnector) SelectPortionBinaryData(ctx context.Context) ([]model.Po
 
 		err = rows.Scan(&pbd.Uid, &pbd.Portion, &pbd.Body)
 		if err != nil {
-			constants.Logger.ErrorLog(err)
+			constants.Logger.Ctx(ctx).ErrorLog(err)
 			continue
 		}
 		arrPbd = append(arrPbd, pbd)
@@ -228,14 +576,636 @@ func (dbc *DBConnector) SelectPortionBinaryData(ctx context.Context) ([]model.Po
 	return arrPbd, nil
 }
 
-// InsertPortionBinaryData добавляет порции бинарных данных в БД
-func (dbc *DBConnector) InsertPortionBinaryData(ctx context.Context) error {
+// CopyPortionBinaryData добавляет порции бинарных данных в БД: командой COPY во временную таблицу
+// и одним запросом из нее, повторно отправленные порции заменяют сохраненные.
+// Порции передаются в контексте по ключу "data" ([]model.PortionBinaryData)
+func (dbc *DBConnector) CopyPortionBinaryData(ctx context.Context) error {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
 
-	pbd := ctx.Value(model.KeyContext("data")).(model.PortionBinaryData)
-	_, err := dbc.Pool.Exec(ctx, constants.QueryInsertPortionsBinaryData, pbd.Uid, pbd.Portion, pbd.Body)
+	arrPbd := ctx.Value(model.KeyContext("data")).([]model.PortionBinaryData)
+	tx, err := dbc.Pool.Begin(ctx)
+	if err != nil {
+		return errs.InvalidFormat
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err = tx.Exec(ctx, constants.QueryCreatePortionsCopy); err != nil {
+		constants.Logger.Ctx(ctx).ErrorLog(err)
+		return errs.InvalidFormat
+	}
+	_, err = tx.CopyFrom(ctx, portionsCopyTable, portionsFilesColumns,
+		pgx.CopyFromSlice(len(arrPbd), func(i int) ([]interface{}, error) {
+			return []interface{}{arrPbd[i].Uid, arrPbd[i].Portion, arrPbd[i].Body}, nil
+		}))
 	if err != nil {
+		constants.Logger.Ctx(ctx).ErrorLog(err)
 		return errs.InvalidFormat
 	}
+	if _, err = tx.Exec(ctx, constants.QueryUpsertPortionsCopy); err != nil {
+		constants.Logger.Ctx(ctx).ErrorLog(err)
+		return errs.InvalidFormat
+	}
+	if err = tx.Commit(ctx); err != nil {
+		constants.Logger.Ctx(ctx).ErrorLog(err)
+		return errs.InvalidFormat
+	}
+
+	return nil
+}
+
+// SelectFilesStored выбирает объем порций файлов пользователя, сохраненных в БД, в байтах по УИДам файлов.
+// Имя пользователя передается в контексте по ключу "user"
+func (dbc *DBConnector) SelectFilesStored(ctx context.Context) (map[string]int64, error) {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	name := ctx.Value(model.KeyContext("user")).(string)
+	rows, err := dbc.Pool.Query(ctx, constants.QuerySelectFilesStored, name)
+	if err != nil {
+		return nil, errs.ErrErrorServer
+	}
+	defer rows.Close()
+
+	stored := map[string]int64{}
+	for rows.Next() {
+		var uid string
+		var size int64
+		if err = rows.Scan(&uid, &size); err != nil {
+			return nil, errs.ErrErrorServer
+		}
+		stored[uid] = size
+	}
+	if rows.Err() != nil {
+		return nil, errs.ErrErrorServer
+	}
+	return stored, nil
+}
+
+// InsertLockout добавляет запись аудита блокировки/разблокировки в БД
+func (dbc *DBConnector) InsertLockout(ctx context.Context) error {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	l := ctx.Value(model.KeyContext("data")).(model.Lockout)
+	_, err := dbc.Pool.Exec(ctx, constants.QueryInsertLockout, l.Key, l.Event, l.Failures, l.Until, l.Date)
+	if err != nil {
+		return errs.InvalidFormat
+	}
+
+	return nil
+}
+
+// NewSession добавляет сессию пользователя в БД
+func (dbc *DBConnector) NewSession(ctx context.Context) error {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	s := ctx.Value(model.KeyContext("data")).(model.Session)
+	_, err := dbc.Pool.Exec(ctx, constants.QueryInsertSession, s.Uid, s.User, s.Device, s.Build, s.IP, s.Created,
+		s.DeviceID)
+	if err != nil {
+		return errs.ErrErrorServer
+	}
+
+	return nil
+}
+
+// SelectSessions выбирает активные (не отозванные и не истекшие) сессии пользователя.
+// Имя пользователя передается в контексте по ключу "user"
+func (dbc *DBConnector) SelectSessions(ctx context.Context) ([]model.Session, error) {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	user := ctx.Value(model.KeyContext("user"))
+	created := time.Now().Add(-time.Hour * constants.TimeLiveToken)
+	rows, err := dbc.Pool.Query(ctx, constants.QuerySelectSessions, user, created)
+	if err != nil {
+		return nil, errs.ErrErrorServer
+	}
+	defer rows.Close()
+
+	var arrSession []model.Session
+	for rows.Next() {
+		var s model.Session
+
+		err = rows.Scan(&s.Uid, &s.User, &s.Device, &s.Build, &s.IP, &s.Created, &s.LastSeen, &s.DeviceID)
+		if err != nil {
+			constants.Logger.Ctx(ctx).ErrorLog(err)
+			continue
+		}
+		arrSession = append(arrSession, s)
+	}
+
+	return arrSession, nil
+}
+
+// SelectActiveSession выбирает сессию по УИДу, если она не отозвана и не истекла.
+// Если такой сессии нет, возвращает ошибку errs.ErrNotFound
+func (dbc *DBConnector) SelectActiveSession(ctx context.Context, uid string) (model.Session, error) {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	s := model.Session{}
+	created := time.Now().Add(-time.Hour * constants.TimeLiveToken)
+	err := dbc.Pool.QueryRow(ctx, constants.QuerySelectActiveSession, uid, created).Scan(&s.Uid, &s.User, &s.Created)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return s, errs.ErrNotFound
+	}
+	if err != nil {
+		return s, errs.ErrErrorServer
+	}
+	return s, nil
+}
+
+// SelectRevokedSessions выбирает УИДы отозванных сессий, токены которых еще не истекли
+func (dbc *DBConnector) SelectRevokedSessions(ctx context.Context) ([]string, error) {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	created := time.Now().Add(-time.Hour * constants.TimeLiveToken)
+	rows, err := dbc.Pool.Query(ctx, constants.QuerySelectRevokedSessions, created)
+	if err != nil {
+		return nil, errs.ErrErrorServer
+	}
+	defer rows.Close()
+
+	var arrUID []string
+	for rows.Next() {
+		var uid string
+		if err = rows.Scan(&uid); err != nil {
+			constants.Logger.Ctx(ctx).ErrorLog(err)
+			continue
+		}
+		arrUID = append(arrUID, uid)
+	}
+
+	return arrUID, nil
+}
 
+// RevokeSession отзывает сессию пользователя по УИДу.
+// Если сессия не найдена у пользователя, возвращает ошибку errs.ErrNotFound
+func (dbc *DBConnector) RevokeSession(ctx context.Context) error {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	s := ctx.Value(model.KeyContext("data")).(model.Session)
+	tag, err := dbc.Pool.Exec(ctx, constants.QueryRevokeSession, s.Uid, s.User)
+	if err != nil {
+		return errs.ErrErrorServer
+	}
+	if tag.RowsAffected() == 0 {
+		return errs.ErrNotFound
+	}
+
+	return nil
+}
+
+// UpdateSessionsLastSeen обновляет время последней активности сессий
+func (dbc *DBConnector) UpdateSessionsLastSeen(ctx context.Context, lastSeen map[string]time.Time) error {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	for uid, t := range lastSeen {
+		if _, err := dbc.Pool.Exec(ctx, constants.QueryUpdateSessionLastSeen, uid, t); err != nil {
+			return errs.ErrErrorServer
+		}
+	}
+
+	return nil
+}
+
+// NewDevice добавляет устройство пользователя с выпущенным сертификатом в БД
+func (dbc *DBConnector) NewDevice(ctx context.Context) error {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	d := ctx.Value(model.KeyContext("data")).(model.Device)
+	_, err := dbc.Pool.Exec(ctx, constants.QueryInsertDevice, d.Uid, d.User, d.Name, d.Serial, d.Created, d.NotAfter)
+	if err != nil {
+		return errs.ErrErrorServer
+	}
+
+	return nil
+}
+
+// SelectDevices выбирает действующие (не отозванные и не истекшие) устройства пользователя.
+// Имя пользователя передается в контексте по ключу "user"
+func (dbc *DBConnector) SelectDevices(ctx context.Context) ([]model.Device, error) {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	user := ctx.Value(model.KeyContext("user"))
+	rows, err := dbc.Pool.Query(ctx, constants.QuerySelectDevices, user, time.Now())
+	if err != nil {
+		return nil, errs.ErrErrorServer
+	}
+	defer rows.Close()
+
+	var arrDevice []model.Device
+	for rows.Next() {
+		var d model.Device
+
+		err = rows.Scan(&d.Uid, &d.User, &d.Name, &d.Serial, &d.Created, &d.NotAfter)
+		if err != nil {
+			constants.Logger.Ctx(ctx).ErrorLog(err)
+			continue
+		}
+		arrDevice = append(arrDevice, d)
+	}
+
+	return arrDevice, nil
+}
+
+// SelectRevokedDevices выбирает УИДы отозванных устройств, сертификаты которых еще не истекли
+func (dbc *DBConnector) SelectRevokedDevices(ctx context.Context) ([]string, error) {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	rows, err := dbc.Pool.Query(ctx, constants.QuerySelectRevokedDevices, time.Now())
+	if err != nil {
+		return nil, errs.ErrErrorServer
+	}
+	defer rows.Close()
+
+	var arrUID []string
+	for rows.Next() {
+		var uid string
+		if err = rows.Scan(&uid); err != nil {
+			constants.Logger.Ctx(ctx).ErrorLog(err)
+			continue
+		}
+		arrUID = append(arrUID, uid)
+	}
+
+	return arrUID, nil
+}
+
+// RevokeDevice отзывает устройство пользователя по УИДу.
+// Если устройство не найдено у пользователя, возвращает ошибку errs.ErrNotFound
+func (dbc *DBConnector) RevokeDevice(ctx context.Context) error {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	d := ctx.Value(model.KeyContext("data")).(model.Device)
+	tag, err := dbc.Pool.Exec(ctx, constants.QueryRevokeDevice, d.Uid, d.User)
+	if err != nil {
+		return errs.ErrErrorServer
+	}
+	if tag.RowsAffected() == 0 {
+		return errs.ErrNotFound
+	}
+
+	return nil
+}
+
+// InsertAudit добавляет запись в журнал аудита. Запись передается в контексте по ключу "data"
+func (dbc *DBConnector) InsertAudit(ctx context.Context) error {
+	a := ctx.Value(model.KeyContext("data")).(model.AuditRecord)
+	return dbc.InsertAudits(ctx, []model.AuditRecord{a})
+}
+
+// InsertAudits добавляет записи в журнал аудита одной транзакцией в порядке arr.
+// Каждая запись связывается с предыдущей хешем. Добавление идет под блокировкой БД,
+// поэтому цепочка не ломается при одновременной записи из нескольких серверов
+func (dbc *DBConnector) InsertAudits(ctx context.Context, arr []model.AuditRecord) error {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	tx, err := dbc.Pool.Begin(ctx)
+	if err != nil {
+		return errs.ErrErrorServer
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	if _, err = tx.Exec(ctx, constants.QueryLockAudit); err != nil {
+		return errs.ErrErrorServer
+	}
+
+	var lastID int64
+	var prevHash string
+	err = tx.QueryRow(ctx, constants.QuerySelectLastAudit).Scan(&lastID, &prevHash)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return errs.ErrErrorServer
+	}
+
+	batch := &pgx.Batch{}
+	for _, a := range arr {
+		a.Date = auditchain.Canonical(a.Date)
+		a.PrevHash = prevHash
+		a.Hash = auditchain.Hash(a.PrevHash, a)
+		prevHash = a.Hash
+		batch.Queue(constants.QueryInsertAudit, a.User, a.Event, a.Type, a.Uid, a.IP, a.Session,
+			a.Success, a.Date, a.PrevHash, a.Hash)
+	}
+	br := tx.SendBatch(ctx, batch)
+	for range arr {
+		if _, err = br.Exec(); err != nil {
+			_ = br.Close()
+			return errs.ErrErrorServer
+		}
+	}
+	if err = br.Close(); err != nil {
+		return errs.ErrErrorServer
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return errs.ErrErrorServer
+	}
+
+	return nil
+}
+
+// WalkAudit обходит весь журнал аудита в порядке добавления и вызывает fn для каждой записи.
+// Обход прерывается на первой ошибке fn
+func (dbc *DBConnector) WalkAudit(ctx context.Context, fn func(model.AuditRecord) error) error {
+
+	rows, err := dbc.Pool.Query(ctx, constants.QuerySelectAuditChain)
+	if err != nil {
+		return errs.ErrErrorServer
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a model.AuditRecord
+
+		err = rows.Scan(&a.ID, &a.User, &a.Event, &a.Type, &a.Uid, &a.IP, &a.Session, &a.Success, &a.Date,
+			&a.PrevHash, &a.Hash)
+		if err != nil {
+			return errs.ErrErrorServer
+		}
+		if err = fn(a); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// InsertAuditCheckpoint создает контрольную точку последней записи журнала аудита.
+// Контрольная точка подписывается функцией sign. Если с прошлой контрольной точки журнал не изменился,
+// то новая точка не создается
+func (dbc *DBConnector) InsertAuditCheckpoint(ctx context.Context, sign func(model.AuditCheckpoint) string) error {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	c := model.AuditCheckpoint{Date: auditchain.Canonical(time.Now())}
+	err := dbc.Pool.QueryRow(ctx, constants.QuerySelectLastAudit).Scan(&c.AuditID, &c.Hash)
+	if errors.Is(err, pgx.ErrNoRows) || c.Hash == "" {
+		return nil
+	}
+	if err != nil {
+		return errs.ErrErrorServer
+	}
+
+	var lastID int64
+	if err = dbc.Pool.QueryRow(ctx, constants.QuerySelectLastAuditCheckpoint).Scan(&lastID); err != nil {
+		return errs.ErrErrorServer
+	}
+	if lastID == c.AuditID {
+		return nil
+	}
+
+	c.Signature = sign(c)
+	_, err = dbc.Pool.Exec(ctx, constants.QueryInsertAuditCheckpoint, c.AuditID, c.Hash, c.Signature, c.Date)
+	if err != nil {
+		return errs.ErrErrorServer
+	}
+
+	return nil
+}
+
+// SelectAuditCheckpoints выбирает все контрольные точки журнала аудита
+func (dbc *DBConnector) SelectAuditCheckpoints(ctx context.Context) ([]model.AuditCheckpoint, error) {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	rows, err := dbc.Pool.Query(ctx, constants.QuerySelectAuditCheckpoints)
+	if err != nil {
+		return nil, errs.ErrErrorServer
+	}
+	defer rows.Close()
+
+	var arrCheckpoint []model.AuditCheckpoint
+	for rows.Next() {
+		var c model.AuditCheckpoint
+		if err = rows.Scan(&c.ID, &c.AuditID, &c.Hash, &c.Signature, &c.Date); err != nil {
+			return nil, errs.ErrErrorServer
+		}
+		arrCheckpoint = append(arrCheckpoint, c)
+	}
+
+	return arrCheckpoint, nil
+}
+
+// SelectAudit выбирает журнал аудита пользователя по фильтру, переданному в контексте по ключу "data"
+func (dbc *DBConnector) SelectAudit(ctx context.Context) ([]model.AuditRecord, error) {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	f := ctx.Value(model.KeyContext("data")).(model.AuditFilter)
+	rows, err := dbc.Pool.Query(ctx, constants.QuerySelectAudit, f.User, f.From, f.To, f.Limit)
+	if err != nil {
+		return nil, errs.ErrErrorServer
+	}
+	defer rows.Close()
+
+	var arrAudit []model.AuditRecord
+	for rows.Next() {
+		var a model.AuditRecord
+
+		err = rows.Scan(&a.ID, &a.User, &a.Event, &a.Type, &a.Uid, &a.IP, &a.Session, &a.Success, &a.Date,
+			&a.PrevHash, &a.Hash)
+		if err != nil {
+			constants.Logger.Ctx(ctx).ErrorLog(err)
+			continue
+		}
+		arrAudit = append(arrAudit, a)
+	}
+
+	return arrAudit, nil
+}
+
+// Exists проверяет, существует ли объект в базе
+func (dbc *DBConnector) Exists(ctx context.Context, u model.Updater) (bool, error) {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	conn, err := dbc.Pool.Acquire(ctx)
+	if err != nil {
+		return false, errs.ErrErrorServer
+	}
+	defer conn.Release()
+
+	ctxVW := context.WithValue(ctx, model.KeyContext("data"), u)
+	pc := PgxpoolConn{conn}
+
+	return pc.CheckExistence(ctxVW)
+}
+
+// SelectUserStatus выбирает роль пользователя и признак блокировки экаунта.
+// Имя пользователя передается в контексте по ключу "user"
+func (dbc *DBConnector) SelectUserStatus(ctx context.Context) (model.UserStatus, error) {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	name := ctx.Value(model.KeyContext("user")).(string)
+
+	us := model.UserStatus{}
+	err := dbc.Pool.QueryRow(ctx, constants.QuerySelectUserStatus, name).Scan(&us.Role, &us.Disabled)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return us, errs.ErrNotFound
+	}
+	if err != nil {
+		return us, errs.ErrErrorServer
+	}
+	return us, nil
+}
+
+// SelectUsersStats выбирает всех пользователей с количеством записей, объемом данных и активными сессиями
+func (dbc *DBConnector) SelectUsersStats(ctx context.Context) ([]model.UserStats, error) {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	created := time.Now().Add(-time.Hour * constants.TimeLiveToken)
+	rows, err := dbc.Pool.Query(ctx, constants.QuerySelectUsersStats, created)
+	if err != nil {
+		return nil, errs.ErrErrorServer
+	}
+	defer rows.Close()
+
+	arrStats := []model.UserStats{}
+	for rows.Next() {
+		var us model.UserStats
+		var pairs, text, binary, card int
+		err = rows.Scan(&us.Login, &us.Role, &us.Disabled, &pairs, &text, &binary, &card, &us.Storage, &us.Sessions)
+		if err != nil {
+			constants.Logger.Ctx(ctx).ErrorLog(err)
+			continue
+		}
+		us.Records = map[string]int{"pairs": pairs, "text": text, "binary": binary, "card": card}
+		arrStats = append(arrStats, us)
+	}
+
+	return arrStats, nil
+}
+
+// UpdateUserDisabled блокирует или разблокирует экаунт пользователя.
+// Имя пользователя передается в контексте по ключу "user".
+// Если пользователь не найден, возвращает ошибку errs.ErrNotFound
+func (dbc *DBConnector) UpdateUserDisabled(ctx context.Context, disabled bool) error {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	return dbc.execUser(ctx, constants.QueryUpdateUserDisabled, disabled)
+}
+
+// UpdateUserRole меняет роль пользователя.
+// Имя пользователя передается в контексте по ключу "user".
+// Если пользователь не найден, возвращает ошибку errs.ErrNotFound
+func (dbc *DBConnector) UpdateUserRole(ctx context.Context, role string) error {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	return dbc.execUser(ctx, constants.QueryUpdateUserRole, role)
+}
+
+// execUser выполняет запрос изменения пользователя из контекста (ключ "user") с параметром arg
+func (dbc *DBConnector) execUser(ctx context.Context, query string, arg interface{}) error {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	name := ctx.Value(model.KeyContext("user")).(string)
+
+	tag, err := dbc.Pool.Exec(ctx, query, name, arg)
+	if err != nil {
+		return errs.ErrErrorServer
+	}
+	if tag.RowsAffected() == 0 {
+		return errs.ErrNotFound
+	}
+	return nil
+}
+
+// RevokeUserSessions отзывает все сессии пользователя, кроме сессии except (пустая строка - все сессии),
+// и возвращает УИДы отозванных сессий. Имя пользователя передается в контексте по ключу "user"
+func (dbc *DBConnector) RevokeUserSessions(ctx context.Context, except string) ([]string, error) {
+	return dbc.revokeUser(ctx, constants.QueryRevokeUserSessions, except)
+}
+
+// RevokeUserDevices отзывает все устройства пользователя и возвращает УИДы отозванных устройств.
+// Имя пользователя передается в контексте по ключу "user"
+func (dbc *DBConnector) RevokeUserDevices(ctx context.Context) ([]string, error) {
+	return dbc.revokeUser(ctx, constants.QueryRevokeUserDevices)
+}
+
+// revokeUser выполняет запрос отзыва query по имени пользователя из контекста (ключ "user")
+// с аргументами arg и возвращает УИДы, которые вернул запрос
+func (dbc *DBConnector) revokeUser(ctx context.Context, query string, arg ...interface{}) ([]string, error) {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	name := ctx.Value(model.KeyContext("user")).(string)
+
+	rows, err := dbc.Pool.Query(ctx, query, append([]interface{}{name}, arg...)...)
+	if err != nil {
+		return nil, errs.ErrErrorServer
+	}
+	defer rows.Close()
+
+	var arrUID []string
+	for rows.Next() {
+		var uid string
+		if err = rows.Scan(&uid); err != nil {
+			constants.Logger.Ctx(ctx).ErrorLog(err)
+			continue
+		}
+		arrUID = append(arrUID, uid)
+	}
+
+	return arrUID, rows.Err()
+}
+
+// AdminDelAccount удаляет пользователя по имени без проверки пароля (по команде администратора).
+// Вместе с пользователем в одной транзакции удаляются все его данные, порции файлов и сессии,
+// устройства пользователя отзываются.
+// Имя пользователя передается в контексте по ключу "user".
+// Если пользователь не найден, возвращает ошибку errs.ErrNotFound
+func (dbc *DBConnector) AdminDelAccount(ctx context.Context) error {
+	ctx, cancel := dbc.queryContext(ctx)
+	defer cancel()
+
+	name := ctx.Value(model.KeyContext("user")).(string)
+
+	tx, err := dbc.Pool.Begin(ctx)
+	if err != nil {
+		return errs.ErrErrorServer
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	for _, v := range []string{constants.QueryLockUser, constants.QueryDelUserPortionsBinaryData, constants.QueryDelUserBinaryData,
+		constants.QueryDelUserTextData, constants.QueryDelUserBankCard, constants.QueryDelUserPairs,
+		constants.QueryDelUserSessions, constants.QueryRevokeUserDevices} {
+		if _, err = tx.Exec(ctx, v, name); err != nil {
+			return errs.ErrErrorServer
+		}
+	}
+
+	tag, err := tx.Exec(ctx, constants.QueryDelUserByName, name)
+	if err != nil {
+		return errs.ErrErrorServer
+	}
+	if tag.RowsAffected() == 0 {
+		return errs.ErrNotFound
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		constants.Logger.Ctx(ctx).ErrorLog(err)
+		return errs.ErrErrorServer
+	}
 	return nil
 }
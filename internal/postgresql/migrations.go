@@ -0,0 +1,192 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"gophkeeper/internal/constants"
+)
+
+// migration версионная миграция схемы БД. Миграция выполняется один раз в своей транзакции,
+// номер версии записывается в gophkeeper."Migrations". early - миграция выполняется до создания таблиц
+// (например, переименование таблицы прежней версии, иначе создание таблицы займет новое имя)
+type migration struct {
+	version int
+	name    string
+	early   bool
+	apply   func(ctx context.Context, tx pgx.Tx) error
+}
+
+// migrations миграции схемы БД по возрастанию версий. Применённые миграции не изменяются,
+// изменение схемы добавляется новой миграцией. Миграции early выполняются раньше остальных
+var migrations = []migration{
+	{version: 1, name: "unique user and uid of records", apply: migrateRecordsUserUID},
+	{version: 2, name: "unique portions of files", apply: migratePortionsUIDPortion},
+	{version: 3, name: "rename PairLoginPassword to PairsLoginPassword", early: true, apply: migratePairsRename},
+}
+
+// migrate применяет к БД миграции этапа early, которые еще не применены. Экземпляры сервера,
+// запущенные одновременно, применяют миграции по очереди (блокировка constants.QueryLockMigrations)
+func migrate(ctx context.Context, pool *pgxpool.Pool, early bool) error {
+	_, err := pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS gophkeeper."Migrations"
+								(
+									"Version" integer PRIMARY KEY,
+									"Name" character varying(150) COLLATE pg_catalog."default",
+									"Applied" timestamp with time zone DEFAULT now()
+								)
+
+								TABLESPACE pg_default;
+
+								ALTER TABLE IF EXISTS gophkeeper."Migrations"
+									OWNER to postgres;`)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.early != early {
+			continue
+		}
+		if err = applyMigration(ctx, pool, m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+// applyMigration применяет миграцию m в транзакции, если она еще не применена
+func applyMigration(ctx context.Context, pool *pgxpool.Pool, m migration) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err = tx.Exec(ctx, constants.QueryLockMigrations); err != nil {
+		return err
+	}
+	applied := false
+	err = tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM gophkeeper."Migrations" WHERE "Version" = $1);`,
+		m.version).Scan(&applied)
+	if err != nil || applied {
+		return err
+	}
+
+	constants.Logger.InfoLog(fmt.Sprintf("applying migration %d: %s", m.version, m.name))
+	if err = m.apply(ctx, tx); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(ctx, `INSERT INTO gophkeeper."Migrations"("Version", "Name") VALUES ($1, $2);`,
+		m.version, m.name); err != nil {
+		return err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+	constants.Logger.InfoLog(fmt.Sprintf("migration %d applied", m.version))
+	return nil
+}
+
+// dropDuplicates удаляет из таблицы table дубли строк по колонкам columns (остается последняя строка)
+// и пишет в лог количество удаленных строк
+func dropDuplicates(ctx context.Context, tx pgx.Tx, table string, columns ...string) error {
+	where := ""
+	for _, c := range columns {
+		where += ` AND a."` + c + `" = b."` + c + `"`
+	}
+	tag, err := tx.Exec(ctx, `DELETE FROM gophkeeper."`+table+`" a
+								USING gophkeeper."`+table+`" b
+								WHERE a.ctid < b.ctid`+where+`;`)
+	if err != nil {
+		return err
+	}
+	if n := tag.RowsAffected(); n > 0 {
+		constants.Logger.Log.Warn().Msgf("migration: %d duplicate rows deleted from %s", n, table)
+	}
+	return nil
+}
+
+// migrateRecordsUserUID уникальные индексы по пользователю и УИДу нужны для добавления/обновления записей
+// одним запросом (INSERT ... ON CONFLICT). Перед созданием индекса из таблицы удаляются дубли
+func migrateRecordsUserUID(ctx context.Context, tx pgx.Tx) error {
+	for _, table := range []string{"PairsLoginPassword", "Text", "Files", "BankCards"} {
+		if err := dropDuplicates(ctx, tx, table, "User", "UID"); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `CREATE UNIQUE INDEX IF NOT EXISTS "`+table+`UserUID"
+									ON gophkeeper."`+table+`" ("User", "UID");`)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migratePortionsUIDPortion уникальный индекс по УИДу файла и смещению порции: повторно отправленная порция
+// заменяет сохраненную (см. DBConnector.CopyPortionBinaryData). Перед созданием индекса удаляются дубли порций
+func migratePortionsUIDPortion(ctx context.Context, tx pgx.Tx) error {
+	if err := dropDuplicates(ctx, tx, "PortionsFiles", "UID", "Portion"); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, `CREATE UNIQUE INDEX IF NOT EXISTS "PortionsFilesUIDPortion"
+								ON gophkeeper."PortionsFiles" ("UID", "Portion");`)
+	return err
+}
+
+// migratePairsRename переименование таблицы пар логин/пароль прежних версий "PairLoginPassword"
+// и ее колонки "TypePair" в имена, которые используют запросы. Если таблица с новым именем уже создана,
+// строки прежней таблицы переносятся в нее, а прежняя таблица удаляется
+func migratePairsRename(ctx context.Context, tx pgx.Tx) error {
+	var oldExists, newExists bool
+	err := tx.QueryRow(ctx, `SELECT to_regclass('gophkeeper."PairLoginPassword"') IS NOT NULL,
+									to_regclass('gophkeeper."PairsLoginPassword"') IS NOT NULL;`).Scan(&oldExists, &newExists)
+	if err != nil || !oldExists {
+		return err
+	}
+
+	if err = renameColumn(ctx, tx, "PairLoginPassword", "TypePair", "TypePairs"); err != nil {
+		return err
+	}
+	if !newExists {
+		_, err = tx.Exec(ctx, `ALTER TABLE gophkeeper."PairLoginPassword" RENAME TO "PairsLoginPassword";`)
+		return err
+	}
+
+	if err = renameColumn(ctx, tx, "PairsLoginPassword", "TypePair", "TypePairs"); err != nil {
+		return err
+	}
+	var total int64
+	if err = tx.QueryRow(ctx, `SELECT count(*) FROM gophkeeper."PairLoginPassword";`).Scan(&total); err != nil {
+		return err
+	}
+	tag, err := tx.Exec(ctx, `INSERT INTO gophkeeper."PairsLoginPassword"("User", "TypePairs", "Name", "Password", "UID")
+								SELECT "User", "TypePairs", "Name", "Password", "UID" 
+								FROM gophkeeper."PairLoginPassword"
+								ON CONFLICT DO NOTHING;`)
+	if err != nil {
+		return err
+	}
+	if skipped := total - tag.RowsAffected(); skipped > 0 {
+		constants.Logger.Log.Warn().Msgf("migration: %d rows of PairLoginPassword already exist in PairsLoginPassword", skipped)
+	}
+	constants.Logger.InfoLog(fmt.Sprintf("migration: %d rows moved from PairLoginPassword to PairsLoginPassword",
+		tag.RowsAffected()))
+	_, err = tx.Exec(ctx, `DROP TABLE gophkeeper."PairLoginPassword";`)
+	return err
+}
+
+// renameColumn переименовывает колонку column таблицы table в name, если такая колонка есть
+func renameColumn(ctx context.Context, tx pgx.Tx, table, column, name string) error {
+	var exists bool
+	err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM information_schema.columns
+								WHERE table_schema = 'gophkeeper' AND table_name = $1 AND column_name = $2);`,
+		table, column).Scan(&exists)
+	if err != nil || !exists {
+		return err
+	}
+	_, err = tx.Exec(ctx, `ALTER TABLE gophkeeper."`+table+`" RENAME COLUMN "`+column+`" TO "`+name+`";`)
+	return err
+}
@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+// UserStatus роль пользователя и признак блокировки экаунта администратором
+type UserStatus struct {
+	Role     string `json:"role"`
+	Disabled bool   `json:"disabled"`
+}
+
+// UserStats объект пользователь для администратора: роль, блокировка, количество записей по типам
+// (pairs, text, binary, card), объем хранимых данных в байтах (вместе с порциями файлов) и количество активных сессий
+type UserStats struct {
+	Login string `json:"login"`
+	UserStatus
+	Records  map[string]int `json:"records"`
+	Storage  int64          `json:"storage_bytes"`
+	Sessions int            `json:"sessions"`
+}
+
+// RoleRequest запрос администратора на смену роли пользователя
+type RoleRequest struct {
+	Role string `json:"role"`
+}
+
+// DeadItem запись хранилища сервера, которую не удалось сохранить в БД за несколько попыток.
+// Данные записи администратору не отдаются, только тип, УИД, пользователь и последняя ошибка
+type DeadItem struct {
+	Type     string    `json:"type"`
+	Uid      string    `json:"uid"`
+	User     string    `json:"user"`
+	Event    string    `json:"event"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	Date     time.Time `json:"date"`
+}
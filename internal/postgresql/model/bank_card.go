@@ -74,6 +74,18 @@ func (b *BankCard) InstructionsUpdate() (string, interface{}, error) {
 	return constants.QueryUpdateBankCard, arg, nil
 }
 
+// InstructionsUpsert метод объекта BankCard. Возвращает инструкции для добавления или обновления объекта в БД
+// одним запросом, по пользователю и УИДу
+func (b *BankCard) InstructionsUpsert() (string, interface{}, error) {
+	claims, ok := token.ExtractClaims(b.User)
+	if !ok {
+		return "", nil, errs.ErrInvalidLoginPassword
+	}
+
+	arg := []interface{}{claims["user"], b.Uid, b.Number, b.Cvc}
+	return constants.QueryUpsertBankCard, arg, nil
+}
+
 // InstructionsDelete метод объекта BankCard. Возвращает инструкции для удаления объекта из БД, по пользователю и УИДу
 func (b *BankCard) InstructionsDelete() ([]ActionDatabase, error) {
 	claims, ok := token.ExtractClaims(b.User)
@@ -3,6 +3,7 @@ package model
 import (
 	"errors"
 	"gophkeeper/internal/constants"
+	"time"
 )
 
 // KeyContext тип для создания ключа контекста
@@ -15,6 +16,92 @@ type PortionBinaryData struct {
 	Body    string `json:"body"`
 }
 
+// Lockout структура записи аудита блокировки ключа (пользователь или IP) при переборе паролей
+type Lockout struct {
+	Key      string    `json:"key"`
+	Event    string    `json:"event"`
+	Failures int       `json:"failures"`
+	Until    time.Time `json:"until"`
+	Date     time.Time `json:"date"`
+}
+
+// Session структура сессии пользователя. Создается при каждом входе в систему или регистрации.
+// Свойство Current заполняется сервером для сессии, из которой пришел запрос.
+// Свойство DeviceID заполняется, если вход выполнен с сертификатом устройства
+type Session struct {
+	Uid      string    `json:"uid"`
+	User     string    `json:"user"`
+	Device   string    `json:"device"`
+	Build    string    `json:"build"`
+	IP       string    `json:"ip"`
+	Created  time.Time `json:"created"`
+	LastSeen time.Time `json:"last_seen"`
+	Current  bool      `json:"current,omitempty"`
+	DeviceID string    `json:"device_id,omitempty"`
+}
+
+// Device структура устройства пользователя, которому выпущен сертификат.
+// Serial серийный номер сертификата в шестнадцатеричном виде.
+// Свойство Current заполняется сервером для устройства, с которого пришел запрос
+type Device struct {
+	Uid      string    `json:"uid"`
+	User     string    `json:"user"`
+	Name     string    `json:"name"`
+	Serial   string    `json:"serial"`
+	Created  time.Time `json:"created"`
+	NotAfter time.Time `json:"not_after"`
+	Current  bool      `json:"current,omitempty"`
+}
+
+// DeviceEnrollment структура запроса на выпуск сертификата устройства.
+// Пароль пользователя проверяется повторно
+type DeviceEnrollment struct {
+	Password string `json:"password"`
+	Name     string `json:"name"`
+	CSR      string `json:"csr"`
+}
+
+// DeviceCertificate структура ответа с выпущенным сертификатом устройства и сертификатом удостоверяющего центра
+type DeviceCertificate struct {
+	Uid         string `json:"uid"`
+	Certificate string `json:"certificate"`
+	CA          string `json:"ca"`
+}
+
+// AuditRecord структура записи журнала аудита пользователя.
+// Для событий с данными заполняются тип и УИД записи
+type AuditRecord struct {
+	ID       int64     `json:"id"`
+	User     string    `json:"user"`
+	Event    string    `json:"event"`
+	Type     string    `json:"type,omitempty"`
+	Uid      string    `json:"uid,omitempty"`
+	IP       string    `json:"ip"`
+	Session  string    `json:"session,omitempty"`
+	Success  bool      `json:"success"`
+	Date     time.Time `json:"date"`
+	PrevHash string    `json:"prev_hash,omitempty"`
+	Hash     string    `json:"hash,omitempty"`
+}
+
+// AuditCheckpoint структура подписанной контрольной точки журнала аудита.
+// Фиксирует хеш записи журнала AuditID на момент Date
+type AuditCheckpoint struct {
+	ID        int64     `json:"id"`
+	AuditID   int64     `json:"audit_id"`
+	Hash      string    `json:"hash"`
+	Signature string    `json:"signature"`
+	Date      time.Time `json:"date"`
+}
+
+// AuditFilter параметры отбора журнала аудита пользователя
+type AuditFilter struct {
+	User  string
+	From  time.Time
+	To    time.Time
+	Limit int
+}
+
 // ActionDatabase структура указывающая, что делать с БД, с параметрами для отбора
 type ActionDatabase struct {
 	StrExec string
@@ -29,6 +116,7 @@ type Updater interface {
 	CheckExistence() (string, interface{}, error)
 	InstructionsUpdate() (string, interface{}, error)
 	InstructionsInsert() (string, interface{}, error)
+	InstructionsUpsert() (string, interface{}, error)
 	InstructionsDelete() ([]ActionDatabase, error)
 	InstructionsSelect() (ActionDatabase, error)
 
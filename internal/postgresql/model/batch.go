@@ -0,0 +1,49 @@
+package model
+
+import "encoding/json"
+
+const (
+	// BatchPut операция пакетного запроса добавление/изменение записи
+	BatchPut = "put"
+
+	// BatchDelete операция пакетного запроса удаление записи
+	BatchDelete = "delete"
+
+	// BatchOK операция применена
+	BatchOK = "ok"
+
+	// BatchError операция не применена из-за ошибки
+	BatchError = "error"
+
+	// BatchSkipped операция не применена из-за ошибки в другой операции пакета
+	BatchSkipped = "skipped"
+)
+
+// Batch объект пакетный запрос. Операции применяются в одной транзакции: все или ни одной
+type Batch struct {
+	Operations []BatchOperation `json:"operations"`
+}
+
+// BatchOperation операция пакетного запроса.
+// Type тип записи как в REST API (pairs, text, binary, card), Data запись для операции put
+type BatchOperation struct {
+	Op   string          `json:"op"`
+	Type string          `json:"type"`
+	Uid  string          `json:"uid"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// BatchResult результат операции пакетного запроса
+type BatchResult struct {
+	Op     string `json:"op"`
+	Type   string `json:"type"`
+	Uid    string `json:"uid"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BatchReply объект ответ на пакетный запрос. Committed признак, что транзакция зафиксирована
+type BatchReply struct {
+	Committed bool          `json:"committed"`
+	Results   []BatchResult `json:"results"`
+}
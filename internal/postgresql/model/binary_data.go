@@ -1,6 +1,8 @@
 package model
 
 import (
+	"strconv"
+
 	"gophkeeper/internal/constants"
 	"gophkeeper/internal/constants/errs"
 	"gophkeeper/internal/token"
@@ -71,6 +73,18 @@ func (b *BinaryData) InstructionsUpdate() (string, interface{}, error) {
 	return constants.QueryUpdateBinaryData, arg, nil
 }
 
+// InstructionsUpsert метод объекта BinaryData. Возвращает инструкции для добавления или обновления объекта в БД
+// одним запросом, по пользователю и УИДу
+func (b *BinaryData) InstructionsUpsert() (string, interface{}, error) {
+	claims, ok := token.ExtractClaims(b.User)
+	if !ok {
+		return "", nil, errs.ErrInvalidLoginPassword
+	}
+
+	arg := []interface{}{claims["user"], b.Uid, b.Name, b.Expansion, b.Size, b.Patch}
+	return constants.QueryUpsertBinaryData, arg, nil
+}
+
 // InstructionsDelete метод объекта BinaryData. Возвращает инструкции для удаления объекта из БД,
 // по пользователю и УИДу
 func (b *BinaryData) InstructionsDelete() ([]ActionDatabase, error) {
@@ -107,6 +121,16 @@ func (b *BinaryData) GetSecondaryText(cryptoKey string) string {
 	return b.Name + ":::" + b.Expansion + ":::" + b.Size + ":::" + b.Patch
 }
 
+// FileSize метод объекта BinaryData. Возвращает размер файла в байтах и признак, что размер указан
+// положительным числом
+func (b *BinaryData) FileSize() (int64, bool) {
+	size, err := strconv.ParseInt(b.Size, 10, 64)
+	if err != nil || size <= 0 {
+		return 0, false
+	}
+	return size, true
+}
+
 // GetEvent метод объекта BinaryData. Возвращает событие, которое должно произойти с объектом
 // в БД. Удаление или добавление/обновление
 func (b *BinaryData) GetEvent() string {
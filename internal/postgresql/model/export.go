@@ -0,0 +1,76 @@
+package model
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// UserExport объект выгрузка всех данных пользователя.
+// Данные выгружаются в том виде, в каком хранятся на сервере (зашифрованные на клиенте)
+type UserExport struct {
+	User      string              `json:"user"`
+	Date      time.Time           `json:"date"`
+	Pairs     []PairLoginPassword `json:"pairs"`
+	Text      []TextData          `json:"text"`
+	Binary    []BinaryData        `json:"binary"`
+	BankCards []BankCard          `json:"bank_cards"`
+	Portions  []PortionBinaryData `json:"portions"`
+}
+
+// SetValue метод раскладывает объект Updater по спискам выгрузки в зависимости от типа
+func (e *UserExport) SetValue(u Updater) {
+	switch v := u.(type) {
+	case *PairLoginPassword:
+		e.Pairs = append(e.Pairs, *v)
+	case *TextData:
+		e.Text = append(e.Text, *v)
+	case *BinaryData:
+		e.Binary = append(e.Binary, *v)
+	case *BankCard:
+		e.BankCards = append(e.BankCards, *v)
+	}
+}
+
+// WriteJSON пишет выгрузку в w в формате JSON. Порции файлов (после e.Portions) передает функция portions
+// по одной через yield, поэтому файлы не загружаются в память целиком
+func (e *UserExport) WriteJSON(w io.Writer, portions func(yield func(PortionBinaryData) error) error) error {
+	head := *e
+	head.Portions = nil
+	msg, err := json.Marshal(struct {
+		UserExport
+		Portions []PortionBinaryData `json:"portions,omitempty"`
+	}{UserExport: head})
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	// объект без порций заканчивается "}", массив порций дописывается перед ней
+	_, _ = bw.Write(msg[:len(msg)-1])
+	_, _ = bw.WriteString(`,"portions":[`)
+	enc := json.NewEncoder(bw)
+	first := true
+	yield := func(pbd PortionBinaryData) error {
+		if !first {
+			if err := bw.WriteByte(','); err != nil {
+				return err
+			}
+		}
+		first = false
+		return enc.Encode(pbd)
+	}
+	for _, pbd := range e.Portions {
+		if err = yield(pbd); err != nil {
+			return err
+		}
+	}
+	if portions != nil {
+		if err = portions(yield); err != nil {
+			return err
+		}
+	}
+	_, _ = bw.WriteString("]}\n")
+	return bw.Flush()
+}
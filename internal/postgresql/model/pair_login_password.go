@@ -70,6 +70,18 @@ func (p *PairLoginPassword) InstructionsUpdate() (string, interface{}, error) {
 	return constants.QueryUpdatePairsTemplate, arg, nil
 }
 
+// InstructionsUpsert метод объекта PairLoginPassword. Возвращает инструкции для добавления или обновления объекта в БД
+// одним запросом, по пользователю и УИДу
+func (p *PairLoginPassword) InstructionsUpsert() (string, interface{}, error) {
+	claims, ok := token.ExtractClaims(p.User)
+	if !ok {
+		return "", nil, errs.ErrInvalidLoginPassword
+	}
+
+	arg := []interface{}{claims["user"], p.Uid, p.TypePair, p.Name, p.Password}
+	return constants.QueryUpsertPairsTemplate, arg, nil
+}
+
 // InstructionsDelete метод объекта PairLoginPassword. Возвращает инструкции для удаления объекта из БД,
 // по пользователю и УИДу
 func (p *PairLoginPassword) InstructionsDelete() ([]ActionDatabase, error) {
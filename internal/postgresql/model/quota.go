@@ -0,0 +1,17 @@
+package model
+
+// QuotaLimits квоты пользователя: общий объем файлов в байтах, количество записей каждого типа
+// и размер одного файла в байтах. 0 означает без ограничения
+type QuotaLimits struct {
+	Bytes    int64 `json:"bytes"`
+	Records  int   `json:"records"`
+	FileSize int64 `json:"file_size"`
+}
+
+// QuotaUsage использование квот пользователем: объем файлов в байтах и количество записей по типам
+// (pairs, text, binary, card) с учетом изменений, которые еще не сохранены в БД
+type QuotaUsage struct {
+	Bytes   int64          `json:"bytes"`
+	Records map[string]int `json:"records"`
+	Limits  QuotaLimits    `json:"limits"`
+}
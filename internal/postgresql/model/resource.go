@@ -0,0 +1,73 @@
+package model
+
+import (
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/constants/errs"
+)
+
+// Resource интерфейс хранимой записи пользователя (пары логин/пароль, текст, файл, банковская карта).
+// SetIdentity заполняет владельца (токен или имя), УИД и событие записи,
+// когда они передаются не в теле запроса, а в адресе и методе HTTP. GetUser возвращает владельца записи.
+// Validate проверяет запись до помещения в хранилище сервера
+type Resource interface {
+	Updater
+	Validator
+	SetIdentity(user, uid, event string)
+	GetUser() string
+}
+
+// NewResource создает пустую запись по типу хранимой информации
+func NewResource(t string) (Resource, error) {
+	switch t {
+	case constants.TypePairLoginPassword.String():
+		return &PairLoginPassword{}, nil
+	case constants.TypeTextData.String():
+		return &TextData{}, nil
+	case constants.TypeBinaryData.String():
+		return &BinaryData{}, nil
+	case constants.TypeBankCardData.String():
+		return &BankCard{}, nil
+	default:
+		return nil, errs.ErrNotFound
+	}
+}
+
+// SetIdentity метод объекта PairLoginPassword. Заполняет владельца, УИД и событие записи
+func (p *PairLoginPassword) SetIdentity(user, uid, event string) {
+	p.User, p.Uid, p.Event = user, uid, event
+}
+
+// SetIdentity метод объекта TextData. Заполняет владельца, УИД и событие записи
+func (t *TextData) SetIdentity(user, uid, event string) {
+	t.User, t.Uid, t.Event = user, uid, event
+}
+
+// SetIdentity метод объекта BinaryData. Заполняет владельца, УИД и событие записи
+func (b *BinaryData) SetIdentity(user, uid, event string) {
+	b.User, b.Uid, b.Event = user, uid, event
+}
+
+// SetIdentity метод объекта BankCard. Заполняет владельца, УИД и событие записи
+func (b *BankCard) SetIdentity(user, uid, event string) {
+	b.User, b.Uid, b.Event = user, uid, event
+}
+
+// GetUser метод объекта PairLoginPassword. Возвращает владельца записи
+func (p *PairLoginPassword) GetUser() string {
+	return p.User
+}
+
+// GetUser метод объекта TextData. Возвращает владельца записи
+func (t *TextData) GetUser() string {
+	return t.User
+}
+
+// GetUser метод объекта BinaryData. Возвращает владельца записи
+func (b *BinaryData) GetUser() string {
+	return b.User
+}
+
+// GetUser метод объекта BankCard. Возвращает владельца записи
+func (b *BankCard) GetUser() string {
+	return b.User
+}
@@ -69,6 +69,18 @@ func (t *TextData) InstructionsUpdate() (string, interface{}, error) {
 	return constants.QueryUpdateTextData, arg, nil
 }
 
+// InstructionsUpsert метод объекта TextData. Возвращает инструкции для добавления или обновления объекта в БД
+// одним запросом, по пользователю и УИДу
+func (t *TextData) InstructionsUpsert() (string, interface{}, error) {
+	claims, ok := token.ExtractClaims(t.User)
+	if !ok {
+		return "", nil, errs.ErrInvalidLoginPassword
+	}
+
+	arg := []interface{}{claims["user"], t.Uid, t.Text}
+	return constants.QueryUpsertTextData, arg, nil
+}
+
 // InstructionsDelete метод объекта TextData. Возвращает инструкции для удаления объекта из БД,
 // по пользователю и УИДу
 func (t *TextData) InstructionsDelete() ([]ActionDatabase, error) {
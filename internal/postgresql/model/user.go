@@ -2,15 +2,16 @@ package model
 
 import (
 	"gophkeeper/internal/constants"
-	"gophkeeper/internal/constants/errs"
 	"gophkeeper/internal/encryption"
-	"gophkeeper/internal/token"
 )
 
+// User объект пользователь.
+// Свойство NewPassword заполняется только при смене пароля
 type User struct {
 	Type         string `json:"type"`
 	Name         string `json:"login"`
 	Password     string `json:"password"`
+	NewPassword  string `json:"new_password,omitempty"`
 	HashPassword string `json:"hash_password"`
 	Event        string `json:"event"`
 	New          bool   `json:"new"`
@@ -47,10 +48,23 @@ func (u *User) InstructionsSelect() (ActionDatabase, error) {
 	return actionDatabase, nil
 }
 
-// InstructionsDelete метод объекта User. Удаляет объект из БД по имени и хешированному паролю
+// InstructionsDelete метод объекта User. Удаляет объект из БД по имени и хешированному паролю.
+// Вместе с пользователем удаляются все его данные, порции файлов и сессии, устройства отзываются.
+// Данные пользователя блокируются до конца транзакции
 func (u *User) InstructionsDelete() ([]ActionDatabase, error) {
 
-	arrActionDatabase := []ActionDatabase{}
+	arrActionDatabase := []ActionDatabase{{
+		StrExec: constants.QueryLockUser,
+		Arg:     []interface{}{u.Name},
+	}}
+	for _, v := range []string{constants.QueryDelUserPortionsBinaryData, constants.QueryDelUserBinaryData,
+		constants.QueryDelUserTextData, constants.QueryDelUserBankCard, constants.QueryDelUserPairs,
+		constants.QueryDelUserSessions, constants.QueryRevokeUserDevices} {
+		arrActionDatabase = append(arrActionDatabase, ActionDatabase{
+			StrExec: v,
+			Arg:     []interface{}{u.Name},
+		})
+	}
 	arrActionDatabase = append(arrActionDatabase, ActionDatabase{
 		StrExec: constants.QueryDeleteUserTemplate,
 		Arg:     []interface{}{u.Name, u.HashPassword},
@@ -76,17 +90,18 @@ func (u *User) CheckExistence() (string, interface{}, error) {
 	return constants.QuerySelectUserWithPassword, arg, nil
 }
 
-// InstructionsUpdate метод объекта PairLoginPassword. Обновляет объект в БД, по пользователю и УИДу
+// InstructionsUpdate метод объекта User. Обновляет хешированный пароль пользователя в БД, по имени
 func (u *User) InstructionsUpdate() (string, interface{}, error) {
-	claims, ok := token.ExtractClaims(u.Name)
-	if !ok {
-		return "", nil, errs.ErrInvalidLoginPassword
-	}
-
-	arg := []interface{}{claims["user"], u.Password}
+	arg := []interface{}{u.Name, u.HashPassword}
 	return constants.QueryUpdatUserTemplate, arg, nil
 }
 
+// InstructionsUpsert метод объекта User. Добавляет пользователя или обновляет хешированный пароль в БД, по имени
+func (u *User) InstructionsUpsert() (string, interface{}, error) {
+	arg := []interface{}{u.Name, u.HashPassword}
+	return constants.QueryUpsertUserTemplate, arg, nil
+}
+
 // SetFromInListUserData метод объекта User. Добавляет оьъект в хранилище сервера InListUserData
 func (u *User) SetFromInListUserData(a Appender) {
 	a[u.Name] = u
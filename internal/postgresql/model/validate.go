@@ -0,0 +1,104 @@
+package model
+
+import (
+	"strconv"
+
+	"github.com/google/uuid"
+
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/constants/errs"
+)
+
+// Validator интерфейс проверки данных объекта перед помещением в хранилище сервера или в БД
+type Validator interface {
+	Validate() error
+}
+
+// validateIdentity проверка УИДа и события записи. Пустое событие означает добавление/изменение.
+// Возвращает true, если запись удаляется и остальные поля проверять не нужно
+func validateIdentity(ve *errs.ValidationError, uid, event string) bool {
+	if len(uid) != 36 {
+		ve.Add("uid", "must be a UUID")
+	} else if _, err := uuid.Parse(uid); err != nil {
+		ve.Add("uid", "must be a UUID")
+	}
+
+	switch event {
+	case "", constants.EventAddEdit.String():
+		return false
+	case constants.EventDel.String():
+		return true
+	default:
+		ve.Add("event", "must be "+constants.EventAddEdit.String()+" or "+constants.EventDel.String())
+		return false
+	}
+}
+
+// validateLength проверка обязательности и длины поля
+func validateLength(ve *errs.ValidationError, field, value string, max int, required bool) {
+	if required && value == "" {
+		ve.Add(field, "is required")
+		return
+	}
+	if len(value) > max {
+		ve.Add(field, "must be at most "+strconv.Itoa(max)+" bytes")
+	}
+}
+
+// Validate метод объекта PairLoginPassword. Проверяет УИД, событие и длины зашифрованных полей
+func (p *PairLoginPassword) Validate() error {
+	ve := &errs.ValidationError{}
+	if validateIdentity(ve, p.Uid, p.Event) {
+		return ve.Err()
+	}
+	validateLength(ve, "type_pair", p.TypePair, constants.MaxNameLength, false)
+	validateLength(ve, "name", p.Name, constants.MaxNameLength, true)
+	validateLength(ve, "password", p.Password, constants.MaxNameLength, false)
+	return ve.Err()
+}
+
+// Validate метод объекта TextData. Проверяет УИД, событие и длину зашифрованного текста
+func (t *TextData) Validate() error {
+	ve := &errs.ValidationError{}
+	if validateIdentity(ve, t.Uid, t.Event) {
+		return ve.Err()
+	}
+	validateLength(ve, "text", t.Text, constants.MaxTextLength, true)
+	return ve.Err()
+}
+
+// Validate метод объекта BinaryData. Проверяет УИД, событие, имя, расширение, путь и размер файла.
+// Размер обязателен: по нему сервер ограничивает порции файла и квоты
+func (b *BinaryData) Validate() error {
+	ve := &errs.ValidationError{}
+	if validateIdentity(ve, b.Uid, b.Event) {
+		return ve.Err()
+	}
+	validateLength(ve, "name", b.Name, constants.MaxFileNameLength, true)
+	validateLength(ve, "expansion", b.Expansion, constants.MaxExpansionLength, false)
+	validateLength(ve, "patch", b.Patch, constants.MaxPatchLength, false)
+	if _, ok := b.FileSize(); !ok {
+		ve.Add("size", "must be a positive integer")
+	}
+	return ve.Err()
+}
+
+// Validate метод объекта BankCard. Проверяет УИД, событие и длины зашифрованных номера и CVC
+func (b *BankCard) Validate() error {
+	ve := &errs.ValidationError{}
+	if validateIdentity(ve, b.Uid, b.Event) {
+		return ve.Err()
+	}
+	validateLength(ve, "number", b.Number, constants.MaxCardFieldLength, true)
+	validateLength(ve, "cvc", b.Cvc, constants.MaxCardFieldLength, false)
+	return ve.Err()
+}
+
+// Validate метод объекта User. Проверяет имя и пароль пользователя
+func (u *User) Validate() error {
+	ve := &errs.ValidationError{}
+	validateLength(ve, "login", u.Name, constants.MaxNameLength, true)
+	validateLength(ve, "password", u.Password, constants.MaxPasswordLength, true)
+	validateLength(ve, "new_password", u.NewPassword, constants.MaxPasswordLength, false)
+	return ve.Err()
+}
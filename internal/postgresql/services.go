@@ -20,7 +20,7 @@ type DataList struct {
 	SecondaryText string `json:"secondary_text"`
 }
 
-// CreateModeLDB при запуске сервера создает таблицы, если их не находит
+// CreateModeLDB при запуске сервера создает таблицы, если их не находит, и применяет миграции схемы (см. migrations)
 func CreateModeLDB(Pool *pgxpool.Pool) error {
 	ctx := context.Background()
 	conn, err := Pool.Acquire(ctx)
@@ -30,6 +30,13 @@ func CreateModeLDB(Pool *pgxpool.Pool) error {
 
 	if _, err = Pool.Exec(ctx, `CREATE SCHEMA IF NOT EXISTS gophkeeper`); err != nil {
 		constants.Logger.ErrorLog(err)
+		conn.Release()
+		return err
+	}
+
+	if err = migrate(ctx, Pool, true); err != nil {
+		constants.Logger.ErrorLog(err)
+		conn.Release()
 		return err
 	}
 
@@ -42,17 +49,21 @@ func CreateModeLDB(Pool *pgxpool.Pool) error {
 								TABLESPACE pg_default;
 								
 								ALTER TABLE IF EXISTS gophkeeper."Users"
-									OWNER to postgres;`)
+									OWNER to postgres;
+								
+								ALTER TABLE IF EXISTS gophkeeper."Users"
+									ADD COLUMN IF NOT EXISTS "Role" character varying(20) COLLATE pg_catalog."default" DEFAULT 'user',
+									ADD COLUMN IF NOT EXISTS "Disabled" boolean DEFAULT false;`)
 	if err != nil {
 		constants.Logger.ErrorLog(err)
 		conn.Release()
 		return err
 	}
 
-	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS gophkeeper."PairLoginPassword"
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS gophkeeper."PairsLoginPassword"
 								(
 									"User" character varying(150) COLLATE pg_catalog."default" NOT NULL,
-									"TypePair" character varying(150) COLLATE pg_catalog."default",
+									"TypePairs" character varying(150) COLLATE pg_catalog."default",
 									"Name" character varying(150) COLLATE pg_catalog."default",
 									"Password" character varying(150) COLLATE pg_catalog."default",
 									"UID" character varying(36) COLLATE pg_catalog."default" NOT NULL
@@ -60,7 +71,7 @@ func CreateModeLDB(Pool *pgxpool.Pool) error {
 								
 								TABLESPACE pg_default;
 								
-								ALTER TABLE IF EXISTS gophkeeper."PairLoginPassword"
+								ALTER TABLE IF EXISTS gophkeeper."PairsLoginPassword"
 									OWNER to postgres;`)
 
 	if err != nil {
@@ -144,6 +155,131 @@ func CreateModeLDB(Pool *pgxpool.Pool) error {
 		return err
 	}
 
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS gophkeeper."Lockouts"
+								(
+									"Key" character varying(200) COLLATE pg_catalog."default",
+									"Event" character varying(50) COLLATE pg_catalog."default",
+									"Failures" integer,
+									"Until" timestamp with time zone,
+									"Date" timestamp with time zone
+								)
+								
+								TABLESPACE pg_default;
+								
+								ALTER TABLE IF EXISTS gophkeeper."Lockouts"
+									OWNER to postgres;`)
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+		conn.Release()
+		return err
+	}
+
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS gophkeeper."Sessions"
+								(
+									"UID" character varying(36) COLLATE pg_catalog."default" PRIMARY KEY,
+									"User" character varying(150) COLLATE pg_catalog."default",
+									"Device" character varying(150) COLLATE pg_catalog."default",
+									"Build" character varying(150) COLLATE pg_catalog."default",
+									"IP" character varying(50) COLLATE pg_catalog."default",
+									"Created" timestamp with time zone,
+									"LastSeen" timestamp with time zone,
+									"Revoked" boolean
+								)
+								
+								TABLESPACE pg_default;
+								
+								ALTER TABLE IF EXISTS gophkeeper."Sessions"
+									OWNER to postgres;
+								
+								ALTER TABLE IF EXISTS gophkeeper."Sessions"
+									ADD COLUMN IF NOT EXISTS "DeviceID" character varying(36) COLLATE pg_catalog."default";`)
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+		conn.Release()
+		return err
+	}
+
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS gophkeeper."Devices"
+								(
+									"UID" character varying(36) COLLATE pg_catalog."default" PRIMARY KEY,
+									"User" character varying(150) COLLATE pg_catalog."default",
+									"Name" character varying(150) COLLATE pg_catalog."default",
+									"Serial" character varying(50) COLLATE pg_catalog."default",
+									"Created" timestamp with time zone,
+									"NotAfter" timestamp with time zone,
+									"Revoked" boolean
+								)
+								
+								TABLESPACE pg_default;
+								
+								ALTER TABLE IF EXISTS gophkeeper."Devices"
+									OWNER to postgres;`)
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+		conn.Release()
+		return err
+	}
+
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS gophkeeper."Audit"
+								(
+									"ID" bigserial PRIMARY KEY,
+									"User" character varying(150) COLLATE pg_catalog."default",
+									"Event" character varying(50) COLLATE pg_catalog."default",
+									"Type" character varying(50) COLLATE pg_catalog."default",
+									"UID" character varying(36) COLLATE pg_catalog."default",
+									"IP" character varying(50) COLLATE pg_catalog."default",
+									"Session" character varying(36) COLLATE pg_catalog."default",
+									"Success" boolean,
+									"Date" timestamp with time zone
+								)
+								
+								TABLESPACE pg_default;
+								
+								ALTER TABLE IF EXISTS gophkeeper."Audit"
+									OWNER to postgres;
+								
+								ALTER TABLE IF EXISTS gophkeeper."Audit"
+									ADD COLUMN IF NOT EXISTS "PrevHash" character varying(64) COLLATE pg_catalog."default",
+									ADD COLUMN IF NOT EXISTS "Hash" character varying(64) COLLATE pg_catalog."default";
+								
+								CREATE OR REPLACE RULE "AuditNoUpdate" AS ON UPDATE TO gophkeeper."Audit" DO INSTEAD NOTHING;
+								CREATE OR REPLACE RULE "AuditNoDelete" AS ON DELETE TO gophkeeper."Audit" DO INSTEAD NOTHING;`)
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+		conn.Release()
+		return err
+	}
+
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS gophkeeper."AuditCheckpoints"
+								(
+									"ID" bigserial PRIMARY KEY,
+									"AuditID" bigint,
+									"Hash" character varying(64) COLLATE pg_catalog."default",
+									"Signature" character varying(128) COLLATE pg_catalog."default",
+									"Date" timestamp with time zone
+								)
+								
+								TABLESPACE pg_default;
+								
+								ALTER TABLE IF EXISTS gophkeeper."AuditCheckpoints"
+									OWNER to postgres;
+								
+								CREATE OR REPLACE RULE "AuditCheckpointsNoUpdate" AS ON UPDATE TO gophkeeper."AuditCheckpoints" 
+									DO INSTEAD NOTHING;
+								CREATE OR REPLACE RULE "AuditCheckpointsNoDelete" AS ON DELETE TO gophkeeper."AuditCheckpoints" 
+									DO INSTEAD NOTHING;`)
+	if err != nil {
+		constants.Logger.ErrorLog(err)
+		conn.Release()
+		return err
+	}
+	conn.Release()
+
+	if err = migrate(ctx, Pool, false); err != nil {
+		constants.Logger.ErrorLog(err)
+		return err
+	}
+
 	return nil
 }
 
@@ -227,7 +363,7 @@ func (conn *PgxpoolConn) Delete(ctx context.Context) error {
 	}
 
 	if err = tx.Commit(ctx); err != nil {
-		constants.Logger.ErrorLog(err)
+		constants.Logger.Ctx(ctx).ErrorLog(err)
 		return errs.InvalidFormat
 	}
 
@@ -254,13 +390,13 @@ func (conn *PgxpoolConn) Select(ctx context.Context) (model.Appender, error) {
 	for rows.Next() {
 		app, err := model.NewAppender(actionDatabase.Type, actionDatabase.User)
 		if err != nil {
-			constants.Logger.ErrorLog(err)
+			constants.Logger.Ctx(ctx).ErrorLog(err)
 			continue
 		}
 
 		err = rows.Scan(app.ArgOut...)
 		if err != nil {
-			constants.Logger.ErrorLog(err)
+			constants.Logger.Ctx(ctx).ErrorLog(err)
 			continue
 		}
 
@@ -0,0 +1,296 @@
+// Package staging: хранилище сервера для изменений, ожидающих сохранения в БД.
+// Хранилище разбито на шарды по пользователю: запись в хранилище блокирует только шард пользователя
+// и никогда не ждет обращений к БД. Сохранение шарда работает со снимком записей, который берется
+// под блокировкой шарда, а сами обращения к БД выполняются без нее
+package staging
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"gophkeeper/internal/postgresql/model"
+)
+
+// ErrFull хранилище заполнено: новые записи не принимаются, пока сохранение в БД не освободит место
+var ErrFull = errors.New("staging buffer full")
+
+// Значения по умолчанию количества шардов и емкости хранилища.
+// MaxBatch наибольшее количество записей шарда, которые передаются на сохранение за один вызов SaveFunc
+const (
+	DefaultShards   = 16
+	DefaultCapacity = 100000
+	MaxBatch        = 1000
+)
+
+// Key ключ записи хранилища: пользователь, тип и УИД записи. Пользователь определяет шард и входит
+// в ключ, что бы запись одного пользователя не заменила запись другого с тем же УИДом
+type Key struct {
+	User string
+	Type string
+	Uid  string
+}
+
+// Item запись хранилища. Span span запроса, которым запись попала в хранилище, Audit записи журнала аудита
+// запросов, которыми запись попала в хранилище (пишутся в журнал после сохранения записи в БД),
+// Seq номер версии записи, Attempts количество неудачных попыток сохранения
+type Item struct {
+	Key
+	Record   model.Updater
+	Span     trace.SpanContext
+	Audit    []model.AuditRecord
+	Seq      uint64
+	Attempts int
+}
+
+// SaveFunc сохранение пакета записей в БД. Возвращает nil, если сохранены все записи, иначе
+// ошибки сохранения по индексам записей пакета (nil для сохраненной записи)
+type SaveFunc func(ctx context.Context, items []Item) []error
+
+// Buffer шардированное хранилище с ограниченной емкостью
+type Buffer struct {
+	shards   []*shard
+	capacity int64
+	count    atomic.Int64
+	seq      atomic.Uint64
+}
+
+// shard часть хранилища. mu защищает items и удерживается только на время работы с картой,
+// flush удерживается на все время сохранения шарда в БД
+type shard struct {
+	mu    sync.Mutex
+	items map[Key]*Item
+	flush sync.Mutex
+}
+
+// New создание хранилища из shards шардов емкостью capacity записей.
+// Неположительные значения заменяются значениями по умолчанию
+func New(shards, capacity int) *Buffer {
+	if shards <= 0 {
+		shards = DefaultShards
+	}
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+
+	b := &Buffer{shards: make([]*shard, shards), capacity: int64(capacity)}
+	for i := range b.shards {
+		b.shards[i] = &shard{items: map[Key]*Item{}}
+	}
+	return b
+}
+
+// shard шард пользователя user
+func (b *Buffer) shard(user string) *shard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(user))
+	return b.shards[h.Sum32()%uint32(len(b.shards))]
+}
+
+// Put кладет запись в хранилище. Более новая версия записи заменяет старую и не занимает места,
+// записи аудита старой версии переходят к новой. Если хранилище заполнено, то возвращает ErrFull
+func (b *Buffer) Put(item Item) error {
+	s := b.shard(item.User)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if old, ok := s.items[item.Key]; ok {
+		item.Audit = append(old.Audit[:len(old.Audit):len(old.Audit)], item.Audit...)
+	} else if b.count.Add(1) > b.capacity {
+		b.count.Add(-1)
+		return ErrFull
+	}
+	item.Seq = b.seq.Add(1)
+	item.Attempts = 0
+	s.items[item.Key] = &item
+	return nil
+}
+
+// Requeue возвращает запись в хранилище, если в нем нет более новой версии. Емкость не проверяется:
+// запись уже была принята хранилищем. Если более новая версия есть, то к ней переходят записи аудита.
+// Возвращает признак, что запись возвращена
+func (b *Buffer) Requeue(item Item) bool {
+	s := b.shard(item.User)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cur, ok := s.items[item.Key]; ok {
+		cur.Audit = append(item.Audit[:len(item.Audit):len(item.Audit)], cur.Audit...)
+		return false
+	}
+	b.count.Add(1)
+	item.Seq = b.seq.Add(1)
+	item.Attempts = 0
+	s.items[item.Key] = &item
+	return true
+}
+
+// User снимок записей пользователя user типа t
+func (b *Buffer) User(user, t string) []Item {
+	s := b.shard(user)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var arr []Item
+	for k, v := range s.items {
+		if k.Type == t && v.User == user {
+			arr = append(arr, *v)
+		}
+	}
+	return arr
+}
+
+// Get запись пользователя user по типу и УИДу из key
+func (b *Buffer) Get(user string, key Key) (Item, bool) {
+	s := b.shard(user)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key.User = user
+	v, ok := s.items[key]
+	if !ok {
+		return Item{}, false
+	}
+	return *v, true
+}
+
+// Len количество записей в хранилище
+func (b *Buffer) Len() int {
+	return int(b.count.Load())
+}
+
+// LenByType количество записей в хранилище по типам
+func (b *Buffer) LenByType() map[string]int {
+	res := map[string]int{}
+	for _, s := range b.shards {
+		s.mu.Lock()
+		for k := range s.items {
+			res[k.Type]++
+		}
+		s.mu.Unlock()
+	}
+	return res
+}
+
+// LockUser ждет окончания сохранения шарда пользователя user и не дает начать новое до вызова
+// возвращенной функции. Используется, когда изменения пользователя применяются в БД минуя хранилище,
+// что бы сохранение старой версии записи не перезаписало результат. Запись в хранилище не блокируется
+func (b *Buffer) LockUser(user string) func() {
+	s := b.shard(user)
+	s.flush.Lock()
+	return s.flush.Unlock
+}
+
+// Remove удаляет записи пользователя user по типам и УИДам из keys
+func (b *Buffer) Remove(user string, keys ...Key) {
+	s := b.shard(user)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range keys {
+		k.User = user
+		if _, ok := s.items[k]; ok {
+			delete(s.items, k)
+			b.count.Add(-1)
+		}
+	}
+}
+
+// RemoveUser удаляет все записи пользователя user
+func (b *Buffer) RemoveUser(user string) {
+	s := b.shard(user)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, v := range s.items {
+		if v.User == user {
+			delete(s.items, k)
+			b.count.Add(-1)
+		}
+	}
+}
+
+// Flush сохраняет все шарды в БД функцией save, шарды сохраняются параллельно пакетами не больше MaxBatch записей.
+// Запись удаляется из хранилища после успешного сохранения, только если ее не заменили более новой версией.
+// После неудачного сохранения вызывается failed с количеством попыток, если failed возвращает true, то
+// запись удаляется из хранилища. Сохранение прерывается, когда заканчивается время ctx.
+// Возвращает количество сохраненных записей
+func (b *Buffer) Flush(ctx context.Context, save SaveFunc, failed func(item Item, err error) bool) int {
+	var wg sync.WaitGroup
+	var saved atomic.Int64
+	for _, s := range b.shards {
+		wg.Add(1)
+		go func(s *shard) {
+			defer wg.Done()
+			saved.Add(int64(b.flushShard(ctx, s, nil, save, failed)))
+		}(s)
+	}
+	wg.Wait()
+	return int(saved.Load())
+}
+
+// FlushUser сохраняет в БД записи пользователя user, не дожидаясь общего сохранения, как Flush.
+// Возвращает количество сохраненных записей
+func (b *Buffer) FlushUser(ctx context.Context, user string, save SaveFunc, failed func(item Item, err error) bool) int {
+	return b.flushShard(ctx, b.shard(user), func(item *Item) bool { return item.User == user }, save, failed)
+}
+
+// flushShard сохранение записей шарда, отобранных filter (nil - все записи).
+// Блокировка шарда удерживается только на время снимка и подтверждения пакета
+func (b *Buffer) flushShard(ctx context.Context, s *shard, filter func(item *Item) bool, save SaveFunc,
+	failed func(item Item, err error) bool) int {
+	s.flush.Lock()
+	defer s.flush.Unlock()
+
+	s.mu.Lock()
+	snapshot := make([]Item, 0, len(s.items))
+	for _, v := range s.items {
+		if filter == nil || filter(v) {
+			snapshot = append(snapshot, *v)
+		}
+	}
+	s.mu.Unlock()
+
+	saved := 0
+	for len(snapshot) > 0 {
+		if ctx.Err() != nil {
+			break
+		}
+		n := len(snapshot)
+		if n > MaxBatch {
+			n = MaxBatch
+		}
+		batch := snapshot[:n]
+		snapshot = snapshot[n:]
+		arrErr := save(ctx, batch)
+
+		s.mu.Lock()
+		for i, item := range batch {
+			var err error
+			if arrErr != nil {
+				err = arrErr[i]
+			}
+			cur, ok := s.items[item.Key]
+			if !ok || cur.Seq != item.Seq {
+				continue
+			}
+			if err == nil {
+				delete(s.items, item.Key)
+				b.count.Add(-1)
+				saved++
+				continue
+			}
+			cur.Attempts++
+			if failed != nil && failed(*cur, err) {
+				delete(s.items, item.Key)
+				b.count.Add(-1)
+			}
+		}
+		s.mu.Unlock()
+	}
+	return saved
+}
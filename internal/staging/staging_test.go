@@ -0,0 +1,277 @@
+package staging
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gophkeeper/internal/postgresql/model"
+)
+
+func newItem(user, uid, text string) Item {
+	return Item{Key: Key{User: user, Type: "text", Uid: uid}, Record: &model.TextData{Uid: uid, Text: text}}
+}
+
+func TestBuffer(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Checking put and replace", func(t *testing.T) {
+		b := New(4, 2)
+		if err := b.Put(newItem("user", "1", "a")); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Put(newItem("user", "1", "b")); err != nil {
+			t.Errorf("Error replacing record: %v", err)
+		}
+		if b.Len() != 1 {
+			t.Errorf("Expected 1 record, got %d", b.Len())
+		}
+		item, ok := b.Get("user", Key{Type: "text", Uid: "1"})
+		if !ok || item.Record.(*model.TextData).Text != "b" {
+			t.Errorf("Error getting replaced record: %+v", item)
+		}
+		if _, ok = b.Get("other", Key{Type: "text", Uid: "1"}); ok {
+			t.Error("Record of other user is returned")
+		}
+	})
+
+	t.Run("Checking same uid of other user", func(t *testing.T) {
+		// один шард на всех пользователей: ключи пользователей с одним УИДом не должны совпадать
+		b := New(1, 10)
+		if err := b.Put(newItem("user", "1", "a")); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Put(newItem("other", "1", "b")); err != nil {
+			t.Fatal(err)
+		}
+		item, ok := b.Get("user", Key{Type: "text", Uid: "1"})
+		if !ok || item.Record.(*model.TextData).Text != "a" {
+			t.Errorf("Record is overwritten by other user: %+v", item)
+		}
+		b.Remove("other", Key{Type: "text", Uid: "1"})
+		if _, ok = b.Get("user", Key{Type: "text", Uid: "1"}); !ok || b.Len() != 1 {
+			t.Errorf("Record is removed by other user: %d", b.Len())
+		}
+	})
+
+	t.Run("Checking audit of replaced record", func(t *testing.T) {
+		b := New(1, 10)
+		for _, uid := range []string{"a", "b"} {
+			item := newItem("user", "1", uid)
+			item.Audit = []model.AuditRecord{{Uid: uid}}
+			if err := b.Put(item); err != nil {
+				t.Fatal(err)
+			}
+		}
+		item, _ := b.Get("user", Key{Type: "text", Uid: "1"})
+		if len(item.Audit) != 2 || item.Audit[0].Uid != "a" || item.Audit[1].Uid != "b" {
+			t.Errorf("Audit of replaced record is lost: %+v", item.Audit)
+		}
+	})
+
+	t.Run("Checking capacity", func(t *testing.T) {
+		b := New(4, 2)
+		_ = b.Put(newItem("user", "1", ""))
+		_ = b.Put(newItem("other", "2", ""))
+		if err := b.Put(newItem("user", "3", "")); !errors.Is(err, ErrFull) {
+			t.Errorf("Expected ErrFull, got %v", err)
+		}
+		if err := b.Put(newItem("user", "1", "new")); err != nil {
+			t.Errorf("Error replacing record in full buffer: %v", err)
+		}
+		b.RemoveUser("user")
+		if b.Len() != 1 || len(b.User("other", "text")) != 1 {
+			t.Errorf("Error removing user records: %d", b.Len())
+		}
+		if err := b.Put(newItem("user", "3", "")); err != nil {
+			t.Errorf("Error putting record after remove: %v", err)
+		}
+	})
+
+	t.Run("Checking flush", func(t *testing.T) {
+		b := New(4, 100)
+		for i := 0; i < 10; i++ {
+			_ = b.Put(newItem("user"+strconv.Itoa(i%3), strconv.Itoa(i), ""))
+		}
+		n := b.Flush(ctx, func(ctx context.Context, items []Item) []error { return nil }, nil)
+		if n != 10 || b.Len() != 0 {
+			t.Errorf("Expected 10 saved records, got %d, left %d", n, b.Len())
+		}
+	})
+
+	t.Run("Checking batches", func(t *testing.T) {
+		b := New(1, 10000)
+		for i := 0; i < 2*MaxBatch+10; i++ {
+			_ = b.Put(newItem("user", strconv.Itoa(i), ""))
+		}
+
+		var sizes []int
+		save := func(ctx context.Context, items []Item) []error {
+			sizes = append(sizes, len(items))
+			arrErr := make([]error, len(items))
+			arrErr[0] = errors.New("invalid record")
+			return arrErr
+		}
+		n := b.Flush(ctx, save, nil)
+		if len(sizes) != 3 || sizes[0] != MaxBatch || sizes[2] != 10 {
+			t.Errorf("Error splitting batches: %v", sizes)
+		}
+		if n != 2*MaxBatch+7 || b.Len() != 3 {
+			t.Errorf("Expected failed records left, saved %d, left %d", n, b.Len())
+		}
+	})
+
+	t.Run("Checking flush user", func(t *testing.T) {
+		b := New(1, 100)
+		_ = b.Put(newItem("user", "1", ""))
+		_ = b.Put(newItem("other", "2", ""))
+
+		n := b.FlushUser(ctx, "user", func(ctx context.Context, items []Item) []error {
+			for _, item := range items {
+				if item.User != "user" {
+					t.Errorf("Record of other user is flushed: %+v", item)
+				}
+			}
+			return nil
+		}, nil)
+		if n != 1 || b.Len() != 1 {
+			t.Errorf("Expected 1 saved record, got %d, left %d", n, b.Len())
+		}
+	})
+
+	t.Run("Checking newer version during flush", func(t *testing.T) {
+		b := New(1, 100)
+		_ = b.Put(newItem("user", "1", "old"))
+
+		save := func(ctx context.Context, items []Item) []error {
+			if err := b.Put(newItem("user", "1", "new")); err != nil {
+				t.Error(err)
+			}
+			return nil
+		}
+		if n := b.Flush(ctx, save, nil); n != 0 {
+			t.Errorf("Expected no records acknowledged, got %d", n)
+		}
+		item, ok := b.Get("user", Key{Type: "text", Uid: "1"})
+		if !ok || item.Record.(*model.TextData).Text != "new" {
+			t.Errorf("Newer version is lost: %+v", item)
+		}
+	})
+
+	t.Run("Checking failed flush", func(t *testing.T) {
+		b := New(2, 100)
+		_ = b.Put(newItem("user", "1", ""))
+
+		save := func(ctx context.Context, items []Item) []error {
+			return []error{errors.New("db is down")}
+		}
+		var attempts []int
+		failed := func(item Item, err error) bool {
+			attempts = append(attempts, item.Attempts)
+			return item.Attempts >= 2
+		}
+		b.Flush(ctx, save, failed)
+		if b.Len() != 1 {
+			t.Error("Record removed after first failure")
+		}
+		b.Flush(ctx, save, failed)
+		if b.Len() != 0 || len(attempts) != 2 || attempts[1] != 2 {
+			t.Errorf("Error removing failed record: %v", attempts)
+		}
+
+		item := newItem("user", "1", "")
+		if !b.Requeue(item) || b.Requeue(item) || b.Len() != 1 {
+			t.Error("Error requeueing record")
+		}
+	})
+
+	t.Run("Checking lock user", func(t *testing.T) {
+		b := New(1, 100)
+		_ = b.Put(newItem("user", "1", ""))
+
+		unlock := b.LockUser("user")
+		done := make(chan int)
+		go func() {
+			done <- b.Flush(ctx, func(ctx context.Context, items []Item) []error { return nil }, nil)
+		}()
+
+		if err := b.Put(newItem("user", "2", "")); err != nil {
+			t.Errorf("Put is blocked by locked user: %v", err)
+		}
+		b.Remove("user", Key{Type: "text", Uid: "1"}, Key{Type: "text", Uid: "2"})
+		select {
+		case <-done:
+			t.Error("Flush is not blocked by locked user")
+		case <-time.After(50 * time.Millisecond):
+		}
+		unlock()
+		if n := <-done; n != 0 || b.Len() != 0 {
+			t.Errorf("Removed records are flushed: %d", n)
+		}
+	})
+}
+
+// benchmarkPut параллельная запись в хранилище из shards шардов
+func benchmarkPut(b *testing.B, shards int) {
+	buf := New(shards, b.N+1)
+	var n atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		user := "user" + strconv.FormatInt(n.Add(1), 10)
+		i := 0
+		for pb.Next() {
+			i++
+			if err := buf.Put(newItem(user, strconv.Itoa(i), "")); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkPut1Shard(b *testing.B) {
+	benchmarkPut(b, 1)
+}
+
+func BenchmarkPut16Shards(b *testing.B) {
+	benchmarkPut(b, DefaultShards)
+}
+
+// BenchmarkPutDuringFlush запись в хранилище, пока идет медленное сохранение в БД:
+// писатели не должны ждать обращений к БД
+func BenchmarkPutDuringFlush(b *testing.B) {
+	buf := New(DefaultShards, b.N+1000)
+	for i := 0; i < 1000; i++ {
+		_ = buf.Put(newItem("user"+strconv.Itoa(i%100), "seed"+strconv.Itoa(i), ""))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf.Flush(ctx, func(ctx context.Context, items []Item) []error {
+			select {
+			case <-time.After(time.Duration(len(items)) * time.Millisecond):
+			case <-ctx.Done():
+			}
+			return nil
+		}, nil)
+	}()
+
+	var n atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		user := "user" + strconv.FormatInt(n.Add(1), 10)
+		i := 0
+		for pb.Next() {
+			i++
+			if err := buf.Put(newItem(user, strconv.Itoa(i), "")); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.StopTimer()
+	cancel()
+	<-done
+}
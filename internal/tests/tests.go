@@ -2,12 +2,29 @@
 package tests
 
 import (
+	"os"
+
 	"gophkeeper/internal/constants"
 	"gophkeeper/internal/cryptography"
 	"gophkeeper/internal/encryption"
 	"gophkeeper/internal/postgresql/model"
+	"gophkeeper/internal/token"
 )
 
+// TokenKey секрет подписи токенов в тестах, если он не задан параметром сеанса TOKEN_KEY
+const TokenKey = "gophkeeper test token signing key"
+
+// InitTokenKey задает секрет подписи токенов в тестах: из параметра сеанса TOKEN_KEY или TokenKey.
+// Сервер, запущенный в тестах, читает секрет из того же параметра сеанса
+func InitTokenKey() {
+	key, ok := os.LookupEnv("TOKEN_KEY")
+	if !ok {
+		key = TokenKey
+		_ = os.Setenv("TOKEN_KEY", key)
+	}
+	token.SetSigningKey([]byte(key))
+}
+
 // CreateUser создание сущности User для тестов
 func CreateUser(event string) model.User {
 	return model.User{
@@ -0,0 +1,202 @@
+// Package tlsutil: сертификаты TLS сервера и проверка сертификата сервера на клиенте
+package tlsutil
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrFingerprintMismatch отпечаток сертификата сервера не совпадает с закрепленным
+var ErrFingerprintMismatch = errors.New("server certificate fingerprint mismatch")
+
+// LoadOrCreateServerCert читает сертификат и ключ сервера из файлов.
+// Если файлов нет, то создает самоподписанный сертификат для указанных хостов и сохраняет его
+func LoadOrCreateServerCert(certFile, keyFile string, hosts []string) (tls.Certificate, error) {
+	_, errCert := os.Stat(certFile)
+	_, errKey := os.Stat(keyFile)
+	if errors.Is(errCert, os.ErrNotExist) && errors.Is(errKey, os.ErrNotExist) {
+		if err := createSelfSigned(certFile, keyFile, hosts); err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+
+	return tls.LoadX509KeyPair(certFile, keyFile)
+}
+
+// createSelfSigned создает самоподписанный сертификат ECDSA P-256 сроком на 10 лет
+func createSelfSigned(certFile, keyFile string, hosts []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serial, err := newSerial()
+	if err != nil {
+		return err
+	}
+
+	tmpl := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"gophkeeper"}, CommonName: "gophkeeper server"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else if h != "" {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	return writeKeyPair(certFile, keyFile, der, key)
+}
+
+// ServerHosts возвращает список хостов для самоподписанного сертификата по адресу сервера
+func ServerHosts(address string) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	host, _, err := net.SplitHostPort(address)
+	if err == nil && host != "" && host != "localhost" {
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+// Fingerprint отпечаток сертификата: SHA-256 от DER в шестнадцатеричном виде
+func Fingerprint(der []byte) string {
+	h := sha256.Sum256(der)
+	return hex.EncodeToString(h[:])
+}
+
+// normalizeFingerprint приводит отпечаток к виду без двоеточий в нижнем регистре
+func normalizeFingerprint(fp string) string {
+	return strings.ToLower(strings.ReplaceAll(fp, ":", ""))
+}
+
+// ClientOptions параметры проверки сертификата сервера на клиенте.
+// Pin закрепленный отпечаток сертификата. CAFile файл с корневыми сертификатами.
+// KnownHosts файл отпечатков серверов для доверия при первом подключении (trust-on-first-use).
+// CertFile и KeyFile сертификат устройства, который предъявляется серверу, если файлы существуют
+type ClientOptions struct {
+	Pin        string
+	CAFile     string
+	KnownHosts string
+	CertFile   string
+	KeyFile    string
+}
+
+// ClientConfig создает конфигурацию TLS клиента.
+// Приоритет проверки: закрепленный отпечаток, файл корневых сертификатов, доверие при первом подключении
+func ClientConfig(host string, opts ClientOptions) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if opts.CertFile != "" && opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if err == nil {
+			cfg.Certificates = []tls.Certificate{cert}
+		}
+	}
+
+	switch {
+	case opts.Pin != "":
+		pin := normalizeFingerprint(opts.Pin)
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 || Fingerprint(rawCerts[0]) != pin {
+				return ErrFingerprintMismatch
+			}
+			return nil
+		}
+	case opts.CAFile != "":
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", opts.CAFile)
+		}
+		cfg.RootCAs = pool
+	case opts.KnownHosts != "":
+		kh := &knownHosts{path: opts.KnownHosts}
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return ErrFingerprintMismatch
+			}
+			return kh.verify(host, Fingerprint(rawCerts[0]))
+		}
+	}
+
+	return cfg, nil
+}
+
+// knownHosts файл отпечатков сертификатов серверов. Формат строки: "хост отпечаток"
+type knownHosts struct {
+	sync.Mutex
+	path string
+}
+
+// verify проверяет отпечаток сертификата хоста. При первом подключении к хосту отпечаток запоминается
+func (kh *knownHosts) verify(host, fp string) error {
+	kh.Lock()
+	defer kh.Unlock()
+
+	file, err := os.Open(kh.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) != 2 || fields[0] != host {
+				continue
+			}
+			_ = file.Close()
+			if normalizeFingerprint(fields[1]) != fp {
+				return fmt.Errorf("%w for %s (known hosts %s)", ErrFingerprintMismatch, host, kh.path)
+			}
+			return nil
+		}
+		_ = file.Close()
+	}
+
+	if err = os.MkdirAll(filepath.Dir(kh.path), 0700); err != nil {
+		return err
+	}
+	file, err = os.OpenFile(kh.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = fmt.Fprintf(file, "%s %s\n", host, fp)
+	return err
+}
@@ -0,0 +1,163 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+
+	cert, err := LoadOrCreateServerCert(certFile, keyFile, ServerHosts("127.0.0.1:8080"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := Fingerprint(cert.Certificate[0])
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	ts.StartTLS()
+	defer ts.Close()
+	host := ts.Listener.Addr().String()
+
+	get := func(opts ClientOptions) error {
+		cfg, err := ClientConfig(host, opts)
+		if err != nil {
+			return err
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	t.Run("Checking reuse of existing certificate", func(t *testing.T) {
+		again, err := LoadOrCreateServerCert(certFile, keyFile, nil)
+		if err != nil || Fingerprint(again.Certificate[0]) != fp {
+			t.Errorf("Error checking reuse of existing certificate")
+		}
+	})
+
+	t.Run("Checking pinned fingerprint", func(t *testing.T) {
+		if err := get(ClientOptions{Pin: fp}); err != nil {
+			t.Errorf("Error checking pinned fingerprint: %v", err)
+		}
+		if err := get(ClientOptions{Pin: "00" + fp[2:]}); !errors.Is(err, ErrFingerprintMismatch) {
+			t.Errorf("Error checking wrong pinned fingerprint: %v", err)
+		}
+	})
+
+	t.Run("Checking CA file", func(t *testing.T) {
+		if err := get(ClientOptions{CAFile: certFile}); err != nil {
+			t.Errorf("Error checking CA file: %v", err)
+		}
+	})
+
+	t.Run("Checking trust on first use", func(t *testing.T) {
+		knownHosts := filepath.Join(dir, "known", "known_hosts")
+		if err := get(ClientOptions{KnownHosts: knownHosts}); err != nil {
+			t.Errorf("Error checking first use: %v", err)
+		}
+		if err := get(ClientOptions{KnownHosts: knownHosts}); err != nil {
+			t.Errorf("Error checking known host: %v", err)
+		}
+
+		other, err := LoadOrCreateServerCert(filepath.Join(dir, "other.crt"), filepath.Join(dir, "other.key"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ts.TLS.Certificates = []tls.Certificate{other}
+		if err := get(ClientOptions{KnownHosts: knownHosts}); !errors.Is(err, ErrFingerprintMismatch) {
+			t.Errorf("Error checking changed certificate: %v", err)
+		}
+	})
+}
+
+func TestDeviceCA(t *testing.T) {
+	dir := t.TempDir()
+
+	ca, err := LoadOrCreateCA(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCert, err := LoadOrCreateServerCert(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"),
+		ServerHosts("127.0.0.1:8080"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var user, device string
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, device = "", ""
+		if len(r.TLS.VerifiedChains) > 0 {
+			user, device = DeviceFromCert(r.TLS.VerifiedChains[0][0])
+		}
+	}))
+	ts.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    ca.Pool,
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	get := func(opts ClientOptions) error {
+		opts.CAFile = filepath.Join(dir, "server.crt")
+		cfg, err := ClientConfig(ts.Listener.Addr().String(), opts)
+		if err != nil {
+			return err
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	t.Run("Checking request without device certificate", func(t *testing.T) {
+		if err := get(ClientOptions{}); err != nil || device != "" {
+			t.Errorf("Error checking request without device certificate: %v", err)
+		}
+	})
+
+	t.Run("Checking invalid CSR", func(t *testing.T) {
+		if _, _, err := ca.IssueDevice([]byte("not a csr"), "test", "device", time.Hour); !errors.Is(err, ErrInvalidCSR) {
+			t.Errorf("Error checking invalid CSR: %v", err)
+		}
+	})
+
+	t.Run("Checking device certificate", func(t *testing.T) {
+		keyPEM, csrPEM, err := NewDeviceKey("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		certPEM, _, err := ca.IssueDevice(csrPEM, "test", "device-uid", time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		certFile := filepath.Join(dir, "device.crt")
+		keyFile := filepath.Join(dir, "device.key")
+		if err = os.WriteFile(certFile, certPEM, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = get(ClientOptions{CertFile: certFile, KeyFile: keyFile}); err != nil || user != "test" || device != "device-uid" {
+			t.Errorf("Error checking device certificate: %v", err)
+		}
+	})
+}
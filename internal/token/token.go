@@ -2,6 +2,8 @@
 package token
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -9,10 +11,39 @@ import (
 	"gophkeeper/internal/constants"
 )
 
+// ErrNoSigningKey секрет подписи токенов не задан
+var ErrNoSigningKey = errors.New("token signing key is not set")
+
+// signingKey секрет подписи токенов. Задается при старте сервера из конфигурации (см. SetSigningKey)
+var signingKey []byte
+
+// SetSigningKey задает секрет подписи токенов. Вызывается до обработки запросов
+func SetSigningKey(key []byte) {
+	signingKey = key
+}
+
+// keyFunc секрет проверки подписи токена. Принимаются только токены, подписанные HMAC
+func keyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+	}
+	if len(signingKey) == 0 {
+		return nil, ErrNoSigningKey
+	}
+	return signingKey, nil
+}
+
+// Parse разбор токена с проверкой подписи и срока действия
+func Parse(tokenStr string) (*jwt.Token, error) {
+	return jwt.Parse(tokenStr, keyFunc)
+}
+
 // Claims данные токена, полусенные с сервера
 type Claims struct {
 	Authorized bool
 	User       string
+	Session    string
+	Device     string
 	Exp        int64
 }
 
@@ -23,10 +54,19 @@ func (c *Claims) GenerateJWT() (string, error) {
 	claims := token.Claims.(jwt.MapClaims)
 
 	claims["authorized"] = c.Authorized
+	if c.Session != "" {
+		claims["session"] = c.Session
+	}
+	if c.Device != "" {
+		claims["device"] = c.Device
+	}
 	claims["user"] = c.User
 	claims["exp"] = c.Exp
 
-	tokenString, err := token.SignedString(constants.HashKey)
+	if len(signingKey) == 0 {
+		return "", ErrNoSigningKey
+	}
+	tokenString, err := token.SignedString(signingKey)
 
 	if err != nil {
 		constants.Logger.ErrorLog(err)
@@ -38,10 +78,7 @@ func (c *Claims) GenerateJWT() (string, error) {
 
 // ExtractClaims получение имя пользователя из токена
 func ExtractClaims(tokenStr string) (jwt.MapClaims, bool) {
-	hmacSecret := constants.HashKey
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		return hmacSecret, nil
-	})
+	token, err := Parse(tokenStr)
 	if err != nil {
 		return nil, false
 	}
@@ -61,3 +98,23 @@ func NewClaims(name string) *Claims {
 		Exp:        time.Now().Add(time.Hour * constants.TimeLiveToken).Unix(),
 	}
 }
+
+// SessionFromToken получение УИДа сессии из токена. Для токенов без сессии возвращает пустую строку
+func SessionFromToken(tokenStr string) string {
+	claims, ok := ExtractClaims(tokenStr)
+	if !ok {
+		return ""
+	}
+	session, _ := claims["session"].(string)
+	return session
+}
+
+// DeviceFromToken получение УИДа устройства из токена. Для токенов без устройства возвращает пустую строку
+func DeviceFromToken(tokenStr string) string {
+	claims, ok := ExtractClaims(tokenStr)
+	if !ok {
+		return ""
+	}
+	device, _ := claims["device"].(string)
+	return device
+}
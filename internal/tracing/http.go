@@ -0,0 +1,107 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"gophkeeper/internal/constants/errs"
+)
+
+// Middleware middleware трассировки запросов сервера. Продолжает трассировку клиента из хедеров запроса
+// (или начинает новую), создает span с именем по шаблону маршрута и кладет его в контекст запроса
+// для хедлеров, хранилища и БД. Идентификатор трассировки отдается в хедере X-Trace-ID.
+// Span запроса открытия websocket длится все время жизни соединения
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := ""
+		if cr := mux.CurrentRoute(r); cr != nil {
+			route, _ = cr.GetPathTemplate()
+		}
+		name := "HTTP " + r.Method
+		if route != "" {
+			name = r.Method + " " + route
+		}
+
+		ctx, span := Tracer().Start(Extract(r.Context(), r.Header), name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPMethodKey.String(r.Method), semconv.HTTPRouteKey.String(route)))
+		defer span.End()
+
+		if id := TraceID(ctx); id != "" {
+			w.Header().Set(errs.HeaderTraceID, id)
+		}
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+		SetHTTPStatus(span, sw.status)
+	})
+}
+
+// statusWriter запоминает HTTP статус ответа
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader запоминает статус и передает его дальше
+func (sw *statusWriter) WriteHeader(status int) {
+	sw.status = status
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+// Hijack передает соединение дальше для websocket
+func (sw *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := sw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijack is not supported")
+	}
+	sw.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+// transport транспорт HTTP клиента с трассировкой запросов
+type transport struct {
+	base http.RoundTripper
+}
+
+// Transport транспорт HTTP клиента, который создает span на каждый запрос и передает
+// контекст трассировки серверу в хедерах. base транспорт для выполнения запросов, nil означает транспорт по умолчанию
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base}
+}
+
+// RoundTrip выполняет запрос в span. Запрос копируется, исходный запрос не меняется
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	ctx, span := Tracer().Start(r.Context(), r.Method+" "+r.URL.Path,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.HTTPMethodKey.String(r.Method)))
+	defer span.End()
+
+	r = r.Clone(ctx)
+	Inject(ctx, r.Header)
+
+	resp, err := t.base.RoundTrip(r)
+	if err != nil {
+		SetError(span, err)
+		return nil, err
+	}
+	SetHTTPStatus(span, resp.StatusCode)
+	return resp, nil
+}
+
+// StartSession начинает span websocket сессии клиента name и записывает контекст трассировки в хедеры открытия соединения h
+func StartSession(ctx context.Context, name string, h http.Header) (context.Context, trace.Span) {
+	ctx, span := Tracer().Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+	Inject(ctx, h)
+	return ctx, span
+}
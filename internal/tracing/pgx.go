@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// QueryLogger логер pgx, который создает span на каждый выполненный запрос к БД.
+// pgx вызывает логер после выполнения запроса с длительностью, поэтому span строится задним числом.
+// В span пишется текст запроса, параметры запроса (зашифрованные данные, хеши паролей) не пишутся.
+// Запросы вне трассировки (без span в контексте) не трассируются
+type QueryLogger struct{}
+
+// Log создает span запроса по сообщению pgx. Сообщения без длительности (соединение, закрытие) пропускаются
+func (QueryLogger) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return
+	}
+	d, ok := data["time"].(time.Duration)
+	if !ok {
+		return
+	}
+
+	end := time.Now()
+	attrs := []attribute.KeyValue{semconv.DBSystemPostgreSQL}
+	if sql, ok := data["sql"].(string); ok {
+		attrs = append(attrs, semconv.DBStatementKey.String(sql))
+	}
+	if n, ok := data["batchLen"].(int); ok {
+		attrs = append(attrs, attribute.Int("db.batch_len", n))
+	}
+	switch n := data["rowCount"].(type) {
+	case int:
+		attrs = append(attrs, attribute.Int("db.rows", n))
+	case int64:
+		attrs = append(attrs, attribute.Int64("db.rows", n))
+	}
+	if table, ok := data["tableName"].(pgx.Identifier); ok {
+		attrs = append(attrs, semconv.DBSQLTableKey.String(table.Sanitize()))
+	}
+
+	_, span := Tracer().Start(ctx, "db."+msg,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(end.Add(-d)),
+		trace.WithAttributes(attrs...))
+	if err, ok := data["err"].(error); ok && level <= pgx.LogLevelError {
+		SetError(span, err)
+	}
+	span.End(trace.WithTimestamp(end))
+}
@@ -0,0 +1,185 @@
+// Package tracing: распределенная трассировка запросов клиента, сервера и БД на базе OpenTelemetry.
+// Контекст трассировки передается в хедерах W3C Trace Context (traceparent, tracestate)
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Экспортеры трассировки
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+	ExporterOTLP   = "otlp"
+)
+
+// instrumentation имя трассировщика
+const instrumentation = "gophkeeper"
+
+// Config параметры трассировки. Exporter экспортер (none, stdout, file, otlp),
+// Endpoint адрес коллектора OTLP HTTP (например, http://localhost:4318), File файл трассировки
+// для экспортера file, Service имя сервиса в трассировке
+type Config struct {
+	Exporter string
+	Endpoint string
+	File     string
+	Service  string
+}
+
+// ShutdownFunc отправка оставшихся span и остановка экспортера
+type ShutdownFunc func(ctx context.Context) error
+
+// Init настройка трассировки процесса. Передача контекста трассировки в хедерах включается всегда,
+// поэтому идентификатор трассировки клиента доходит до ответа сервера даже без экспортера.
+// Возвращает функцию остановки, которую нужно вызвать при завершении процесса
+func Init(cfg Config) (ShutdownFunc, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var closeFile func() error
+	switch strings.ToLower(cfg.Exporter) {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		e, err := stdouttrace.New()
+		if err != nil {
+			return nil, err
+		}
+		exporter = e
+	case ExporterFile:
+		if cfg.File == "" {
+			return nil, fmt.Errorf("trace exporter %s: empty trace file", ExporterFile)
+		}
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, err
+		}
+		e, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		exporter, closeFile = e, f.Close
+	case ExporterOTLP:
+		opts, err := otlpOptions(cfg.Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		e, err := otlptracehttp.New(context.Background(), opts...)
+		if err != nil {
+			return nil, err
+		}
+		exporter = e
+	default:
+		return nil, fmt.Errorf("trace exporter %q: must be %s, %s, %s or %s",
+			cfg.Exporter, ExporterNone, ExporterStdout, ExporterFile, ExporterOTLP)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(cfg.Service))),
+	)
+	otel.SetTracerProvider(tp)
+
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if closeFile != nil {
+			if errClose := closeFile(); err == nil {
+				err = errClose
+			}
+		}
+		return err
+	}, nil
+}
+
+// otlpOptions параметры экспортера OTLP по адресу коллектора. Адрес без схемы считается адресом https,
+// пустой адрес оставляет адрес по умолчанию (переменные OTEL_EXPORTER_OTLP_*)
+func otlpOptions(endpoint string) ([]otlptracehttp.Option, error) {
+	if endpoint == "" {
+		return nil, nil
+	}
+	if !strings.Contains(endpoint, "://") {
+		return []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint)}, nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("trace endpoint %q: %w", endpoint, err)
+	}
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+	switch u.Scheme {
+	case "http":
+		opts = append(opts, otlptracehttp.WithInsecure())
+	case "https":
+	default:
+		return nil, fmt.Errorf("trace endpoint %q: scheme must be http or https", endpoint)
+	}
+	if u.Path != "" && u.Path != "/" {
+		opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+	}
+	return opts, nil
+}
+
+// Tracer трассировщик приложения
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// Inject записывает контекст трассировки ctx в хедеры исходящего запроса
+func Inject(ctx context.Context, h http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(h))
+}
+
+// Extract контекст трассировки из хедеров входящего запроса
+func Extract(ctx context.Context, h http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(h))
+}
+
+// TraceID идентификатор трассировки из контекста. Пустая строка, если трассировки нет
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+// SetHTTPStatus записывает HTTP статус ответа в span. Статусы 5xx отмечают span ошибкой
+func SetHTTPStatus(span trace.Span, status int) {
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+}
+
+// SetError отмечает span ошибкой err
+func SetError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Record атрибуты span записи хранилища: тип и УИД записи. Данные записи в трассировку не попадают
+func Record(t, uid string) trace.SpanStartOption {
+	return trace.WithAttributes(attribute.String("gophkeeper.record.type", t), attribute.String("gophkeeper.record.uid", uid))
+}
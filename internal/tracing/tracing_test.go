@@ -0,0 +1,165 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+
+	"gophkeeper/internal/constants/errs"
+)
+
+// record подключает запись span в память на время теста
+func record(t *testing.T) *tracetest.SpanRecorder {
+	if _, err := Init(Config{}); err != nil {
+		t.Fatal(err)
+	}
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	defaultProvider := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() { otel.SetTracerProvider(defaultProvider) })
+	return sr
+}
+
+// attr значение атрибута span
+func attr(s sdktrace.ReadOnlySpan, key string) (string, bool) {
+	for _, kv := range s.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value.Emit(), true
+		}
+	}
+	return "", false
+}
+
+func TestPropagation(t *testing.T) {
+	sr := record(t)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/resource/{type}", func(w http.ResponseWriter, r *http.Request) {
+		errs.WriteError(w, errs.ErrErrorServer)
+	})
+	r.Use(Middleware)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	client := &http.Client{Transport: Transport(nil)}
+	resp, err := client.Get(ts.URL + "/api/resource/text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiErr := &errs.APIError{}
+	if !errors.As(errs.FromResponse(resp), &apiErr) {
+		t.Fatal("Expected API error")
+	}
+	_ = resp.Body.Close()
+
+	spans := sr.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	server, clientSpan := spans[0], spans[1]
+	if server.Name() != "GET /api/resource/{type}" || clientSpan.Name() != "GET /api/resource/text" {
+		t.Errorf("Unexpected span names %q, %q", server.Name(), clientSpan.Name())
+	}
+	if server.Parent().SpanID() != clientSpan.SpanContext().SpanID() {
+		t.Error("Server span is not a child of the client span")
+	}
+	traceID := clientSpan.SpanContext().TraceID().String()
+	if apiErr.TraceID != traceID || resp.Header.Get(errs.HeaderTraceID) != traceID {
+		t.Errorf("Expected trace id %s in error, got %q", traceID, apiErr.TraceID)
+	}
+	if v, _ := attr(server, string(semconv.HTTPStatusCodeKey)); v != "500" {
+		t.Errorf("Expected status 500, got %s", v)
+	}
+	if server.Status().Code != codes.Error {
+		t.Error("Expected server span with error status")
+	}
+}
+
+func TestQueryLogger(t *testing.T) {
+	sr := record(t)
+	l := QueryLogger{}
+	data := map[string]interface{}{
+		"sql":  "SELECT * FROM text_data WHERE uid = $1",
+		"args": []interface{}{"secret"},
+		"time": 10 * time.Millisecond,
+	}
+
+	l.Log(context.Background(), pgx.LogLevelInfo, "Query", data)
+	if len(sr.Ended()) != 0 {
+		t.Fatal("Query outside of a trace was traced")
+	}
+
+	ctx, parent := Tracer().Start(context.Background(), "staging.flush")
+	l.Log(ctx, pgx.LogLevelInfo, "Dialing PostgreSQL server", map[string]interface{}{"host": "localhost"})
+	l.Log(ctx, pgx.LogLevelError, "Exec", map[string]interface{}{"sql": "DELETE", "err": errors.New("failed"),
+		"time": time.Millisecond})
+	l.Log(ctx, pgx.LogLevelInfo, "Query", data)
+	parent.End()
+
+	spans := sr.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 spans, got %d", len(spans))
+	}
+	exec, query := spans[0], spans[1]
+	if exec.Status().Code != codes.Error {
+		t.Error("Expected failed query with error status")
+	}
+	if query.Name() != "db.Query" || query.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("Unexpected query span %q", query.Name())
+	}
+	if d := query.EndTime().Sub(query.StartTime()); d != 10*time.Millisecond {
+		t.Errorf("Expected duration 10ms, got %s", d)
+	}
+	if v, _ := attr(query, string(semconv.DBStatementKey)); v != data["sql"] {
+		t.Errorf("Unexpected statement %q", v)
+	}
+	for _, kv := range query.Attributes() {
+		if strings.Contains(kv.Value.Emit(), "secret") {
+			t.Errorf("Query argument in span attribute %s", kv.Key)
+		}
+	}
+}
+
+func TestInit(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "None", cfg: Config{Exporter: ExporterNone}},
+		{name: "File", cfg: Config{Exporter: ExporterFile, File: t.TempDir() + "/trace.json"}},
+		{name: "File without name", cfg: Config{Exporter: ExporterFile}, wantErr: true},
+		{name: "OTLP", cfg: Config{Exporter: ExporterOTLP, Endpoint: "http://localhost:4318/v1/traces"}},
+		{name: "OTLP bad scheme", cfg: Config{Exporter: ExporterOTLP, Endpoint: "ftp://localhost"}, wantErr: true},
+		{name: "Unknown", cfg: Config{Exporter: "jaeger"}, wantErr: true},
+	}
+	defaultProvider := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(defaultProvider)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shutdown, err := Init(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if err = shutdown(context.Background()); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+}
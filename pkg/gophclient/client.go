@@ -0,0 +1,453 @@
+// Package gophclient: типизированный клиент HTTP API сервера Gophkeeper для встраивания в другие инструменты.
+// Клиент сжимает запросы способом, который принимает сервер (zstd или gzip), шифрует и расшифровывает данные ключом клиента
+// и обновляет токен, если он истек. Контекст трассировки OpenTelemetry из ctx передается серверу
+// через propagator, настроенный в приложении (otel.SetTextMapPropagator)
+package gophclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/gorilla/websocket"
+
+	"gophkeeper/internal/compression"
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/constants/errs"
+	"gophkeeper/internal/postgresql/model"
+	"gophkeeper/internal/tracing"
+)
+
+var (
+	// ErrUnauthorized неверное имя пользователя или пароль, или токен не принят сервером
+	ErrUnauthorized = errors.New("gophclient: unauthorized")
+
+	// ErrForbidden запрос запрещен (например, не предъявлен сертификат устройства)
+	ErrForbidden = errors.New("gophclient: forbidden")
+
+	// ErrNotFound запись не найдена
+	ErrNotFound = errors.New("gophclient: not found")
+
+	// ErrConflict пользователь уже существует
+	ErrConflict = errors.New("gophclient: conflict")
+
+	// ErrTooManyRequests превышено количество неудачных попыток входа
+	ErrTooManyRequests = errors.New("gophclient: too many requests")
+
+	// ErrInvalid сервер не принял запрос: неверный формат или данные
+	ErrInvalid = errors.New("gophclient: invalid request")
+
+	// ErrQuotaExceeded запись или файл превышает квоту пользователя. Квота и использование в Error.Details
+	ErrQuotaExceeded = errors.New("gophclient: quota exceeded")
+
+	// ErrUnavailable сервер временно не принимает запросы (например, заполнено хранилище сервера), запрос можно повторить
+	ErrUnavailable = errors.New("gophclient: service unavailable")
+)
+
+// refreshBefore за сколько до истечения токена он обновляется
+const refreshBefore = time.Minute
+
+// Client клиент API сервера Gophkeeper. Безопасен для использования из нескольких горутин
+type Client struct {
+	baseURL   string
+	http      *http.Client
+	dialer    *websocket.Dialer
+	cryptoKey string
+	device    string
+	encoding  compression.Remote
+
+	mu       sync.Mutex
+	token    string
+	login    string
+	password string
+}
+
+// Option параметр клиента
+type Option func(*Client)
+
+// WithHTTPClient HTTP клиент для запросов к серверу
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// WithDialer websocket dialer для передачи файлов
+func WithDialer(d *websocket.Dialer) Option {
+	return func(c *Client) { c.dialer = d }
+}
+
+// WithTLSConfig конфигурация TLS для HTTP и websocket
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *Client) {
+		c.http = &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+		c.dialer = &websocket.Dialer{
+			Proxy:            http.ProxyFromEnvironment,
+			HandshakeTimeout: websocket.DefaultDialer.HandshakeTimeout,
+			TLSClientConfig:  cfg,
+		}
+	}
+}
+
+// WithCryptoKey ключ шифрования данных. Данные шифруются на клиенте, сервер хранит их зашифрованными
+func WithCryptoKey(key string) Option {
+	return func(c *Client) { c.cryptoKey = key }
+}
+
+// WithDeviceName имя устройства, которое сервер сохраняет в сессии
+func WithDeviceName(name string) Option {
+	return func(c *Client) { c.device = name }
+}
+
+// WithToken токен уже открытой сессии
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// New создание клиента. baseURL адрес сервера, например https://localhost:8080
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    &http.Client{},
+		dialer:  websocket.DefaultDialer,
+	}
+	if host, err := os.Hostname(); err == nil {
+		c.device = host
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Token текущий токен сессии
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.token
+}
+
+// Login вход пользователя. Имя и пароль запоминаются для обновления токена
+func (c *Client) Login(ctx context.Context, login, password string) error {
+	return c.auth(ctx, "/api/user/login", login, password)
+}
+
+// Register регистрация нового пользователя. После регистрации пользователь залогинен
+func (c *Client) Register(ctx context.Context, login, password string) error {
+	return c.auth(ctx, "/api/user/register", login, password)
+}
+
+// ChangePassword смена пароля текущего пользователя
+func (c *Client) ChangePassword(ctx context.Context, password, newPassword string) error {
+	c.mu.Lock()
+	login := c.login
+	c.mu.Unlock()
+
+	err := c.send(ctx, "POST", "/api/user/password", model.User{Name: login, Password: password, NewPassword: newPassword}, nil)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.password = newPassword
+	c.mu.Unlock()
+	return nil
+}
+
+// QuotaLimits квоты пользователя: объем файлов в байтах, количество записей и размер одного файла.
+// Нулевое значение означает, что квота не ограничена
+type QuotaLimits struct {
+	Bytes    int64
+	Records  int
+	FileSize int64
+}
+
+// Quota использование квот: объем файлов в байтах и количество записей по типам (pairs, text, binary, card)
+type Quota struct {
+	Bytes   int64
+	Records map[string]int
+	Limits  QuotaLimits
+}
+
+// Portion порция файла: Offset байт, с которого порция начинается в файле
+type Portion struct {
+	Uid    string
+	Offset int64
+	Body   []byte
+}
+
+// Export выгрузка всех данных пользователя в расшифрованном виде
+type Export struct {
+	User     string
+	Date     time.Time
+	Pairs    []Pair
+	Texts    []Text
+	Files    []File
+	Cards    []Card
+	Portions []Portion
+}
+
+// Quota квоты пользователя и их использование
+func (c *Client) Quota(ctx context.Context) (*Quota, error) {
+	qu := model.QuotaUsage{}
+	if err := c.send(ctx, "GET", "/api/user/quota", nil, &qu); err != nil {
+		return nil, err
+	}
+	return &Quota{
+		Bytes:   qu.Bytes,
+		Records: qu.Records,
+		Limits:  QuotaLimits{Bytes: qu.Limits.Bytes, Records: qu.Limits.Records, FileSize: qu.Limits.FileSize},
+	}, nil
+}
+
+// Export выгрузка всех данных пользователя. Записи и порции файлов расшифровываются ключом клиента
+func (c *Client) Export(ctx context.Context) (*Export, error) {
+	ue := model.UserExport{}
+	if err := c.send(ctx, "GET", "/api/user/export", nil, &ue); err != nil {
+		return nil, err
+	}
+
+	e := Export{User: ue.User, Date: ue.Date}
+	for _, v := range ue.Pairs {
+		e.Pairs = append(e.Pairs, c.decryptPair(v))
+	}
+	for _, v := range ue.Text {
+		e.Texts = append(e.Texts, Text{Uid: v.Uid, Text: c.decrypt(v.Text)})
+	}
+	for _, v := range ue.Binary {
+		e.Files = append(e.Files, fileFromModel(v))
+	}
+	for _, v := range ue.BankCards {
+		e.Cards = append(e.Cards, Card{Uid: v.Uid, Number: c.decrypt(v.Number), Cvc: c.decrypt(v.Cvc)})
+	}
+	for _, v := range ue.Portions {
+		e.Portions = append(e.Portions, Portion{Uid: v.Uid, Offset: v.Portion, Body: []byte(c.decrypt(v.Body))})
+	}
+	return &e, nil
+}
+
+func (c *Client) auth(ctx context.Context, path, login, password string) error {
+	resp, err := c.do(ctx, "POST", path, model.User{Name: login, Password: password}, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err = statusError(resp); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.token = resp.Header.Get(constants.HeaderAuthorization)
+	c.login = login
+	c.password = password
+	return nil
+}
+
+// currentToken возвращает токен, обновляя его, если он истекает
+func (c *Client) currentToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	token, login, password := c.token, c.login, c.password
+	c.mu.Unlock()
+
+	if token != "" && !expiring(token) {
+		return token, nil
+	}
+	if login == "" {
+		if token == "" {
+			return "", ErrUnauthorized
+		}
+		return token, nil
+	}
+
+	if err := c.Login(ctx, login, password); err != nil {
+		return "", err
+	}
+	return c.Token(), nil
+}
+
+// expiring проверяет, что токен истекает. Подпись не проверяется, ее проверяет сервер
+func expiring(token string) bool {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		return true
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return false
+	}
+	return time.Until(time.Unix(int64(exp), 0)) < refreshBefore
+}
+
+// send запрос к API с токеном. Если сервер не принял токен, то токен обновляется и запрос повторяется один раз
+func (c *Client) send(ctx context.Context, method, path string, in, out interface{}) error {
+	token, err := c.currentToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(ctx, method, path, in, token)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && c.canRefresh() {
+		resp.Body.Close()
+
+		c.mu.Lock()
+		c.token = ""
+		c.mu.Unlock()
+		if token, err = c.currentToken(ctx); err != nil {
+			return err
+		}
+		if resp, err = c.do(ctx, method, path, in, token); err != nil {
+			return err
+		}
+	}
+	defer resp.Body.Close()
+
+	if err = statusError(resp); err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, out)
+}
+
+func (c *Client) canRefresh() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.login != ""
+}
+
+// do выполняет запрос. Тело запроса передается в JSON, сжатом способом, который принимает сервер
+// (см. compression.Remote). Сжатое тело ответа распаковывается
+func (c *Client) do(ctx context.Context, method, path string, in interface{}, token string) (*http.Response, error) {
+	var body io.Reader
+	encoding := c.encoding.Encoding()
+	if in != nil {
+		arrJSON, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		compressJSON, err := compression.Encode(encoding, arrJSON)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(compressJSON)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	req.Header.Set("Accept-Encoding", compression.AcceptEncoding)
+	if token != "" {
+		req.Header.Set(constants.HeaderAuthorization, token)
+	}
+	req.Header.Set(constants.HeaderDeviceName, c.device)
+	req.Header.Set(constants.HeaderClientBuild, "gophclient")
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	c.encoding.Update(resp.Header.Get("Accept-Encoding"))
+	if err = compression.DecodeResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Error ошибка, которую вернул сервер: HTTP статус, стабильный код, описание, идентификаторы запроса и трассировки.
+// Разворачивается в ошибку пакета по статусу, поэтому проверяется через errors.Is, например
+// errors.Is(err, ErrNotFound), а подробности получаются через errors.As
+type Error struct {
+	Status    int
+	Code      string
+	Message   string
+	Details   json.RawMessage
+	RequestID string
+	TraceID   string
+
+	kind error
+}
+
+// Error текст ошибки
+func (e *Error) Error() string {
+	if e.RequestID == "" {
+		return "gophclient: " + e.Message
+	}
+	return fmt.Sprintf("gophclient: %s (request %s)", e.Message, e.RequestID)
+}
+
+// Unwrap ошибка пакета по статусу ответа
+func (e *Error) Unwrap() error {
+	return e.kind
+}
+
+// statusError ошибка по ответу сервера. Тело ответа разбирается как ошибка API сервера
+func statusError(resp *http.Response) error {
+	err := errs.FromResponse(resp)
+	if err == nil {
+		return nil
+	}
+	var apiErr *errs.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+
+	e := &Error{
+		Status:    resp.StatusCode,
+		Code:      apiErr.Code,
+		Message:   apiErr.Error(),
+		RequestID: apiErr.RequestID,
+		TraceID:   apiErr.TraceID,
+	}
+	if apiErr.Details != nil {
+		e.Details, _ = json.Marshal(apiErr.Details)
+	}
+	switch resp.StatusCode {
+	case http.StatusBadRequest:
+		e.kind = ErrInvalid
+	case http.StatusUnauthorized:
+		e.kind = ErrUnauthorized
+	case http.StatusForbidden:
+		e.kind = ErrForbidden
+		if apiErr.Code == errs.CodeQuotaExceeded {
+			e.kind = ErrQuotaExceeded
+		}
+	case http.StatusNotFound:
+		e.kind = ErrNotFound
+	case http.StatusConflict:
+		e.kind = ErrConflict
+	case http.StatusTooManyRequests:
+		e.kind = ErrTooManyRequests
+	case http.StatusServiceUnavailable:
+		e.kind = ErrUnavailable
+	}
+	return e
+}
@@ -0,0 +1,211 @@
+package gophclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"gophkeeper/internal/compression"
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/constants/errs"
+	"gophkeeper/internal/postgresql/model"
+	"gophkeeper/internal/tracing"
+)
+
+// closeTimeout время ожидания ответа сервера на закрытие соединения выгрузки файла
+const closeTimeout = 10 * time.Second
+
+// UploadFile выгрузка файла на сервер. Сначала сохраняется описание файла, затем по websocket
+// передается содержимое порциями по constants.Step байт. Порции шифруются и сжимаются способом,
+// который выбрал сервер (зашифрованные порции сервер принимает без сжатия)
+func (c *Client) UploadFile(ctx context.Context, path string) (File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return File{}, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return File{}, err
+	}
+
+	ext := filepath.Ext(path)
+	f := File{
+		Name:      strings.TrimSuffix(filepath.Base(path), ext),
+		Expansion: strings.TrimPrefix(ext, "."),
+		Size:      strconv.FormatInt(info.Size(), 10),
+		Patch:     path,
+	}
+	if err = c.putFile(ctx, &f); err != nil {
+		return File{}, err
+	}
+
+	token, err := c.currentToken(ctx)
+	if err != nil {
+		return File{}, err
+	}
+	h := http.Header{}
+	h.Set(constants.HeaderAuthorization, token)
+	h.Set(compression.HeaderMessageEncoding, compression.MessageEncodings)
+	tracing.Inject(ctx, h)
+	conn, resp, err := c.dialer.DialContext(ctx, c.wsURL("/socket_file"), h)
+	if err != nil {
+		if resp != nil {
+			if errStatus := statusError(resp); errStatus != nil {
+				return File{}, errStatus
+			}
+		}
+		return File{}, err
+	}
+	defer conn.Close()
+	encoding := compression.MessageEncoding(resp.Header.Get(compression.HeaderMessageEncoding))
+
+	var pos int64
+	b := make([]byte, constants.Step)
+	for {
+		n, err := io.ReadFull(file, b)
+		if n > 0 {
+			pbd := model.PortionBinaryData{
+				Uid:     f.Uid,
+				Portion: pos,
+				Body:    c.encrypt(string(b[:n])),
+			}
+			if err := writePortion(conn, pbd, encoding); err != nil {
+				return File{}, uploadError(conn, err)
+			}
+			pos += int64(n)
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return File{}, err
+		}
+	}
+
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	if err = conn.WriteMessage(websocket.CloseMessage, msg); err != nil {
+		return File{}, uploadError(conn, err)
+	}
+	// сервер отвечает на закрытие соединения после записи порций в БД или закрывает его сам, если не принял порцию
+	_ = conn.SetReadDeadline(time.Now().Add(closeTimeout))
+	_, _, err = conn.ReadMessage()
+	if websocket.IsCloseError(err, websocket.ClosePolicyViolation, websocket.CloseInternalServerErr) {
+		return File{}, uploadError(conn, err)
+	}
+	return f, nil
+}
+
+// uploadError ошибка выгрузки файла. Если сервер закрыл соединение, потому что не принял порцию,
+// то возвращается ErrQuotaExceeded или ErrInvalid по причине закрытия, если не смог записать порции в БД,
+// то ErrUnavailable
+func uploadError(conn *websocket.Conn, err error) error {
+	var ce *websocket.CloseError
+	if !errors.As(err, &ce) {
+		if _, _, err2 := conn.ReadMessage(); !errors.As(err2, &ce) {
+			return err
+		}
+	}
+	if ce.Code == websocket.CloseInternalServerErr {
+		return ErrUnavailable
+	}
+	if ce.Code != websocket.ClosePolicyViolation {
+		return err
+	}
+	switch ce.Text {
+	case errs.CodeQuotaExceeded:
+		return ErrQuotaExceeded
+	case errs.CodeNotFound:
+		return ErrNotFound
+	}
+	return ErrInvalid
+}
+
+// DownloadFile загрузка файла с сервера в файл dst.
+// Порции собираются в файл по меткам, с какого байта начинается порция
+func (c *Client) DownloadFile(ctx context.Context, uid, dst string) error {
+	token, err := c.currentToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	h := http.Header{}
+	h.Set("UID", uid)
+	h.Set(constants.HeaderAuthorization, token)
+	h.Set(compression.HeaderMessageEncoding, compression.MessageEncodings)
+	tracing.Inject(ctx, h)
+	conn, resp, err := c.dialer.DialContext(ctx, c.wsURL("/socket_download_file"), h)
+	if err != nil {
+		if resp != nil {
+			if errStatus := statusError(resp); errStatus != nil {
+				return errStatus
+			}
+		}
+		return err
+	}
+	defer conn.Close()
+	encoding := compression.MessageEncoding(resp.Header.Get(compression.HeaderMessageEncoding))
+
+	newFile, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer newFile.Close()
+
+	for {
+		_, messageContent, err := conn.ReadMessage()
+		if websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+			return ErrNotFound
+		}
+		if err != nil {
+			// сервер закрывает соединение после отправки последней порции
+			return nil
+		}
+
+		messageContent, err = compression.Decode(encoding, messageContent, 0)
+		if err != nil {
+			return err
+		}
+		pbd := model.PortionBinaryData{}
+		if err = json.Unmarshal(messageContent, &pbd); err != nil {
+			return err
+		}
+		if _, err = newFile.WriteAt([]byte(c.decrypt(pbd.Body)), pbd.Portion); err != nil {
+			return err
+		}
+	}
+}
+
+// writePortion отправляет порцию файла, сжатую способом encoding
+func writePortion(conn *websocket.Conn, pbd model.PortionBinaryData, encoding string) error {
+	msg, err := json.Marshal(pbd)
+	if err != nil {
+		return err
+	}
+	msg, err = compression.Encode(encoding, msg)
+	if err != nil {
+		return err
+	}
+	return conn.WriteMessage(websocket.TextMessage, msg)
+}
+
+// wsURL адрес websocket по адресу сервера
+func (c *Client) wsURL(path string) string {
+	switch {
+	case strings.HasPrefix(c.baseURL, "https://"):
+		return "wss://" + strings.TrimPrefix(c.baseURL, "https://") + path
+	case strings.HasPrefix(c.baseURL, "http://"):
+		return "ws://" + strings.TrimPrefix(c.baseURL, "http://") + path
+	}
+	return c.baseURL + path
+}
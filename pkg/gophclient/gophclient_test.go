@@ -0,0 +1,351 @@
+package gophclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/gorilla/websocket"
+
+	"gophkeeper/internal/compression"
+	"gophkeeper/internal/constants"
+	"gophkeeper/internal/constants/errs"
+	"gophkeeper/internal/postgresql/model"
+)
+
+// fakeServer минимальная реализация API сервера для проверки клиента
+type fakeServer struct {
+	sync.Mutex
+	tokens   map[string]bool
+	issued   int
+	records  map[string]json.RawMessage
+	portions map[string][]model.PortionBinaryData
+	quota    int64
+}
+
+func (fs *fakeServer) newToken() string {
+	fs.issued++
+	claims := jwt.MapClaims{"user": "user", "n": fs.issued, "exp": time.Now().Add(time.Hour).Unix()}
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test"))
+	fs.tokens[token] = true
+	return token
+}
+
+func (fs *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fs.Lock()
+	defer fs.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		body, _ = compression.Decompress(body)
+	}
+
+	switch {
+	case r.URL.Path == "/api/user/login":
+		u := model.User{}
+		_ = json.Unmarshal(body, &u)
+		if u.Password != "password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set(constants.HeaderAuthorization, fs.newToken())
+		return
+	case !fs.tokens[r.Header.Get(constants.HeaderAuthorization)]:
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	case r.URL.Path == "/socket_download_file":
+		fs.download(w, r)
+		return
+	case r.URL.Path == "/api/user/quota":
+		qu := model.QuotaUsage{Bytes: 100, Records: map[string]int{"text": 1}, Limits: model.QuotaLimits{FileSize: fs.quota}}
+		_ = json.NewEncoder(w).Encode(qu)
+		return
+	case r.URL.Path == "/api/user/export":
+		ue := model.UserExport{User: "user"}
+		for k, v := range fs.records {
+			if strings.HasPrefix(k, "text/") {
+				td := model.TextData{}
+				_ = json.Unmarshal(v, &td)
+				ue.SetValue(&td)
+			}
+		}
+		for _, arr := range fs.portions {
+			ue.Portions = append(ue.Portions, arr...)
+		}
+		_ = json.NewEncoder(w).Encode(ue)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/api/resource/")
+	switch r.Method {
+	case "PUT":
+		bd := model.BinaryData{}
+		if strings.HasPrefix(key, "binary/") && json.Unmarshal(body, &bd) == nil && fs.quota > 0 {
+			if size, _ := bd.FileSize(); size > fs.quota {
+				errs.WriteError(w, &errs.QuotaError{Quota: "file_size", Limit: fs.quota, Requested: size})
+				return
+			}
+		}
+		fs.records[key] = body
+	case "GET":
+		if v, ok := fs.records[key]; ok {
+			_, _ = w.Write(v)
+			return
+		}
+		var arr []json.RawMessage
+		for k, v := range fs.records {
+			if strings.HasPrefix(k, key+"/") {
+				arr = append(arr, v)
+			}
+		}
+		if arr == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		msg, _ := json.Marshal(arr)
+		msg, _ = compression.Compress(msg)
+		w.Header().Set("Content-Encoding", "gzip")
+		_, _ = w.Write(msg)
+	case "DELETE":
+		delete(fs.records, key)
+	}
+}
+
+func (fs *fakeServer) upload(w http.ResponseWriter, r *http.Request) {
+	fs.Lock()
+	authorized := fs.tokens[r.Header.Get(constants.HeaderAuthorization)]
+	fs.Unlock()
+	if !authorized {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		msg, _ = compression.Decompress(msg)
+		pbd := model.PortionBinaryData{}
+		_ = json.Unmarshal(msg, &pbd)
+
+		fs.Lock()
+		fs.portions[pbd.Uid] = append(fs.portions[pbd.Uid], pbd)
+		fs.Unlock()
+	}
+}
+
+func (fs *fakeServer) download(w http.ResponseWriter, r *http.Request) {
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	arr, ok := fs.portions[r.Header.Get("UID")]
+	if !ok {
+		msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "file not found")
+		_ = conn.WriteMessage(websocket.CloseMessage, msg)
+		return
+	}
+	for _, v := range arr {
+		_ = writePortion(conn, v, compression.Gzip)
+	}
+}
+
+func TestClient(t *testing.T) {
+	fs := &fakeServer{
+		tokens:   map[string]bool{},
+		records:  map[string]json.RawMessage{},
+		portions: map[string][]model.PortionBinaryData{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/socket_file", fs.upload)
+	mux.Handle("/", fs)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	ctx := context.Background()
+	c := New(ts.URL, WithCryptoKey("secret"))
+
+	if err := c.Login(ctx, "user", "wrong"); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("ожидалась ошибка авторизации, получено %v", err)
+	}
+	if err := c.Login(ctx, "user", "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Records", func(t *testing.T) {
+		text := Text{Text: "private text"}
+		if err := c.PutText(ctx, &text); err != nil {
+			t.Fatal(err)
+		}
+		if text.Uid == "" {
+			t.Fatal("не создан УИД записи")
+		}
+
+		fs.Lock()
+		stored := string(fs.records["text/"+text.Uid])
+		fs.Unlock()
+		if strings.Contains(stored, "private text") {
+			t.Fatal("текст передан на сервер в открытом виде")
+		}
+
+		got, err := c.Text(ctx, text.Uid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != text {
+			t.Fatalf("получено %+v, ожидалось %+v", got, text)
+		}
+
+		pair := Pair{Type: "site", Login: "login", Password: "pass"}
+		if err = c.PutPair(ctx, &pair); err != nil {
+			t.Fatal(err)
+		}
+		pairs, err := c.Pairs(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pairs) != 1 || pairs[0] != pair {
+			t.Fatalf("получено %+v, ожидалось %+v", pairs, pair)
+		}
+
+		if err = c.DeleteText(ctx, text.Uid); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = c.Texts(ctx); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("ожидалась ошибка ErrNotFound, получено %v", err)
+		}
+	})
+
+	t.Run("RefreshToken", func(t *testing.T) {
+		old := c.Token()
+		fs.Lock()
+		delete(fs.tokens, old)
+		fs.Unlock()
+
+		if err := c.PutCard(ctx, &Card{Number: "4111", Cvc: "123"}); err != nil {
+			t.Fatal(err)
+		}
+		if c.Token() == old {
+			t.Fatal("токен не обновлен")
+		}
+	})
+
+	t.Run("Files", func(t *testing.T) {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "source.bin")
+		content := bytes.Repeat([]byte("0123456789"), constants.Step/10+7)
+		if err := os.WriteFile(src, content, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := c.UploadFile(ctx, src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Size != fmt.Sprint(len(content)) || f.Expansion != "bin" {
+			t.Fatalf("неверное описание файла %+v", f)
+		}
+
+		// выгрузка асинхронная, ждем пока сервер получит все порции
+		for i := 0; i < 100; i++ {
+			fs.Lock()
+			n := len(fs.portions[f.Uid])
+			fs.Unlock()
+			if n == 2 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		dst := filepath.Join(dir, "result.bin")
+		if err = c.DownloadFile(ctx, f.Uid, dst); err != nil {
+			t.Fatal(err)
+		}
+		result, err := os.ReadFile(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(result, content) {
+			t.Fatalf("размер файла %d, ожидалось %d", len(result), len(content))
+		}
+
+		if err = c.DownloadFile(ctx, "unknown", filepath.Join(dir, "unknown.bin")); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("ожидалась ошибка ErrNotFound, получено %v", err)
+		}
+	})
+	t.Run("Quota usage", func(t *testing.T) {
+		qu, err := c.Quota(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if qu.Bytes != 100 || qu.Records["text"] != 1 || qu.Limits.FileSize != 0 {
+			t.Fatalf("неверное использование квот %+v", qu)
+		}
+	})
+	t.Run("Export", func(t *testing.T) {
+		text := Text{Text: "export"}
+		if err := c.PutText(ctx, &text); err != nil {
+			t.Fatal(err)
+		}
+		e, err := c.Export(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, v := range e.Texts {
+			found = found || v == text
+		}
+		if e.User != "user" || !found || len(e.Portions) == 0 {
+			t.Fatalf("в выгрузке нет расшифрованного текста %+v", e)
+		}
+		for _, v := range e.Portions {
+			if v.Uid == "" || len(v.Body) == 0 {
+				t.Fatalf("неверная порция в выгрузке %+v", v)
+			}
+		}
+	})
+	t.Run("Quota", func(t *testing.T) {
+		src := filepath.Join(t.TempDir(), "large.bin")
+		if err := os.WriteFile(src, make([]byte, 100), 0600); err != nil {
+			t.Fatal(err)
+		}
+		fs.Lock()
+		fs.quota = 10
+		fs.Unlock()
+		defer func() {
+			fs.Lock()
+			fs.quota = 0
+			fs.Unlock()
+		}()
+
+		_, err := c.UploadFile(ctx, src)
+		if !errors.Is(err, ErrQuotaExceeded) {
+			t.Fatalf("ожидалась ошибка ErrQuotaExceeded, получено %v", err)
+		}
+		var e *Error
+		if !errors.As(err, &e) || !strings.Contains(string(e.Details), `"quota":"file_size"`) {
+			t.Fatalf("нет подробностей квоты в ошибке %v", err)
+		}
+	})
+}
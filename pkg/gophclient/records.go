@@ -0,0 +1,220 @@
+package gophclient
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/google/uuid"
+
+	"gophkeeper/internal/encryption"
+	"gophkeeper/internal/postgresql/model"
+)
+
+// Pair пара логин/пароль в расшифрованном виде
+type Pair struct {
+	Uid      string
+	Type     string
+	Login    string
+	Password string
+}
+
+// Text произвольный текст в расшифрованном виде
+type Text struct {
+	Uid  string
+	Text string
+}
+
+// Card банковская карта в расшифрованном виде
+type Card struct {
+	Uid    string
+	Number string
+	Cvc    string
+}
+
+// File описание бинарных данных. Содержимое передается методами UploadFile и DownloadFile
+type File struct {
+	Uid       string
+	Name      string
+	Expansion string
+	Size      string
+	Patch     string
+}
+
+// Pairs список пар логин/пароль
+func (c *Client) Pairs(ctx context.Context) ([]Pair, error) {
+	var arr []model.PairLoginPassword
+	if err := c.send(ctx, "GET", resourcePath("pairs", ""), nil, &arr); err != nil {
+		return nil, err
+	}
+
+	res := make([]Pair, 0, len(arr))
+	for _, v := range arr {
+		res = append(res, c.decryptPair(v))
+	}
+	return res, nil
+}
+
+// Pair пара логин/пароль по УИДу
+func (c *Client) Pair(ctx context.Context, uid string) (Pair, error) {
+	v := model.PairLoginPassword{}
+	if err := c.send(ctx, "GET", resourcePath("pairs", uid), nil, &v); err != nil {
+		return Pair{}, err
+	}
+	return c.decryptPair(v), nil
+}
+
+// PutPair добавление/изменение пары логин/пароль. Если УИД не указан, то он создается
+func (c *Client) PutPair(ctx context.Context, p *Pair) error {
+	setUid(&p.Uid)
+	v := model.PairLoginPassword{
+		Uid:      p.Uid,
+		TypePair: c.encrypt(p.Type),
+		Name:     c.encrypt(p.Login),
+		Password: c.encrypt(p.Password),
+	}
+	return c.send(ctx, "PUT", resourcePath("pairs", p.Uid), v, nil)
+}
+
+// DeletePair удаление пары логин/пароль
+func (c *Client) DeletePair(ctx context.Context, uid string) error {
+	return c.send(ctx, "DELETE", resourcePath("pairs", uid), nil, nil)
+}
+
+// Texts список текстовых данных
+func (c *Client) Texts(ctx context.Context) ([]Text, error) {
+	var arr []model.TextData
+	if err := c.send(ctx, "GET", resourcePath("text", ""), nil, &arr); err != nil {
+		return nil, err
+	}
+
+	res := make([]Text, 0, len(arr))
+	for _, v := range arr {
+		res = append(res, Text{Uid: v.Uid, Text: c.decrypt(v.Text)})
+	}
+	return res, nil
+}
+
+// Text текстовые данные по УИДу
+func (c *Client) Text(ctx context.Context, uid string) (Text, error) {
+	v := model.TextData{}
+	if err := c.send(ctx, "GET", resourcePath("text", uid), nil, &v); err != nil {
+		return Text{}, err
+	}
+	return Text{Uid: v.Uid, Text: c.decrypt(v.Text)}, nil
+}
+
+// PutText добавление/изменение текстовых данных. Если УИД не указан, то он создается
+func (c *Client) PutText(ctx context.Context, t *Text) error {
+	setUid(&t.Uid)
+	v := model.TextData{Uid: t.Uid, Text: c.encrypt(t.Text)}
+	return c.send(ctx, "PUT", resourcePath("text", t.Uid), v, nil)
+}
+
+// DeleteText удаление текстовых данных
+func (c *Client) DeleteText(ctx context.Context, uid string) error {
+	return c.send(ctx, "DELETE", resourcePath("text", uid), nil, nil)
+}
+
+// Cards список банковских карт
+func (c *Client) Cards(ctx context.Context) ([]Card, error) {
+	var arr []model.BankCard
+	if err := c.send(ctx, "GET", resourcePath("card", ""), nil, &arr); err != nil {
+		return nil, err
+	}
+
+	res := make([]Card, 0, len(arr))
+	for _, v := range arr {
+		res = append(res, Card{Uid: v.Uid, Number: c.decrypt(v.Number), Cvc: c.decrypt(v.Cvc)})
+	}
+	return res, nil
+}
+
+// Card банковская карта по УИДу
+func (c *Client) Card(ctx context.Context, uid string) (Card, error) {
+	v := model.BankCard{}
+	if err := c.send(ctx, "GET", resourcePath("card", uid), nil, &v); err != nil {
+		return Card{}, err
+	}
+	return Card{Uid: v.Uid, Number: c.decrypt(v.Number), Cvc: c.decrypt(v.Cvc)}, nil
+}
+
+// PutCard добавление/изменение банковской карты. Если УИД не указан, то он создается
+func (c *Client) PutCard(ctx context.Context, card *Card) error {
+	setUid(&card.Uid)
+	v := model.BankCard{Uid: card.Uid, Number: c.encrypt(card.Number), Cvc: c.encrypt(card.Cvc)}
+	return c.send(ctx, "PUT", resourcePath("card", card.Uid), v, nil)
+}
+
+// DeleteCard удаление банковской карты
+func (c *Client) DeleteCard(ctx context.Context, uid string) error {
+	return c.send(ctx, "DELETE", resourcePath("card", uid), nil, nil)
+}
+
+// Files список бинарных данных
+func (c *Client) Files(ctx context.Context) ([]File, error) {
+	var arr []model.BinaryData
+	if err := c.send(ctx, "GET", resourcePath("binary", ""), nil, &arr); err != nil {
+		return nil, err
+	}
+
+	res := make([]File, 0, len(arr))
+	for _, v := range arr {
+		res = append(res, fileFromModel(v))
+	}
+	return res, nil
+}
+
+// File описание бинарных данных по УИДу
+func (c *Client) File(ctx context.Context, uid string) (File, error) {
+	v := model.BinaryData{}
+	if err := c.send(ctx, "GET", resourcePath("binary", uid), nil, &v); err != nil {
+		return File{}, err
+	}
+	return fileFromModel(v), nil
+}
+
+// DeleteFile удаление бинарных данных
+func (c *Client) DeleteFile(ctx context.Context, uid string) error {
+	return c.send(ctx, "DELETE", resourcePath("binary", uid), nil, nil)
+}
+
+func (c *Client) putFile(ctx context.Context, f *File) error {
+	setUid(&f.Uid)
+	v := model.BinaryData{Uid: f.Uid, Name: f.Name, Expansion: f.Expansion, Size: f.Size, Patch: f.Patch}
+	return c.send(ctx, "PUT", resourcePath("binary", f.Uid), v, nil)
+}
+
+func fileFromModel(v model.BinaryData) File {
+	return File{Uid: v.Uid, Name: v.Name, Expansion: v.Expansion, Size: v.Size, Patch: v.Patch}
+}
+
+func (c *Client) decryptPair(v model.PairLoginPassword) Pair {
+	return Pair{
+		Uid:      v.Uid,
+		Type:     c.decrypt(v.TypePair),
+		Login:    c.decrypt(v.Name),
+		Password: c.decrypt(v.Password),
+	}
+}
+
+func (c *Client) encrypt(s string) string {
+	return encryption.EncryptString(s, c.cryptoKey)
+}
+
+func (c *Client) decrypt(s string) string {
+	return encryption.DecryptString(s, c.cryptoKey)
+}
+
+// resourcePath адрес REST API записи. Без УИДа адрес списка записей
+func resourcePath(t, uid string) string {
+	if uid == "" {
+		return "/api/resource/" + t
+	}
+	return "/api/resource/" + t + "/" + url.PathEscape(uid)
+}
+
+func setUid(uid *string) {
+	if *uid == "" {
+		*uid = uuid.New().String()
+	}
+}